@@ -7,24 +7,20 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
-	"reflect"
+	"slices"
 	"sync/atomic"
 	"time"
 
+	"github.com/bww/go-apiclient/v1/events"
+
 	"github.com/bww/go-metrics/v1"
 	"github.com/bww/go-ratelimit/v1"
 	errutil "github.com/bww/go-util/v1/errors"
+	"github.com/bww/go-util/v1/ext"
 	"github.com/dustin/go-humanize"
-	"github.com/google/go-querystring/query"
-)
-
-var (
-	requestDurationSampler = metrics.RegisterSamplerVec("rest_client_perform_request", "Perform an HTTP request", []string{"domain"})
-	rateLimitDelaySampler  = metrics.RegisterSamplerVec("rest_client_rate_limit_delay", "Request delayed due to rate limiting", []string{"domain"})
-	rateLimitRetrySampler  = metrics.RegisterSamplerVec("rest_client_rate_limit_retry", "Request retried due to rate limiting", []string{"domain"})
-	failureRetrySampler    = metrics.RegisterSamplerVec("rest_client_failure_retry", "Request retried due to recoverable failure", []string{"domain"})
 )
 
 const (
@@ -49,14 +45,19 @@ var sharedClient = &http.Client{
 // An API client
 type Client struct {
 	*http.Client
-	auth    Authorizer
-	limiter ratelimit.Limiter
-	retry   map[int]struct{}
-	backoff time.Duration
-	base    *url.URL
-	header  http.Header
-	dctype  string
-	debug   Debug
+	settings
+	conf    Config
+	metrics *lazyMetrics
+	pause   *pause
+	latency *latencyTracker
+	health  *health
+	stats   *stats
+	snaps   *snapshotter
+	refresh *refreshing
+	pinger  *pinger
+	sampler *debugSampler
+	bases   *failover
+	backlog *requestQueue
 }
 
 // Create a new client
@@ -70,6 +71,10 @@ func New(opts ...Option) (*Client, error) {
 func NewWithConfig(conf Config) (*Client, error) {
 	var err error
 
+	if err := checkSink(conf.Metrics); err != nil {
+		return nil, err
+	}
+
 	var base *url.URL
 	if u := conf.BaseURL; u != "" {
 		base, err = url.Parse(u)
@@ -87,34 +92,61 @@ func NewWithConfig(conf Config) (*Client, error) {
 		client = sharedClient
 	}
 
-	ctype := conf.ContentType
-	if ctype == "" {
-		ctype = JSON
+	if conf.Jar != nil && client.Jar != conf.Jar { // don't share cookies with other users of the underlying client
+		jc := *client
+		jc.Jar = conf.Jar
+		client = &jc
+	}
+	if conf.Timeout > 0 && client.Timeout != conf.Timeout { // don't change the timeout of other users of the underlying client
+		tc := *client
+		tc.Timeout = conf.Timeout
+		client = &tc
 	}
 
-	retry := make(map[int]struct{})
-	for _, e := range conf.RetryStatus {
-		retry[e] = struct{}{}
+	client, err = transportClient(client, &conf)
+	if err != nil {
+		return nil, err
 	}
 
 	debug, err := Debug{
 		Debug:   conf.Debug,
 		Verbose: conf.Verbose,
-	}.WithEnv()
+		Curl:    conf.DebugCurl,
+		Writer:  conf.DebugWriter,
+	}.WithEnvPrefix(conf.EnvPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if debug.Writer == nil {
+		debug.Writer = os.Stdout
+	}
+
+	ping, err := newPinger(conf.KeepAlive, base, conf.URLResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	bases, err := newFailover(conf.Failover, base, conf.FallbackURLs)
 	if err != nil {
 		return nil, err
 	}
 
+	conf.Client = client // derived clients share the same underlying client
 	return &Client{
-		Client:  client,
-		auth:    conf.Authorizer,
-		limiter: conf.RateLimiter,
-		retry:   retry,
-		backoff: conf.RetryDelay,
-		base:    base,
-		header:  conf.Header,
-		dctype:  ctype,
-		debug:   debug,
+		Client:   redirectClient(client, conf),
+		settings: newSettings(conf, base, debug),
+		conf:     conf,
+		metrics:  newLazyMetrics(conf.Metrics),
+		pause:    newPause(),
+		latency:  newLatencyTracker(conf.AdaptiveTimeout),
+		health:   newHealth(),
+		stats:    newStats(),
+		snaps:    newSnapshotter(conf.StatsSnapshots),
+		refresh:  newRefreshing(),
+		pinger:   ping,
+		sampler:  newDebugSampler(conf.DebugSampling, debug.Writer),
+		bases:    bases,
+		backlog:  newRequestQueue(conf.Queue),
 	}, nil
 }
 
@@ -122,32 +154,130 @@ func (c *Client) Base() *url.URL {
 	return c.base
 }
 
+// WithBase derives a client which uses the provided base URL. The derived
+// client has no fallback base URLs.
 func (c *Client) WithBase(b *url.URL) *Client {
-	return &Client{
-		Client:  c.Client,
-		auth:    c.auth,
-		limiter: c.limiter,
-		base:    b,
-		header:  c.header,
-		dctype:  c.dctype,
-		debug:   c.debug,
+	conf := c.conf.copy()
+	if b != nil {
+		conf.BaseURL = b.String()
+	} else {
+		conf.BaseURL = ""
 	}
+	conf.FallbackURLs = nil
+	d := c.derive(conf, b)
+	d.bases = nil
+	return d
 }
 
 func (c *Client) Authorizer() Authorizer {
 	return c.auth
 }
 
+// WithAuthorizer derives a client which uses the provided authorizer. The
+// derived client does not share cached responses with the receiver; see
+// WithCache.
 func (c *Client) WithAuthorizer(a Authorizer) *Client {
-	return &Client{
-		Client:  c.Client,
-		auth:    a,
-		limiter: c.limiter,
-		base:    c.base,
-		header:  c.header,
-		dctype:  c.dctype,
-		debug:   c.debug,
+	conf := c.conf.copy()
+	conf.Authorizer = a
+	conf.cacheScope = newCacheScope()
+	return c.derive(conf, c.base)
+}
+
+// WithHeader derives a client which sets the provided default header in
+// addition to those of the receiver.
+func (c *Client) WithHeader(key, val string) *Client {
+	return c.derive(WithHeader(key, val)(c.conf.copy()), c.base)
+}
+
+// WithTimeout derives a client which uses the provided request timeout. The
+// derived client shares the transport of the receiver.
+func (c *Client) WithTimeout(t time.Duration) *Client {
+	conf := c.conf.copy()
+	client := *c.conf.Client
+	client.Timeout = t
+	conf.Client = &client
+	conf.Timeout = t
+	return c.derive(conf, c.base)
+}
+
+// WithRateLimiter derives a client which uses the provided rate limiter
+func (c *Client) WithRateLimiter(l ratelimit.Limiter) *Client {
+	conf := c.conf.copy()
+	conf.RateLimiter = l
+	return c.derive(conf, c.base)
+}
+
+// Clone derives a client which has the same configuration as the receiver
+// with the provided options applied. The derived client shares the receiver's
+// underlying HTTP client, metrics, pause state, latency history, health,
+// statistics, failover state, keep-alive requests, and request queue.
+func (c *Client) Clone(opts ...Option) (*Client, error) {
+	conf := c.conf.copy().WithOptions(opts)
+	if !sameAuthorizer(conf.Authorizer, c.conf.Authorizer) {
+		conf.cacheScope = newCacheScope()
+	}
+	if conf.Timeout != c.conf.Timeout && conf.Client == c.conf.Client {
+		client := *c.conf.Client
+		client.Timeout = conf.Timeout
+		conf.Client = &client
+	}
+	d, err := NewWithConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	d.pause = c.pause
+	d.health = c.health
+	d.stats = c.stats
+	if conf.StatsSnapshots == c.conf.StatsSnapshots {
+		d.snaps = c.snaps
+	}
+	if conf.Metrics == c.conf.Metrics {
+		d.metrics = c.metrics
+	}
+	if conf.AdaptiveTimeout == c.conf.AdaptiveTimeout {
+		d.latency = c.latency
+	}
+	if conf.DebugSampling == c.conf.DebugSampling {
+		d.sampler = c.sampler
+	}
+	if conf.KeepAlive == c.conf.KeepAlive && conf.BaseURL == c.conf.BaseURL && conf.URLResolution == c.conf.URLResolution {
+		d.pinger = c.pinger
+	}
+	if conf.Queue == c.conf.Queue {
+		d.backlog = c.backlog
+	}
+	if conf.Failover == c.conf.Failover && conf.BaseURL == c.conf.BaseURL && slices.Equal(conf.FallbackURLs, c.conf.FallbackURLs) {
+		d.bases = c.bases
+	}
+	return d, nil
+}
+
+// Determine which response statuses are successful for a request
+func (c *Client) successFor(conf Config) func(int) bool {
+	if conf.SuccessStatus != nil {
+		return conf.SuccessStatus
+	} else if c.success != nil {
+		return c.success
+	} else {
+		return isSuccess
+	}
+}
+
+// Determine whether strict content types are enforced for a request
+func (c *Client) strictFor(conf Config) bool {
+	if conf.StrictContentType != nil {
+		return *conf.StrictContentType
+	}
+	return c.strict
+}
+
+// Determine whether a request fails immediately while the client is paused,
+// which may be overridden per-request
+func (c *Client) pauseFailFor(conf Config) bool {
+	if conf.PauseFail != nil {
+		return *conf.PauseFail
 	}
+	return c.pfail
 }
 
 func (c *Client) isVerbose(req *http.Request) bool {
@@ -155,6 +285,9 @@ func (c *Client) isVerbose(req *http.Request) bool {
 }
 
 func (c *Client) isDebug(req *http.Request) bool {
+	if isDebugContext(req.Context()) {
+		return true
+	}
 	if !c.debug.Debug {
 		return false
 	}
@@ -172,54 +305,70 @@ func (c *Client) Get(cxt context.Context, u string, output interface{}, opts ...
 
 // A convenience for Exec with a POST request
 func (c *Client) Post(cxt context.Context, u string, input, output interface{}, opts ...Option) (*http.Response, error) {
-	data, err := entityReader(c.dctype, input)
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequest(http.MethodPost, u, data)
+	req, err := c.newEntityRequest(cxt, http.MethodPost, u, input, opts)
 	if err != nil {
 		return nil, err
 	}
-	return c.Exec(req.WithContext(cxt), output, opts...)
+	return c.Exec(req, output, opts...)
 }
 
 // A convenience for Exec with a PUT request
 func (c *Client) Put(cxt context.Context, u string, input, output interface{}, opts ...Option) (*http.Response, error) {
-	data, err := entityReader(c.dctype, input)
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequest(http.MethodPut, u, data)
+	req, err := c.newEntityRequest(cxt, http.MethodPut, u, input, opts)
 	if err != nil {
 		return nil, err
 	}
-	return c.Exec(req.WithContext(cxt), output, opts...)
+	return c.Exec(req, output, opts...)
 }
 
 // A convenience for Exec with a PATCH request. This is the same as PUT and it is included for the benefit of those misguided APIs that use PATCH operations.
 func (c *Client) Patch(cxt context.Context, u string, input, output interface{}, opts ...Option) (*http.Response, error) {
-	data, err := entityReader(c.dctype, input)
+	req, err := c.newEntityRequest(cxt, http.MethodPatch, u, input, opts)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPatch, u, data)
+	return c.Exec(req, output, opts...)
+}
+
+// A convenience for Exec with a DELETE request
+func (c *Client) Delete(cxt context.Context, u string, input, output interface{}, opts ...Option) (*http.Response, error) {
+	req, err := c.newEntityRequest(cxt, http.MethodDelete, u, input, opts)
 	if err != nil {
 		return nil, err
 	}
-	return c.Exec(req.WithContext(cxt), output, opts...)
+	return c.Exec(req, output, opts...)
 }
 
-// A convenience for Exec with a DELETE request
-func (c *Client) Delete(cxt context.Context, u string, input, output interface{}, opts ...Option) (*http.Response, error) {
-	data, err := entityReader(c.dctype, input)
+// Create a request with an entity which is marshaled according to the
+// content type in effect for the request. The Content-Type header is set
+// accordingly unless the entity is provided as raw data, in which case it is
+// only set if a content type is provided as a per-request option. A
+// Content-Type header among the client's default headers takes precedence
+// over the client's default content type.
+func (c *Client) newEntityRequest(cxt context.Context, method, u string, input interface{}, opts []Option) (*http.Request, error) {
+	conf := Config{}.With(opts)
+	ctype := ext.Coalesce(conf.ContentType, c.dctype)
+	data, err := entityReader(ctype, input)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodDelete, u, data)
+	req, err := http.NewRequestWithContext(cxt, method, u, data)
 	if err != nil {
 		return nil, err
 	}
-	return c.Exec(req.WithContext(cxt), output, opts...)
+	if data != nil {
+		var set bool
+		switch input.(type) {
+		case []byte, io.Reader:
+			set = conf.ContentType != ""
+		default:
+			set = conf.ContentType != "" || c.header.Get("Content-Type") == ""
+		}
+		if set {
+			req.Header.Set("Content-Type", ctype)
+		}
+	}
+	return req, nil
 }
 
 // Perform a request and attempt to unmarshal the response into an entity.
@@ -230,15 +379,32 @@ func (c *Client) Exec(req *http.Request, entity interface{}, opts ...Option) (*h
 			req.Header.Set(k, e)
 		}
 	}
+	applyContext(req)
+	c.negotiate(req, ext.Coalesce(conf.ContentType, c.dctype), entity)
+	if conf.Debug || conf.Verbose { // debug this request alone
+		req = req.WithContext(ContextWithDebug(req.Context()))
+	}
 
-	rsp, err := c.Do(req)
+	rsp, err := c.roundTripCached(req, conf)
 	if err != nil {
 		return nil, err
 	}
-	defer rsp.Body.Close()
+	if conf.RawBody {
+		return rsp, nil // the caller owns the body
+	}
+	defer c.metrics.get().drain(req.URL.Host, rsp)
 
 	if entity != nil {
-		err = c.unmarshal(rsp, req, entity)
+		if req.Method == http.MethodHead {
+			err = UnmarshalHeader(rsp.Header, entity)
+		} else if c.strictFor(conf) {
+			err = c.checkContentType(req, rsp, entity, ext.Coalesce(conf.ErrorEntityLimit, c.entlim))
+			if err == nil {
+				err = c.unmarshal(rsp, req, entity)
+			}
+		} else {
+			err = c.unmarshal(rsp, req, entity)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -246,6 +412,13 @@ func (c *Client) Exec(req *http.Request, entity interface{}, opts ...Option) (*h
 	return rsp, nil
 }
 
+// Perform a request and return the response without consuming its body. The
+// caller is responsible for closing the response body. This is the equivalent
+// of Exec with the WithRawBody option.
+func (c *Client) ExecRaw(req *http.Request, opts ...Option) (*http.Response, error) {
+	return c.Exec(req, nil, append(opts, WithRawBody())...)
+}
+
 // Unmarshal the provided response into the provided entity. The caller must close
 // the response body, this method will not do so.
 func (c *Client) unmarshal(rsp *http.Response, req *http.Request, entity interface{}) error {
@@ -263,10 +436,11 @@ func (c *Client) unmarshal(rsp *http.Response, req *http.Request, entity interfa
 	}
 	err := Unmarshal(rsp, entity)
 	if err != nil {
-		return Errorf(rsp.StatusCode, "Could not unmarshal response").
+		c.metrics.get().unmarshalFailures.With(metrics.Tags{"domain": req.URL.Host}).Inc()
+		return c.redactErr(req, Errorf(rsp.StatusCode, "Could not unmarshal response").
 			SetRequest(req).
 			SetEntity(ent).
-			SetCause(wrapErr(err, ErrCouldNotUnmarshalResponse))
+			SetCause(wrapErr(err, ErrCouldNotUnmarshalResponse)))
 	}
 	return nil
 }
@@ -278,130 +452,378 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 
 // Route-trip a request. The client may mutate the parameter request.
 func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
+	applyContext(req)
+	return c.roundTrip(req, Config{})
+}
+
+// Round-trip a request with per-request configuration.
+func (c *Client) roundTrip(req *http.Request, conf Config) (*http.Response, error) {
+	if c.dry || conf.DryRun {
+		return c.dryRun(req, conf)
+	}
+	var rsp *http.Response
+	var err error
+	if key, ok := c.flight.key(req, conf); ok {
+		req.URL = c.resolve(req.URL) // the flight sends a copy of the request, which may outlive our interest in it
+		rsp, err = c.flight.do(req.Context(), key, func(cxt context.Context) (*http.Response, error) {
+			return c.dispatch(req.Clone(cxt), conf)
+		})
+	} else {
+		rsp, err = c.dispatch(req, conf)
+	}
+	if err != nil {
+		err = c.redactErr(req, err)
+	}
+	return rsp, err
+}
+
+// Emit an event to the client's listeners, if it has any
+func (c *Client) emit(e events.Event) {
+	if len(c.events) > 0 {
+		c.events.Receive(e)
+	}
+}
+
+// Perform a request and record its outcome in the client's health
+func (c *Client) record(req *http.Request, conf Config, attempts *int) (*http.Response, error) {
 	start := time.Now()
-	reqid := atomic.AddInt64(&reqctr, 1)
-	cxt := req.Context()
+	rsp, err := c.sampled(req, conf, func() (*http.Response, error) {
+		return c.perform(req, conf, attempts)
+	})
+	if c.health != nil && req.URL.Host != "" {
+		c.health.Record(req.URL.Host, start, err)
+	}
+	if err != nil {
+		c.stats.failed(req.URL.Host)
+		if len(c.observe) > 0 {
+			c.observe.Failure(req, c.redactErr(req, err)) // the same request observers saw in preflight
+		}
+	}
+	return rsp, err
+}
 
-	if c.base != nil {
-		req.URL = c.base.ResolveReference(req.URL)
+// Return a reservation to a limiter
+func (c *Client) returnReservation(l ReturnableLimiter, reqid int64, req *http.Request, t time.Time) {
+	if err := l.Return(t); err != nil {
+		if c.isVerbose(req) {
+			fmt.Fprintf(c.debug.Writer, "api: [%06d] %v %v: could not return rate limit reservation: %v\n", reqid, req.Method, c.redact.url(req.URL), err)
+		}
+		return
 	}
+	c.metrics.get().rateLimitReturned.With(metrics.Tags{"domain": req.URL.Host}).Inc()
+	if c.isVerbose(req) {
+		fmt.Fprintf(c.debug.Writer, "api: [%06d] %v %v: returned rate limit reservation for %v\n", reqid, req.Method, c.redact.url(req.URL), t)
+	}
+}
 
-	domain := req.URL.Host
-	defer func() {
-		requestDurationSampler.With(metrics.Tags{"domain": domain}).Observe(float64(time.Since(start)))
-	}()
+// Render the URL and entity of a request error using the client's redaction
+// settings, which may differ from the defaults used by Error.SetRequest.
+func (c *Client) redactErr(req *http.Request, err error) error {
+	var apierr *Error
+	if errors.As(err, &apierr) {
+		if apierr.URL != "" {
+			apierr.URL = c.redact.url(req.URL)
+		}
+		apierr.Entity = c.fields.entity(apierr.Entity)
+	}
+	return err
+}
 
+// Authorize a request, if the client has an authorizer
+func (c *Client) authorize(req *http.Request, mx *clientMetrics) error {
 	if c.auth != nil {
 		err := c.auth.Authorize(req)
 		if err != nil {
-			return nil, errutil.Redact(fmt.Errorf("Could not authorize request: %w", err), ErrCouldNotAuthorize)
+			mx.authFailures.With(metrics.Tags{"domain": req.URL.Host}).Inc()
+			return errutil.Redact(fmt.Errorf("Could not authorize request: %w", err), ErrCouldNotAuthorize)
 		}
 	}
+	return nil
+}
+
+// Prepare a request to be sent by authorizing it and setting the client's
+// default and correlation headers
+func (c *Client) prepare(req *http.Request, mx *clientMetrics) error {
+	if err := c.authorize(req, mx); err != nil {
+		return err
+	}
 	for k, v := range c.header {
 		n := http.CanonicalHeaderKey(k)
 		if _, set := req.Header[n]; !set { // don't overrwrite explicitly set headers
 			req.Header[n] = v
 		}
 	}
+	for _, e := range c.correl {
+		if _, set := req.Header[e.Header]; !set {
+			if v := e.Value(req.Context()); v != "" {
+				req.Header.Set(e.Header, v)
+			}
+		}
+	}
+	return nil
+}
+
+// Finalize a request immediately before an attempt to send it, first with the
+// client's finalizers and then with those of the request.
+func (c *Client) finalize(req *http.Request, conf Config) error {
+	for _, f := range [][]Finalizer{c.final, conf.Finalizers} {
+		for _, e := range f {
+			if err := e.Finalize(req); err != nil {
+				return errutil.Redact(fmt.Errorf("%w: %w", ErrCouldNotFinalize, err), ErrCouldNotFinalize)
+			}
+		}
+	}
+	return nil
+}
+
+// Perform a request, retrying it as its policy permits. The attempts of a
+// request are counted over every host it is sent to, in case it fails over.
+func (c *Client) perform(req *http.Request, conf Config, attempts *int) (*http.Response, error) {
+	start := time.Now()
+	reqid := atomic.AddInt64(&reqctr, 1)
+	cxt := req.Context()
+	pol := c.policyFor(req)
+	mx := c.metrics.get()
+
+	sent := false
+	defer func() {
+		if !sent && req.Body != nil {
+			req.Body.Close() // once a request is sent the transport closes its body; until then, we must
+		}
+	}()
+
+	req.URL = c.resolve(req.URL)
+
+	domain := req.URL.Host
+	c.pinger.touch(c)
+	c.snaps.touch(c)
+	c.stats.requests.Add(1)
+	defer func() {
+		mx.requestDuration.With(metrics.Tags{"domain": domain}).Observe(float64(time.Since(start)))
+	}()
+
+	if err := c.prepare(req, mx); err != nil {
+		return nil, err
+	}
 
-	if l := c.limiter; l != nil {
+	if err := c.pause.Wait(cxt, c.pauseFailFor(conf)); err != nil {
+		var apierr *Error
+		if errors.As(err, &apierr) {
+			apierr.SetId(reqid).SetRequest(req)
+		}
+		return nil, err
+	}
+
+	if l := pol.limiter; l != nil && !conf.Scheduled {
 		if c.isVerbose(req) {
-			state := c.limiter.State(start)
-			fmt.Printf("api: [%06d] %v %v: rate limit state: limit=%d, remaining=%d, reset=%v (in %v)\n", reqid, req.Method, req.URL, state.Limit, state.Remaining, state.Reset, state.Reset.Sub(start))
+			state := l.State(start)
+			fmt.Fprintf(c.debug.Writer, "api: [%06d] %v %v: rate limit state: limit=%d, remaining=%d, reset=%v (in %v)\n", reqid, req.Method, c.redact.url(req.URL), state.Limit, state.Remaining, state.Reset, state.Reset.Sub(start))
+		}
+		acquire := time.Now()
+		var next time.Time
+		var err error
+		if cl, ok := l.(CostLimiter); ok && conf.Cost > 0 {
+			next, err = cl.NextCost(start, conf.Cost, ratelimit.WithRequest(req))
+		} else {
+			next, err = l.Next(start, ratelimit.WithRequest(req))
 		}
-		next, err := l.Next(start, ratelimit.WithRequest(req))
+		mx.rateLimitAcquire.With(metrics.Tags{"domain": domain}).Observe(float64(time.Since(acquire)))
 		if err != nil {
+			if errors.Is(err, ErrQuotaExceeded) {
+				mx.rateLimitRejected.With(metrics.Tags{"domain": domain}).Inc()
+			}
 			return nil, fmt.Errorf("Could not compute next rate-limited request window: %w", err)
 		}
+		if r, ok := l.(ReturnableLimiter); ok {
+			defer func() {
+				if !sent { // the request was canceled or failed before it was sent; give back its reservation
+					c.returnReservation(r, reqid, req, next)
+				}
+			}()
+		}
 		delay := next.Sub(time.Now())
-		rateLimitDelaySampler.With(metrics.Tags{"domain": domain}).Observe(float64(delay))
+		mx.rateLimitDelay.With(metrics.Tags{"domain": domain}).Observe(float64(delay))
 		if delay > 0 {
+			c.stats.waits.Add(1)
 			if c.isVerbose(req) {
-				fmt.Printf("api: [%06d] %v %v: delaying %v for rate limits\n", reqid, req.Method, req.URL, delay)
+				fmt.Fprintf(c.debug.Writer, "api: [%06d] %v %v: delaying %v for rate limits\n", reqid, req.Method, c.redact.url(req.URL), delay)
 			}
-			select {
-			case <-time.After(delay):
-			case <-cxt.Done():
-				return nil, context.Canceled
+			c.emit(events.WaitStarted{Reason: "rate limits", Duration: delay, Req: req})
+			if err := waitRequest(reqid, req, delay, "rate limits"); err != nil {
+				return nil, err
 			}
 		}
 	}
 
 	if c.isVerbose(req) || c.isDebug(req) {
-		fmt.Printf("api: [%06d] %v %v\n", reqid, req.Method, req.URL)
+		fmt.Fprintf(c.debug.Writer, "api: [%06d] %v %v\n", reqid, req.Method, c.redact.url(req.URL))
 	}
-	if c.isDebug(req) {
-		err := c.dumpReq(os.Stdout, req)
+
+	observed := req // observers see the same request over its lifecycle
+	if len(c.observe) > 0 {
+		err := c.observe.Preflight(observed, c.opolicy, c.ignoreObserver(reqid, req))
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	req = req.WithContext(httptrace.WithClientTrace(cxt, mx.connTrace(domain)))
+	if c.health != nil {
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), c.health.connTrace(domain)))
+		c.health.Begin(domain)
+		defer c.health.End(domain)
+	}
+
+	balanced := c.isBalanced(req)
+	sent = true
 	var rsp *http.Response
 retries:
 	for i := 0; ; i++ {
-		tsp, err := c.Client.Do(req)
-		if err != nil {
+		if i > 0 && req.GetBody != nil { // the previous attempt consumed the body; produce a fresh copy to send again
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		if i > 0 && !(c.authonce || conf.AuthorizeOnce) { // credentials may have expired while we waited to retry
+			if err := c.authorize(req, mx); err != nil {
+				return nil, err
+			}
+		}
+		var done func()
+		if balanced {
+			var err error
+			done, err = c.pick(req)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := c.finalize(req, conf); err != nil {
+			if done != nil {
+				done()
+			}
+			return nil, err
+		}
+		if i == 0 { // show the request as it is sent, once its endpoint is selected and it is finalized
+			if err := c.debugReq(req); err != nil {
+				if done != nil {
+					done()
+				}
+				return nil, err
+			}
+		}
+		*attempts++
+		c.emit(events.AttemptStarted{Attempt: *attempts, Req: req})
+		began := time.Now()
+		tm := newTiming(req).observe(c.stats)
+		tsp, err := c.attempt(tm.request(req))
+		if done != nil {
+			done()
+		}
+		c.emit(events.AttemptFinished{Attempt: *attempts, Req: req, Rsp: tsp, Err: err, Duration: time.Since(began)})
+		if err == nil && tsp.Body != nil && tsp.StatusCode != http.StatusSwitchingProtocols { // upgraded bodies must remain writable
+			tsp.Body = &timedBody{ReadCloser: tsp.Body, timing: tm}
+		} else {
+			tm.release() // the connection is no longer ours to account for
+		}
+		if isProxyErr(err) {
+			return nil, Errorf(0, "Could not connect via proxy").SetId(reqid).SetRequest(req).SetCause(fmt.Errorf("%w: %w", ErrProxyConnect, err))
+		} else if err != nil {
 			return nil, err
 		}
 		defer func() { // note that all these defers queue up and unravel on return
 			if tsp != nil { // if set, this temporary response never converted; clean up
-				tsp.Body.Close()
+				mx.drain(domain, tsp)
 			}
 		}()
 
+		mx.responses.With(metrics.Tags{"domain": domain, "class": statusClass(tsp.StatusCode)}).Inc()
+		if fb, ok := c.auth.(FeedbackAuthorizer); ok {
+			fb.Feedback(req, tsp)
+		}
+		if tsp.StatusCode == http.StatusUnauthorized {
+			mx.authFailures.With(metrics.Tags{"domain": domain}).Inc()
+		}
+
 		var rlerr error
-		if l := c.limiter; l != nil {
+		if l := pol.limiter; l != nil {
 			rlerr = l.Update(start, ratelimit.WithResponse(tsp)) // first, update rate limiter state to avoid an error response going unaccounted for
 			if rlerr != nil {
 				var retry ratelimit.RetryError
 				if errors.As(rlerr, &retry) { // special handling for retries; insert a specific delay and re-perform the same request
-					if i >= maxRetries {
+					if i >= maxRetries || !conf.RetryBudget.allow() {
+						mx.retriesExhausted.With(metrics.Tags{"domain": domain, "reason": "rate_limit"}).Inc()
 						return nil, rlerr
 					}
 					delay := retry.RetryAfter.Sub(time.Now())
-					rateLimitRetrySampler.With(metrics.Tags{"domain": domain}).Observe(float64(delay))
+					mx.rateLimitRetry.With(metrics.Tags{"domain": domain}).Observe(float64(delay))
 					if c.isVerbose(req) {
-						fmt.Printf("api: [%06d] %v %v: retrying after %v due to rate limits\n", reqid, req.Method, req.URL, retry.RetryAfter)
+						fmt.Fprintf(c.debug.Writer, "api: [%06d] %v %v: retrying after %v due to rate limits\n", reqid, req.Method, c.redact.url(req.URL), retry.RetryAfter)
 					}
-					select {
-					case <-time.After(delay):
-						continue retries
-					case <-cxt.Done():
-						return nil, context.Canceled
+					mx.drain(domain, tsp) // release the connection before we wait
+					tsp = nil
+					c.stats.retries.Add(1)
+					c.stats.waits.Add(1)
+					c.emit(events.WaitStarted{Reason: "rate limit retry", Duration: delay, Req: req})
+					if err := waitRequest(reqid, req, delay, "rate limit retry"); err != nil {
+						return nil, err
 					}
+					continue retries
 				}
 			}
 		}
 
-		if c.retry != nil && i < maxRetries && !isSuccess(tsp.StatusCode) {
-			if _, ok := c.retry[tsp.StatusCode]; ok { // recoverable failure; wait and then try again up to our retry limit
+		success := c.successFor(conf)
+		if pol.retry != nil && i < maxRetries && !success(tsp.StatusCode) {
+			if _, ok := pol.retry[tsp.StatusCode]; ok && conf.RetryBudget.allow() { // recoverable failure; wait and then try again up to our retry limit
 				var delay time.Duration
-				if c.backoff > 0 {
-					delay = c.backoff
+				if pol.backoff > 0 {
+					delay = pol.backoff
 				} else {
 					delay = backoffDefault
 				}
 				delay = delay * time.Duration(i+1) // progressive backoff
-				failureRetrySampler.With(metrics.Tags{"domain": domain}).Observe(float64(delay))
+				mx.failureRetry.With(metrics.Tags{"domain": domain}).Observe(float64(delay))
 				if c.isVerbose(req) {
-					fmt.Printf("api: [%06d] %v %v: retrying after %v due to recoverable failure: %s\n", reqid, req.Method, req.URL, delay, tsp.Status)
+					fmt.Fprintf(c.debug.Writer, "api: [%06d] %v %v: retrying after %v due to recoverable failure: %s\n", reqid, req.Method, c.redact.url(req.URL), delay, tsp.Status)
 				}
-				select {
-				case <-time.After(delay):
-					continue retries
-				case <-cxt.Done():
-					return nil, context.Canceled
+				mx.drain(domain, tsp) // release the connection before we wait
+				tsp = nil
+				c.stats.retries.Add(1)
+				c.emit(events.WaitStarted{Reason: "retry", Duration: delay, Req: req})
+				if err := waitRequest(reqid, req, delay, "retry"); err != nil {
+					return nil, err
 				}
+				continue retries
 			}
 		}
 
-		err = checkErr(reqid, req, tsp)
+		if c.replayConflict(req, tsp, conf) { // a conflict which replays the original response is a success
+			rsp, tsp = tsp, nil
+			break
+		}
+
+		limit := ext.Coalesce(conf.ErrorEntityLimit, c.entlim)
+		err = checkStatus(reqid, req, tsp, limit, success)
 		if err != nil { // first, check for non-2XX/application-level errors
+			if _, ok := pol.retry[tsp.StatusCode]; ok { // we would have retried this status if we had any retries left
+				mx.retriesExhausted.With(metrics.Tags{"domain": domain, "reason": "failure"}).Inc()
+			}
+			return nil, err
+		}
+		err = checkExpected(reqid, req, tsp, conf.ExpectStatus, limit)
+		if err != nil { // then, check for a specific expected status, if any
 			return nil, err
 		}
+		if v := ext.Coalesce(conf.Validator, c.valid); v != nil && !conf.RawBody {
+			err = validateResponse(reqid, req, tsp, v)
+			if err != nil { // finally, check for errors reported by the response itself
+				return nil, err
+			}
+		}
 		if rlerr != nil { // second, handle any non-retry rate limiting errors that may have occurred
-			return nil, fmt.Errorf("api: [%06d] %v %v: rate limit error: %v", reqid, req.Method, req.URL, rlerr)
+			return nil, fmt.Errorf("api: [%06d] %v %v: rate limit error: %v", reqid, req.Method, c.redact.url(req.URL), rlerr)
 		}
 
 		// the response will be returned; convert it and clear the temporary value
@@ -416,31 +838,24 @@ retries:
 		} else {
 			l = "<unknown>"
 		}
-		fmt.Printf("api: [%06d] %v %v -> %v (%v)\n", reqid, req.Method, req.URL, rsp.Status, l)
+		if t, ok := ResponseTimings(rsp); ok {
+			l += "; " + t.String()
+		}
+		fmt.Fprintf(c.debug.Writer, "api: [%06d] %v %v -> %v (%v)\n", reqid, req.Method, c.redact.url(req.URL), rsp.Status, l)
 	}
 	if c.isDebug(req) {
-		err := c.dumpRsp(os.Stdout, req, rsp)
+		err := c.dumpRsp(c.debug.Writer, req, rsp, !conf.RawBody)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if len(c.observe) > 0 {
+		err := c.observe.Postflight(observed, rsp, c.opolicy, c.ignoreObserver(reqid, req))
+		if err != nil {
+			rsp.Body.Close()
+			return nil, err
+		}
+	}
 
 	return rsp, nil
 }
-
-func URLWithParams(s string, params interface{}) (string, error) {
-	v := reflect.ValueOf(params)
-	if v.Kind() == reflect.Ptr && v.IsNil() {
-		return s, nil
-	}
-	u, err := url.Parse(s)
-	if err != nil {
-		return s, err
-	}
-	q, err := query.Values(params)
-	if err != nil {
-		return s, err
-	}
-	u.RawQuery = q.Encode()
-	return u.String(), nil
-}
@@ -3,19 +3,28 @@ package api
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/bww/go-apiclient/v1/cache"
+	"github.com/bww/go-apiclient/v1/events"
+
 	"github.com/bww/go-ratelimit/v1"
 	"github.com/bww/go-rest/v2"
 	"github.com/bww/go-router/v2"
 	"github.com/bww/go-util/v1/debug"
+	"github.com/bww/go-util/v1/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -65,6 +74,10 @@ func (s *testService) Run() {
 	}
 
 	svc.Add("/limited", s.handleRateLimited).Methods("GET")
+	svc.Add("/status/{code}", s.handleStatus).Methods("GET", "POST", "PUT", "DELETE")
+	svc.Add("/collection", s.handleCollection).Methods("GET", "HEAD")
+	svc.Add("/slow", s.handleSlow).Methods("GET", "POST")
+	svc.Add("/echo", s.handleEcho).Methods("POST", "PUT")
 
 	svr := &http.Server{
 		Handler:      svc,
@@ -100,6 +113,51 @@ func (s *testService) handleRateLimited(req *router.Request, cxt router.Context)
 	return rsp, nil
 }
 
+func (s *testService) handleStatus(req *router.Request, cxt router.Context) (*router.Response, error) {
+	code, err := strconv.Atoi(cxt.Vars["code"])
+	if err != nil {
+		return nil, err
+	}
+	return router.NewResponse(code).SetJSON(map[string]interface{}{"status": code})
+}
+
+func (s *testService) handleCollection(req *router.Request, cxt router.Context) (*router.Response, error) {
+	const etag = `"v1"`
+	if req.Header.Get("If-None-Match") == etag {
+		return router.NewResponse(http.StatusNotModified).SetHeader("ETag", etag), nil
+	}
+	return router.NewResponse(http.StatusOK).SetHeader("ETag", etag).SetJSON([]string{"a", "b", "c"})
+}
+
+func (s *testService) handleSlow(req *router.Request, cxt router.Context) (*router.Response, error) {
+	d := time.Millisecond * 100
+	if v := req.URL.Query().Get("d"); v != "" {
+		var err error
+		d, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-req.Context().Done():
+	}
+	return router.NewResponse(http.StatusOK).SetJSON(map[string]interface{}{"slow": true})
+}
+
+func (s *testService) handleEcho(req *router.Request, cxt router.Context) (*router.Response, error) {
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	return router.NewResponse(http.StatusOK).SetJSON(map[string]interface{}{
+		"data":     string(data),
+		"encoding": req.TransferEncoding,
+	})
+}
+
 var service testService
 
 func TestMain(m *testing.M) {
@@ -309,3 +367,925 @@ func TestMeterRateLimit(t *testing.T) {
 	fmt.Printf(">>> dur=%v, start=%v, n=%d, c=%d, avg=%v, del=%v\n", dur, start, n, c, avg, del)
 	assert.InEpsilon(t, avg, del, 0.333)
 }
+
+func TestExpectStatus(t *testing.T) {
+	cxt := context.Background()
+	api, err := New(WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		Status int
+		Expect []int
+		Error  error
+	}{
+		{http.StatusOK, nil, nil},
+		{http.StatusOK, []int{http.StatusOK}, nil},
+		{http.StatusCreated, []int{http.StatusOK, http.StatusCreated}, nil},
+		{http.StatusOK, []int{http.StatusCreated}, ErrUnexpectedStatusCode},
+		{http.StatusNotFound, []int{http.StatusOK}, ErrNotFound},
+		{http.StatusPreconditionFailed, nil, ErrPreconditionFailed},
+	}
+	for i, e := range tests {
+		_, err := api.Get(cxt, fmt.Sprintf("/status/%d", e.Status), nil, WithExpectStatuses(e.Expect...))
+		if e.Error != nil {
+			assert.ErrorIs(t, err, e.Error, fmt.Sprintf("[#%d]", i))
+		} else {
+			assert.NoError(t, err, fmt.Sprintf("[#%d]", i))
+		}
+	}
+}
+
+func TestCollectionSync(t *testing.T) {
+	cxt := context.Background()
+	api, err := New(WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	coll := NewCollection[[]string](api, cache.NewMemory(), "/collection")
+	for i, e := range []bool{true, false, false} {
+		res, changed, err := coll.Sync(cxt)
+		if assert.NoError(t, err, fmt.Sprintf("[#%d]", i)) {
+			assert.Equal(t, e, changed, fmt.Sprintf("[#%d]", i))
+			assert.Equal(t, []string{"a", "b", "c"}, res, fmt.Sprintf("[#%d]", i))
+		}
+	}
+}
+
+func TestCachedEntity(t *testing.T) {
+	cxt := context.Background()
+	api, err := New(WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())), WithCache(cache.NewMemory()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i, e := range []string{"", "1", "1"} {
+		var res []string
+		rsp, err := api.Get(cxt, "/collection", &res)
+		if assert.NoError(t, err, fmt.Sprintf("[#%d]", i)) {
+			assert.Equal(t, http.StatusOK, rsp.StatusCode, fmt.Sprintf("[#%d]", i))
+			assert.Equal(t, e, rsp.Header.Get(CacheHeader), fmt.Sprintf("[#%d]", i))
+			assert.Equal(t, []string{"a", "b", "c"}, res, fmt.Sprintf("[#%d]", i))
+		}
+	}
+
+	_, err = api.Get(cxt, "/collection", nil, WithHeader("If-None-Match", `"v1"`))
+	assert.ErrorIs(t, err, ErrNotModified, "explicit conditional requests must bypass the cache")
+
+	type meta struct {
+		ETag   string `header:"ETag"`
+		Type   string `header:"Content-Type"`
+		Length int    `header:"Content-Length"`
+		Other  string `header:"X-Missing"`
+	}
+	req, err := http.NewRequestWithContext(cxt, http.MethodHead, "/collection", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var res meta
+	_, err = api.Exec(req, &res)
+	if assert.NoError(t, err) {
+		assert.Equal(t, meta{ETag: `"v1"`, Type: "application/json", Length: len(`["a","b","c"]`)}, res)
+	}
+}
+
+func TestPause(t *testing.T) {
+	cxt := context.Background()
+	api, err := New(WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	api.Pause(time.Now().Add(time.Hour), "Testing")
+	_, _, paused := api.Paused()
+	assert.True(t, paused)
+
+	_, err = api.Get(cxt, "/status/200", nil, WithPauseFailFast(true))
+	assert.ErrorIs(t, err, ErrPaused)
+
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		api.Resume()
+	}()
+	start := time.Now()
+	_, err = api.Get(cxt, "/status/200", nil)
+	if assert.NoError(t, err) {
+		assert.True(t, time.Since(start) >= time.Millisecond*50)
+	}
+	_, _, paused = api.Paused()
+	assert.False(t, paused)
+
+	api, err = New(WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())), WithPauseFailFast(true))
+	if !assert.NoError(t, err) {
+		return
+	}
+	api.Pause(time.Now().Add(time.Hour), "Testing")
+	_, err = api.Get(cxt, "/status/200", nil)
+	assert.ErrorIs(t, err, ErrPaused)
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		api.Resume()
+	}()
+	_, err = api.Get(cxt, "/status/200", nil, WithPauseFailFast(false)) // overrides the client's setting
+	assert.NoError(t, err)
+}
+
+func TestInterruptedWait(t *testing.T) {
+	api, err := New(
+		WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())),
+		WithRetryStatus(http.StatusServiceUnavailable),
+		WithRetryDelay(time.Second*10),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(time.Millisecond*50, cancel)
+	_, err = api.Get(cxt, "/status/503", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, ErrInterrupted)
+	var apierr *Error
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Equal(t, http.MethodGet, apierr.Method)
+		assert.Contains(t, apierr.Message, "for retry")
+	}
+
+	cause := fmt.Errorf("Shutting down")
+	cxt, cancelCause := context.WithCancelCause(context.Background())
+	api.Pause(time.Now().Add(time.Hour), "Testing")
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cancelCause(cause)
+	}()
+	_, err = api.Get(cxt, "/status/200", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, cause)
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Contains(t, apierr.Message, "for pause: Testing")
+	}
+}
+
+func TestDeadlineWait(t *testing.T) {
+	api, err := New(
+		WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())),
+		WithRetryStatus(http.StatusServiceUnavailable),
+		WithRetryDelay(time.Second*10),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	start := time.Now()
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err = api.Get(cxt, "/status/503", nil)
+	assert.ErrorIs(t, err, ErrWouldExceedDeadline)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second, "the retry should fail without waiting")
+	var apierr *Error
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Contains(t, apierr.Message, "Waiting 10s for retry")
+	}
+
+	lim := NewTokenBucket(1, 1)
+	lim.Next(time.Now()) // consume the only token
+	tcxt, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	_, err = api.WithRateLimiter(lim).Get(tcxt, "/status/200", nil)
+	assert.ErrorIs(t, err, ErrWouldExceedDeadline)
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Contains(t, apierr.Message, "for rate limits")
+	}
+	assert.False(t, isHostFailure(err), "a wait which would exceed the deadline is not the host's fault")
+}
+
+type trackingBody struct {
+	io.Reader
+	closed *int64
+}
+
+func (b trackingBody) Close() error {
+	atomic.AddInt64(b.closed, 1)
+	return nil
+}
+
+func TestCancellationLeaks(t *testing.T) {
+	client := &http.Client{Transport: &http.Transport{}}
+	api, err := NewWithConfig(Config{
+		BaseURL:     fmt.Sprintf("http://%s/", service.Addr()),
+		Client:      client,
+		RateLimiter: ratelimit.NewLinear(ratelimit.Config{Window: time.Second, Events: 200}),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	base := runtime.NumGoroutine()
+
+	var closed int64
+	n := 200
+	done := make(chan struct{}, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer func() { done <- struct{}{} }()
+			cxt, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(i%50))
+			defer cancel()
+			_, err := api.ExecBuilder(cxt, func(cxt context.Context) (*http.Request, error) {
+				req, err := http.NewRequestWithContext(cxt, http.MethodPost, "/slow", nil)
+				if err != nil {
+					return nil, err
+				}
+				req.Body = trackingBody{strings.NewReader("{}"), &closed}
+				return req, nil
+			}, nil)
+			assert.Error(t, err)
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		<-done
+	}
+
+	// every request that was built must have had its body closed, whether or
+	// not it was ever sent
+	assert.Equal(t, int64(n)-int64(n/50), atomic.LoadInt64(&closed))
+
+	client.CloseIdleConnections()
+	deadline := time.Now().Add(time.Second * 5)
+	for runtime.NumGoroutine() > base && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), base, "goroutines leaked")
+}
+
+// A transport which records the context of the last request it sent
+type contextTransport struct {
+	http.RoundTripper
+	sync.Mutex
+	cxt context.Context
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.Lock()
+	t.cxt = req.Context()
+	t.Unlock()
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func (t *contextTransport) last() context.Context {
+	t.Lock()
+	defer t.Unlock()
+	return t.cxt
+}
+
+func TestCancellationRelease(t *testing.T) {
+	tsp := &contextTransport{RoundTripper: &http.Transport{}}
+	api, err := NewWithConfig(Config{
+		BaseURL:         fmt.Sprintf("http://%s/", service.Addr()),
+		Client:          &http.Client{Transport: tsp},
+		AdaptiveTimeout: &AdaptiveTimeout{Floor: time.Millisecond * 50, MinSamples: 1, Keyer: func(*http.Request) string { return "" }},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt := context.Background()
+	_, err = api.Get(cxt, "/slow?d=1ms", nil) // adaptive timeouts apply from now on
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// an attempt canceled mid-flight
+	canceled, cancel := context.WithCancel(cxt)
+	time.AfterFunc(time.Millisecond*10, cancel)
+	_, err = api.Get(canceled, "/slow?d=30ms", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Error(t, tsp.last().Err(), "the attempt context must be released")
+
+	// an attempt which fails with a response
+	_, err = api.Get(cxt, "/status/404", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Error(t, tsp.last().Err(), "the attempt context must be released")
+
+	// an attempt whose response is held by the caller outlives its timeout,
+	// since the timer is stopped once response headers are received, and is
+	// released when its body is closed
+	rsp, err := api.Get(cxt, "/slow?d=1ms", nil, WithRawBody())
+	if assert.NoError(t, err) {
+		time.Sleep(time.Millisecond * 100)
+		acxt := tsp.last()
+		assert.NoError(t, acxt.Err(), "the attempt context must not be released while the body is open")
+		rsp.Body.Close()
+		assert.Error(t, acxt.Err(), "the attempt context must be released when the body is closed")
+		assert.NotErrorIs(t, context.Cause(acxt), ErrAttemptTimeout)
+	}
+}
+
+func TestAdaptiveTimeout(t *testing.T) {
+	cxt := context.Background()
+	api, err := New(
+		WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())),
+		WithAdaptiveTimeout(AdaptiveTimeout{Floor: time.Millisecond * 50, Ceiling: time.Second, MinSamples: 5}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 5; i++ {
+		_, err := api.Get(cxt, "/slow?d=1ms", nil)
+		assert.NoError(t, err)
+	}
+	d, ok := api.latency.Timeout(errors.Must(http.NewRequest(http.MethodGet, "/slow", nil)))
+	if assert.True(t, ok) {
+		assert.Equal(t, time.Millisecond*50, d)
+	}
+
+	start := time.Now()
+	_, err = api.Get(cxt, "/slow?d=500ms", nil)
+	assert.ErrorIs(t, err, ErrAttemptTimeout)
+	assert.True(t, time.Since(start) < time.Millisecond*400)
+
+	_, err = api.Get(cxt, "/slow?d=1ms", nil)
+	assert.NoError(t, err)
+}
+
+func TestAdaptiveTimeoutSlowdown(t *testing.T) {
+	cxt := context.Background()
+	api, err := New(
+		WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())),
+		WithAdaptiveTimeout(AdaptiveTimeout{Floor: time.Millisecond * 20, Samples: 5, MinSamples: 5}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 5; i++ {
+		_, err := api.Get(cxt, "/slow?d=1ms", nil)
+		assert.NoError(t, err)
+	}
+
+	// the endpoint has become slower than its timeout; timed-out attempts are
+	// recorded, so the timeout grows until the endpoint is waited for
+	var timeouts int
+	for i := 0; i < 5; i++ {
+		_, err = api.Get(cxt, "/slow?d=100ms", nil)
+		if err == nil {
+			break
+		}
+		assert.ErrorIs(t, err, ErrAttemptTimeout)
+		timeouts++
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, 2, timeouts)
+}
+
+func TestAdaptiveTimeoutEndpoints(t *testing.T) {
+	l := newLatencyTracker(&AdaptiveTimeout{MinSamples: 1, Endpoints: 2})
+	a := errors.Must(http.NewRequest(http.MethodGet, "/a", nil))
+	b := errors.Must(http.NewRequest(http.MethodGet, "/b", nil))
+	c := errors.Must(http.NewRequest(http.MethodGet, "/c", nil))
+
+	l.Record(a, time.Millisecond)
+	l.Record(b, time.Millisecond)
+	_, ok := l.Timeout(a) // a is now more recently used than b
+	assert.True(t, ok)
+	l.Record(c, time.Millisecond)
+
+	assert.Len(t, l.endpoints, 2)
+	_, ok = l.Timeout(a)
+	assert.True(t, ok)
+	_, ok = l.Timeout(b)
+	assert.False(t, ok, "the least recently used endpoint must be discarded")
+	_, ok = l.Timeout(c)
+	assert.True(t, ok)
+}
+
+func TestHealth(t *testing.T) {
+	cxt := context.Background()
+	api, err := New(WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, e := range []int{http.StatusOK, http.StatusNotFound, http.StatusInternalServerError} {
+		api.Get(cxt, fmt.Sprintf("/status/%d", e), nil)
+	}
+	hosts := api.Health()
+	if assert.Len(t, hosts, 1) {
+		h := hosts[0]
+		assert.Equal(t, service.Addr(), h.Host)
+		assert.Equal(t, 1, h.ConsecutiveFailures)
+		assert.Equal(t, 0, h.InFlight)
+		assert.False(t, h.LastSuccess.IsZero())
+		assert.True(t, h.LastFailure.After(h.LastSuccess))
+		assert.Equal(t, int64(3), h.NewConns+h.ReusedConns)
+		assert.True(t, h.Latency.P50 > 0)
+	}
+
+	_, err = api.Get(cxt, "/status/200", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, api.Health()[0].ConsecutiveFailures)
+	}
+}
+
+func TestStreamBody(t *testing.T) {
+	cxt := context.Background()
+	api, err := New(WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	type echo struct {
+		Data     string   `json:"data"`
+		Encoding []string `json:"encoding"`
+	}
+
+	ch := make(chan []byte)
+	go func() {
+		defer close(ch)
+		for i := 0; i < 5; i++ {
+			ch <- []byte(fmt.Sprintf("%d,", i))
+		}
+	}()
+	var res echo
+	_, err = api.ExecBuilder(cxt, api.NewStreamRequest(http.MethodPost, "/echo", PlainText, ChannelBody(ch)), &res)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "0,1,2,3,4,", res.Data)
+		assert.Equal(t, []string{"chunked"}, res.Encoding)
+	}
+
+	n := 0
+	_, err = api.ExecBuilder(cxt, api.NewStreamRequest(http.MethodPost, "/echo", PlainText, StreamBody(func() ([]byte, error) {
+		if n++; n > 3 {
+			return nil, io.EOF
+		}
+		return []byte("x"), nil
+	})), &res)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "xxx", res.Data)
+	}
+}
+
+func TestSingleflight(t *testing.T) {
+	var hits int64
+	release := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		<-release
+		rsp.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(rsp, `{"path":%q,"accept":%q}`, req.URL.Path, req.Header.Get("Accept"))
+	}))
+	defer svr.Close()
+
+	api, err := New(WithBaseURL(svr.URL+"/"), WithSingleflight())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	type result struct {
+		Path   string `json:"path"`
+		Accept string `json:"accept"`
+	}
+	const n = 10
+	cxt := context.Background()
+	res := make([]result, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var opts []Option
+			if i%2 != 0 {
+				opts = append(opts, WithHeader("Accept", "text/plain"))
+			}
+			_, errs[i] = api.Get(cxt, "/shared", &res[i], opts...)
+		}(i)
+	}
+	for atomic.LoadInt64(&hits) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 50) // let the remaining requests join their flights
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int64(2), atomic.LoadInt64(&hits))
+	for i := 0; i < n; i++ {
+		if assert.NoError(t, errs[i]) {
+			assert.Equal(t, "/shared", res[i].Path)
+			if i%2 != 0 {
+				assert.Equal(t, "text/plain", res[i].Accept)
+			} else {
+				assert.Equal(t, JSON, res[i].Accept, "negotiated from the output entity")
+			}
+		}
+	}
+
+	_, err = api.Get(cxt, "/shared", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&hits), "completed flights must not be reused")
+}
+
+func TestSingleflightCancel(t *testing.T) {
+	var hits int64
+	release := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		if req.URL.Path == "/alone" {
+			<-req.Context().Done()
+			return
+		}
+		select {
+		case <-release:
+			rsp.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(rsp, `{"ok":true}`)
+		case <-req.Context().Done():
+		}
+	}))
+	defer svr.Close()
+
+	api, err := New(WithBaseURL(svr.URL+"/"), WithSingleflight())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var res struct {
+		Ok bool `json:"ok"`
+	}
+	leader, cancel := context.WithCancel(context.Background())
+	lerr := make(chan error, 1)
+	go func() {
+		var res struct{}
+		_, err := api.Get(leader, "/shared", &res)
+		lerr <- err
+	}()
+	for atomic.LoadInt64(&hits) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	ferr := make(chan error, 1)
+	go func() {
+		_, err := api.Get(context.Background(), "/shared", &res)
+		ferr <- err
+	}()
+	time.Sleep(time.Millisecond * 50) // let the follower join the flight
+
+	cancel()
+	assert.ErrorIs(t, <-lerr, context.Canceled)
+	close(release)
+	if assert.NoError(t, <-ferr, "a follower must not be canceled by the leader") {
+		assert.True(t, res.Ok)
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&hits))
+
+	// once every caller has stopped waiting, the flight is canceled
+	alone, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := api.Get(alone, "/alone", nil)
+		lerr <- err
+	}()
+	for atomic.LoadInt64(&hits) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	assert.ErrorIs(t, <-lerr, context.Canceled)
+	again, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	_, err = api.Get(again, "/alone", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&hits), "a canceled flight must not be reused")
+}
+
+func TestSingleflightOptions(t *testing.T) {
+	var hits int64
+	release := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		<-release
+		rsp.Header().Set("Content-Type", "text/plain")
+		rsp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(rsp, req.Header.Get("X-Tenant"))
+	}))
+	defer svr.Close()
+
+	api, err := New(WithBaseURL(svr.URL+"/"), WithSingleflight())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	opts := [][]Option{
+		nil,
+		nil,
+		{WithSuccessStatuses(func(s int) bool { return s == http.StatusNotFound })},
+		{WithHeader("X-Tenant", "a")},
+		{WithHeader("X-Tenant", "b")},
+	}
+	cxt := context.Background()
+	errs := make([]error, len(opts))
+	var wg sync.WaitGroup
+	for i, e := range opts {
+		wg.Add(1)
+		go func(i int, opts []Option) {
+			defer wg.Done()
+			_, errs[i] = api.Get(cxt, "/shared", nil, opts...)
+		}(i, e)
+	}
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt64(&hits) < 4 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 50) // let the remaining requests join their flights
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int64(4), atomic.LoadInt64(&hits))
+	assert.ErrorIs(t, errs[0], ErrNotFound)
+	assert.ErrorIs(t, errs[1], ErrNotFound)
+	assert.NoError(t, errs[2], "per-request success statuses must not be shared")
+	var apierr *Error
+	if assert.ErrorAs(t, errs[3], &apierr) && assert.NotNil(t, apierr.Entity) {
+		assert.Equal(t, "a", string(apierr.Entity.Data))
+	}
+	if assert.ErrorAs(t, errs[4], &apierr) && assert.NotNil(t, apierr.Entity) {
+		assert.Equal(t, "b", string(apierr.Entity.Data))
+	}
+}
+
+func TestContentType(t *testing.T) {
+	var ctype, body string
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		ctype, body = req.Header.Get("Content-Type"), string(data)
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer svr.Close()
+	cxt := context.Background()
+
+	type thing struct {
+		Name string `json:"name" schema:"name"`
+	}
+
+	api, err := New(WithBaseURL(svr.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	tests := []struct {
+		Method  string
+		Input   interface{}
+		Options []Option
+		Type    string
+		Body    string
+	}{
+		{http.MethodPost, thing{"A"}, nil, JSON, `{"name":"A"}`},
+		{http.MethodPut, thing{"A"}, []Option{WithContentType(URLEncoded)}, URLEncoded, `name=A`},
+		{http.MethodPatch, []byte("raw"), nil, "", `raw`},
+		{http.MethodDelete, []byte("raw"), []Option{WithContentType(PlainText)}, PlainText, `raw`},
+		{http.MethodPost, thing{"A"}, []Option{WithHeader("Content-Type", "application/vnd.thing+json")}, "application/vnd.thing+json", `{"name":"A"}`},
+		{http.MethodPost, nil, nil, "", ``},
+	}
+	for _, e := range tests {
+		_, err := api.ExecBuilder(cxt, func(cxt context.Context) (*http.Request, error) {
+			return api.newEntityRequest(cxt, e.Method, "/things", e.Input, e.Options)
+		}, nil, e.Options...)
+		if assert.NoError(t, err, "%s %v", e.Method, e.Input) {
+			assert.Equal(t, e.Type, ctype, "%s %v", e.Method, e.Input)
+			assert.Equal(t, e.Body, body, "%s %v", e.Method, e.Input)
+		}
+	}
+
+	_, err = api.Post(cxt, "/things", thing{"B"}, nil, WithContentType(URLEncoded))
+	if assert.NoError(t, err) {
+		assert.Equal(t, URLEncoded, ctype)
+		assert.Equal(t, "name=B", body)
+	}
+
+	api, err = New(WithBaseURL(svr.URL), WithContentType(URLEncoded))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = api.ExecBuilder(cxt, api.NewRequest(http.MethodPost, "/things", thing{"C"}), nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, URLEncoded, ctype)
+		assert.Equal(t, "name=C", body)
+	}
+
+	api, err = New(WithBaseURL(svr.URL), WithHeader("Content-Type", "application/vnd.thing+json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = api.Put(cxt, "/things", thing{"D"}, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "application/vnd.thing+json", ctype, "the client's default header is preferred")
+	}
+}
+
+func TestSuccessStatuses(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.Header().Set("Content-Type", JSON)
+		rsp.Header().Set("Location", "/elsewhere")
+		rsp.WriteHeader(http.StatusSeeOther)
+		rsp.Write([]byte(`{"id":"abc"}`))
+	}))
+	defer svr.Close()
+	cxt := context.Background()
+
+	api, err := NewWithConfig(Config{
+		BaseURL: svr.URL,
+		Client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var res struct {
+		Id string `json:"id"`
+	}
+	_, err = api.Post(cxt, "/things", nil, &res)
+	var apierr *Error
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Equal(t, http.StatusSeeOther, apierr.Status)
+	}
+
+	seeOther := WithSuccessStatuses(func(s int) bool {
+		return (s >= 200 && s < 300) || s == http.StatusSeeOther
+	})
+	rsp, err := api.Post(cxt, "/things", nil, &res, seeOther)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusSeeOther, rsp.StatusCode)
+		assert.Equal(t, "abc", res.Id)
+	}
+
+	strict, err := api.Clone(WithSuccessStatuses(func(s int) bool { return s == http.StatusOK }))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = strict.Post(cxt, "/things", nil, &res)
+	assert.Error(t, err)
+	_, err = strict.Post(cxt, "/things", nil, &res, seeOther)
+	assert.NoError(t, err, "per-request options take precedence")
+}
+
+func TestHealthy(t *testing.T) {
+	var status int32 = http.StatusOK
+	var hits int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.URL.Path != "/status" || r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer s.Close()
+
+	c, err := New(WithBaseURL(s.URL), WithRetryStatus(http.StatusServiceUnavailable), WithProbe(Probe{Method: http.MethodHead, Path: "/status"}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, c.Healthy(context.Background()))
+
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	atomic.StoreInt32(&hits, 0)
+	err = c.Checker("remote").Check(context.Background())
+	assert.ErrorIs(t, err, ErrUnhealthy)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "probes are not retried")
+
+	// a status other than success may indicate health
+	d, err := c.Clone(WithProbe(Probe{Method: http.MethodHead, Path: "/status", ExpectStatus: []int{http.StatusServiceUnavailable}}))
+	if assert.NoError(t, err) {
+		assert.NoError(t, d.Healthy(context.Background()))
+	}
+
+	c.Pause(time.Now().Add(time.Hour), "maintenance")
+	err = c.Healthy(context.Background())
+	assert.ErrorIs(t, err, ErrUnhealthy)
+	assert.ErrorIs(t, err, ErrPaused)
+
+	var probed string
+	b := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer b.Close()
+	c, err = New(WithBaseURL(b.URL + "/api/v2/"))
+	if assert.NoError(t, err) {
+		assert.NoError(t, c.Healthy(context.Background()))
+		assert.Equal(t, "/api/v2/", probed, "the default probe is for the base URL rather than the root of its host")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	var evts []events.Event
+	api, err := New(
+		WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())),
+		WithRetryStatus(http.StatusServiceUnavailable),
+		WithRetryDelay(time.Millisecond*10),
+		WithEvents(events.ListenerFunc(func(e events.Event) {
+			evts = append(evts, e)
+		})),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cxt := context.Background()
+	_, err = api.Get(cxt, "/status/200", nil)
+	if assert.NoError(t, err) && assert.Len(t, evts, 2) {
+		if e, ok := evts[0].(events.AttemptStarted); assert.True(t, ok) {
+			assert.Equal(t, 1, e.Attempt)
+			assert.Equal(t, "/status/200", e.Req.URL.Path)
+		}
+		if e, ok := evts[1].(events.AttemptFinished); assert.True(t, ok) {
+			assert.Equal(t, 1, e.Attempt)
+			assert.NoError(t, e.Err)
+			assert.Equal(t, http.StatusOK, e.Rsp.StatusCode)
+			assert.True(t, e.Duration > 0)
+		}
+	}
+
+	evts = nil
+	_, err = api.Get(cxt, "/status/503", nil)
+	assert.Error(t, err)
+	var kinds []string
+	for _, e := range evts {
+		kinds = append(kinds, e.Kind())
+	}
+	assert.Equal(t, []string{
+		"attempt_started", "attempt_finished", "wait_started",
+		"attempt_started", "attempt_finished", "wait_started",
+		"attempt_started", "attempt_finished", "wait_started",
+		"attempt_started", "attempt_finished",
+		"gave_up",
+	}, kinds)
+	if e, ok := evts[2].(events.WaitStarted); assert.True(t, ok) {
+		assert.Equal(t, "retry", e.Reason)
+		assert.Equal(t, time.Millisecond*10, e.Duration)
+	}
+	if e, ok := evts[len(evts)-1].(events.GaveUp); assert.True(t, ok) {
+		assert.Equal(t, 4, e.Attempts)
+		assert.ErrorIs(t, e.Err, ErrServiceUnavailable)
+	}
+}
+
+func TestDerive(t *testing.T) {
+	var hdrs []http.Header
+	var lock sync.Mutex
+	s := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		hdrs = append(hdrs, req.Header.Clone())
+		lock.Unlock()
+		if d, err := time.ParseDuration(req.URL.Query().Get("sleep")); err == nil {
+			time.Sleep(d)
+		}
+	}))
+	defer s.Close()
+	cxt := context.Background()
+
+	parent, err := New(WithBaseURL(s.URL), WithTimeout(time.Millisecond*50), WithHeader("X-Parent", "yes"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, time.Millisecond*50, parent.Client.Timeout, "the timeout must be applied to a new client")
+	assert.Equal(t, time.Second*60, sharedClient.Timeout, "the shared client must not be modified")
+	_, err = parent.Get(cxt, "/?sleep=200ms", nil)
+	assert.Error(t, err)
+
+	slow := parent.WithTimeout(time.Second)
+	_, err = slow.Get(cxt, "/?sleep=100ms", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Millisecond*50, parent.Client.Timeout, "the receiver must not be modified")
+
+	clone, err := parent.Clone(WithTimeout(time.Second), WithHeader("X-Clone", "yes"))
+	if assert.NoError(t, err) {
+		_, err = clone.Get(cxt, "/?sleep=100ms", nil)
+		assert.NoError(t, err)
+	}
+
+	lock.Lock()
+	hdrs = nil
+	lock.Unlock()
+	_, err = parent.WithHeader("X-Child", "yes").Get(cxt, "/", nil)
+	assert.NoError(t, err)
+	_, err = parent.Get(cxt, "/", nil)
+	assert.NoError(t, err)
+	if assert.Len(t, hdrs, 2) {
+		assert.Equal(t, "yes", hdrs[0].Get("X-Parent"), "derived clients inherit headers")
+		assert.Equal(t, "yes", hdrs[0].Get("X-Child"))
+		assert.Equal(t, "", hdrs[1].Get("X-Child"), "the receiver must not be modified")
+	}
+
+	limited := parent.WithRateLimiter(&intervalLimiter{interval: time.Millisecond * 100})
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		_, err = limited.Get(cxt, "/", nil)
+		assert.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*100)
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		_, err = parent.Get(cxt, "/", nil)
+		assert.NoError(t, err)
+	}
+	assert.Less(t, time.Since(start), time.Millisecond*100, "the receiver must not be limited")
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultKeyCooldown = time.Minute
+
+// Where an API key is placed in a request
+type APIKeyPlacement int
+
+const (
+	APIKeyHeader APIKeyPlacement = iota
+	APIKeyQuery
+	APIKeyCookie
+)
+
+type apiKeyConfig struct {
+	prefix   string
+	cooldown time.Duration
+}
+
+type APIKeyOption func(apiKeyConfig) apiKeyConfig
+
+// WithKeyPrefix sets a prefix which is prepended to the key, for example,
+// "Token " for schemes like 'Authorization: Token <key>'.
+func WithKeyPrefix(p string) APIKeyOption {
+	return func(c apiKeyConfig) apiKeyConfig {
+		c.prefix = p
+		return c
+	}
+}
+
+// WithKeyCooldown sets the period for which a key that was rejected by the
+// service is avoided before it is tried again.
+func WithKeyCooldown(d time.Duration) APIKeyOption {
+	return func(c apiKeyConfig) apiKeyConfig {
+		c.cooldown = d
+		return c
+	}
+}
+
+// An API key authorizer places a key in a header, query parameter, or cookie.
+// When more than one key is provided, keys are rotated between requests and
+// a key which is rejected by the service (401, 403, or 429) is avoided for a
+// cooldown period in favor of the remaining healthy keys.
+type APIKeyAuthorizer struct {
+	sync.Mutex
+	place    APIKeyPlacement
+	name     string
+	prefix   string
+	keys     []string
+	cooldown time.Duration
+	next     int
+	failed   map[string]time.Time
+}
+
+// NewAPIKeyAuthorizer creates an authorizer which places one of the provided
+// keys in the named header, query parameter, or cookie.
+func NewAPIKeyAuthorizer(place APIKeyPlacement, name string, keys []string, opts ...APIKeyOption) *APIKeyAuthorizer {
+	conf := apiKeyConfig{cooldown: defaultKeyCooldown}
+	for _, opt := range opts {
+		conf = opt(conf)
+	}
+	return &APIKeyAuthorizer{
+		place:    place,
+		name:     name,
+		prefix:   conf.prefix,
+		keys:     keys,
+		cooldown: conf.cooldown,
+		failed:   make(map[string]time.Time),
+	}
+}
+
+// Select the next key to use; healthy keys are preferred in rotation, and if
+// no key is healthy the one which has been failed the longest is used.
+func (a *APIKeyAuthorizer) key(now time.Time) string {
+	a.Lock()
+	defer a.Unlock()
+	var oldest string
+	var since time.Time
+	for i := 0; i < len(a.keys); i++ {
+		k := a.keys[(a.next+i)%len(a.keys)]
+		t, ok := a.failed[k]
+		if !ok || now.Sub(t) >= a.cooldown {
+			a.next = (a.next + i + 1) % len(a.keys)
+			return k
+		}
+		if oldest == "" || t.Before(since) {
+			oldest, since = k, t
+		}
+	}
+	return oldest
+}
+
+func (a *APIKeyAuthorizer) Authorize(req *http.Request) error {
+	if len(a.keys) == 0 {
+		return nil
+	}
+	v := a.prefix + a.key(time.Now())
+	switch a.place {
+	case APIKeyQuery:
+		q := req.URL.Query()
+		q.Set(a.name, v)
+		req.URL.RawQuery = q.Encode()
+	case APIKeyCookie:
+		cookies := req.Cookies() // replace any key set when the request was previously authorized
+		req.Header.Del("Cookie")
+		for _, e := range cookies {
+			if e.Name != a.name {
+				req.AddCookie(e)
+			}
+		}
+		req.AddCookie(&http.Cookie{Name: a.name, Value: v})
+	default:
+		req.Header.Set(a.name, v)
+	}
+	return nil
+}
+
+// Identify the key that was used to authorize a request
+func (a *APIKeyAuthorizer) used(req *http.Request) string {
+	var v string
+	switch a.place {
+	case APIKeyQuery:
+		v = req.URL.Query().Get(a.name)
+	case APIKeyCookie:
+		if c, err := req.Cookie(a.name); err == nil {
+			v = c.Value
+		}
+	default:
+		v = req.Header.Get(a.name)
+	}
+	if len(v) < len(a.prefix) {
+		return ""
+	}
+	return v[len(a.prefix):]
+}
+
+func (a *APIKeyAuthorizer) Feedback(req *http.Request, rsp *http.Response) {
+	switch rsp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+	default:
+		return
+	}
+	if k := a.used(req); k != "" {
+		a.Lock()
+		a.failed[k] = time.Now()
+		a.Unlock()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"net/http"
 	"net/url"
+	"sync"
 
 	"golang.org/x/oauth2"
 )
@@ -13,6 +14,31 @@ type Authorizer interface {
 	Authorize(*http.Request) error
 }
 
+// An authorizer may optionally receive feedback about the responses to the
+// requests it authorized, which it may use to adjust how it authorizes
+// subsequent requests.
+type FeedbackAuthorizer interface {
+	Authorizer
+	Feedback(*http.Request, *http.Response)
+}
+
+// A finalizer modifies a request immediately before it is sent, after its URL
+// is resolved and the client's default and correlation headers are set, and
+// again before each retry. This suits signature schemes which must cover the
+// final form of a request and which include a fresh timestamp in every
+// attempt. A finalizer which signs the request entity should read it from
+// GetBody rather than consuming the body.
+type Finalizer interface {
+	Finalize(*http.Request) error
+}
+
+// A function which finalizes requests
+type FinalizerFunc func(*http.Request) error
+
+func (f FinalizerFunc) Finalize(req *http.Request) error {
+	return f(req)
+}
+
 type HeaderAuthorizer struct {
 	header http.Header
 }
@@ -41,9 +67,9 @@ func NewQueryAuthorizer(params url.Values) QueryAuthorizer {
 }
 
 func (a QueryAuthorizer) Authorize(req *http.Request) error {
-
 	q := req.URL.Query()
 	for k, v := range a.Params {
+		q.Del(k) // replace any parameters set when the request was previously authorized
 		for _, i := range v {
 			q.Add(k, i)
 		}
@@ -78,12 +104,19 @@ func (a BearerAuthorizer) Authorize(req *http.Request) error {
 	return nil
 }
 
+// An OAuth authorizer authorizes requests using tokens from a token source.
+// Tokens are cached and refreshed at most once per expiry, regardless of how
+// many requests or derived clients share the authorizer; concurrent requests
+// that encounter an expired token wait on a single refresh.
 type OAuthAuthorizer struct {
-	src oauth2.TokenSource
+	src *sharedTokenSource
 }
 
 func NewOAuthAuthorizer(src oauth2.TokenSource) OAuthAuthorizer {
-	return OAuthAuthorizer{src}
+	if s, ok := src.(*sharedTokenSource); ok {
+		return OAuthAuthorizer{s}
+	}
+	return OAuthAuthorizer{&sharedTokenSource{src: src}}
 }
 
 func (a OAuthAuthorizer) Token() (*oauth2.Token, error) {
@@ -98,3 +131,48 @@ func (a OAuthAuthorizer) Authorize(req *http.Request) error {
 	tok.SetAuthHeader(req)
 	return nil
 }
+
+// A token source which caches tokens and coordinates refreshes so that only
+// one is in flight at a time.
+type sharedTokenSource struct {
+	sync.Mutex
+	src    oauth2.TokenSource
+	tok    *oauth2.Token
+	flight *tokenFlight
+}
+
+type tokenFlight struct {
+	done chan struct{}
+	tok  *oauth2.Token
+	err  error
+}
+
+func (s *sharedTokenSource) Token() (*oauth2.Token, error) {
+	s.Lock()
+	if s.tok.Valid() {
+		tok := s.tok
+		s.Unlock()
+		return tok, nil
+	}
+	f := s.flight
+	if f != nil { // a refresh is already in progress; wait for it
+		s.Unlock()
+		<-f.done
+		return f.tok, f.err
+	}
+	f = &tokenFlight{done: make(chan struct{})}
+	s.flight = f
+	s.Unlock()
+
+	f.tok, f.err = s.src.Token()
+
+	s.Lock()
+	if f.err == nil {
+		s.tok = f.tok
+	}
+	s.flight = nil
+	s.Unlock()
+	close(f.done)
+
+	return f.tok, f.err
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+type countingTokenSource struct {
+	count int64
+}
+
+func (s *countingTokenSource) Token() (*oauth2.Token, error) {
+	n := atomic.AddInt64(&s.count, 1)
+	time.Sleep(time.Millisecond * 10) // give other callers a chance to pile up
+	return &oauth2.Token{
+		AccessToken: string(rune('a' + n)),
+		Expiry:      time.Now().Add(time.Hour),
+	}, nil
+}
+
+func TestOAuthRefreshCoordination(t *testing.T) {
+	src := &countingTokenSource{}
+	auth := NewOAuthAuthorizer(src)
+
+	c, err := New(WithAuthorizer(auth))
+	if !assert.NoError(t, err) {
+		return
+	}
+	clients := []*Client{c, c.WithAuthorizer(auth), c.WithBase(nil)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			tok, err := c.Authorizer().(OAuthAuthorizer).Token()
+			if assert.NoError(t, err) {
+				assert.Equal(t, "b", tok.AccessToken)
+			}
+		}(clients[i%len(clients)])
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&src.count))
+}
+
+func TestAPIKeyFailover(t *testing.T) {
+	auth := NewAPIKeyAuthorizer(APIKeyHeader, "Authorization", []string{"a", "b"}, WithKeyPrefix("Token "))
+
+	keys := func(n int) []string {
+		var res []string
+		for i := 0; i < n; i++ {
+			req, _ := http.NewRequest("GET", "http://localhost/", nil)
+			assert.NoError(t, auth.Authorize(req))
+			res = append(res, req.Header.Get("Authorization"))
+		}
+		return res
+	}
+	assert.Equal(t, []string{"Token a", "Token b", "Token a", "Token b"}, keys(4))
+
+	req, _ := http.NewRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Token a")
+	auth.Feedback(req, &http.Response{StatusCode: http.StatusUnauthorized})
+	assert.Equal(t, []string{"Token b", "Token b", "Token b"}, keys(3))
+
+	req, _ = http.NewRequest("GET", "http://localhost/", nil)
+	auth = NewAPIKeyAuthorizer(APIKeyQuery, "api_key", []string{"a"})
+	assert.NoError(t, auth.Authorize(req))
+	assert.Equal(t, "a", req.URL.Query().Get("api_key"))
+}
+
+func TestFinalizers(t *testing.T) {
+	var seen []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("X-Signature"))
+		if len(seen) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+
+	var n int32
+	sign := FinalizerFunc(func(req *http.Request) error {
+		// the request is resolved and carries the client's default headers by now
+		req.Header.Set("X-Signature", fmt.Sprintf("%s %s %s #%d", req.Method, req.URL, req.Header.Get("X-Default"), atomic.AddInt32(&n, 1)))
+		return nil
+	})
+	suffix := FinalizerFunc(func(req *http.Request) error {
+		req.Header.Set("X-Signature", req.Header.Get("X-Signature")+" final")
+		return nil
+	})
+
+	c, err := New(WithBaseURL(s.URL), WithHeader("X-Default", "yes"), WithFinalizers(sign), WithRetryStatus(http.StatusServiceUnavailable), WithRetryDelay(time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Get(context.Background(), "/a", nil, WithFinalizers(suffix))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"GET " + s.URL + "/a yes #1 final",
+			"GET " + s.URL + "/a yes #2 final",
+		}, seen)
+	}
+
+	failed := errors.New("Nope")
+	_, err = c.Get(context.Background(), "/a", nil, WithFinalizers(FinalizerFunc(func(*http.Request) error { return failed })))
+	assert.ErrorIs(t, err, ErrCouldNotFinalize)
+	assert.Len(t, seen, 2)
+}
+
+type countingAuthorizer struct {
+	count int32
+}
+
+func (a *countingAuthorizer) Authorize(req *http.Request) error {
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %d", atomic.AddInt32(&a.count, 1)))
+	return nil
+}
+
+func TestReauthorizeRetries(t *testing.T) {
+	var seen []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization")+" "+r.URL.RawQuery)
+		if len(seen)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+
+	auth := &countingAuthorizer{}
+	c, err := New(WithBaseURL(s.URL), WithAuthorizer(auth), WithRetryStatus(http.StatusServiceUnavailable), WithRetryDelay(time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Get(context.Background(), "/", nil)
+	assert.NoError(t, err)
+	_, err = c.Get(context.Background(), "/", nil, WithAuthorizeOnce())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bearer 1 ", "Bearer 2 ", "Bearer 3 ", "Bearer 3 "}, seen)
+
+	// authorizing a request again replaces its credentials rather than adding to them
+	seen = nil
+	c = c.WithAuthorizer(NewQueryAuthorizer(map[string][]string{"key": {"a"}}))
+	_, err = c.Get(context.Background(), "/", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{" key=a", " key=a"}, seen)
+}
@@ -0,0 +1,204 @@
+// Package balance distributes the requests performed by a client across a
+// set of equivalent endpoints. Endpoints are produced by a resolver, which may
+// be a static list or service discovery, and one is selected for each attempt
+// of a request by a picker:
+//
+//	eps, _ := balance.NewStatic("https://a.example.com", "https://b.example.com")
+//	client, _ := api.New(
+//	  api.WithBaseURL("https://api.example.com/v1/"),
+//	  api.WithBalancer(balance.New(eps, balance.NewRoundRobin())),
+//	)
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrNoEndpoints = errors.New("No endpoints")
+
+// An endpoint to which requests may be sent. Only the scheme and host of its
+// URL are used.
+type Endpoint struct {
+	URL *url.URL
+	// The relative weight of the endpoint, which is used by weighted pickers;
+	// zero is treated as 1
+	Weight int
+}
+
+func (e Endpoint) key() string {
+	return e.URL.Scheme + "://" + e.URL.Host
+}
+
+func (e Endpoint) weight() int {
+	if e.Weight <= 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+// A resolver produces the endpoints which are currently available. Resolvers
+// are consulted for every attempt, so those which perform service discovery
+// should cache their results.
+type Resolver interface {
+	Resolve(context.Context) ([]Endpoint, error)
+}
+
+type ResolverFunc func(context.Context) ([]Endpoint, error)
+
+func (f ResolverFunc) Resolve(cxt context.Context) ([]Endpoint, error) {
+	return f(cxt)
+}
+
+// A static set of endpoints
+type Static []Endpoint
+
+// NewStatic creates a static set of endpoints with the provided URLs
+func NewStatic(urls ...string) (Static, error) {
+	res := make(Static, 0, len(urls))
+	for _, e := range urls {
+		u, err := url.Parse(e)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid endpoint URL: %v", err)
+		}
+		res = append(res, Endpoint{URL: u})
+	}
+	return res, nil
+}
+
+func (s Static) Resolve(context.Context) ([]Endpoint, error) {
+	return s, nil
+}
+
+// A picker selects one of a set of endpoints. It produces the endpoint and,
+// optionally, a function which is invoked when the attempt sent to it has
+// completed.
+type Picker interface {
+	Pick([]Endpoint) (Endpoint, func(), error)
+}
+
+// A balancer selects an endpoint for each attempt using a resolver and a
+// picker. It implements api.Balancer.
+type Balancer struct {
+	resolver Resolver
+	picker   Picker
+}
+
+func New(r Resolver, p Picker) *Balancer {
+	return &Balancer{
+		resolver: r,
+		picker:   p,
+	}
+}
+
+func (b *Balancer) Pick(req *http.Request) (*url.URL, func(), error) {
+	eps, err := b.resolver.Resolve(req.Context())
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not resolve endpoints: %w", err)
+	} else if len(eps) == 0 {
+		return nil, nil, ErrNoEndpoints
+	}
+	e, done, err := b.picker.Pick(eps)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e.URL, done, nil
+}
+
+// A round-robin picker selects each endpoint in turn
+type RoundRobin struct {
+	next atomic.Uint64
+}
+
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{}
+}
+
+func (p *RoundRobin) Pick(eps []Endpoint) (Endpoint, func(), error) {
+	if len(eps) == 0 {
+		return Endpoint{}, nil, ErrNoEndpoints
+	}
+	n := p.next.Add(1) - 1
+	return eps[n%uint64(len(eps))], nil, nil
+}
+
+// A least-in-flight picker selects the endpoint with the fewest attempts
+// awaiting a response, preferring endpoints in the order they are resolved
+// when several are equally busy.
+type LeastInFlight struct {
+	sync.Mutex
+	inflight map[string]int
+}
+
+func NewLeastInFlight() *LeastInFlight {
+	return &LeastInFlight{inflight: make(map[string]int)}
+}
+
+func (p *LeastInFlight) Pick(eps []Endpoint) (Endpoint, func(), error) {
+	if len(eps) == 0 {
+		return Endpoint{}, nil, ErrNoEndpoints
+	}
+	p.Lock()
+	defer p.Unlock()
+	sel := eps[0]
+	for _, e := range eps[1:] {
+		if p.inflight[e.key()] < p.inflight[sel.key()] {
+			sel = e
+		}
+	}
+	k := sel.key()
+	p.inflight[k]++
+	var once sync.Once
+	return sel, func() {
+		once.Do(func() {
+			p.Lock()
+			defer p.Unlock()
+			if p.inflight[k]--; p.inflight[k] <= 0 {
+				delete(p.inflight, k)
+			}
+		})
+	}, nil
+}
+
+// A weighted picker selects endpoints in proportion to their weights. Picks
+// are spread evenly over time rather than selecting each endpoint several
+// times in a row.
+type Weighted struct {
+	sync.Mutex
+	current map[string]int
+}
+
+func NewWeighted() *Weighted {
+	return &Weighted{current: make(map[string]int)}
+}
+
+func (p *Weighted) Pick(eps []Endpoint) (Endpoint, func(), error) {
+	if len(eps) == 0 {
+		return Endpoint{}, nil, ErrNoEndpoints
+	}
+	p.Lock()
+	defer p.Unlock()
+	// smooth weighted round-robin: every endpoint gains its weight, and the
+	// endpoint with the greatest accumulated weight is selected and pays back
+	// the total
+	var sel int
+	var total int
+	curr := make(map[string]int, len(eps))
+	for i, e := range eps {
+		w := e.weight()
+		k := e.key()
+		curr[k] = p.current[k] + w
+		total += w
+		if curr[k] > curr[eps[sel].key()] {
+			sel = i
+		}
+	}
+	curr[eps[sel].key()] -= total
+	p.current = curr // discard endpoints which are no longer resolved
+	return eps[sel], nil, nil
+}
@@ -0,0 +1,94 @@
+package balance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/bww/go-apiclient/v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPickers(t *testing.T) {
+	eps, err := NewStatic("http://a", "http://b", "http://c")
+	if !assert.NoError(t, err) {
+		return
+	}
+	eps[0].Weight = 3
+
+	pick := func(p Picker, n int) []string {
+		var res []string
+		for i := 0; i < n; i++ {
+			e, _, err := p.Pick(eps)
+			if assert.NoError(t, err) {
+				res = append(res, e.URL.Host)
+			}
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"a", "b", "c", "a"}, pick(NewRoundRobin(), 4))
+	assert.Equal(t, []string{"a", "b", "a", "c", "a"}, pick(NewWeighted(), 5))
+
+	lif := NewLeastInFlight()
+	a, done, err := lif.Pick(eps)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", a.URL.Host)
+	b, _, err := lif.Pick(eps)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", b.URL.Host)
+	done()
+	done() // has no further effect
+	a, _, err = lif.Pick(eps)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", a.URL.Host)
+	c, _, err := lif.Pick(eps)
+	assert.NoError(t, err)
+	assert.Equal(t, "c", c.URL.Host)
+
+	_, _, err = New(Static(nil), NewRoundRobin()).Pick(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.ErrorIs(t, err, ErrNoEndpoints)
+}
+
+func TestBalancedClient(t *testing.T) {
+	var hits [2]int64
+	var servers [2]*httptest.Server
+	for i := range servers {
+		n := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+			atomic.AddInt64(&hits[n], 1)
+			assert.Equal(t, "/v1/things", req.URL.Path)
+			if n == 0 {
+				rsp.WriteHeader(http.StatusServiceUnavailable)
+			} else {
+				rsp.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		defer servers[i].Close()
+	}
+
+	eps, err := NewStatic(servers[0].URL, servers[1].URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	client, err := api.New(
+		api.WithBaseURL("http://api.invalid/v1/"),
+		api.WithBalancer(New(eps, NewRoundRobin())),
+		api.WithRetryStatus(http.StatusServiceUnavailable),
+		api.WithRetryDelay(time.Millisecond),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	rsp, err := client.Get(context.Background(), "things", nil)
+	if assert.NoError(t, err, "the retry is sent to the next endpoint") {
+		assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&hits[0]))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&hits[1]))
+}
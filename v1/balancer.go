@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// A balancer selects the endpoint to which each attempt of a request is sent;
+// see the balance package. Pick produces the URL of an endpoint and, if it is
+// not nil, a function which is invoked once the attempt has produced a
+// response or failed.
+type Balancer interface {
+	Pick(*http.Request) (*url.URL, func(), error)
+}
+
+// WithBalancer distributes requests across the endpoints selected by the
+// provided balancer. The scheme and host of each attempt are replaced by those
+// of the selected endpoint, so retries may be sent to different endpoints.
+// Only requests to the host of the client's base URL are balanced, or every
+// request if the client has no base URL.
+func WithBalancer(b Balancer) Option {
+	return func(c Config) Config {
+		c.Balancer = b
+		return c
+	}
+}
+
+// Determine whether a request is directed by the client's balancer
+func (c *Client) isBalanced(req *http.Request) bool {
+	return c.balance != nil && (c.base == nil || req.URL.Host == c.base.Host)
+}
+
+// Direct an attempt to the endpoint selected by the client's balancer
+func (c *Client) pick(req *http.Request) (func(), error) {
+	u, done, err := c.balance.Pick(req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not select endpoint: %w", err)
+	}
+	t := *req.URL
+	t.Scheme, t.Host = u.Scheme, u.Host
+	req.URL = &t
+	req.Host = "" // the host header follows the endpoint
+	return done, nil
+}
@@ -0,0 +1,261 @@
+// Package batch coalesces individual logical calls into the native batch
+// formats supported by some APIs, such as a JSON array of operations or a
+// multipart/mixed request of embedded HTTP requests, and splits the combined
+// response back into individual results. When no batch endpoint is
+// configured, calls are performed individually using a multiplexer.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	api "github.com/bww/go-apiclient/v1"
+	"github.com/bww/go-apiclient/v1/multiplex"
+)
+
+var ErrMissingResult = errors.New("Batch response is missing a result")
+
+const (
+	defaultMaxSize     = 100
+	defaultConcurrency = 4
+)
+
+// A call is a single logical request in a batch
+type Call struct {
+	Method string
+	URL    string // in the form the batch format expects; resolved against the client's base URL when performed individually
+	Header http.Header
+	Entity interface{} // encoded as JSON; may be nil
+}
+
+// The result of a call. A result for a call which the service processed but
+// which did not succeed has its status set and an *api.Error as its error.
+type Result struct {
+	Index  int
+	Status int
+	Header http.Header
+	Data   []byte
+	Err    error
+}
+
+// Unmarshal the result's entity
+func (r Result) Unmarshal(entity interface{}) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	return api.Entity{ContentType: r.Header.Get("Content-Type"), Data: r.Data}.Unmarshal(entity)
+}
+
+// A format encodes calls into the entity of a batch request and decodes the
+// results of those calls from the batch response.
+type Format interface {
+	Encode(calls []Call) (string, []byte, error)
+	Decode(calls []Call, rsp *http.Response) ([]Result, error)
+}
+
+type Config struct {
+	Endpoint    string
+	Format      Format
+	MaxSize     int
+	Concurrency int
+}
+
+func (c Config) WithOptions(opts []Option) Config {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type Option func(Config) Config
+
+// WithEndpoint sets the batch endpoint, relative to the client's base URL,
+// and the format it accepts.
+func WithEndpoint(u string, f Format) Option {
+	return func(c Config) Config {
+		c.Endpoint = u
+		c.Format = f
+		return c
+	}
+}
+
+// WithMaxSize sets the maximum number of calls in a single batch request.
+// Larger sets of calls are split into several batches.
+func WithMaxSize(n int) Option {
+	return func(c Config) Config {
+		c.MaxSize = n
+		return c
+	}
+}
+
+// WithConcurrency sets the number of batches, or of individual calls when no
+// batch endpoint is configured, which are performed concurrently.
+func WithConcurrency(n int) Option {
+	return func(c Config) Config {
+		c.Concurrency = n
+		return c
+	}
+}
+
+// A batcher performs sets of calls
+type Batcher struct {
+	client *api.Client
+	conf   Config
+}
+
+func New(client *api.Client, opts ...Option) *Batcher {
+	conf := Config{
+		MaxSize:     defaultMaxSize,
+		Concurrency: defaultConcurrency,
+	}.WithOptions(opts)
+	return &Batcher{
+		client: client,
+		conf:   conf,
+	}
+}
+
+// Do performs a set of calls, producing a result for each call in the same
+// order. An error is returned only when the batch as a whole could not be
+// performed; the failure of an individual call is reported by its result.
+func (b *Batcher) Do(cxt context.Context, calls []Call) ([]Result, error) {
+	if b.conf.Endpoint == "" || b.conf.Format == nil {
+		return b.fallback(cxt, calls)
+	}
+
+	var chunks [][]Call
+	for i := 0; i < len(calls); i += max(1, b.conf.MaxSize) {
+		chunks = append(chunks, calls[i:min(len(calls), i+max(1, b.conf.MaxSize))])
+	}
+
+	res := make([][]Result, len(chunks))
+	mux := multiplex.New(b.client, b.conf.Concurrency)
+	producer := multiplex.RequestProducerFunc(func(i int) (*http.Request, error) {
+		if i >= len(chunks) {
+			return nil, nil
+		}
+		ctype, data, err := b.conf.Format.Encode(chunks[i])
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPost, b.conf.Endpoint, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", ctype)
+		return req, nil
+	})
+	err := mux.DoFunc(cxt, producer, func(r *multiplex.Result) error {
+		var err error
+		res[r.Index], err = b.decode(chunks[r.Index], r.Response)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Result, 0, len(calls))
+	for _, e := range res {
+		out = append(out, e...)
+	}
+	for i := range out {
+		out[i].Index = i
+	}
+	return out, nil
+}
+
+// Decode the results of a batch, which must include one result per call
+func (b *Batcher) decode(calls []Call, rsp *http.Response) ([]Result, error) {
+	res, err := b.conf.Format.Decode(calls, rsp)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode batch response: %w", err)
+	}
+	if len(res) != len(calls) {
+		return nil, fmt.Errorf("%w: expected %d results, got %d", ErrMissingResult, len(calls), len(res))
+	}
+	return res, nil
+}
+
+// Perform calls individually when no batch endpoint is configured
+func (b *Batcher) fallback(cxt context.Context, calls []Call) ([]Result, error) {
+	res := make([]Result, len(calls))
+	mux := multiplex.New(b.client, b.conf.Concurrency)
+	producer := multiplex.RequestProducerFunc(func(i int) (*http.Request, error) {
+		if i >= len(calls) {
+			return nil, nil
+		}
+		return newRequest(calls[i])
+	})
+	err := mux.DoFunc(cxt, producer, func(r *multiplex.Result) error {
+		res[r.Index] = resultFrom(r.Index, r.Response, r.Err)
+		return nil
+	}, multiplex.WithPartialFailures())
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Create an individual request for a call
+func newRequest(c Call) (*http.Request, error) {
+	var body io.Reader
+	if c.Entity != nil {
+		data, err := api.Marshal(api.JSON, c.Entity)
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+	req, err := http.NewRequest(c.Method, c.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	if c.Entity != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", api.JSON)
+	}
+	return req, nil
+}
+
+// Convert a response or error into a result
+func resultFrom(i int, rsp *http.Response, err error) Result {
+	var apierr *api.Error
+	if errors.As(err, &apierr) {
+		res := Result{Index: i, Status: apierr.Status, Err: err}
+		if e := apierr.Entity; e != nil {
+			res.Header = http.Header{"Content-Type": []string{e.ContentType}}
+			res.Data = e.Data
+		}
+		return res
+	} else if err != nil {
+		return Result{Index: i, Err: err}
+	}
+	defer rsp.Body.Close()
+	data, err := io.ReadAll(rsp.Body)
+	return Result{
+		Index:  i,
+		Status: rsp.StatusCode,
+		Header: rsp.Header,
+		Data:   data,
+		Err:    err,
+	}
+}
+
+// Produce the result for a call which was processed within a batch
+func callResult(c Call, status int, hdr http.Header, data []byte) Result {
+	res := Result{Status: status, Header: hdr, Data: data}
+	if status < 200 || status > 299 {
+		res.Err = (&api.Error{
+			Status:  status,
+			Method:  c.Method,
+			URL:     c.URL,
+			Message: fmt.Sprintf("Unexpected status code: %d %s", status, http.StatusText(status)),
+		}).SetEntity(&api.Entity{ContentType: hdr.Get("Content-Type"), Data: data})
+	}
+	return res
+}
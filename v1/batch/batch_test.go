@@ -0,0 +1,129 @@
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	api "github.com/bww/go-apiclient/v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pathEntity struct {
+	Path string `json:"path"`
+}
+
+func respond(path string) (int, []byte) {
+	if path == "/missing" {
+		return http.StatusNotFound, []byte(`{"error":"not found"}`)
+	}
+	data, _ := json.Marshal(pathEntity{path})
+	return http.StatusOK, data
+}
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/batch/json", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Requests []jsonOperation `json:"requests"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var rsp struct {
+			Responses []jsonResult `json:"responses"`
+			Meta      struct {
+				Count int `json:"count"`
+			} `json:"meta"` // other members of the envelope are ignored
+		}
+		rsp.Meta.Count = len(req.Requests)
+		for i := len(req.Requests) - 1; i >= 0; i-- { // respond out of order
+			e := req.Requests[i]
+			status, data := respond(e.URL)
+			rsp.Responses = append(rsp.Responses, jsonResult{ID: e.ID, Status: status, Body: data})
+		}
+		w.Header().Set("Content-Type", api.JSON)
+		json.NewEncoder(w).Encode(rsp)
+	})
+	mux.HandleFunc("/batch/multipart", func(w http.ResponseWriter, r *http.Request) {
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			preq, err := http.ReadRequest(bufio.NewReader(part))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			status, data := respond(preq.URL.Path)
+			out, _ := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type": []string{"application/http"},
+				"Content-Id":   []string{"<response-" + part.Header.Get("Content-Id")[1:]},
+			})
+			fmt.Fprintf(out, "HTTP/1.1 %d %s\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s", status, http.StatusText(status), api.JSON, len(data), data)
+		}
+		mw.Close()
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		status, data := respond(r.URL.Path)
+		w.Header().Set("Content-Type", api.JSON)
+		w.WriteHeader(status)
+		w.Write(data)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestBatch(t *testing.T) {
+	svr := newTestServer()
+	defer svr.Close()
+
+	client, err := api.New(api.WithBaseURL(svr.URL + "/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	calls := make([]Call, 7)
+	for i := range calls {
+		calls[i] = Call{Method: http.MethodGet, URL: fmt.Sprintf("/items/%d", i)}
+	}
+	calls[3].URL = "/missing"
+
+	tests := []struct {
+		Name string
+		Opts []Option
+	}{
+		{"JSON", []Option{WithEndpoint("/batch/json", JSONFormat{RequestKey: "requests", ResponseKey: "responses"}), WithMaxSize(3)}},
+		{"Multipart", []Option{WithEndpoint("/batch/multipart", MultipartFormat{}), WithMaxSize(3)}},
+		{"Fallback", nil},
+	}
+	for _, e := range tests {
+		res, err := New(client, e.Opts...).Do(context.Background(), calls)
+		if assert.NoError(t, err, e.Name) && assert.Len(t, res, len(calls), e.Name) {
+			for i, r := range res {
+				assert.Equal(t, i, r.Index, e.Name)
+				if i == 3 {
+					var apierr *api.Error
+					if assert.ErrorAs(t, r.Err, &apierr, e.Name) {
+						assert.Equal(t, http.StatusNotFound, apierr.Status, e.Name)
+					}
+					continue
+				}
+				var v pathEntity
+				if assert.NoError(t, r.Unmarshal(&v), e.Name) {
+					assert.Equal(t, calls[i].URL, v.Path, e.Name)
+				}
+			}
+		}
+	}
+}
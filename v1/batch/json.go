@@ -0,0 +1,132 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	api "github.com/bww/go-apiclient/v1"
+)
+
+// A JSON format encodes a batch as an array of operations and decodes a
+// corresponding array of results, as in:
+//
+//	[{"id": "0", "method": "GET", "url": "/a", "headers": {...}, "body": ...}]
+//	[{"id": "0", "status": 200, "headers": {...}, "body": ...}]
+//
+// When keys are set, the arrays are enclosed in an object under those keys;
+// for example, Microsoft Graph uses the keys "requests" and "responses".
+// Results are matched to calls by their identifier, or by position when
+// results have no identifier.
+type JSONFormat struct {
+	RequestKey  string
+	ResponseKey string
+}
+
+type jsonOperation struct {
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+type jsonResult struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+func (f JSONFormat) Encode(calls []Call) (string, []byte, error) {
+	ops := make([]jsonOperation, len(calls))
+	for i, c := range calls {
+		op := jsonOperation{
+			ID:     strconv.Itoa(i),
+			Method: c.Method,
+			URL:    c.URL,
+		}
+		if len(c.Header) > 0 {
+			op.Headers = make(map[string]string)
+			for k := range c.Header {
+				op.Headers[k] = c.Header.Get(k)
+			}
+		}
+		if c.Entity != nil {
+			r, err := api.Marshal(api.JSON, c.Entity)
+			if err != nil {
+				return "", nil, err
+			}
+			op.Body, err = io.ReadAll(r)
+			if err != nil {
+				return "", nil, err
+			}
+			if op.Headers == nil {
+				op.Headers = make(map[string]string)
+			}
+			if _, ok := op.Headers["Content-Type"]; !ok {
+				op.Headers["Content-Type"] = api.JSON
+			}
+		}
+		ops[i] = op
+	}
+
+	var v interface{} = ops
+	if f.RequestKey != "" {
+		v = map[string]interface{}{f.RequestKey: ops}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", nil, err
+	}
+	return api.JSON, data, nil
+}
+
+func (f JSONFormat) Decode(calls []Call, rsp *http.Response) ([]Result, error) {
+	var results []jsonResult
+	var err error
+	if f.ResponseKey != "" {
+		env := make(map[string]json.RawMessage) // other members of the envelope may be anything
+		err = json.NewDecoder(rsp.Body).Decode(&env)
+		if v, ok := env[f.ResponseKey]; ok && err == nil {
+			err = json.Unmarshal(v, &results)
+		}
+	} else {
+		err = json.NewDecoder(rsp.Body).Decode(&results)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Result, len(calls))
+	found := make([]bool, len(calls))
+	for i, e := range results {
+		n := i
+		if e.ID != "" {
+			n, err = strconv.Atoi(e.ID)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid result identifier: %q", e.ID)
+			}
+		}
+		if n < 0 || n >= len(calls) {
+			return nil, fmt.Errorf("Result identifier out of range: %d", n)
+		}
+		hdr := make(http.Header)
+		for k, v := range e.Headers {
+			hdr.Set(k, v)
+		}
+		if len(e.Body) > 0 && hdr.Get("Content-Type") == "" {
+			hdr.Set("Content-Type", api.JSON)
+		}
+		res[n] = callResult(calls[n], e.Status, hdr, e.Body)
+		found[n] = true
+	}
+	for i, e := range found {
+		if !e {
+			return nil, fmt.Errorf("%w: %d", ErrMissingResult, i)
+		}
+	}
+	return res, nil
+}
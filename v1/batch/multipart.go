@@ -0,0 +1,118 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	api "github.com/bww/go-apiclient/v1"
+)
+
+// A multipart format encodes a batch as a multipart/mixed entity in which
+// each part is an embedded HTTP request, and decodes a multipart/mixed
+// response in which each part is an embedded HTTP response. This is the
+// format used by Google and OData batch endpoints. Each part is identified by
+// a Content-ID of the form <item-N>, to which the service responds with
+// <response-item-N>; results are matched by position when they are not
+// identified.
+type MultipartFormat struct{}
+
+func (f MultipartFormat) Encode(calls []Call) (string, []byte, error) {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	for i, c := range calls {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": []string{"application/http"},
+			"Content-Id":   []string{fmt.Sprintf("<item-%d>", i)},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		var data []byte
+		hdr := c.Header.Clone()
+		if hdr == nil {
+			hdr = make(http.Header)
+		}
+		if c.Entity != nil {
+			r, err := api.Marshal(api.JSON, c.Entity)
+			if err != nil {
+				return "", nil, err
+			}
+			data, err = io.ReadAll(r)
+			if err != nil {
+				return "", nil, err
+			}
+			if hdr.Get("Content-Type") == "" {
+				hdr.Set("Content-Type", api.JSON)
+			}
+			hdr.Set("Content-Length", strconv.Itoa(len(data)))
+		}
+		fmt.Fprintf(part, "%s %s HTTP/1.1\r\n", c.Method, c.URL)
+		hdr.Write(part)
+		fmt.Fprint(part, "\r\n")
+		part.Write(data)
+	}
+	err := mw.Close()
+	if err != nil {
+		return "", nil, err
+	}
+	return mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}), buf.Bytes(), nil
+}
+
+func (f MultipartFormat) Decode(calls []Call, rsp *http.Response) ([]Result, error) {
+	m, params, err := mime.ParseMediaType(rsp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(m, "multipart/") {
+		return nil, fmt.Errorf("%w: %s", api.ErrUnsupportedMimetype, m)
+	}
+
+	res := make([]Result, len(calls))
+	found := make([]bool, len(calls))
+	mr := multipart.NewReader(rsp.Body, params["boundary"])
+	for i := 0; ; i++ {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		n := i
+		if id := strings.Trim(part.Header.Get("Content-Id"), "<>"); id != "" {
+			if x := strings.LastIndex(id, "-"); x >= 0 {
+				if v, err := strconv.Atoi(id[x+1:]); err == nil {
+					n = v
+				}
+			}
+		}
+		if n < 0 || n >= len(calls) {
+			return nil, fmt.Errorf("Result identifier out of range: %d", n)
+		}
+		prsp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read embedded response: %w", err)
+		}
+		data, err := io.ReadAll(prsp.Body)
+		prsp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		res[n] = callResult(calls[n], prsp.StatusCode, prsp.Header, data)
+		found[n] = true
+	}
+	for i, e := range found {
+		if !e {
+			return nil, fmt.Errorf("%w: %d", ErrMissingResult, i)
+		}
+	}
+	return res, nil
+}
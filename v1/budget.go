@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bww/go-ratelimit/v1"
+)
+
+// A cost limiter reserves capacity for requests which consume more than one
+// unit of a quota, such as APIs which count points per call rather than
+// requests. The client reserves the cost set with WithCost from a limiter
+// which implements this interface.
+type CostLimiter interface {
+	ratelimit.Limiter
+	NextCost(rel time.Time, cost int, opts ...ratelimit.Option) (time.Time, error)
+}
+
+type BudgetConfig struct {
+	Resource        string
+	ResourceHeader  string
+	LimitHeader     string
+	RemainingHeader string
+	UsedHeader      string
+	ResetHeader     string
+}
+
+func (c BudgetConfig) WithOptions(opts []BudgetOption) BudgetConfig {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type BudgetOption func(BudgetConfig) BudgetConfig
+
+// WithBudgetResource only updates a budget from responses which identify the
+// named resource in their resource header, for APIs which maintain separate
+// budgets for different resources, such as GitHub's "core" and "graphql".
+func WithBudgetResource(name string) BudgetOption {
+	return func(c BudgetConfig) BudgetConfig {
+		c.Resource = name
+		return c
+	}
+}
+
+// WithBudgetHeaders sets the response headers which describe a budget's
+// limit, the remaining points, the points used, and the time, in Unix
+// seconds, at which it resets. Empty names are not read.
+func WithBudgetHeaders(limit, remaining, used, reset string) BudgetOption {
+	return func(c BudgetConfig) BudgetConfig {
+		c.LimitHeader = limit
+		c.RemainingHeader = remaining
+		c.UsedHeader = used
+		c.ResetHeader = reset
+		return c
+	}
+}
+
+// A budget limiter permits a budget of points to be consumed in each window,
+// where each request consumes its cost. When a response describes the state
+// of the budget in its headers, which by default are GitHub's X-RateLimit-*
+// headers, the server's accounting replaces the limiter's own.
+type BudgetLimiter struct {
+	sync.Mutex
+	conf      BudgetConfig
+	window    time.Duration
+	limit     int
+	remaining int
+	avail     time.Time // the time at which the remaining budget may be used
+	reset     time.Time
+}
+
+// NewBudgetLimiter creates a limiter which permits budget points to be
+// consumed in each window.
+func NewBudgetLimiter(budget int, window time.Duration, opts ...BudgetOption) *BudgetLimiter {
+	return &BudgetLimiter{
+		conf: BudgetConfig{
+			ResourceHeader:  "X-RateLimit-Resource",
+			LimitHeader:     "X-RateLimit-Limit",
+			RemainingHeader: "X-RateLimit-Remaining",
+			UsedHeader:      "X-RateLimit-Used",
+			ResetHeader:     "X-RateLimit-Reset",
+		}.WithOptions(opts),
+		window:    window,
+		limit:     budget,
+		remaining: budget,
+	}
+}
+
+// Reserve a request which costs a single point
+func (l *BudgetLimiter) Next(rel time.Time, opts ...ratelimit.Option) (time.Time, error) {
+	return l.NextCost(rel, 1, opts...)
+}
+
+// Reserve a request which costs the provided number of points. A request
+// which cannot be afforded in the current window is scheduled for the start
+// of the next one; a request which costs more than the entire budget is
+// rejected with ErrQuotaExceeded.
+func (l *BudgetLimiter) NextCost(rel time.Time, cost int, opts ...ratelimit.Option) (time.Time, error) {
+	l.Lock()
+	defer l.Unlock()
+	if cost > l.limit {
+		return time.Time{}, fmt.Errorf("%w: request costs %d of a budget of %d", ErrQuotaExceeded, cost, l.limit)
+	}
+	if !rel.Before(l.reset) { // the window has passed; begin a new one
+		l.remaining = l.limit
+		l.avail = rel
+		l.reset = rel.Add(l.window)
+	}
+	if l.remaining < cost { // defer to the next window
+		l.remaining = l.limit
+		l.avail = l.reset
+		l.reset = l.reset.Add(l.window)
+	}
+	l.remaining -= cost
+	if l.avail.After(rel) {
+		return l.avail, nil
+	}
+	return rel, nil
+}
+
+func (l *BudgetLimiter) Wait(cxt context.Context, rel time.Time, opts ...ratelimit.Option) (time.Time, error) {
+	t, err := l.Next(rel, opts...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := wait(cxt, t.Sub(rel), "rate limits"); err != nil {
+		return t, ratelimit.ErrCanceled
+	}
+	return t, nil
+}
+
+// Update the budget from the headers of a response, if it describes them
+func (l *BudgetLimiter) Update(rel time.Time, opts ...ratelimit.Option) error {
+	hdr := http.Header(ratelimit.Options{}.With(opts).Attrs)
+	if hdr == nil {
+		return nil
+	}
+	if l.conf.Resource != "" && l.conf.ResourceHeader != "" && hdr.Get(l.conf.ResourceHeader) != l.conf.Resource {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.avail.After(rel) { // the budget describes a window which has not begun; the response describes the current one
+		return nil
+	}
+	limit, haveLimit := intHeader(hdr, l.conf.LimitHeader)
+	if haveLimit && limit > 0 {
+		l.limit = limit
+	}
+	if v, ok := intHeader(hdr, l.conf.RemainingHeader); ok {
+		l.remaining = v
+	} else if v, ok := intHeader(hdr, l.conf.UsedHeader); ok && haveLimit {
+		l.remaining = limit - v
+	}
+	if v, ok := intHeader(hdr, l.conf.ResetHeader); ok && v > 0 {
+		l.reset = time.Unix(int64(v), 0)
+	}
+	return nil
+}
+
+func (l *BudgetLimiter) State(rel time.Time) ratelimit.State {
+	l.Lock()
+	defer l.Unlock()
+	if !rel.Before(l.reset) {
+		return ratelimit.State{Limit: l.limit, Remaining: l.limit, Reset: rel.Add(l.window)}
+	}
+	return ratelimit.State{Limit: l.limit, Remaining: l.remaining, Reset: l.reset}
+}
+
+func intHeader(hdr http.Header, name string) (int, bool) {
+	if name == "" {
+		return 0, false
+	}
+	v, err := strconv.Atoi(hdr.Get(name))
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
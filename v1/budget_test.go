@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bww/go-ratelimit/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetLimiter(t *testing.T) {
+	l := NewBudgetLimiter(10, time.Minute)
+	base := time.Now()
+	var next []time.Duration
+	for i := 0; i < 3; i++ {
+		n, err := l.NextCost(base, 4)
+		assert.NoError(t, err)
+		next = append(next, n.Sub(base))
+	}
+	assert.Equal(t, []time.Duration{0, 0, time.Minute}, next)
+	_, err := l.NextCost(base, 11)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// the server's accounting replaces the limiter's own, for the configured resource only
+	l = NewBudgetLimiter(5000, time.Hour, WithBudgetResource("graphql"))
+	_, err = l.NextCost(base, 10)
+	assert.NoError(t, err)
+	reset := base.Add(time.Minute * 30).Truncate(time.Second)
+	update := func(resource string, used int) {
+		hdr := http.Header{}
+		hdr.Set("X-RateLimit-Resource", resource)
+		hdr.Set("X-RateLimit-Limit", "5000")
+		hdr.Set("X-RateLimit-Used", strconv.Itoa(used))
+		hdr.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		assert.NoError(t, l.Update(base, ratelimit.WithAttrs(ratelimit.Attrs(hdr))))
+	}
+	update("core", 100)
+	assert.Equal(t, 4990, l.State(base).Remaining)
+	update("graphql", 100)
+	assert.Equal(t, ratelimit.State{Limit: 5000, Remaining: 4900, Reset: reset}, l.State(base))
+}
+
+func TestRequestCost(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	l := NewBudgetLimiter(10, time.Hour)
+	c, err := New(WithBaseURL(s.URL), WithRateLimiter(l))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Get(context.Background(), "/", nil, WithCost(7))
+	assert.NoError(t, err)
+	_, err = c.Get(context.Background(), "/", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, l.State(time.Now()).Remaining)
+	_, err = c.Get(context.Background(), "/", nil, WithCost(20))
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+}
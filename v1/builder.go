@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A request builder produces a request which is bound to the provided
+// context. Building a request, including encoding its entity, is deferred
+// until it is about to be performed.
+type RequestBuilder func(context.Context) (*http.Request, error)
+
+// NewRequest creates a builder for a request with the provided method and URL
+// and an input entity, which is encoded using the client's content type and
+// sets the request's Content-Type. The input may be nil.
+func (c *Client) NewRequest(method, u string, input interface{}) RequestBuilder {
+	return func(cxt context.Context) (*http.Request, error) {
+		return c.newEntityRequest(cxt, method, u, input, nil)
+	}
+}
+
+// ExecBuilder builds a request and performs it as Exec does, attempting to
+// unmarshal the response into the provided entity.
+//
+// The request is not built if the context is already done. If the context is
+// canceled while the request is waiting or in flight, every resource held on
+// its behalf, including request and response bodies and any timers waiting on
+// pauses, rate limits, or retries, is released before this method returns.
+func (c *Client) ExecBuilder(cxt context.Context, b RequestBuilder, entity interface{}, opts ...Option) (*http.Response, error) {
+	if err := cxt.Err(); err != nil {
+		return nil, err
+	}
+	req, err := b(cxt)
+	if err != nil {
+		return nil, err
+	}
+	if req.Context() != cxt {
+		req = req.WithContext(cxt)
+	}
+	return c.Exec(req, entity, opts...)
+}
+
+// With derives a builder which applies the provided function to every request
+// it builds.
+func (b RequestBuilder) With(fn func(*http.Request)) RequestBuilder {
+	return func(cxt context.Context) (*http.Request, error) {
+		req, err := b(cxt)
+		if err != nil {
+			return nil, err
+		}
+		fn(req)
+		return req, nil
+	}
+}
+
+// Header derives a builder which sets the provided header
+func (b RequestBuilder) Header(key, val string) RequestBuilder {
+	return b.With(func(req *http.Request) {
+		req.Header.Set(key, val)
+	})
+}
+
+// IfMatch derives a builder which makes the request conditional on the
+// resource matching one of the provided entity tags. Tags which are not
+// quoted are quoted; "*" matches any current representation. A server
+// responds 412 Precondition Failed, which produces ErrPreconditionFailed, if
+// the condition is not met.
+func (b RequestBuilder) IfMatch(etags ...string) RequestBuilder {
+	return b.Header("If-Match", etagList(etags))
+}
+
+// IfNoneMatch derives a builder which makes the request conditional on the
+// resource not matching any of the provided entity tags. For GET and HEAD
+// requests, a server responds 304 Not Modified, which produces ErrNotModified,
+// if the condition is not met.
+func (b RequestBuilder) IfNoneMatch(etags ...string) RequestBuilder {
+	return b.Header("If-None-Match", etagList(etags))
+}
+
+// IfModifiedSince derives a builder which makes the request conditional on
+// the resource having been modified after the provided time.
+func (b RequestBuilder) IfModifiedSince(t time.Time) RequestBuilder {
+	return b.Header("If-Modified-Since", t.UTC().Format(http.TimeFormat))
+}
+
+// IfUnmodifiedSince derives a builder which makes the request conditional on
+// the resource not having been modified after the provided time.
+func (b RequestBuilder) IfUnmodifiedSince(t time.Time) RequestBuilder {
+	return b.Header("If-Unmodified-Since", t.UTC().Format(http.TimeFormat))
+}
+
+// Format a list of entity tags, quoting them as necessary
+func etagList(etags []string) string {
+	res := make([]string, len(etags))
+	for i, e := range etags {
+		res[i] = quoteETag(e)
+	}
+	return strings.Join(res, ", ")
+}
+
+func quoteETag(e string) string {
+	if e == "*" || strings.HasPrefix(e, `"`) || strings.HasPrefix(e, `W/"`) {
+		return e
+	}
+	return strconv.Quote(e)
+}
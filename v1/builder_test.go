@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionalBuilder(t *testing.T) {
+	c, err := New()
+	if !assert.NoError(t, err) {
+		return
+	}
+	when := time.Date(2015, 10, 21, 7, 28, 0, 0, time.FixedZone("PDT", -7*60*60))
+
+	req, err := c.NewRequest(http.MethodGet, "https://example.com/", nil).
+		IfNoneMatch("a", `"b"`, `W/"c"`).
+		IfMatch("*").
+		IfModifiedSince(when).
+		IfUnmodifiedSince(when)(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, `"a", "b", W/"c"`, req.Header.Get("If-None-Match"))
+		assert.Equal(t, "*", req.Header.Get("If-Match"))
+		assert.Equal(t, "Wed, 21 Oct 2015 14:28:00 GMT", req.Header.Get("If-Modified-Since"))
+		assert.Equal(t, "Wed, 21 Oct 2015 14:28:00 GMT", req.Header.Get("If-Unmodified-Since"))
+	}
+}
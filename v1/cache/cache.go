@@ -0,0 +1,66 @@
+// Package cache defines storage for cached responses
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("Not found")
+
+// A cached response entity
+type Entry struct {
+	ETag         string
+	LastModified string
+	ContentType  string
+	Header       http.Header
+	Data         []byte
+	Stored       time.Time
+}
+
+// A store persists cache entries by key
+type Store interface {
+	// Get returns the entry for a key, or ErrNotFound if there is none
+	Get(context.Context, string) (*Entry, error)
+	// Set stores the entry for a key, replacing any existing entry
+	Set(context.Context, string, *Entry) error
+	// Delete removes the entry for a key, if any
+	Delete(context.Context, string) error
+}
+
+// An in-memory store
+type Memory struct {
+	sync.Mutex
+	entries map[string]*Entry
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]*Entry)}
+}
+
+func (m *Memory) Get(cxt context.Context, key string) (*Entry, error) {
+	m.Lock()
+	defer m.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
+
+func (m *Memory) Set(cxt context.Context, key string, e *Entry) error {
+	m.Lock()
+	defer m.Unlock()
+	m.entries[key] = e
+	return nil
+}
+
+func (m *Memory) Delete(cxt context.Context, key string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.entries, key)
+	return nil
+}
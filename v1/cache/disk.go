@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/internal/fsutil"
+)
+
+const (
+	diskIndex       = "index.json"
+	diskSuffix      = ".body"
+	defaultDiskSize = 64 << 20
+)
+
+// An eviction policy determines which entries are removed first when a disk
+// store exceeds its maximum size
+type Eviction int
+
+const (
+	LRU Eviction = iota // least recently used
+	LFU                 // least frequently used, then least recently used
+)
+
+type DiskConfig struct {
+	MaxSize  int64
+	Eviction Eviction
+}
+
+func (c DiskConfig) WithOptions(opts []DiskOption) DiskConfig {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type DiskOption func(DiskConfig) DiskConfig
+
+// WithMaxSize sets the maximum total size, in bytes, of the bodies retained
+// by a disk store
+func WithMaxSize(n int64) DiskOption {
+	return func(c DiskConfig) DiskConfig {
+		c.MaxSize = n
+		return c
+	}
+}
+
+// WithEviction sets the policy by which a disk store evicts entries
+func WithEviction(e Eviction) DiskOption {
+	return func(c DiskConfig) DiskConfig {
+		c.Eviction = e
+		return c
+	}
+}
+
+// An indexed entry; everything but the body, which is stored separately
+type diskEntry struct {
+	Key          string      `json:"key"`
+	File         string      `json:"file"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	ContentType  string      `json:"content_type,omitempty"`
+	Header       http.Header `json:"header,omitempty"`
+	Stored       time.Time   `json:"stored"`
+	Size         int64       `json:"size"`
+	Used         time.Time   `json:"used"`
+	Hits         int64       `json:"hits"`
+}
+
+// A store which persists entries to a directory, so that they survive across
+// runs of a program. Bodies are stored in individual files and described by
+// an index. When the total size of the bodies exceeds the store's maximum,
+// entries are evicted according to its eviction policy.
+//
+// A disk store is safe for concurrent use. Files are replaced atomically, so
+// other processes sharing the directory never observe a partially-written
+// entry, however they may overwrite each other's index; the index should be
+// considered to belong to a single process at a time.
+type Disk struct {
+	sync.Mutex
+	dir     string
+	max     int64
+	evict   Eviction
+	size    int64
+	entries map[string]*diskEntry
+}
+
+// NewDisk creates a disk store in the provided directory, creating it if it
+// does not exist and loading its index if it does.
+func NewDisk(dir string, opts ...DiskOption) (*Disk, error) {
+	conf := DiskConfig{
+		MaxSize: defaultDiskSize,
+	}.WithOptions(opts)
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	d := &Disk{
+		dir:     dir,
+		max:     conf.MaxSize,
+		evict:   conf.Eviction,
+		entries: make(map[string]*diskEntry),
+	}
+	err = d.load()
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Size returns the total size, in bytes, of the bodies in the store
+func (d *Disk) Size() int64 {
+	d.Lock()
+	defer d.Unlock()
+	return d.size
+}
+
+func (d *Disk) Get(cxt context.Context, key string) (*Entry, error) {
+	d.Lock()
+	defer d.Unlock()
+	e, ok := d.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(d.dir, e.File))
+	if errors.Is(err, os.ErrNotExist) { // removed from underneath us
+		d.remove(e)
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	e.Used = time.Now()
+	e.Hits++
+	return &Entry{
+		ETag:         e.ETag,
+		LastModified: e.LastModified,
+		ContentType:  e.ContentType,
+		Header:       e.Header.Clone(),
+		Data:         data,
+		Stored:       e.Stored,
+	}, nil
+}
+
+func (d *Disk) Set(cxt context.Context, key string, v *Entry) error {
+	size := int64(len(v.Data))
+	if size > d.max {
+		return nil // too large to ever retain
+	}
+	sum := sha256.Sum256([]byte(key))
+	file := hex.EncodeToString(sum[:]) + diskSuffix
+	tmp, err := fsutil.WriteTemp(d.dir, v.Data)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	err = fsutil.Publish(tmp, filepath.Join(d.dir, file)) // the body and its index entry must change together
+	if err != nil {
+		return err
+	}
+	if e, ok := d.entries[key]; ok {
+		d.size -= e.Size
+	}
+	now := time.Now()
+	d.entries[key] = &diskEntry{
+		Key:          key,
+		File:         file,
+		ETag:         v.ETag,
+		LastModified: v.LastModified,
+		ContentType:  v.ContentType,
+		Header:       v.Header.Clone(),
+		Stored:       v.Stored,
+		Size:         size,
+		Used:         now,
+	}
+	d.size += size
+	d.evictTo(d.max, key)
+	return d.save()
+}
+
+func (d *Disk) Delete(cxt context.Context, key string) error {
+	d.Lock()
+	defer d.Unlock()
+	if e, ok := d.entries[key]; ok {
+		d.remove(e)
+		return d.save()
+	}
+	return nil
+}
+
+// Flush persists the index, which records usage that has occurred since the
+// store was last modified
+func (d *Disk) Flush() error {
+	d.Lock()
+	defer d.Unlock()
+	return d.save()
+}
+
+// Remove an entry and its body; the caller must hold the lock
+func (d *Disk) remove(e *diskEntry) {
+	delete(d.entries, e.Key)
+	d.size -= e.Size
+	os.Remove(filepath.Join(d.dir, e.File))
+}
+
+// Evict entries other than the one to keep, which has just been stored, until
+// the store is no larger than the provided size; the caller must hold the lock
+func (d *Disk) evictTo(max int64, keep string) {
+	if d.size <= max {
+		return
+	}
+	order := make([]*diskEntry, 0, len(d.entries))
+	for _, e := range d.entries {
+		if e.Key != keep {
+			order = append(order, e)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if d.evict == LFU && a.Hits != b.Hits {
+			return a.Hits < b.Hits
+		}
+		return a.Used.Before(b.Used)
+	})
+	for _, e := range order {
+		if d.size <= max {
+			break
+		}
+		d.remove(e)
+	}
+}
+
+func (d *Disk) load() error {
+	data, err := os.ReadFile(filepath.Join(d.dir, diskIndex))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var index []*diskEntry
+	err = json.Unmarshal(data, &index)
+	if err != nil {
+		return nil // a corrupt index is discarded
+	}
+	for _, e := range index {
+		if _, err := os.Stat(filepath.Join(d.dir, e.File)); err != nil {
+			continue
+		}
+		d.entries[e.Key] = e
+		d.size += e.Size
+	}
+	d.evictTo(d.max, "")
+	return nil
+}
+
+// Persist the index; the caller must hold the lock
+func (d *Disk) save() error {
+	index := make([]*diskEntry, 0, len(d.entries))
+	for _, e := range d.entries {
+		index = append(index, e)
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(filepath.Join(d.dir, diskIndex), data)
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisk(t *testing.T) {
+	cxt := context.Background()
+	dir := t.TempDir()
+
+	entry := func(etag string, n int) *Entry {
+		return &Entry{
+			ETag:        etag,
+			ContentType: "text/plain",
+			Header:      http.Header{"Etag": {etag}},
+			Data:        []byte(strings.Repeat("x", n)),
+			Stored:      time.Now().UTC().Truncate(time.Second),
+		}
+	}
+
+	tests := []struct {
+		Name     string
+		Eviction Eviction
+		Retained []string
+		Evicted  []string
+	}{
+		{"LRU", LRU, []string{"a", "c"}, []string{"b"}},
+		{"LFU", LFU, []string{"b", "c"}, []string{"a"}},
+	}
+	for _, e := range tests {
+		t.Run(e.Name, func(t *testing.T) {
+			d, err := NewDisk(dir+"/"+e.Name, WithMaxSize(25), WithEviction(e.Eviction))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.NoError(t, d.Set(cxt, "a", entry(`"a"`, 10)))
+			assert.NoError(t, d.Set(cxt, "b", entry(`"b"`, 10)))
+			for i := 0; i < 2; i++ {
+				_, err = d.Get(cxt, "b") // b is used more frequently...
+				assert.NoError(t, err)
+			}
+			time.Sleep(time.Millisecond)
+			_, err = d.Get(cxt, "a") // ...but a is used more recently
+			assert.NoError(t, err)
+			assert.NoError(t, d.Set(cxt, "c", entry(`"c"`, 10)))
+			assert.Equal(t, int64(20), d.Size())
+
+			r, err := NewDisk(dir+"/"+e.Name, WithMaxSize(25)) // reload from the index
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, k := range e.Retained {
+				v, err := r.Get(cxt, k)
+				if assert.NoError(t, err, k) {
+					assert.Equal(t, entry(`"`+k+`"`, 10), v)
+				}
+			}
+			for _, k := range e.Evicted {
+				_, err := r.Get(cxt, k)
+				assert.ErrorIs(t, err, ErrNotFound, k)
+			}
+
+			assert.NoError(t, r.Delete(cxt, e.Retained[0]))
+			_, err = r.Get(cxt, e.Retained[0])
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.Equal(t, int64(10), r.Size())
+		})
+	}
+}
+
+func TestDiskConcurrentSet(t *testing.T) {
+	cxt := context.Background()
+	d, err := NewDisk(t.TempDir())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			assert.NoError(t, d.Set(cxt, "k", &Entry{ETag: strconv.Itoa(n), Data: []byte(strings.Repeat("x", n))}))
+		}(i)
+	}
+	wg.Wait()
+
+	v, err := d.Get(cxt, "k")
+	if assert.NoError(t, err) {
+		assert.Equal(t, v.ETag, strconv.Itoa(len(v.Data)), "the body must be the one which was indexed")
+		assert.Equal(t, int64(len(v.Data)), d.Size())
+	}
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/cache"
+
+	"github.com/bww/go-util/v1/ext"
+)
+
+// The header set on responses which are produced from cached entries rather
+// than transferred from the server
+const CacheHeader = "X-From-Cache"
+
+// WithCache enables transparent conditional GET requests backed by the
+// provided store. Successful responses which carry an ETag or Last-Modified
+// header are stored; subsequent requests for the same URL are made
+// conditionally and, when the server responds 304 Not Modified, the caller's
+// entity is populated from the cached entry and a response reconstructed
+// from it is returned with the CacheHeader set.
+//
+// Entries are keyed by URL, so a store must not be shared between clients
+// which use different credentials. A client derived with a different
+// authorizer, by WithAuthorizer or Clone, keeps its entries apart from those
+// of the receiver, even though they use the same store. Requests which set
+// their own conditional
+// headers, or which are made with WithRawBody, bypass the cache. This may be
+// used as a client or per-request option.
+func WithCache(store cache.Store) Option {
+	return func(c Config) Config {
+		c.Cache = store
+		return c
+	}
+}
+
+// WithStaleWhileRevalidate allows a cached response to be served for up to
+// the provided duration after it becomes stale, while it is revalidated in the
+// background. A response is stale once it is older than the max-age in its
+// Cache-Control header, or immediately if it has none. This has no effect
+// unless a cache is in use and may be used as a client or per-request option.
+func WithStaleWhileRevalidate(d time.Duration) Option {
+	return func(c Config) Config {
+		c.StaleWhileRevalidate = d
+		return c
+	}
+}
+
+// WithStaleIfError allows a cached response to be served for up to the
+// provided duration after it becomes stale when revalidating it fails with a
+// 5xx status. This has no effect unless a cache is in use and may be used as a
+// client or per-request option.
+func WithStaleIfError(d time.Duration) Option {
+	return func(c Config) Config {
+		c.StaleIfError = d
+		return c
+	}
+}
+
+// Warnings set on responses which are served stale
+const (
+	warnStale            = `110 - "Response is Stale"`
+	warnRevalidateFailed = `111 - "Revalidation Failed"`
+)
+
+// Determine the cache store to use for a request, if any
+func (c *Client) cacheFor(req *http.Request, conf Config) cache.Store {
+	if req.Method != http.MethodGet || conf.RawBody {
+		return nil
+	}
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return nil // the caller is managing conditional requests itself
+	}
+	if conf.Cache != nil {
+		return conf.Cache
+	}
+	return c.cache
+}
+
+// Round-trip a request, using the cache if one is in effect for it
+func (c *Client) roundTripCached(req *http.Request, conf Config) (*http.Response, error) {
+	store := c.cacheFor(req, conf)
+	if store == nil || c.dry || conf.DryRun {
+		return c.roundTrip(req, conf)
+	}
+
+	cxt := req.Context()
+	key := c.cacheKey(req)
+	ent, err := store.Get(cxt, key)
+	if errors.Is(err, cache.ErrNotFound) {
+		ent = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var age, fresh time.Duration
+	if ent != nil {
+		age, fresh = time.Since(ent.Stored), maxAge(ent.Header)
+		if swr := ext.Coalesce(conf.StaleWhileRevalidate, c.swr); swr > 0 && age < fresh+swr {
+			if age < fresh {
+				return cachedResponse(req, ent, ""), nil
+			}
+			c.revalidate(req, conf, store, key, ent)
+			return cachedResponse(req, ent, warnStale), nil
+		}
+	}
+
+	conditional(req, ent)
+	rsp, err := c.roundTrip(req, conf)
+	switch {
+	case ent != nil && errors.Is(err, ErrNotModified):
+		c.touch(cxt, store, key, req, ent)
+		return cachedResponse(req, ent, ""), nil
+	case ent != nil && isServerError(err):
+		if sie := ext.Coalesce(conf.StaleIfError, c.sie); sie > 0 && age < fresh+sie {
+			return cachedResponse(req, ent, warnRevalidateFailed), nil
+		}
+		return nil, err
+	case err != nil:
+		return nil, err
+	}
+	if err := c.storeResponse(cxt, store, key, req, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// Revalidate a cached entry in the background. Only one revalidation is
+// performed for an entry at a time.
+func (c *Client) revalidate(req *http.Request, conf Config, store cache.Store, key string, ent *cache.Entry) {
+	if !c.refresh.begin(key) {
+		return
+	}
+	cxt := context.WithoutCancel(req.Context())
+	breq := req.Clone(cxt)
+	go func() {
+		defer c.refresh.end(key)
+		conditional(breq, ent)
+		rsp, err := c.roundTrip(breq, conf)
+		if errors.Is(err, ErrNotModified) {
+			c.touch(cxt, store, key, breq, ent)
+		} else if err != nil {
+			if c.isVerbose(breq) {
+				fmt.Fprintf(c.debug.Writer, "api: %v %v: could not revalidate cached response: %v\n", breq.Method, c.redact.url(breq.URL), err)
+			}
+		} else {
+			c.storeResponse(cxt, store, key, breq, rsp)
+			c.metrics.get().drain(breq.URL.Host, rsp)
+		}
+	}()
+}
+
+// The set of cache entries which are being revalidated
+type refreshing struct {
+	sync.Mutex
+	keys map[string]struct{}
+}
+
+func newRefreshing() *refreshing {
+	return &refreshing{keys: make(map[string]struct{})}
+}
+
+func (r *refreshing) begin(key string) bool {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.keys[key]; ok {
+		return false
+	}
+	r.keys[key] = struct{}{}
+	return true
+}
+
+func (r *refreshing) end(key string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.keys, key)
+}
+
+// Make a request conditional upon a cached entry, if there is one
+func conditional(req *http.Request, ent *cache.Entry) {
+	if ent == nil {
+		return
+	}
+	if ent.ETag != "" {
+		req.Header.Set("If-None-Match", ent.ETag)
+	}
+	if ent.LastModified != "" {
+		req.Header.Set("If-Modified-Since", ent.LastModified)
+	}
+}
+
+// Update the time a cached entry was stored after it has been revalidated
+func (c *Client) touch(cxt context.Context, store cache.Store, key string, req *http.Request, ent *cache.Entry) {
+	upd := *ent
+	upd.Stored = time.Now()
+	if err := store.Set(cxt, key, &upd); err != nil && c.isVerbose(req) {
+		fmt.Fprintf(c.debug.Writer, "api: %v %v: could not update cached response: %v\n", req.Method, c.redact.url(req.URL), err)
+	}
+}
+
+// Determine the freshness lifetime of a cached response from its max-age
+func maxAge(hdr http.Header) time.Duration {
+	for _, v := range hdr.Values("Cache-Control") {
+		for _, e := range strings.Split(v, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(e), "=")
+			switch strings.ToLower(k) {
+			case "no-cache", "no-store":
+				return 0
+			case "max-age":
+				n, err := strconv.Atoi(strings.Trim(v, `"`))
+				if err == nil && n > 0 {
+					return time.Duration(n) * time.Second
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func isServerError(err error) bool {
+	var apierr *Error
+	return errors.As(err, &apierr) && apierr.Status >= 500
+}
+
+// Produce the cache key for a request, which is its absolute URL qualified by
+// the scope of the client's credentials, if it has one
+func (c *Client) cacheKey(req *http.Request) string {
+	key := c.resolve(req.URL).String()
+	if c.conf.cacheScope != "" {
+		key = c.conf.cacheScope + " " + key
+	}
+	return key
+}
+
+// Produce a scope which keeps the cache entries of a client apart from those
+// of every other client. It is random rather than sequential, so that entries
+// persisted by a previous process are never attributed to another client.
+func newCacheScope() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Determine whether two authorizers are the same one. Authorizers which are
+// not comparable are never the same, since they cannot be identified.
+func sameAuthorizer(a, b Authorizer) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if !reflect.ValueOf(a).Comparable() || !reflect.ValueOf(b).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// Store a cacheable response. The response body is read and replaced so that
+// it may still be consumed by the caller.
+func (c *Client) storeResponse(cxt context.Context, store cache.Store, key string, req *http.Request, rsp *http.Response) error {
+	if rsp.StatusCode != http.StatusOK {
+		return nil
+	}
+	etag, modified := rsp.Header.Get("ETag"), rsp.Header.Get("Last-Modified")
+	if etag == "" && modified == "" {
+		return nil
+	}
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	rsp.Body = io.NopCloser(bytes.NewReader(data))
+	err = store.Set(cxt, key, &cache.Entry{
+		ETag:         etag,
+		LastModified: modified,
+		ContentType:  rsp.Header.Get("Content-Type"),
+		Header:       rsp.Header.Clone(),
+		Data:         data,
+		Stored:       time.Now(),
+	})
+	if err != nil && c.isVerbose(req) { // a failure to cache does not fail the request
+		fmt.Fprintf(c.debug.Writer, "api: %v %v: could not store cached response: %v\n", req.Method, c.redact.url(req.URL), err)
+	}
+	return nil
+}
+
+// Reconstruct a response from a cached entry, with a warning if it is stale
+func cachedResponse(req *http.Request, ent *cache.Entry, warn string) *http.Response {
+	hdr := ent.Header.Clone()
+	if hdr == nil {
+		hdr = make(http.Header)
+	}
+	hdr.Set("Content-Type", ent.ContentType)
+	hdr.Set(CacheHeader, "1")
+	if warn != "" {
+		hdr.Set("Warning", warn)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusOK, http.StatusText(http.StatusOK)),
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        hdr,
+		Body:          io.NopCloser(bytes.NewReader(ent.Data)),
+		ContentLength: int64(len(ent.Data)),
+		Request:       req,
+	}
+}
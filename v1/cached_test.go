@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/cache"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleCache(t *testing.T) {
+	var hits, version, failing int64
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		if atomic.LoadInt64(&failing) != 0 {
+			http.Error(rsp, "Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		etag := fmt.Sprintf(`"v%d"`, atomic.LoadInt64(&version))
+		rsp.Header().Set("ETag", etag)
+		if req.Header.Get("If-None-Match") == etag {
+			rsp.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rsp.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(rsp, "%q", etag)
+	}))
+	defer svr.Close()
+
+	cxt := context.Background()
+	store := cache.NewMemory()
+	api, err := New(WithBaseURL(svr.URL+"/"), WithCache(store), WithStaleWhileRevalidate(time.Hour))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var res string
+	rsp, err := api.Get(cxt, "/resource", &res)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `"v0"`, res)
+		assert.Equal(t, "", rsp.Header.Get(CacheHeader))
+	}
+
+	atomic.StoreInt64(&version, 1)
+	rsp, err = api.Get(cxt, "/resource", &res) // served stale; revalidated in the background
+	if assert.NoError(t, err) {
+		assert.Equal(t, `"v0"`, res)
+		assert.Equal(t, "1", rsp.Header.Get(CacheHeader))
+		assert.Equal(t, warnStale, rsp.Header.Get("Warning"))
+	}
+	assert.Eventually(t, func() bool {
+		ent, err := store.Get(cxt, svr.URL+"/resource")
+		return err == nil && ent.ETag == `"v1"`
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&hits))
+
+	rsp, err = api.Get(cxt, "/resource", &res)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `"v1"`, res)
+	}
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&hits) == 3 }, time.Second, time.Millisecond)
+
+	atomic.StoreInt64(&failing, 1)
+	api = errorsMust(api.Clone(WithStaleWhileRevalidate(0)))
+	_, err = api.Get(cxt, "/resource", &res)
+	assert.True(t, isServerError(err), "expected a server error, got: %v", err)
+
+	rsp, err = api.Get(cxt, "/resource", &res, WithStaleIfError(time.Hour))
+	if assert.NoError(t, err) {
+		assert.Equal(t, `"v1"`, res)
+		assert.Equal(t, warnRevalidateFailed, rsp.Header.Get("Warning"))
+	}
+}
+
+func TestCacheCredentials(t *testing.T) {
+	var hits int64
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		rsp.Header().Set("ETag", `"v0"`)
+		rsp.Header().Set("Cache-Control", "max-age=3600")
+		rsp.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(rsp, "%q", req.Header.Get("Authorization"))
+	}))
+	defer svr.Close()
+
+	cxt := context.Background()
+	parent, err := New(WithBaseURL(svr.URL+"/"), WithCache(cache.NewMemory()), WithStaleWhileRevalidate(time.Hour))
+	if !assert.NoError(t, err) {
+		return
+	}
+	tenants := []*Client{
+		parent.WithAuthorizer(NewBearerAuthorizer("a")),
+		parent.WithAuthorizer(NewBearerAuthorizer("b")),
+		errorsMust(parent.Clone(WithAuthorizer(NewBearerAuthorizer("c")))),
+	}
+	for i := 0; i < 2; i++ {
+		for j, e := range tenants {
+			var res string
+			_, err := e.Get(cxt, "/resource", &res)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "Bearer "+string(rune('a'+j)), res, "each tenant must see its own responses")
+			}
+		}
+	}
+	assert.Equal(t, int64(3), atomic.LoadInt64(&hits), "each tenant's fresh response is served from the cache")
+}
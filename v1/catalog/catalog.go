@@ -0,0 +1,148 @@
+// Package catalog describes the endpoints of an API as a set of named path
+// templates, so that the same definitions can be used to build requests with
+// a client and to serve test doubles of the API.
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrDuplicateEndpoint = errors.New("Duplicate endpoint")
+	ErrMissingVariable   = errors.New("Missing path variable")
+	ErrInvalidTemplate   = errors.New("Invalid path template")
+)
+
+// Path variables, by name
+type Vars map[string]string
+
+// An endpoint is an operation identified by a method and a path template, in
+// which variables are enclosed in braces, e.g., "/users/{id}". A variable
+// matches a single path segment.
+type Endpoint struct {
+	Name   string
+	Method string
+	Path   string
+}
+
+// URL expands the endpoint's path template with the provided variables, which
+// are escaped as path segments. The result is relative and is resolved
+// against a client's base URL in the usual way.
+func (e Endpoint) URL(vars Vars) (string, error) {
+	parts, err := split(e.Path)
+	if err != nil {
+		return "", err
+	}
+	for i, p := range parts {
+		if n, ok := variable(p); ok {
+			v, ok := vars[n]
+			if !ok {
+				return "", fmt.Errorf("%w: %s in %s", ErrMissingVariable, n, e.Path)
+			}
+			parts[i] = url.PathEscape(v)
+		}
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// Match determines whether an escaped request path, as produced by
+// url.URL.EscapedPath, matches the endpoint's template and if so, produces the
+// variables it contains.
+func (e Endpoint) Match(path string) (Vars, bool) {
+	tmpl, err := split(e.Path)
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) != len(tmpl) {
+		return nil, false
+	}
+	vars := make(Vars)
+	for i, p := range tmpl {
+		if n, ok := variable(p); ok {
+			v, err := url.PathUnescape(parts[i])
+			if err != nil || v == "" {
+				return nil, false
+			}
+			vars[n] = v
+		} else if p != parts[i] {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+func split(tmpl string) ([]string, error) {
+	parts := strings.Split(tmpl, "/")
+	for _, p := range parts {
+		if _, ok := variable(p); !ok && strings.ContainsAny(p, "{}") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTemplate, tmpl)
+		}
+	}
+	return parts, nil
+}
+
+func variable(p string) (string, bool) {
+	if len(p) > 2 && p[0] == '{' && p[len(p)-1] == '}' {
+		return p[1 : len(p)-1], true
+	}
+	return "", false
+}
+
+// A catalog is a set of endpoints, identified by name
+type Catalog struct {
+	sync.RWMutex
+	endpoints []Endpoint
+	names     map[string]int
+}
+
+// New creates a catalog with the provided endpoints. It panics if endpoints
+// are invalid or share a name; use Register to handle these errors instead.
+func New(eps ...Endpoint) *Catalog {
+	c := &Catalog{names: make(map[string]int)}
+	for _, e := range eps {
+		if err := c.Register(e); err != nil {
+			panic(err)
+		}
+	}
+	return c
+}
+
+// Register adds an endpoint to the catalog
+func (c *Catalog) Register(e Endpoint) error {
+	if _, err := split(e.Path); err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.names[e.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateEndpoint, e.Name)
+	}
+	e.Method = strings.ToUpper(e.Method)
+	c.names[e.Name] = len(c.endpoints)
+	c.endpoints = append(c.endpoints, e)
+	return nil
+}
+
+// Lookup returns the endpoint with the provided name
+func (c *Catalog) Lookup(name string) (Endpoint, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	i, ok := c.names[name]
+	if !ok {
+		return Endpoint{}, false
+	}
+	return c.endpoints[i], true
+}
+
+// Endpoints returns every endpoint in the catalog in the order they were
+// registered
+func (c *Catalog) Endpoints() []Endpoint {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]Endpoint(nil), c.endpoints...)
+}
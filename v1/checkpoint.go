@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/bww/go-apiclient/v1/internal/fsutil"
+)
+
+// A checkpointer persists the progress of a paginated collection, so that
+// collecting it may resume after an interruption. It may be backed by anything
+// which retains a value across runs of a program, such as a file or a row in
+// a database table.
+type Checkpointer interface {
+	// Load returns the URL of the page to resume from, or the empty string if
+	// the collection should be collected from its first page
+	Load(context.Context) (string, error)
+	// Save records that every page before the one at the provided URL has been
+	// completed. Once the collection has been completed, the empty string is
+	// saved, so that it is collected from its first page the next time.
+	Save(context.Context, string) error
+}
+
+// A checkpointer which persists its checkpoint to a file
+type FileCheckpointer struct {
+	path string
+}
+
+// NewFileCheckpointer creates a checkpointer which persists its checkpoint to
+// a file at the provided path. The file is removed once the collection has
+// been completed.
+func NewFileCheckpointer(path string) *FileCheckpointer {
+	return &FileCheckpointer{path: path}
+}
+
+func (c *FileCheckpointer) Load(cxt context.Context) (string, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Save replaces the checkpoint atomically, so that an interruption never
+// leaves it partially written
+func (c *FileCheckpointer) Save(cxt context.Context, u string) error {
+	if u == "" {
+		err := os.Remove(c.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return fsutil.WriteFile(c.path, []byte(u+"\n"))
+}
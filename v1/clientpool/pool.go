@@ -0,0 +1,187 @@
+// Package clientpool maintains a bounded set of clients keyed by tenant, for
+// multi-tenant services which need many credentialed clients that share the
+// same underlying transport.
+package clientpool
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+
+	api "github.com/bww/go-apiclient/v1"
+
+	"github.com/bww/go-metrics/v1"
+)
+
+const defaultSize = 256
+
+// A factory creates a client for a tenant. Typically, a factory derives a
+// client from a shared parent client, e.g.:
+//
+//	pool.Get(tenant, func() (*api.Client, error) {
+//	  return parent.WithAuthorizer(authorizerFor(tenant)), nil
+//	})
+type Factory func() (*api.Client, error)
+
+type Config struct {
+	Name    string
+	Size    int
+	Metrics api.MetricsSink
+}
+
+func (c Config) WithOptions(opts []Option) Config {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type Option func(Config) Config
+
+// WithName sets the name of the pool, which is used to tag its metrics
+func WithName(n string) Option {
+	return func(c Config) Config {
+		c.Name = n
+		return c
+	}
+}
+
+// WithSize sets the maximum number of clients retained by the pool
+func WithSize(n int) Option {
+	return func(c Config) Config {
+		c.Size = n
+		return c
+	}
+}
+
+// WithMetrics sets the sink with which the pool's metrics are registered
+func WithMetrics(m api.MetricsSink) Option {
+	return func(c Config) Config {
+		c.Metrics = m
+		return c
+	}
+}
+
+type entry struct {
+	key    string
+	client *api.Client
+}
+
+// A pool of clients with least-recently-used eviction
+type Pool struct {
+	sync.Mutex
+	name    string
+	size    int
+	items   map[string]*list.Element
+	order   *list.List
+	metrics *poolMetrics
+}
+
+func New(opts ...Option) *Pool {
+	conf := Config{
+		Size: defaultSize,
+	}.WithOptions(opts)
+	if conf.Size < 1 {
+		conf.Size = 1
+	}
+	return &Pool{
+		name:    conf.Name,
+		size:    conf.Size,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+		metrics: metricsFor(conf.Metrics),
+	}
+}
+
+// Get returns the client for a key, creating it with the provided factory if
+// it is not already in the pool.
+func (p *Pool) Get(key string, f Factory) (*api.Client, error) {
+	if c, ok := p.lookup(key); ok {
+		p.metrics.lookup.With(metrics.Tags{"pool": p.name, "result": "hit"}).Inc()
+		return c, nil
+	}
+	p.metrics.lookup.With(metrics.Tags{"pool": p.name, "result": "miss"}).Inc()
+
+	c, err := f() // create outside the lock; factories may be slow
+	if err != nil {
+		return nil, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if e, ok := p.items[key]; ok { // someone else created it first; use theirs
+		p.order.MoveToFront(e)
+		return e.Value.(*entry).client, nil
+	}
+	p.items[key] = p.order.PushFront(&entry{key: key, client: c})
+	for p.order.Len() > p.size {
+		e := p.order.Back()
+		p.order.Remove(e)
+		delete(p.items, e.Value.(*entry).key)
+		p.metrics.evictions.With(metrics.Tags{"pool": p.name}).Inc()
+	}
+	return c, nil
+}
+
+func (p *Pool) lookup(key string) (*api.Client, bool) {
+	p.Lock()
+	defer p.Unlock()
+	e, ok := p.items[key]
+	if !ok {
+		return nil, false
+	}
+	p.order.MoveToFront(e)
+	return e.Value.(*entry).client, true
+}
+
+// Remove evicts the client for a key, if any, for example, when a tenant's
+// credentials change.
+func (p *Pool) Remove(key string) {
+	p.Lock()
+	defer p.Unlock()
+	if e, ok := p.items[key]; ok {
+		p.order.Remove(e)
+		delete(p.items, key)
+	}
+}
+
+// Len returns the number of clients in the pool
+func (p *Pool) Len() int {
+	p.Lock()
+	defer p.Unlock()
+	return p.order.Len()
+}
+
+type poolMetrics struct {
+	lookup    metrics.CounterVec
+	evictions metrics.CounterVec
+}
+
+var (
+	metricsLock  sync.Mutex
+	metricsCache = map[api.MetricsSink]*poolMetrics{}
+)
+
+func metricsFor(r api.MetricsSink) *poolMetrics {
+	if r == nil {
+		r = api.GlobalMetrics
+	}
+	if !reflect.ValueOf(r).Comparable() {
+		return newPoolMetrics(r) // cannot be cached; see api.MetricsSink
+	}
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	if m, ok := metricsCache[r]; ok {
+		return m
+	}
+	m := newPoolMetrics(r)
+	metricsCache[r] = m
+	return m
+}
+
+func newPoolMetrics(r api.MetricsSink) *poolMetrics {
+	return &poolMetrics{
+		lookup:    r.RegisterCounterVec("rest_client_pool_lookup", "Client looked up in a pool", []string{"pool", "result"}),
+		evictions: r.RegisterCounterVec("rest_client_pool_eviction", "Client evicted from a pool", []string{"pool"}),
+	}
+}
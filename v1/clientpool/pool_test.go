@@ -0,0 +1,45 @@
+package clientpool
+
+import (
+	"testing"
+
+	api "github.com/bww/go-apiclient/v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	parent, err := api.New(api.WithMetrics(api.NoMetrics))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var created int
+	factory := func(k string) Factory {
+		return func() (*api.Client, error) {
+			created++
+			return parent.WithHeader("X-Tenant", k), nil
+		}
+	}
+
+	pool := New(WithSize(2), WithMetrics(api.NoMetrics))
+	a, err := pool.Get("a", factory("a"))
+	assert.NoError(t, err)
+	b, err := pool.Get("b", factory("b"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, created)
+
+	x, err := pool.Get("a", factory("a"))
+	assert.NoError(t, err)
+	assert.Same(t, a, x)
+	assert.Equal(t, 2, created)
+
+	_, err = pool.Get("c", factory("c")) // evicts b, which is least recently used
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pool.Len())
+
+	y, err := pool.Get("b", factory("b"))
+	assert.NoError(t, err)
+	assert.NotSame(t, b, y)
+	assert.Equal(t, 4, created)
+}
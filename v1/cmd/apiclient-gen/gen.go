@@ -0,0 +1,827 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const apiPackage = "github.com/bww/go-apiclient/v1"
+
+// Query parameters which, by convention, select a page of results
+var pageParams = map[string]struct{}{
+	"page":           {},
+	"page_token":     {},
+	"pagetoken":      {},
+	"cursor":         {},
+	"after":          {},
+	"offset":         {},
+	"starting_after": {},
+}
+
+// Identifiers used by generated methods which parameters must not shadow
+var reserved = map[string]struct{}{
+	"c": {}, "cxt": {}, "params": {}, "body": {}, "opts": {}, "input": {},
+	"u": {}, "req": {}, "res": {}, "rsp": {}, "err": {},
+	"api": {}, "context": {}, "fmt": {}, "http": {}, "url": {}, "time": {}, "json": {}, "io": {},
+}
+
+type generator struct {
+	doc      *Document
+	pkg      string
+	imports  map[string]struct{}
+	names    map[string]struct{}
+	declared map[string]struct{}
+	structs  map[string]struct{}
+	inline   map[*Schema]string
+	decls    bytes.Buffer
+	methods  bytes.Buffer
+}
+
+// Generate the source for a client package from a document
+func Generate(doc *Document, pkg string) ([]byte, error) {
+	g := &generator{
+		doc:      doc,
+		pkg:      pkg,
+		imports:  map[string]struct{}{apiPackage: {}},
+		names:    map[string]struct{}{"Client": {}, "New": {}, "DefaultBaseURL": {}},
+		declared: make(map[string]struct{}),
+		structs:  make(map[string]struct{}),
+		inline:   make(map[*Schema]string),
+	}
+
+	schemas := sortedKeys(doc.Components.Schemas)
+	for _, e := range schemas { // reserve component names before any inline types are named
+		g.names[exported(e)] = struct{}{}
+	}
+	for _, e := range schemas {
+		err := g.declare(exported(e), doc.Components.Schemas[e])
+		if err != nil {
+			return nil, fmt.Errorf("Schema %s: %w", e, err)
+		}
+	}
+	for _, p := range sortedKeys(doc.Paths) {
+		item := doc.Paths[p]
+		for _, m := range item.operations() {
+			err := g.operation(p, m.name, item, m.op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", m.name, p, err)
+			}
+		}
+	}
+
+	b := &bytes.Buffer{}
+	fmt.Fprintln(b, "// Code generated by apiclient-gen. DO NOT EDIT.")
+	fmt.Fprintln(b)
+	if t := strings.TrimSpace(doc.Info.Title + " " + doc.Info.Version); t != "" {
+		fmt.Fprintf(b, "// Package %s is a client for %s\n", pkg, t)
+	}
+	fmt.Fprintf(b, "package %s\n\n", pkg)
+	var std, ext []string
+	for _, e := range sortedKeys(g.imports) {
+		if strings.Contains(strings.SplitN(e, "/", 2)[0], ".") {
+			ext = append(ext, e)
+		} else {
+			std = append(std, e)
+		}
+	}
+	fmt.Fprintln(b, "import (")
+	for _, e := range std {
+		fmt.Fprintf(b, "\t%q\n", e)
+	}
+	fmt.Fprintln(b)
+	for _, e := range ext {
+		if e == apiPackage {
+			fmt.Fprintf(b, "\tapi %q\n", e)
+		} else {
+			fmt.Fprintf(b, "\t%q\n", e)
+		}
+	}
+	fmt.Fprintln(b, ")")
+	fmt.Fprintln(b)
+	server := defaultServer(doc)
+	if server != "" {
+		fmt.Fprintln(b, "// DefaultBaseURL is the first server described by the API")
+		fmt.Fprintf(b, "const DefaultBaseURL = %q\n\n", server)
+	}
+	fmt.Fprintln(b, "// Client performs the operations described by the API")
+	fmt.Fprintln(b, "type Client struct {\n\t*api.Client\n}")
+	fmt.Fprintln(b)
+	fmt.Fprintln(b, "// New creates a client for the API from an underlying client. Operation paths")
+	if server != "" {
+		fmt.Fprintln(b, "// are joined to the base URL of the underlying client or, if it has none, to")
+		fmt.Fprintln(b, "// DefaultBaseURL.")
+		fmt.Fprintln(b, "func New(c *api.Client) (*Client, error) {")
+		fmt.Fprintln(b, "\topts := []api.Option{api.WithURLResolution(api.JoinPaths)}")
+		fmt.Fprintln(b, "\tif c.Base() == nil {\n\t\topts = append(opts, api.WithBaseURL(DefaultBaseURL))\n\t}")
+		fmt.Fprintln(b, "\td, err := c.Clone(opts...)")
+	} else {
+		fmt.Fprintln(b, "// are joined to the base URL of the underlying client.")
+		fmt.Fprintln(b, "func New(c *api.Client) (*Client, error) {")
+		fmt.Fprintln(b, "\td, err := c.Clone(api.WithURLResolution(api.JoinPaths))")
+	}
+	fmt.Fprintln(b, "\tif err != nil {\n\t\treturn nil, err\n\t}")
+	fmt.Fprintln(b, "\treturn &Client{d}, nil")
+	fmt.Fprintln(b, "}")
+	b.Write(g.decls.Bytes())
+	b.Write(g.methods.Bytes())
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("Could not format generated source: %w", err)
+	}
+	return src, nil
+}
+
+// Produce the URL of the first server described by a document, if it is one
+// which may be used as a base URL: it must be absolute and must not have any
+// variables to substitute.
+func defaultServer(doc *Document) string {
+	if len(doc.Servers) == 0 {
+		return ""
+	}
+	u, err := url.Parse(doc.Servers[0].URL)
+	if err != nil || !u.IsAbs() || strings.Contains(doc.Servers[0].URL, "{") {
+		return ""
+	}
+	return doc.Servers[0].URL
+}
+
+// Produce a unique identifier derived from the provided name
+func (g *generator) unique(name string) string {
+	res := name
+	for i := 2; ; i++ {
+		if _, ok := g.names[res]; !ok {
+			break
+		}
+		res = name + strconv.Itoa(i)
+	}
+	g.names[res] = struct{}{}
+	return res
+}
+
+func (g *generator) use(pkg string) {
+	g.imports[pkg] = struct{}{}
+}
+
+// Determine if a schema is described as a struct
+func (g *generator) isStruct(s *Schema) bool {
+	s, err := g.doc.schema(s)
+	if err != nil || s == nil {
+		return false
+	}
+	return len(s.Properties) > 0 || len(s.AllOf) > 0
+}
+
+// Produce the Go type for a schema. Inline schemas which require a named
+// type are declared using the provided name.
+func (g *generator) goType(s *Schema, name string) (string, error) {
+	if s == nil {
+		return "interface{}", nil
+	}
+	if s.Ref != "" {
+		n := refName(s.Ref)
+		if _, ok := g.doc.Components.Schemas[n]; !ok {
+			return "", fmt.Errorf("Unresolved reference: %s", s.Ref)
+		}
+		return exported(n), nil
+	}
+	if len(s.Properties) > 0 || len(s.AllOf) > 0 {
+		if n, ok := g.inline[s]; ok { // an inline schema reached more than once, as through allOf
+			return n, nil
+		}
+		name = g.unique(name)
+		g.inline[s] = name
+		return name, g.declare(name, s)
+	}
+	if len(s.OneOf) > 0 || len(s.AnyOf) > 0 {
+		g.use("encoding/json")
+		return "json.RawMessage", nil
+	}
+	switch s.Type.primary() {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			g.use("time")
+			return "time.Time", nil
+		case "byte":
+			return "[]byte", nil
+		default:
+			return "string", nil
+		}
+	case "integer":
+		if s.Format == "int32" {
+			return "int32", nil
+		}
+		return "int64", nil
+	case "number":
+		if s.Format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		t, err := g.goType(s.Items, name+"Item")
+		if err != nil {
+			return "", err
+		}
+		return "[]" + t, nil
+	case "object":
+		if v, ok := s.additional(); ok {
+			t, err := g.goType(v, name+"Value")
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + t, nil
+		}
+		return "map[string]interface{}", nil
+	default:
+		return "interface{}", nil
+	}
+}
+
+// Declare a named type for a schema
+func (g *generator) declare(name string, s *Schema) error {
+	if _, ok := g.declared[name]; ok {
+		return nil
+	}
+	g.declared[name] = struct{}{}
+
+	b := &bytes.Buffer{}
+	fmt.Fprintln(b)
+	comment(b, "", s.Description)
+	switch {
+	case s.Ref != "":
+		t, err := g.goType(s, name)
+		if err != nil {
+			return err
+		}
+		if g.isStruct(s) {
+			g.structs[name] = struct{}{}
+		}
+		fmt.Fprintf(b, "type %s = %s\n", name, t)
+
+	case len(s.Properties) > 0 || len(s.AllOf) > 0:
+		fields, err := g.fields(name, s)
+		if err != nil {
+			return err
+		}
+		g.structs[name] = struct{}{}
+		fmt.Fprintf(b, "type %s struct {\n", name)
+		b.WriteString(fields)
+		fmt.Fprintln(b, "}")
+
+	case s.Type.primary() == "string" && len(s.Enum) > 0:
+		fmt.Fprintf(b, "type %s string\n\n", name)
+		fmt.Fprintln(b, "const (")
+		for _, e := range s.Enum {
+			v := fmt.Sprint(e)
+			fmt.Fprintf(b, "\t%s %s = %q\n", g.unique(name+exported(v)), name, v)
+		}
+		fmt.Fprintln(b, ")")
+
+	default:
+		t, err := g.goType(s, name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "type %s %s\n", name, t)
+	}
+
+	g.decls.Write(b.Bytes())
+	return nil
+}
+
+// Produce the fields of a struct, including those of any schemas it is
+// composed of with allOf.
+func (g *generator) fields(name string, s *Schema) (string, error) {
+	props := make(map[string]*Schema)
+	required := make(map[string]struct{})
+	var collect func(s *Schema) error
+	collect = func(s *Schema) error {
+		s, err := g.doc.schema(s)
+		if err != nil || s == nil {
+			return err
+		}
+		for _, e := range s.AllOf {
+			if err := collect(e); err != nil {
+				return err
+			}
+		}
+		for k, v := range s.Properties {
+			props[k] = v
+		}
+		for _, e := range s.Required {
+			required[e] = struct{}{}
+		}
+		return nil
+	}
+	if err := collect(s); err != nil {
+		return "", err
+	}
+
+	b := &strings.Builder{}
+	idents := make(map[string]struct{})
+	for _, k := range sortedKeys(props) {
+		v := props[k]
+		t, err := g.goType(v, name+exported(k))
+		if err != nil {
+			return "", fmt.Errorf("Property %s: %w", k, err)
+		}
+		_, req := required[k]
+		if g.nullable(v) || (!req && g.isStruct(v)) {
+			t = "*" + t
+		}
+		tag := k
+		if !req {
+			tag += ",omitempty"
+		}
+		ident := exported(k)
+		for i := 2; ; i++ {
+			if _, ok := idents[ident]; !ok {
+				break
+			}
+			ident = exported(k) + strconv.Itoa(i)
+		}
+		idents[ident] = struct{}{}
+		comment(b, "\t", v.Description)
+		fmt.Fprintf(b, "\t%s %s `json:\"%s\"`\n", ident, t, tag)
+	}
+	return b.String(), nil
+}
+
+func (g *generator) nullable(s *Schema) bool {
+	return s != nil && (s.Nullable || s.Type.nullable())
+}
+
+type param struct {
+	name     string
+	ident    string
+	typ      string
+	in       string
+	required bool
+	desc     string
+}
+
+// Collect the parameters of an operation, which override those of its path
+func (g *generator) params(item *PathItem, op *Operation) ([]*Parameter, error) {
+	var res []*Parameter
+	index := make(map[string]int)
+	for _, e := range append(append([]*Parameter(nil), item.Parameters...), op.Parameters...) {
+		p, err := g.doc.parameter(e)
+		if err != nil {
+			return nil, err
+		}
+		k := p.In + ":" + p.Name
+		if i, ok := index[k]; ok {
+			res[i] = p
+		} else {
+			index[k] = len(res)
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// Select the preferred media type from content, preferring JSON
+func preferredContent(content map[string]*MediaType) (string, *MediaType) {
+	var alt string
+	for _, k := range sortedKeys(content) {
+		m, _, err := mime.ParseMediaType(k)
+		if err != nil {
+			continue
+		}
+		if m == "application/json" {
+			return k, content[k]
+		}
+		if strings.HasSuffix(m, "+json") && alt == "" {
+			alt = k
+		}
+	}
+	if alt == "" {
+		keys := sortedKeys(content)
+		if len(keys) == 0 {
+			return "", nil
+		}
+		alt = keys[0]
+	}
+	return alt, content[alt]
+}
+
+func isJSON(ctype string) bool {
+	m, _, err := mime.ParseMediaType(ctype)
+	return err == nil && (m == "application/json" || strings.HasSuffix(m, "+json"))
+}
+
+// Select the successful response of an operation with the lowest status
+func (g *generator) success(op *Operation) (*Response, error) {
+	var codes []string
+	for k := range op.Responses {
+		if strings.HasPrefix(k, "2") {
+			codes = append(codes, k)
+		}
+	}
+	sort.Strings(codes)
+	for _, e := range codes {
+		r, err := g.doc.response(op.Responses[e])
+		if err != nil {
+			return nil, err
+		}
+		if len(r.Content) > 0 || e == codes[len(codes)-1] {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// Describe how an operation is paginated, if it appears to be
+func paginated(op *Operation, rsp *Response, params []param) string {
+	if v, ok := op.Pagination.(string); ok && v != "" {
+		return v
+	}
+	if rsp != nil {
+		for k := range rsp.Headers {
+			if strings.EqualFold(k, "Link") {
+				return "The next page of results, if any, is linked from the response; see httputil.NextPage."
+			}
+		}
+	}
+	for _, e := range params {
+		if _, ok := pageParams[strings.ToLower(e.name)]; ok && e.in == "query" {
+			return fmt.Sprintf("Results are paginated by the %s parameter.", e.name)
+		}
+	}
+	if op.Pagination != nil {
+		return "Results are paginated."
+	}
+	return ""
+}
+
+// Generate the method for an operation
+func (g *generator) operation(path, method string, item *PathItem, op *Operation) error {
+	var name string
+	if op.OperationId != "" {
+		name = g.unique(exported(op.OperationId))
+	} else {
+		name = g.unique(exported(strings.ToLower(method) + " " + path))
+	}
+
+	specs, err := g.params(item, op)
+	if err != nil {
+		return err
+	}
+	var pathArgs, fields []param
+	for _, p := range specs {
+		t, err := g.goType(p.Schema, name+exported(p.Name))
+		if err != nil {
+			return fmt.Errorf("Parameter %s: %w", p.Name, err)
+		}
+		e := param{name: p.Name, typ: t, in: p.In, required: p.Required, desc: p.Description}
+		switch p.In {
+		case "path":
+			e.ident = unexported(p.Name)
+			if _, ok := reserved[e.ident]; ok || token.IsKeyword(e.ident) {
+				e.ident += "Param"
+			}
+			if strings.HasPrefix(t, "[]") || strings.HasPrefix(t, "map[") || g.isStruct(p.Schema) {
+				e.typ = "string"
+			}
+			pathArgs = append(pathArgs, e)
+		case "query":
+			e.ident = exported(p.Name)
+			fields = append(fields, e)
+		case "header":
+			e.ident = exported(p.Name)
+			e.typ = "string"
+			fields = append(fields, e)
+		}
+	}
+
+	// order path arguments as they appear in the path
+	sort.SliceStable(pathArgs, func(i, j int) bool {
+		return strings.Index(path, "{"+pathArgs[i].name+"}") < strings.Index(path, "{"+pathArgs[j].name+"}")
+	})
+
+	var paramsType string
+	if len(fields) > 0 {
+		paramsType = g.unique(name + "Params")
+		b := &bytes.Buffer{}
+		fmt.Fprintln(b)
+		fmt.Fprintf(b, "// %s are the parameters of %s\n", paramsType, name)
+		fmt.Fprintf(b, "type %s struct {\n", paramsType)
+		for _, e := range fields {
+			comment(b, "\t", e.desc)
+			if e.in == "header" {
+				fmt.Fprintf(b, "\t%s %s `url:\"-\"` // sent as the %s header\n", e.ident, e.typ, e.name)
+			} else if e.required {
+				fmt.Fprintf(b, "\t%s %s `url:\"%s\"`\n", e.ident, e.typ, e.name)
+			} else {
+				fmt.Fprintf(b, "\t%s %s `url:\"%s,omitempty\"`\n", e.ident, e.typ, e.name)
+			}
+		}
+		fmt.Fprintln(b, "}")
+		g.decls.Write(b.Bytes())
+	}
+
+	// the request entity, if any
+	var bodyType, bodyCtype string
+	var bodyOptional bool
+	if op.RequestBody != nil && method != "GET" && method != "HEAD" {
+		rb, err := g.doc.requestBody(op.RequestBody)
+		if err != nil {
+			return err
+		}
+		ctype, media := preferredContent(rb.Content)
+		if media != nil {
+			if isJSON(ctype) {
+				bodyType, err = g.goType(media.Schema, name+"Request")
+				if err != nil {
+					return fmt.Errorf("Request body: %w", err)
+				}
+				if !rb.Required && g.isStruct(media.Schema) {
+					bodyType = "*" + bodyType
+					bodyOptional = true
+				}
+			} else {
+				g.use("io")
+				bodyType = "io.Reader"
+			}
+			if !strings.EqualFold(ctype, "application/json") {
+				bodyCtype = ctype
+			}
+		}
+	}
+
+	// the response entity, if any
+	rsp, err := g.success(op)
+	if err != nil {
+		return err
+	}
+	var resType string
+	var raw bool
+	if rsp != nil {
+		ctype, media := preferredContent(rsp.Content)
+		switch {
+		case media == nil:
+		case isJSON(ctype):
+			resType, err = g.goType(media.Schema, name+"Response")
+			if err != nil {
+				return fmt.Errorf("Response: %w", err)
+			}
+		case strings.HasPrefix(ctype, "text/plain"):
+			resType = "string"
+		default:
+			raw = true
+		}
+	}
+	if method == "HEAD" {
+		resType, raw = "", false
+	}
+
+	// document the method
+	b := &g.methods
+	fmt.Fprintln(b)
+	fmt.Fprintf(b, "// %s performs %s %s.\n", name, method, path)
+	if d := strings.TrimSpace(sentence(op.Summary) + "\n\n" + strings.TrimSpace(op.Description)); d != "" {
+		fmt.Fprintln(b, "//")
+		comment(b, "", d)
+	}
+	if p := paginated(op, rsp, append(pathArgs, fields...)); p != "" {
+		fmt.Fprintln(b, "//")
+		comment(b, "", p)
+	}
+	if raw {
+		fmt.Fprintln(b, "//")
+		fmt.Fprintln(b, "// The response body is not consumed; the caller is responsible for closing it.")
+	}
+	if op.Deprecated {
+		fmt.Fprintln(b, "//")
+		fmt.Fprintln(b, "// Deprecated: this operation is deprecated by the API.")
+	}
+
+	// signature
+	g.use("context")
+	g.use("net/http")
+	args := []string{"cxt context.Context"}
+	for _, e := range pathArgs {
+		args = append(args, e.ident+" "+e.typ)
+	}
+	if paramsType != "" {
+		args = append(args, "params *"+paramsType)
+	}
+	if bodyType != "" {
+		args = append(args, "body "+bodyType)
+	}
+	args = append(args, "opts ...api.Option")
+	_, resStruct := g.structs[resType]
+	var results string
+	switch {
+	case resType == "":
+		results = "(*http.Response, error)"
+	case resStruct:
+		results = fmt.Sprintf("(*%s, *http.Response, error)", resType)
+	default:
+		results = fmt.Sprintf("(%s, *http.Response, error)", resType)
+	}
+	fmt.Fprintf(b, "func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), results)
+
+	fail := "return nil, err"
+	if resType != "" {
+		if resStruct {
+			fail = "return nil, nil, err"
+		} else {
+			fail = "return res, nil, err"
+			fmt.Fprintf(b, "\tvar res %s\n", resType)
+		}
+	}
+
+	// the request URL
+	fmt.Fprintf(b, "\tu := %s\n", g.pathExpr(path, pathArgs))
+	if paramsType != "" {
+		fmt.Fprintln(b, "\tif params != nil {")
+		fmt.Fprintln(b, "\t\tvar err error")
+		fmt.Fprintln(b, "\t\tu, err = api.URLWithParams(u, params)")
+		fmt.Fprintf(b, "\t\tif err != nil {\n\t\t\t%s\n\t\t}\n", fail)
+		for _, e := range fields {
+			if e.in == "header" {
+				fmt.Fprintf(b, "\t\tif params.%s != \"\" {\n", e.ident)
+				fmt.Fprintf(b, "\t\t\topts = append(opts[:len(opts):len(opts)], api.WithHeader(%q, params.%s))\n", e.name, e.ident)
+				fmt.Fprintln(b, "\t\t}")
+			}
+		}
+		fmt.Fprintln(b, "\t}")
+	}
+	if bodyCtype != "" {
+		fmt.Fprintf(b, "\topts = append(opts[:len(opts):len(opts)], api.WithContentType(%q))\n", bodyCtype)
+	}
+	if raw {
+		fmt.Fprintln(b, "\topts = append(opts[:len(opts):len(opts)], api.WithRawBody())")
+	}
+
+	// the request entity and output
+	input := "nil"
+	if bodyType != "" {
+		input = "body"
+		if bodyOptional {
+			fmt.Fprintln(b, "\tvar input interface{}")
+			fmt.Fprintln(b, "\tif body != nil {\n\t\tinput = body\n\t}")
+			input = "input"
+		}
+	}
+	output := "nil"
+	if resType != "" {
+		if resStruct {
+			fmt.Fprintf(b, "\tres := &%s{}\n", resType)
+			output = "res"
+		} else {
+			output = "&res"
+		}
+	}
+
+	switch method {
+	case "GET":
+		fmt.Fprintf(b, "\trsp, err := c.Client.Get(cxt, u, %s, opts...)\n", output)
+	case "POST", "PUT", "PATCH", "DELETE":
+		fmt.Fprintf(b, "\trsp, err := c.Client.%s(cxt, u, %s, %s, opts...)\n", exported(strings.ToLower(method)), input, output)
+	default:
+		fmt.Fprintf(b, "\treq, err := http.NewRequestWithContext(cxt, %q, u, nil)\n", method)
+		fmt.Fprintf(b, "\tif err != nil {\n\t\t%s\n\t}\n", fail)
+		fmt.Fprintf(b, "\trsp, err := c.Client.Exec(req, %s, opts...)\n", output)
+	}
+
+	switch {
+	case resType == "":
+		fmt.Fprintln(b, "\treturn rsp, err")
+	case resStruct:
+		fmt.Fprintf(b, "\tif err != nil {\n\t\treturn nil, rsp, err\n\t}\n")
+		fmt.Fprintln(b, "\treturn res, rsp, nil")
+	default:
+		fmt.Fprintln(b, "\treturn res, rsp, err")
+	}
+	fmt.Fprintln(b, "}")
+	return nil
+}
+
+// Produce an expression for a path, substituting its parameters
+func (g *generator) pathExpr(path string, args []param) string {
+	var parts []string
+	for len(path) > 0 {
+		i := strings.Index(path, "{")
+		j := strings.Index(path, "}")
+		if i < 0 || j < i {
+			parts = append(parts, strconv.Quote(path))
+			break
+		}
+		if i > 0 {
+			parts = append(parts, strconv.Quote(path[:i]))
+		}
+		name := path[i+1 : j]
+		path = path[j+1:]
+		var arg *param
+		for k := range args {
+			if args[k].name == name {
+				arg = &args[k]
+			}
+		}
+		if arg == nil {
+			parts = append(parts, strconv.Quote("{"+name+"}"))
+			continue
+		}
+		g.use("net/url")
+		if arg.typ == "string" {
+			parts = append(parts, fmt.Sprintf("url.PathEscape(%s)", arg.ident))
+		} else {
+			g.use("fmt")
+			parts = append(parts, fmt.Sprintf("url.PathEscape(fmt.Sprint(%s))", arg.ident))
+		}
+	}
+	if len(parts) == 0 {
+		return `"/"`
+	}
+	return strings.Join(parts, " + ")
+}
+
+// Punctuate a summary as a sentence, which also prevents a lone summary from
+// being formatted as a heading.
+func sentence(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.ContainsAny(text[len(text)-1:], ".!?:") {
+		return text
+	}
+	return text + "."
+}
+
+// Write text as a comment, one line at a time
+func comment(b interface{ WriteString(string) (int, error) }, indent, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	for _, e := range strings.Split(text, "\n") {
+		if e = strings.TrimRightFunc(e, unicode.IsSpace); e == "" {
+			b.WriteString(indent + "//\n")
+		} else {
+			b.WriteString(indent + "// " + e + "\n")
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Produce an exported identifier from a name by capitalizing each of its
+// alphanumeric words, so that "pet_id" and "petId" both become "PetId".
+func exported(name string) string {
+	b := &strings.Builder{}
+	up := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			up = true
+			continue
+		}
+		if up {
+			r = unicode.ToUpper(r)
+			up = false
+		}
+		b.WriteRune(r)
+	}
+	res := b.String()
+	if res == "" {
+		return "X"
+	}
+	if unicode.IsDigit(rune(res[0])) {
+		res = "X" + res
+	}
+	return res
+}
+
+// Produce an unexported identifier from a name, lowering any leading initialism
+// so that "ID" becomes "id" and "URLPath" becomes "urlPath".
+func unexported(name string) string {
+	r := []rune(exported(name))
+	n := 0
+	for n < len(r) && unicode.IsUpper(r[n]) {
+		n++
+	}
+	if n > 1 && n < len(r) && !unicode.IsDigit(r[n]) {
+		n-- // the last capital begins the next word
+	}
+	for i := 0; i < n || i == 0; i++ {
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
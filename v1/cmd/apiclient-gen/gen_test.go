@@ -0,0 +1,69 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	doc, err := Load("testdata/petstore.yaml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	src, err := Generate(doc, "petstore")
+	if !assert.NoError(t, err) {
+		return
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "client.go", src, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = conf.Check("petstore", fset, []*ast.File{file}, nil)
+	assert.NoError(t, err, "the generated package must type-check")
+
+	for _, e := range []string{
+		`const DefaultBaseURL = "https://petstore.example.com/v1"`,
+		"opts = append(opts, api.WithBaseURL(DefaultBaseURL))",
+		"type Pets []Pet",
+		"StatusAvailable Status = \"available\"",
+		"Created time.Time `json:\"created\"`",
+		"Owner  *NewPetOwner `json:\"owner,omitempty\"`",
+		"XRequestId string `url:\"-\"`",
+		"func (c *Client) ListPets(cxt context.Context, params *ListPetsParams, opts ...api.Option) (Pets, *http.Response, error)",
+		"see httputil.NextPage",
+		"func (c *Client) CreatePet(cxt context.Context, body NewPet, opts ...api.Option) (*Pet, *http.Response, error)",
+		"func (c *Client) GetPet(cxt context.Context, petId int64, opts ...api.Option) (*Pet, *http.Response, error)",
+		`u := "/pets/" + url.PathEscape(fmt.Sprint(petId))`,
+		"Deprecated: this operation is deprecated by the API.",
+		"func (c *Client) PutPetsPetIdPhoto(cxt context.Context, petId int64, body io.Reader, opts ...api.Option) (*http.Response, error)",
+		`api.WithContentType("image/png")`,
+	} {
+		assert.Contains(t, string(src), e)
+	}
+	assert.NotContains(t, string(src), "type PetOwner struct", "inline schemas reached through allOf are declared once")
+}
+
+func TestIdentifiers(t *testing.T) {
+	tests := []struct {
+		Name, Exported, Unexported string
+	}{
+		{"petId", "PetId", "petId"},
+		{"pet_id", "PetId", "petId"},
+		{"X-Request-Id", "XRequestId", "xRequestId"},
+		{"ID", "ID", "id"},
+		{"URLPath", "URLPath", "urlPath"},
+		{"2fa", "X2fa", "x2fa"},
+	}
+	for _, e := range tests {
+		assert.Equal(t, e.Exported, exported(e.Name), e.Name)
+		assert.Equal(t, e.Unexported, unexported(e.Name), e.Name)
+	}
+}
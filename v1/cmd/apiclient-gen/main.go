@@ -0,0 +1,55 @@
+// Command apiclient-gen generates a typed client from an OpenAPI 3 document.
+//
+// The generated package declares a type for each schema in the document and
+// a Client which embeds *api.Client and has one method per operation. Path
+// parameters are method arguments, query and header parameters are collected
+// in a parameters struct, and request and response entities are typed from
+// their schemas. Operations which appear to be paginated are noted as such.
+//
+//	apiclient-gen -package petstore -output petstore/client.go openapi.yaml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	cmdline := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	var (
+		fPackage = cmdline.String("package", "client", "The name of the generated package.")
+		fOutput  = cmdline.String("output", "", "The file to write the generated client to; if omitted, standard output is used.")
+	)
+	cmdline.Usage = func() {
+		fmt.Fprintf(cmdline.Output(), "Usage: %s [options] <openapi.yaml|openapi.json>\n", os.Args[0])
+		cmdline.PrintDefaults()
+	}
+	cmdline.Parse(os.Args[1:])
+
+	if cmdline.NArg() != 1 {
+		cmdline.Usage()
+		os.Exit(2)
+	}
+	err := run(cmdline.Arg(0), *fPackage, *fOutput)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+		os.Exit(1)
+	}
+}
+
+func run(input, pkg, output string) error {
+	doc, err := Load(input)
+	if err != nil {
+		return err
+	}
+	src, err := Generate(doc, pkg)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(output, src, 0644)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The subset of an OpenAPI 3 document which is used to generate a client
+type Document struct {
+	OpenAPI    string               `yaml:"openapi"`
+	Info       Info                 `yaml:"info"`
+	Servers    []Server             `yaml:"servers"`
+	Paths      map[string]*PathItem `yaml:"paths"`
+	Components Components           `yaml:"components"`
+}
+
+type Info struct {
+	Title   string `yaml:"title"`
+	Version string `yaml:"version"`
+}
+
+type Server struct {
+	URL string `yaml:"url"`
+}
+
+type Components struct {
+	Schemas       map[string]*Schema      `yaml:"schemas"`
+	Parameters    map[string]*Parameter   `yaml:"parameters"`
+	RequestBodies map[string]*RequestBody `yaml:"requestBodies"`
+	Responses     map[string]*Response    `yaml:"responses"`
+}
+
+type PathItem struct {
+	Parameters []*Parameter `yaml:"parameters"`
+	Get        *Operation   `yaml:"get"`
+	Put        *Operation   `yaml:"put"`
+	Post       *Operation   `yaml:"post"`
+	Delete     *Operation   `yaml:"delete"`
+	Options    *Operation   `yaml:"options"`
+	Head       *Operation   `yaml:"head"`
+	Patch      *Operation   `yaml:"patch"`
+	Trace      *Operation   `yaml:"trace"`
+}
+
+type method struct {
+	name string
+	op   *Operation
+}
+
+// The operations of a path item by method, in a stable order
+func (p *PathItem) operations() []method {
+	var res []method
+	for _, e := range []method{
+		{"GET", p.Get}, {"PUT", p.Put}, {"POST", p.Post}, {"DELETE", p.Delete},
+		{"OPTIONS", p.Options}, {"HEAD", p.Head}, {"PATCH", p.Patch}, {"TRACE", p.Trace},
+	} {
+		if e.op != nil {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+type Operation struct {
+	OperationId string               `yaml:"operationId"`
+	Summary     string               `yaml:"summary"`
+	Description string               `yaml:"description"`
+	Deprecated  bool                 `yaml:"deprecated"`
+	Parameters  []*Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody         `yaml:"requestBody"`
+	Responses   map[string]*Response `yaml:"responses"`
+	Pagination  interface{}          `yaml:"x-pagination"`
+}
+
+type Parameter struct {
+	Ref         string  `yaml:"$ref"`
+	Name        string  `yaml:"name"`
+	In          string  `yaml:"in"`
+	Description string  `yaml:"description"`
+	Required    bool    `yaml:"required"`
+	Schema      *Schema `yaml:"schema"`
+}
+
+type RequestBody struct {
+	Ref      string                `yaml:"$ref"`
+	Required bool                  `yaml:"required"`
+	Content  map[string]*MediaType `yaml:"content"`
+}
+
+type Response struct {
+	Ref     string                `yaml:"$ref"`
+	Headers map[string]*yaml.Node `yaml:"headers"`
+	Content map[string]*MediaType `yaml:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 Types              `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Description          string             `yaml:"description"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	Required             []string           `yaml:"required"`
+	Items                *Schema            `yaml:"items"`
+	AdditionalProperties *yaml.Node         `yaml:"additionalProperties"`
+	Enum                 []interface{}      `yaml:"enum"`
+	Nullable             bool               `yaml:"nullable"`
+	AllOf                []*Schema          `yaml:"allOf"`
+	OneOf                []*Schema          `yaml:"oneOf"`
+	AnyOf                []*Schema          `yaml:"anyOf"`
+}
+
+// Types is the type of a schema, which may be a single type or, as of OpenAPI
+// 3.1, a list of types which usually includes "null".
+type Types []string
+
+func (t *Types) UnmarshalYAML(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		*t = Types{n.Value}
+		return nil
+	case yaml.SequenceNode:
+		var v []string
+		if err := n.Decode(&v); err != nil {
+			return err
+		}
+		*t = v
+		return nil
+	default:
+		return fmt.Errorf("Invalid schema type at line %d", n.Line)
+	}
+}
+
+// The primary type, ignoring "null"
+func (t Types) primary() string {
+	for _, e := range t {
+		if e != "null" {
+			return e
+		}
+	}
+	return ""
+}
+
+func (t Types) nullable() bool {
+	for _, e := range t {
+		if e == "null" {
+			return true
+		}
+	}
+	return false
+}
+
+// The schema of additional properties, if they are described
+func (s *Schema) additional() (*Schema, bool) {
+	n := s.AdditionalProperties
+	if n == nil {
+		return nil, false
+	}
+	if n.Kind == yaml.ScalarNode {
+		return &Schema{}, n.Value == "true"
+	}
+	var res Schema
+	if err := n.Decode(&res); err != nil {
+		return &Schema{}, true
+	}
+	return &res, true
+}
+
+// Load a document in either YAML or JSON, which is a subset of YAML
+func Load(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("Could not parse document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("Unsupported OpenAPI version: %q", doc.OpenAPI)
+	}
+	return &doc, nil
+}
+
+// The name of a component referred to by a local reference, such as
+// "#/components/schemas/Pet"
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func (d *Document) parameter(p *Parameter) (*Parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	if r, ok := d.Components.Parameters[refName(p.Ref)]; ok {
+		return d.parameter(r)
+	}
+	return nil, fmt.Errorf("Unresolved reference: %s", p.Ref)
+}
+
+func (d *Document) requestBody(b *RequestBody) (*RequestBody, error) {
+	if b.Ref == "" {
+		return b, nil
+	}
+	if r, ok := d.Components.RequestBodies[refName(b.Ref)]; ok {
+		return d.requestBody(r)
+	}
+	return nil, fmt.Errorf("Unresolved reference: %s", b.Ref)
+}
+
+func (d *Document) response(r *Response) (*Response, error) {
+	if r.Ref == "" {
+		return r, nil
+	}
+	if v, ok := d.Components.Responses[refName(r.Ref)]; ok {
+		return d.response(v)
+	}
+	return nil, fmt.Errorf("Unresolved reference: %s", r.Ref)
+}
+
+func (d *Document) schema(s *Schema) (*Schema, error) {
+	if s == nil || s.Ref == "" {
+		return s, nil
+	}
+	if v, ok := d.Components.Schemas[refName(s.Ref)]; ok {
+		return d.schema(v)
+	}
+	return nil, fmt.Errorf("Unresolved reference: %s", s.Ref)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/cache"
+)
+
+// A collection maintains a local copy of a remote collection, such as a list
+// of resources, which is kept up to date using conditional requests. The
+// collection's ETag and data are persisted in a cache store; when the remote
+// collection has not changed the server responds 304 Not Modified and the
+// cached collection is used instead of transferring it again.
+type Collection[T any] struct {
+	client *Client
+	store  cache.Store
+	url    string
+}
+
+// NewCollection creates a collection for the resource at the provided URL,
+// which is used as its cache key.
+func NewCollection[T any](client *Client, store cache.Store, u string) *Collection[T] {
+	return &Collection[T]{
+		client: client,
+		store:  store,
+		url:    u,
+	}
+}
+
+// Sync fetches the collection if it has changed since it was last fetched,
+// otherwise the cached collection is used. The collection is returned along
+// with a flag indicating whether it changed.
+func (c *Collection[T]) Sync(cxt context.Context, opts ...Option) (T, bool, error) {
+	var res T
+
+	ent, err := c.store.Get(cxt, c.url)
+	if errors.Is(err, cache.ErrNotFound) {
+		ent = nil
+	} else if err != nil {
+		return res, false, err
+	}
+
+	req := c.client.NewRequest(http.MethodGet, c.url, nil)
+	if ent != nil && ent.ETag != "" {
+		req = req.IfNoneMatch(ent.ETag)
+	}
+
+	rsp, err := c.client.ExecBuilder(cxt, req, nil, append(opts, WithRawBody())...)
+	if ent != nil && errors.Is(err, ErrNotModified) {
+		err = Entity{ContentType: ent.ContentType, Data: ent.Data}.Unmarshal(&res)
+		return res, false, err
+	} else if err != nil {
+		return res, false, err
+	}
+	defer rsp.Body.Close()
+
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return res, false, err
+	}
+	update := Entity{
+		ContentType: rsp.Header.Get("Content-Type"),
+		Data:        data,
+	}
+	err = update.Unmarshal(&res)
+	if err != nil {
+		return res, false, err
+	}
+
+	if etag := rsp.Header.Get("ETag"); etag != "" {
+		err = c.store.Set(cxt, c.url, &cache.Entry{
+			ETag:        etag,
+			ContentType: update.ContentType,
+			Header:      rsp.Header,
+			Data:        data,
+			Stored:      time.Now(),
+		})
+		if err != nil {
+			return res, true, err
+		}
+	}
+
+	return res, true, nil
+}
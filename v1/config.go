@@ -1,18 +1,29 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
+	"strings"
 	"time"
 
+	"github.com/bww/go-apiclient/v1/cache"
+	"github.com/bww/go-apiclient/v1/events"
+
 	"github.com/bww/go-ratelimit/v1"
 )
 
 type Debug struct {
 	Debug     bool
 	Verbose   bool
+	Curl      bool
 	FilterURL *regexp.Regexp
+	Writer    io.Writer // defaults to standard output
 }
 
 func (d Debug) Matches(req *http.Request) bool {
@@ -24,12 +35,35 @@ func (d Debug) Matches(req *http.Request) bool {
 	return true
 }
 
+// The environment variables which enable debugging output
+const (
+	envDebug   = "DEBUG_API_CLIENT"
+	envVerbose = "VERBOSE_API_CLIENT"
+	envCurl    = "DEBUG_API_CLIENT_CURL"
+	envFilter  = "DEBUG_API_CLIENT_FILTER"
+)
+
 func (d Debug) WithEnv() (Debug, error) {
+	return d.WithEnvPrefix("")
+}
+
+// WithEnvPrefix is like WithEnv, but also reads the variables qualified by the
+// provided prefix, such as MYAPP_DEBUG_API_CLIENT for the prefix "MYAPP". The
+// qualified variables enable debugging output in addition to the unqualified
+// ones and a qualified filter replaces an unqualified one.
+func (d Debug) WithEnvPrefix(prefix string) (Debug, error) {
 	e := d
-	e.Debug = d.Debug || os.Getenv("DEBUG_API_CLIENT") != ""
-	e.Verbose = e.Debug || d.Verbose || os.Getenv("VERBOSE_API_CLIENT") != ""
+	e.Debug = d.Debug || envSet(prefix, envDebug)
+	e.Verbose = e.Debug || d.Verbose || envSet(prefix, envVerbose)
+	e.Curl = d.Curl || envSet(prefix, envCurl)
 
-	if v := os.Getenv("DEBUG_API_CLIENT_FILTER"); v != "" {
+	v := os.Getenv(envFilter)
+	if prefix != "" {
+		if p := os.Getenv(envName(prefix, envFilter)); p != "" {
+			v = p
+		}
+	}
+	if v != "" {
 		m, err := regexp.Compile(v)
 		if err != nil {
 			return e, err
@@ -40,19 +74,82 @@ func (d Debug) WithEnv() (Debug, error) {
 	return e, nil
 }
 
+func envName(prefix, name string) string {
+	return strings.TrimSuffix(prefix, "_") + "_" + name
+}
+
+func envSet(prefix, name string) bool {
+	if os.Getenv(name) != "" {
+		return true
+	}
+	return prefix != "" && os.Getenv(envName(prefix, name)) != ""
+}
+
 // Client configuration
 type Config struct {
-	BaseURL     string
-	Timeout     time.Duration
-	Client      *http.Client
-	Authorizer  Authorizer
-	RateLimiter ratelimit.Limiter
-	RetryStatus []int
-	RetryDelay  time.Duration
-	Header      http.Header
-	ContentType string
-	Verbose     bool
-	Debug       bool
+	BaseURL              string
+	URLResolution        URLResolution
+	FallbackURLs         []string
+	Failover             *Failover
+	Timeout              time.Duration
+	Client               *http.Client
+	Jar                  http.CookieJar
+	MaxRedirects         int
+	RedirectAuth         func(*http.Request, []*http.Request) bool
+	Proxy                string
+	ProxyFunc            func(*http.Request) (*url.URL, error)
+	TLSConfig            *tls.Config
+	ClientCert           string
+	ClientKey            string
+	RootCAs              *x509.CertPool
+	Balancer             Balancer
+	Authorizer           Authorizer
+	AuthorizeOnce        bool
+	Finalizers           []Finalizer
+	RateLimiter          ratelimit.Limiter
+	RetryStatus          []int
+	RetryDelay           time.Duration
+	SuccessStatus        func(int) bool
+	Methods              map[string]Policy
+	Header               http.Header
+	Correlation          []Correlation
+	ContentType          string
+	StrictContentType    *bool
+	Validator            ResponseValidator
+	Observers            []Observer
+	ObserverPolicy       ObserverPolicy
+	Events               []events.Listener
+	Metrics              MetricsSink
+	PauseFail            *bool
+	DryRun               bool
+	RedactParams         []string
+	RedactFields         []string
+	ErrorEntityLimit     int64
+	SensitiveHeaders     []string
+	AdaptiveTimeout      *AdaptiveTimeout
+	KeepAlive            *KeepAlive
+	Queue                *Queue
+	StatsSnapshots       *StatsSnapshots
+	Probe                *Probe
+	DebugSampling        *DebugSampling
+	ReplayOnConflict     *bool
+	Singleflight         bool
+	SingleflightHeaders  []string
+	Cache                cache.Store
+	cacheScope           string
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	Verbose              bool
+	Debug                bool
+	DebugCurl            bool
+	DebugWriter          io.Writer
+	EnvPrefix            string
+	// Per-request configuration
+	ExpectStatus []int
+	RawBody      bool
+	Scheduled    bool
+	Cost         int
+	RetryBudget  *RetryBudget
 }
 
 func (c Config) With(opts []Option) Config {
@@ -71,6 +168,29 @@ func WithAuthorizer(auth Authorizer) Option {
 	}
 }
 
+// WithAuthorizeOnce authorizes a request only before its first attempt rather
+// than before every attempt. By default, requests are authorized again before
+// each retry, since a retry may follow a long wait which outlives a short-lived
+// token or timestamped signature; schemes which must present the same
+// credentials on every attempt, such as those keyed for idempotency, should
+// disable this.
+func WithAuthorizeOnce() Option {
+	return func(c Config) Config {
+		c.AuthorizeOnce = true
+		return c
+	}
+}
+
+// WithFinalizers adds finalizers which are run, in order, as the last step
+// before every attempt to send a request. When used as a per-request option,
+// they are run after the client's finalizers.
+func WithFinalizers(f ...Finalizer) Option {
+	return func(c Config) Config {
+		c.Finalizers = append(c.Finalizers, f...)
+		return c
+	}
+}
+
 func WithBaseURL(base string) Option {
 	return func(c Config) Config {
 		c.BaseURL = base
@@ -78,6 +198,33 @@ func WithBaseURL(base string) Option {
 	}
 }
 
+// WithURLResolution sets the way in which the URLs of requests are resolved
+// against the client's base URL; by default, ResolveReference.
+func WithURLResolution(r URLResolution) Option {
+	return func(c Config) Config {
+		c.URLResolution = r
+		return c
+	}
+}
+
+func WithTimeout(d time.Duration) Option {
+	return func(c Config) Config {
+		c.Timeout = d
+		return c
+	}
+}
+
+// WithCookieJar sets the jar in which cookies set by responses are stored and
+// from which they are sent with subsequent requests. Since the jar belongs to
+// the underlying HTTP client, a client with a jar uses a copy of any shared
+// HTTP client it is configured with.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c Config) Config {
+		c.Jar = jar
+		return c
+	}
+}
+
 func WithHeader(key, val string) Option {
 	return func(c Config) Config {
 		if c.Header == nil {
@@ -101,6 +248,41 @@ func WithHeaders(hdr http.Header) Option {
 	}
 }
 
+// A correlation derives a header value, such as a request or trace ID, from
+// the context of an outbound request.
+type Correlation struct {
+	Header string
+	Value  func(context.Context) string
+}
+
+// WithCorrelation injects a header into every outbound request whose value is
+// derived from the request context, for example, to propagate a request ID.
+// The header is not set if the function produces an empty value or if the
+// request already has the header set explicitly.
+func WithCorrelation(header string, value func(context.Context) string) Option {
+	return func(c Config) Config {
+		c.Correlation = append(c.Correlation, Correlation{
+			Header: http.CanonicalHeaderKey(header),
+			Value:  value,
+		})
+		return c
+	}
+}
+
+// WithContentType sets the content type with which request entities are
+// marshaled, which is also set as the Content-Type of the request, and which
+// is preferred when negotiating the content type of the response. By default,
+// this is JSON. This may be used as a client or per-request option.
+func WithContentType(ctype string) Option {
+	return func(c Config) Config {
+		c.ContentType = ctype
+		return c
+	}
+}
+
+// WithDebug enables debugging output. When used as a per-request option,
+// debugging output is enabled for that request alone; see also
+// ContextWithDebug.
 func WithDebug(on bool) Option {
 	return func(c Config) Config {
 		c.Debug, c.Verbose = on, on
@@ -108,6 +290,26 @@ func WithDebug(on bool) Option {
 	}
 }
 
+// WithDebugWriter sets the writer to which debugging output is written. By
+// default, it is written to standard output.
+func WithDebugWriter(w io.Writer) Option {
+	return func(c Config) Config {
+		c.DebugWriter = w
+		return c
+	}
+}
+
+// WithEnvPrefix causes the client to also read debugging environment
+// variables qualified by the provided prefix, such as MYAPP_DEBUG_API_CLIENT
+// for the prefix "MYAPP", so that debugging output may be enabled for one
+// client in a process at a time; see Debug.WithEnvPrefix.
+func WithEnvPrefix(prefix string) Option {
+	return func(c Config) Config {
+		c.EnvPrefix = prefix
+		return c
+	}
+}
+
 func WithRateLimiter(l ratelimit.Limiter) Option {
 	return func(c Config) Config {
 		c.RateLimiter = l
@@ -115,6 +317,18 @@ func WithRateLimiter(l ratelimit.Limiter) Option {
 	}
 }
 
+// WithRequestsPerSecond limits the client to rps requests per second on
+// average, permitting bursts of up to burst requests, using a token bucket.
+// This suits APIs which document a fixed quota but do not describe it in
+// their responses. Clients derived from the client share its bucket.
+func WithRequestsPerSecond(rps float64, burst int) Option {
+	l := NewTokenBucket(rps, burst)
+	return func(c Config) Config {
+		c.RateLimiter = l
+		return c
+	}
+}
+
 func WithRetryStatus(s ...int) Option {
 	return func(c Config) Config {
 		c.RetryStatus = s
@@ -129,6 +343,223 @@ func WithRetryDelay(d time.Duration) Option {
 	}
 }
 
+// WithSuccessStatuses sets the function which determines whether a response
+// status is successful. Responses with a successful status are unmarshaled
+// into the output entity and others produce an error; by default, statuses
+// from 200 through 299 are successful. For example, to also accept 303 See
+// Other with a body, when redirects are not followed:
+//
+//	WithSuccessStatuses(func(s int) bool {
+//	  return (s >= 200 && s < 300) || s == http.StatusSeeOther
+//	})
+//
+// This may be used as a client or per-request option.
+func WithSuccessStatuses(fn func(int) bool) Option {
+	return func(c Config) Config {
+		c.SuccessStatus = fn
+		return c
+	}
+}
+
+// WithResponseValidator sets a validator which is invoked on successful
+// responses before they are unmarshaled. When used as a per-request option it
+// overrides the client's validator.
+func WithResponseValidator(v ResponseValidator) Option {
+	return func(c Config) Config {
+		c.Validator = v
+		return c
+	}
+}
+
+// WithObservers adds observers which are notified over the lifecycle of every
+// request performed by the client.
+func WithObservers(o ...Observer) Option {
+	return func(c Config) Config {
+		c.Observers = append(c.Observers, o...)
+		return c
+	}
+}
+
+// WithEvents adds listeners which receive events describing the attempts,
+// waits, and failures of every request performed by the client. Listeners are
+// invoked synchronously and should return promptly.
+func WithEvents(l ...events.Listener) Option {
+	return func(c Config) Config {
+		c.Events = append(c.Events, l...)
+		return c
+	}
+}
+
+// WithMetrics sets the sink with which the client's metrics are registered.
+// By default, metrics are registered with the shared go-metrics registry the
+// first time they are recorded. Use NoMetrics to disable metrics entirely. A
+// sink which is not comparable fails with ErrInvalidMetricsSink.
+func WithMetrics(r MetricsSink) Option {
+	return func(c Config) Config {
+		c.Metrics = r
+		return c
+	}
+}
+
+// WithPauseFailFast causes requests to fail immediately with ErrPaused while
+// the client is paused, rather than waiting for the pause to elapse. This may
+// be used as a client or per-request option; a per-request option overrides
+// the client's setting.
+func WithPauseFailFast(on bool) Option {
+	return func(c Config) Config {
+		c.PauseFail = &on
+		return c
+	}
+}
+
+// WithRedactedParams sets the query parameters whose values are redacted
+// wherever the client renders a URL, such as in errors and debugging output.
+// This replaces the default set, DefaultRedactedParams; to extend it instead:
+//
+//	WithRedactedParams(append(DefaultRedactedParams, "session")...)
+//
+// Calling this with no parameters disables redaction.
+func WithRedactedParams(p ...string) Option {
+	return func(c Config) Config {
+		c.RedactParams = append([]string{}, p...)
+		return c
+	}
+}
+
+// WithRedactedFields sets the JSON body fields whose values are redacted, at
+// any depth, wherever the client renders an entity, such as in debugging
+// output and the entities of errors. This replaces the default set,
+// DefaultRedactedFields. Calling this with no fields disables redaction.
+func WithRedactedFields(f ...string) Option {
+	return func(c Config) Config {
+		c.RedactFields = append([]string{}, f...)
+		return c
+	}
+}
+
+// WithErrorEntityLimit sets the maximum number of bytes of a response body
+// which are captured as the entity of an error; by default, this is
+// DefaultErrorEntityLimit. An entity which exceeds the limit is truncated and
+// marked as such. This may be used as a client or per-request option.
+func WithErrorEntityLimit(n int64) Option {
+	return func(c Config) Config {
+		c.ErrorEntityLimit = n
+		return c
+	}
+}
+
+// WithoutErrorEntity prevents response bodies from being captured as the
+// entity of an error at all. This may be used as a client or per-request
+// option.
+func WithoutErrorEntity() Option {
+	return func(c Config) Config {
+		c.ErrorEntityLimit = -1
+		return c
+	}
+}
+
+// WithSensitiveHeaders adds headers whose values are redacted wherever the
+// client renders headers, such as in debugging output, in addition to those
+// in DefaultSensitiveHeaders.
+func WithSensitiveHeaders(names ...string) Option {
+	return func(c Config) Config {
+		c.SensitiveHeaders = append(c.SensitiveHeaders, names...)
+		return c
+	}
+}
+
+// WithSingleflight causes concurrent identical GET and HEAD requests to share
+// a single in-flight request, each receiving its own copy of the response.
+// Requests are identical when their method, URL, and the values of the
+// headers in DefaultSingleflightHeaders and those provided here are the same.
+// Headers set with the per-request WithHeader option also distinguish requests.
+// Requests made with other per-request options, such as WithRawBody, never
+// share a flight, nor do requests made by clients with different authorizers. Canceling one request does not cancel
+// the others sharing its flight; the flight is canceled once all of them are.
+func WithSingleflight(headers ...string) Option {
+	return func(c Config) Config {
+		c.Singleflight = true
+		c.SingleflightHeaders = append(c.SingleflightHeaders, headers...)
+		return c
+	}
+}
+
+// WithExpectStatus is a per-request option which requires that the response
+// status is exactly the provided status. A success status other than the one
+// expected will produce an error.
+func WithExpectStatus(s int) Option {
+	return WithExpectStatuses(s)
+}
+
+// WithExpectStatuses is a per-request option which requires that the response
+// status is one of the provided statuses.
+func WithExpectStatuses(s ...int) Option {
+	return func(c Config) Config {
+		c.ExpectStatus = s
+		return c
+	}
+}
+
+// WithRawBody is a per-request option which guarantees that the response body
+// is not read, buffered, or closed by the client, even when debugging is
+// enabled. The caller is responsible for closing the response body. Response
+// validators are not invoked and no output entity is unmarshaled when this
+// option is in effect.
+func WithRawBody() Option {
+	return func(c Config) Config {
+		c.RawBody = true
+		return c
+	}
+}
+
+// WithCost is a per-request option which sets the number of points a request
+// consumes from a quota. The cost is reserved from the client's rate limiter
+// when it implements CostLimiter; other limiters reserve a single request.
+func WithCost(n int) Option {
+	return func(c Config) Config {
+		c.Cost = n
+		return c
+	}
+}
+
+// WithScheduled is a per-request option which indicates that the caller has
+// already scheduled the request against the client's rate limiter, as by
+// calling Next on the limiter returned by RateLimiterFor and waiting until
+// the time it produces. The client does not delay the request again.
+func WithScheduled() Option {
+	return func(c Config) Config {
+		c.Scheduled = true
+		return c
+	}
+}
+
+// WithRetryBudget is a per-request option which draws every retry the request
+// performs from the provided budget. When the budget is exhausted, the request
+// fails as if it had exhausted its retries.
+func WithRetryBudget(b *RetryBudget) Option {
+	return func(c Config) Config {
+		c.RetryBudget = b
+		return c
+	}
+}
+
+// WithMethodPolicy overrides rate limiting and retry behavior for requests
+// using the specified HTTP method. For example, to disable retries for POST
+// requests:
+//
+//	WithMethodPolicy(http.MethodPost, Policy{RetryStatus: NoRetries})
+func WithMethodPolicy(method string, p Policy) Option {
+	return func(c Config) Config {
+		m := make(map[string]Policy)
+		for k, v := range c.Methods {
+			m[k] = v
+		}
+		m[strings.ToUpper(method)] = p
+		c.Methods = m
+		return c
+	}
+}
+
 func (c Config) WithOptions(opts []Option) Config {
 	for _, opt := range opts {
 		c = opt(c)
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptrace"
+
+	"github.com/bww/go-metrics/v1"
+)
+
+// The maximum number of bytes we will read from an unconsumed response body
+// in order to allow its connection to be reused. Bodies larger than this are
+// simply closed, which will discard the connection.
+const maxDrain = 1 << 16
+
+// Drain up to a limited number of bytes from a response body which will not
+// otherwise be consumed and then close it, so that the underlying connection
+// may be reused.
+func (m *clientMetrics) drain(domain string, rsp *http.Response) {
+	if rsp == nil || rsp.Body == nil {
+		return
+	}
+	n, _ := io.CopyN(io.Discard, rsp.Body, maxDrain)
+	if n > 0 {
+		m.drainedBytes.With(metrics.Tags{"domain": domain}).Add(float64(n))
+	}
+	rsp.Body.Close()
+}
+
+// Produce a client trace which tracks connection reuse for a domain
+func (m *clientMetrics) connTrace(domain string) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused := "false"
+			if info.Reused {
+				reused = "true"
+			}
+			m.connection.With(metrics.Tags{"domain": domain, "reused": reused}).Inc()
+		},
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+type (
+	headerKey struct{}
+	queryKey  struct{}
+)
+
+// ContextWithHeader produces a context which sets the provided header on every
+// request made with it, for example, to propagate a tenant ID or locale from
+// middleware without passing options to every call. A header which is already
+// set on a request, either explicitly or by a per-request option, is not
+// replaced. Headers set by the context take precedence over the client's
+// default headers.
+func ContextWithHeader(cxt context.Context, key, val string) context.Context {
+	hdr := contextHeader(cxt).Clone()
+	if hdr == nil {
+		hdr = make(http.Header)
+	}
+	hdr.Set(key, val)
+	return context.WithValue(cxt, headerKey{}, hdr)
+}
+
+// ContextWithQuery produces a context which adds the provided query parameter
+// to every request made with it. A parameter which is already present in the
+// URL of a request is not replaced.
+func ContextWithQuery(cxt context.Context, key, val string) context.Context {
+	query := make(url.Values)
+	for k, v := range contextQuery(cxt) {
+		query[k] = v
+	}
+	query.Set(key, val)
+	return context.WithValue(cxt, queryKey{}, query)
+}
+
+func contextHeader(cxt context.Context) http.Header {
+	hdr, _ := cxt.Value(headerKey{}).(http.Header)
+	return hdr
+}
+
+func contextQuery(cxt context.Context) url.Values {
+	query, _ := cxt.Value(queryKey{}).(url.Values)
+	return query
+}
+
+// Apply headers and query parameters from the context of a request. Existing
+// parameters are left in place and new ones are appended to the query.
+func applyContext(req *http.Request) {
+	cxt := req.Context()
+	if hdr := contextHeader(cxt); len(hdr) > 0 {
+		if req.Header == nil {
+			req.Header = make(http.Header)
+		}
+		for k, v := range hdr {
+			if _, set := req.Header[k]; !set {
+				req.Header[k] = v
+			}
+		}
+	}
+	if query := contextQuery(cxt); len(query) > 0 {
+		have := req.URL.Query()
+		add := make(url.Values)
+		for k, v := range query {
+			if !have.Has(k) {
+				add[k] = v
+			}
+		}
+		if len(add) > 0 {
+			if req.URL.RawQuery != "" {
+				req.URL.RawQuery += "&"
+			}
+			req.URL.RawQuery += add.Encode()
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextMetadata(t *testing.T) {
+	var hdr http.Header
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		hdr, query = req.Header.Clone(), req.URL.RawQuery
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := New(WithBaseURL(server.URL), WithHeader("X-Tenant", "default"), WithHeader("Accept-Language", "fr"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cxt := ContextWithHeader(context.Background(), "X-Tenant", "acme")
+	cxt = ContextWithHeader(cxt, "X-Flags", "a")
+	cxt = ContextWithQuery(cxt, "locale", "en")
+	cxt = ContextWithQuery(cxt, "page", "1")
+
+	_, err = client.Get(cxt, "/things?page=2", nil, WithHeader("X-Flags", "b"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "acme", hdr.Get("X-Tenant"), "the context takes precedence over defaults")
+		assert.Equal(t, "b", hdr.Get("X-Flags"), "options take precedence over the context")
+		assert.Equal(t, "fr", hdr.Get("Accept-Language"))
+		assert.Equal(t, "page=2&locale=en", query)
+	}
+
+	_, err = client.Get(context.Background(), "/things", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "default", hdr.Get("X-Tenant"))
+		assert.Equal(t, "", hdr.Get("X-Flags"))
+		assert.Equal(t, "", query)
+	}
+
+	parent := ContextWithHeader(context.Background(), "X-Tenant", "acme")
+	ContextWithHeader(parent, "X-Tenant", "other")
+	assert.Equal(t, "acme", contextHeader(parent).Get("X-Tenant"), "derived contexts don't affect their parents")
+}
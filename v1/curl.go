@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// WithCurlDebug prints the curl command equivalent to every request the
+// client sends, which may be used to reproduce a request outside of the
+// client. Debugging output is filtered as it is otherwise; see Debug. This
+// may also be enabled by setting DEBUG_API_CLIENT_CURL in the environment.
+func WithCurlDebug(on bool) Option {
+	return func(c Config) Config {
+		c.DebugCurl = on
+		return c
+	}
+}
+
+// CurlString renders a curl command which performs the provided request.
+// Sensitive headers, query parameters, and JSON body fields are redacted as
+// they are by default in other debugging output. The request body is read and replaced, so the request may
+// still be sent afterwards.
+func CurlString(req *http.Request) (string, error) {
+	return curlString(req, defaultRedactor, defaultSensitiveHeaders, defaultFieldRedactor)
+}
+
+func curlString(req *http.Request, redact redactor, sensitive headerSet, fields redactor) (string, error) {
+	b := &strings.Builder{}
+	b.WriteString("curl")
+	switch req.Method {
+	case "", http.MethodGet:
+		// the default
+	case http.MethodHead:
+		b.WriteString(" --head")
+	default:
+		b.WriteString(" -X " + req.Method)
+	}
+	b.WriteString(" " + shellQuote(redact.url(req.URL)))
+
+	hdr := sanitizeHeaders(req.Header, sensitive.allow)
+	if req.Host != "" && req.URL != nil && req.Host != req.URL.Host {
+		hdr.Set("Host", req.Host)
+	}
+	keys := make([]string, 0, len(hdr))
+	for k := range hdr {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range hdr[k] {
+			b.WriteString(" -H " + shellQuote(k+": "+v))
+		}
+	}
+
+	data, err := requestBody(req)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > 0 {
+		b.WriteString(" --data-binary " + shellQuote(string(fields.body(req.Header.Get("Content-Type"), data))))
+	}
+	return b.String(), nil
+}
+
+// Read a copy of a request's body, replacing the body if it must be consumed
+// to do so
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// Quote a string for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Print the curl command for a request, if enabled
+func (c *Client) printCurl(req *http.Request) error {
+	if !c.debug.Curl || !c.debug.Matches(req) {
+		return nil
+	}
+	cmd, err := curlString(req, c.redact, c.sensitive, c.fields)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.debug.Writer, "api: "+cmd)
+	return nil
+}
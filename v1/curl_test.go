@@ -0,0 +1,66 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurlString(t *testing.T) {
+	tests := []struct {
+		Method string
+		URL    string
+		Header http.Header
+		Body   io.Reader
+		Expect string
+	}{
+		{
+			http.MethodGet, "https://example.com/things?page=2", nil, nil,
+			`curl 'https://example.com/things?page=2'`,
+		},
+		{
+			http.MethodHead, "https://example.com/things?token=abc", nil, nil,
+			`curl --head 'https://example.com/things?token=REDACTED'`,
+		},
+		{
+			http.MethodPost, "https://example.com/things", http.Header{"Content-Type": {JSON}, "X-Name": {"It's"}}, bytes.NewReader([]byte(`{"a":"b"}`)),
+			`curl -X POST 'https://example.com/things' -H 'Content-Type: application/json' -H 'X-Name: It'\''s' --data-binary '{"a":"b"}'`,
+		},
+		{
+			http.MethodPut, "https://example.com/things", nil, io.NopCloser(strings.NewReader("raw")),
+			`curl -X PUT 'https://example.com/things' --data-binary 'raw'`,
+		},
+	}
+	for _, e := range tests {
+		req, err := http.NewRequest(e.Method, e.URL, e.Body)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		for k, v := range e.Header {
+			req.Header[k] = v
+		}
+		cmd, err := CurlString(req)
+		if assert.NoError(t, err) {
+			assert.Equal(t, e.Expect, cmd)
+		}
+		if req.Body != nil {
+			data, err := io.ReadAll(req.Body)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, data, "the body must still be available")
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	cmd, err := CurlString(req)
+	assert.NoError(t, err)
+	assert.NotContains(t, cmd, "secret")
+	assert.Contains(t, cmd, "-H 'Authorization: <apiclient: redacted")
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -11,15 +12,47 @@ import (
 	"github.com/bww/go-util/v1/text"
 )
 
-var sensitiveHeaders = map[string]struct{}{
-	http.CanonicalHeaderKey("Authorization"): {},
+// The headers whose values are redacted by default wherever a client renders
+// headers, such as in debugging output and diagnostics.
+var DefaultSensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+var defaultSensitiveHeaders = newHeaderSet(DefaultSensitiveHeaders)
+
+// A set of canonical header names
+type headerSet map[string]struct{}
+
+func newHeaderSet(names []string) headerSet {
+	s := make(headerSet)
+	for _, e := range names {
+		s[http.CanonicalHeaderKey(e)] = struct{}{}
+	}
+	return s
 }
 
-func defaultAllowHeader(n string) bool {
-	_, ok := sensitiveHeaders[n]
+// Determine whether a header may be rendered as it is
+func (s headerSet) allow(n string) bool {
+	_, ok := s[http.CanonicalHeaderKey(n)]
 	return !ok // if it's not sensitive, it is allowed
 }
 
+func defaultAllowHeader(n string) bool {
+	return defaultSensitiveHeaders.allow(n)
+}
+
+type debugKey struct{}
+
+// ContextWithDebug produces a context which enables debugging output for
+// every request made with it, regardless of the debug settings of the client
+// which performs the request.
+func ContextWithDebug(cxt context.Context) context.Context {
+	return context.WithValue(cxt, debugKey{}, true)
+}
+
+func isDebugContext(cxt context.Context) bool {
+	on, _ := cxt.Value(debugKey{}).(bool)
+	return on
+}
+
 func sanitizeHeaders(hdr http.Header, allowed func(string) bool) http.Header {
 	res := make(http.Header)
 	for k, v := range hdr {
@@ -38,10 +71,27 @@ func sanitizeHeaders(hdr http.Header, allowed func(string) bool) http.Header {
 	return res
 }
 
+// DebugWriter produces the writer to which the client writes debugging output
+func (c *Client) DebugWriter() io.Writer {
+	return c.debug.Writer
+}
+
+// Write a request to the debug output and as a curl command, when either is
+// enabled for it
+func (c *Client) debugReq(req *http.Request) error {
+	if c.isDebug(req) {
+		err := c.dumpReq(c.debug.Writer, req)
+		if err != nil {
+			return err
+		}
+	}
+	return c.printCurl(req)
+}
+
 func (c *Client) dumpReq(w io.Writer, req *http.Request) error {
 	b := &bytes.Buffer{}
-	sanitizeHeaders(req.Header, defaultAllowHeader).Write(b)
-	fmt.Println(text.Indent(string(b.Bytes()), "   - "))
+	sanitizeHeaders(req.Header, c.sensitive.allow).Write(b)
+	fmt.Fprintln(w, text.Indent(string(b.Bytes()), "   - "))
 	if c.isVerbose(req) && req.Body != nil {
 		defer req.Body.Close()
 		d, err := io.ReadAll(req.Body)
@@ -50,23 +100,23 @@ func (c *Client) dumpReq(w io.Writer, req *http.Request) error {
 		}
 		req.Body = io.NopCloser(bytes.NewBuffer(d))
 		if len(d) > 0 {
-			fmt.Fprintln(w, text.Indent(string(d), "   > "))
+			fmt.Fprintln(w, text.Indent(string(c.fields.body(req.Header.Get("Content-Type"), d)), "   > "))
 		}
 	}
 	return nil
 }
 
-func (c *Client) dumpRsp(w io.Writer, req *http.Request, rsp *http.Response) error {
+func (c *Client) dumpRsp(w io.Writer, req *http.Request, rsp *http.Response, body bool) error {
 	b := &bytes.Buffer{}
-	sanitizeHeaders(rsp.Header, defaultAllowHeader).Write(b)
-	fmt.Println(text.Indent(string(b.Bytes()), "   - "))
-	if c.isVerbose(req) {
+	sanitizeHeaders(rsp.Header, c.sensitive.allow).Write(b)
+	fmt.Fprintln(w, text.Indent(string(b.Bytes()), "   - "))
+	if c.isVerbose(req) && body {
 		d, err := io.ReadAll(rsp.Body)
 		if err != nil {
 			return err
 		}
 		if len(d) > 0 {
-			fmt.Fprintln(w, text.Indent(string(d), "   < "))
+			fmt.Fprintln(w, text.Indent(string(c.fields.body(rsp.Header.Get("Content-Type"), d)), "   < "))
 		}
 		rsp.Body = io.NopCloser(bytes.NewBuffer(d))
 	}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugWriter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	client, err := New(WithBaseURL(server.URL), WithDebugWriter(buf))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt := context.Background()
+
+	_, err = client.Get(cxt, "/quiet", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	_, err = client.Get(cxt, "/option", nil, WithDebug(true))
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "GET "+server.URL+"/option\n")
+	assert.Contains(t, buf.String(), "-> 204 No Content")
+
+	buf.Reset()
+	_, err = client.Get(ContextWithDebug(cxt), "/context", nil)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "GET "+server.URL+"/context\n")
+
+	buf.Reset()
+	_, err = client.Get(cxt, "/quiet", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String(), "debugging is not enabled for other requests")
+}
+
+func TestDebugEnvPrefix(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	t.Setenv("MYAPP_DEBUG_API_CLIENT", "true")
+	t.Setenv("MYAPP_DEBUG_API_CLIENT_FILTER", "^/loud")
+
+	mine, other := &bytes.Buffer{}, &bytes.Buffer{}
+	client, err := New(WithBaseURL(server.URL), WithDebugWriter(mine), WithEnvPrefix("MYAPP"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	unrelated, err := New(WithBaseURL(server.URL), WithDebugWriter(other), WithEnvPrefix("OTHER"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt := context.Background()
+
+	_, err = client.Get(cxt, "/loud", nil)
+	assert.NoError(t, err)
+	assert.Contains(t, mine.String(), "GET "+server.URL+"/loud\n")
+	assert.Contains(t, mine.String(), "   - Date: ")
+
+	mine.Reset()
+	_, err = client.Get(cxt, "/quiet", nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, mine.String(), "   - Date: ", "the prefixed filter applies")
+
+	_, err = unrelated.Get(cxt, "/loud", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", other.String())
+}
@@ -0,0 +1,89 @@
+// Package dedup filters items which have already been delivered to a
+// consumer, for polling workflows in which successive polls or overlapping
+// pages may produce the same items more than once.
+package dedup
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A store records the identities of items which have been delivered
+type Store interface {
+	// Mark records an identity as seen and reports whether it had already been
+	// seen within the store's window.
+	Mark(context.Context, string) (bool, error)
+}
+
+// An in-memory store which remembers identities for a limited window of time
+type Memory struct {
+	sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+	prune  time.Time
+}
+
+// NewMemory creates an in-memory store which remembers identities for the
+// provided window. A window of zero remembers identities indefinitely.
+func NewMemory(window time.Duration) *Memory {
+	return &Memory{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+func (m *Memory) Mark(cxt context.Context, id string) (bool, error) {
+	now := time.Now()
+	m.Lock()
+	defer m.Unlock()
+	if m.window > 0 && now.Sub(m.prune) > m.window {
+		m.pruneBefore(now.Add(-m.window))
+		m.prune = now
+	}
+	t, ok := m.seen[id]
+	if ok && (m.window <= 0 || now.Sub(t) < m.window) {
+		return true, nil
+	}
+	m.seen[id] = now
+	return false, nil
+}
+
+func (m *Memory) pruneBefore(t time.Time) {
+	for k, v := range m.seen {
+		if v.Before(t) {
+			delete(m.seen, k)
+		}
+	}
+}
+
+// A deduplicator filters items by their identity
+type Deduplicator[T any] struct {
+	ident func(T) string
+	store Store
+}
+
+// New creates a deduplicator which identifies items using the provided
+// function and records them in the provided store.
+func New[T any](ident func(T) string, store Store) *Deduplicator[T] {
+	return &Deduplicator[T]{
+		ident: ident,
+		store: store,
+	}
+}
+
+// Filter returns the items which have not previously been seen, in their
+// original order. Items are marked as seen as a result.
+func (d *Deduplicator[T]) Filter(cxt context.Context, items []T) ([]T, error) {
+	res := make([]T, 0, len(items))
+	for _, e := range items {
+		seen, err := d.store.Mark(cxt, d.ident(e))
+		if err != nil {
+			return nil, err
+		}
+		if !seen {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
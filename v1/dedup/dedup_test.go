@@ -0,0 +1,30 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeduplicate(t *testing.T) {
+	cxt := context.Background()
+	d := New(func(v string) string { return v }, NewMemory(time.Millisecond*50))
+
+	res, err := d.Filter(cxt, []string{"a", "b", "a", "c"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a", "b", "c"}, res)
+	}
+
+	res, err = d.Filter(cxt, []string{"c", "d"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"d"}, res)
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	res, err = d.Filter(cxt, []string{"a", "d"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a", "d"}, res)
+	}
+}
@@ -10,12 +10,17 @@ import (
 // A convenience for one-off requests
 var defaultClient = &Client{
 	Client: sharedClient,
-	dctype: JSON,
-	header: http.Header{
-		http.CanonicalHeaderKey("Content-Type"): []string{JSON},
-		http.CanonicalHeaderKey("Accept"):       []string{JSON},
+	settings: settings{
+		dctype: JSON,
+		header: http.Header{
+			http.CanonicalHeaderKey("Content-Type"): []string{JSON},
+			http.CanonicalHeaderKey("Accept"):       []string{JSON},
+		},
+		redact: defaultRedactor,
+		debug:  errors.Must(Debug{}.WithEnv()),
 	},
-	debug: errors.Must(Debug{}.WithEnv()),
+	metrics: newLazyMetrics(nil),
+	pause:   newPause(),
 }
 
 // A convenience for Exec with a GET request
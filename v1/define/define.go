@@ -0,0 +1,329 @@
+// Package define implements services which are declared rather than written.
+// A service is a struct whose function fields are annotated with the method
+// and path of the operation they perform:
+//
+//	type Users struct {
+//		Get    func(cxt context.Context, id string) (*User, error)           `method:"GET" path:"/users/{id}"`
+//		List   func(cxt context.Context, params ListParams) ([]*User, error) `method:"GET" path:"/users"`
+//		Create func(cxt context.Context, user *User) (*User, error)          `method:"POST" path:"/users"`
+//	}
+//
+//	users, err := define.New[Users](client)
+//
+// The arguments of a function are bound in order. An optional leading
+// context.Context is used for the request. Next, one argument is bound to each
+// placeholder in the path, in the order they appear. Of any remaining
+// arguments, a method which sends an entity binds the first to the request
+// entity, and the next argument is bound to query parameters, which may be
+// anything accepted by api.URLWithParams. An http.Header argument, anywhere
+// after the context, is added to the request headers and a final variadic
+// ...api.Option argument is passed through to the client.
+//
+// A function returns an error as its last result. Before it, it may return
+// the response entity, which is unmarshaled in the same way as the client
+// would, and the *http.Response.
+package define
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	api "github.com/bww/go-apiclient/v1"
+)
+
+var ErrInvalidDefinition = errors.New("Invalid service definition")
+
+var (
+	typeContext  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeError    = reflect.TypeOf((*error)(nil)).Elem()
+	typeResponse = reflect.TypeOf((*http.Response)(nil))
+	typeHeader   = reflect.TypeOf(http.Header(nil))
+	typeOptions  = reflect.TypeOf([]api.Option(nil))
+)
+
+// New creates an implementation of the service definition T, which must be a
+// struct type, backed by the provided client.
+func New[T any](client *api.Client) (*T, error) {
+	svc := new(T)
+	err := Implement(client, svc)
+	if err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+// Implement the service definition pointed to by svc, backed by the provided
+// client. Each exported function field which is tagged with a path is set to
+// an implementation of its operation; other fields are left unchanged.
+func Implement(client *api.Client, svc interface{}) error {
+	v := reflect.ValueOf(svc)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T is not a pointer to a struct", ErrInvalidDefinition, svc)
+	}
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		path, ok := f.Tag.Lookup("path")
+		if !ok || !f.IsExported() {
+			continue
+		}
+		if f.Type.Kind() != reflect.Func {
+			return fmt.Errorf("%w: %s.%s is not a function", ErrInvalidDefinition, t.Name(), f.Name)
+		}
+		op, err := newOperation(f.Tag.Get("method"), path, f.Tag.Get("content"), f.Type)
+		if err != nil {
+			return fmt.Errorf("%w: %s.%s: %v", ErrInvalidDefinition, t.Name(), f.Name, err)
+		}
+		v.Field(i).Set(reflect.MakeFunc(f.Type, func(args []reflect.Value) []reflect.Value {
+			return op.call(client, args)
+		}))
+	}
+	return nil
+}
+
+// The kinds of arguments which may be substituted into a path
+var pathKinds = map[reflect.Kind]struct{}{
+	reflect.String: {}, reflect.Bool: {},
+	reflect.Int: {}, reflect.Int8: {}, reflect.Int16: {}, reflect.Int32: {}, reflect.Int64: {},
+	reflect.Uint: {}, reflect.Uint8: {}, reflect.Uint16: {}, reflect.Uint32: {}, reflect.Uint64: {},
+	reflect.Float32: {}, reflect.Float64: {},
+}
+
+// An operation describes how the arguments of a function are bound to a
+// request and how its results are produced from the response.
+type operation struct {
+	method  string
+	path    []string // literal segments and placeholders, alternating
+	ctype   string
+	cxt     int // the index of each argument, or -1 if there is none
+	header  int
+	entity  int
+	params  int
+	opts    int
+	pargs   []int
+	output  reflect.Type
+	outptr  bool
+	rspidx  int
+	erridx  int
+	nresult int
+}
+
+func newOperation(method, path, ctype string, t reflect.Type) (*operation, error) {
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	op := &operation{
+		method: method,
+		ctype:  ctype,
+		cxt:    -1,
+		header: -1,
+		entity: -1,
+		params: -1,
+		opts:   -1,
+		rspidx: -1,
+		path:   splitPath(path),
+	}
+
+	// bind arguments
+	i, n := 0, t.NumIn()
+	if t.IsVariadic() {
+		if t.In(n-1) != typeOptions {
+			return nil, fmt.Errorf("variadic argument must be ...api.Option")
+		}
+		op.opts = n - 1
+		n--
+	}
+	if i < n && t.In(i) == typeContext {
+		op.cxt = i
+		i++
+	}
+	var rest []int
+	for ; i < n; i++ {
+		a := t.In(i)
+		switch {
+		case a == typeHeader && op.header < 0:
+			op.header = i
+		case len(op.pargs) < len(op.path)/2:
+			if _, ok := pathKinds[a.Kind()]; !ok {
+				return nil, fmt.Errorf("argument %d (%v) cannot be substituted into the path", i, a)
+			}
+			op.pargs = append(op.pargs, i)
+		default:
+			rest = append(rest, i)
+		}
+	}
+	if len(op.pargs) < len(op.path)/2 {
+		return nil, fmt.Errorf("path has %d placeholders but only %d arguments are bound to it", len(op.path)/2, len(op.pargs))
+	}
+	if sendsEntity(method) && len(rest) > 0 {
+		op.entity, rest = rest[0], rest[1:]
+	}
+	if len(rest) > 0 {
+		op.params, rest = rest[0], rest[1:]
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("argument %d (%v) is not bound to the request", rest[0], t.In(rest[0]))
+	}
+
+	// bind results
+	op.nresult = t.NumOut()
+	if op.nresult < 1 || t.Out(op.nresult-1) != typeError {
+		return nil, fmt.Errorf("last result must be an error")
+	}
+	op.erridx = op.nresult - 1
+	for i := 0; i < op.erridx; i++ {
+		r := t.Out(i)
+		switch {
+		case r == typeResponse && op.rspidx < 0:
+			op.rspidx = i
+		case op.output == nil && op.rspidx < 0:
+			op.output = r
+			op.outptr = r.Kind() == reflect.Pointer
+		default:
+			return nil, fmt.Errorf("result %d (%v) is not supported; results are [entity,] [*http.Response,] error", i, r)
+		}
+	}
+	return op, nil
+}
+
+func sendsEntity(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// Split a path into literal segments and placeholders, such that even
+// elements are literal and odd elements are placeholder names.
+func splitPath(path string) []string {
+	var res []string
+	for {
+		i := strings.Index(path, "{")
+		j := strings.Index(path, "}")
+		if i < 0 || j < i {
+			return append(res, path)
+		}
+		res = append(res, path[:i], path[i+1:j])
+		path = path[j+1:]
+	}
+}
+
+// Perform the operation for a call to its function
+func (op *operation) call(client *api.Client, args []reflect.Value) []reflect.Value {
+	rsp, out, err := op.exec(client, args)
+	res := make([]reflect.Value, op.nresult)
+	if op.output != nil { // the entity is always the first result
+		if err == nil {
+			res[0] = out
+		} else {
+			res[0] = reflect.Zero(op.output)
+		}
+	}
+	if op.rspidx >= 0 {
+		res[op.rspidx] = reflect.ValueOf(rsp)
+	}
+	if err != nil {
+		res[op.erridx] = reflect.ValueOf(&err).Elem()
+	} else {
+		res[op.erridx] = reflect.Zero(typeError)
+	}
+	return res
+}
+
+func (op *operation) exec(client *api.Client, args []reflect.Value) (*http.Response, reflect.Value, error) {
+	cxt := context.Background()
+	if op.cxt >= 0 {
+		if v, ok := args[op.cxt].Interface().(context.Context); ok && v != nil {
+			cxt = v
+		}
+	}
+
+	b := &strings.Builder{}
+	for i, e := range op.path {
+		if i%2 == 0 {
+			b.WriteString(e)
+		} else {
+			b.WriteString(url.PathEscape(fmt.Sprint(args[op.pargs[i/2]].Interface())))
+		}
+	}
+	u := b.String()
+	if op.params >= 0 {
+		var err error
+		u, err = api.URLWithParams(u, args[op.params].Interface())
+		if err != nil {
+			return nil, reflect.Value{}, err
+		}
+	}
+
+	var opts []api.Option
+	if op.header >= 0 {
+		if hdr, _ := args[op.header].Interface().(http.Header); len(hdr) > 0 {
+			opts = append(opts, api.WithHeaders(hdr))
+		}
+	}
+	if op.ctype != "" {
+		opts = append(opts, api.WithContentType(op.ctype))
+	}
+	if op.opts >= 0 {
+		opts = append(opts, args[op.opts].Interface().([]api.Option)...)
+	}
+
+	var input interface{}
+	if op.entity >= 0 {
+		if v := args[op.entity]; !isNil(v) {
+			input = v.Interface()
+		}
+	}
+	var out reflect.Value
+	var output interface{}
+	if op.output != nil {
+		if op.outptr {
+			out = reflect.New(op.output.Elem())
+			output = out.Interface()
+		} else {
+			p := reflect.New(op.output)
+			out = p.Elem()
+			output = p.Interface()
+		}
+	}
+
+	var rsp *http.Response
+	var err error
+	switch op.method {
+	case http.MethodGet:
+		rsp, err = client.Get(cxt, u, output, opts...)
+	case http.MethodPost:
+		rsp, err = client.Post(cxt, u, input, output, opts...)
+	case http.MethodPut:
+		rsp, err = client.Put(cxt, u, input, output, opts...)
+	case http.MethodPatch:
+		rsp, err = client.Patch(cxt, u, input, output, opts...)
+	case http.MethodDelete:
+		rsp, err = client.Delete(cxt, u, input, output, opts...)
+	default:
+		var req *http.Request
+		req, err = http.NewRequestWithContext(cxt, op.method, u, nil)
+		if err == nil {
+			rsp, err = client.Exec(req, output, opts...)
+		}
+	}
+	return rsp, out, err
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
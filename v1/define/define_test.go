@@ -0,0 +1,129 @@
+package define
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	api "github.com/bww/go-apiclient/v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type listParams struct {
+	Limit int `url:"limit,omitempty"`
+}
+
+type users struct {
+	Get    func(cxt context.Context, id string) (*user, error)                                  `method:"GET" path:"/users/{id}"`
+	List   func(cxt context.Context, params listParams, opts ...api.Option) ([]user, error)     `method:"GET" path:"/users"`
+	Create func(cxt context.Context, u *user, hdr http.Header) (*user, *http.Response, error)   `method:"POST" path:"/users"`
+	Rename func(cxt context.Context, id string, u user, params map[string]string) (user, error) `method:"PATCH" path:"/users/{id}"`
+	Delete func(id string) error                                                                `method:"DELETE" path:"/users/{id}"`
+	Other  string
+}
+
+func TestDefine(t *testing.T) {
+	var reqs []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqs = append(reqs, r.Method+" "+r.URL.String()+" "+r.Header.Get("X-Test"))
+		var in user
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&in)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/users":
+			json.NewEncoder(w).Encode([]user{{Id: "1", Name: "A"}, {Id: "2", Name: "B"}})
+		case r.Method == http.MethodGet && r.URL.Path == "/users/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode(user{Id: r.URL.Path[len("/users/"):], Name: "A"})
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(user{Id: "3", Name: in.Name})
+		}
+	}))
+	defer s.Close()
+
+	c, err := api.New(api.WithBaseURL(s.URL))
+	assert.NoError(t, err)
+	svc, err := New[users](c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt := context.Background()
+
+	u, err := svc.Get(cxt, "a/b")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &user{Id: "a/b", Name: "A"}, u)
+	}
+	u, err = svc.Get(cxt, "missing")
+	assert.Nil(t, u)
+	assert.True(t, errors.Is(err, api.ErrNotFound), err)
+
+	l, err := svc.List(cxt, listParams{Limit: 2}, api.WithHeader("X-Test", "list"))
+	if assert.NoError(t, err) {
+		assert.Len(t, l, 2)
+	}
+
+	u, rsp, err := svc.Create(cxt, &user{Name: "C"}, http.Header{"X-Test": {"create"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, &user{Id: "3", Name: "C"}, u)
+		assert.Equal(t, http.StatusCreated, rsp.StatusCode)
+	}
+
+	r, err := svc.Rename(cxt, "3", user{Name: "D"}, map[string]string{"notify": "true"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, user{Id: "3", Name: "D"}, r)
+	}
+
+	assert.NoError(t, svc.Delete("3"))
+
+	assert.Equal(t, []string{
+		"GET /users/a%2Fb ",
+		"GET /users/missing ",
+		"GET /users?limit=2 list",
+		"POST /users create",
+		"PATCH /users/3?notify=true ",
+		"DELETE /users/3 ",
+	}, reqs)
+}
+
+func TestInvalidDefinition(t *testing.T) {
+	c, err := api.New()
+	assert.NoError(t, err)
+
+	tests := []interface{}{
+		&struct {
+			Get func(cxt context.Context) (*user, error) `path:"/users/{id}"`
+		}{},
+		&struct {
+			Get func(cxt context.Context, id []string) error `path:"/users/{id}"`
+		}{},
+		&struct {
+			Get func(cxt context.Context, id string) *user `path:"/users/{id}"`
+		}{},
+		&struct {
+			Get func(cxt context.Context, a, b listParams) error `path:"/users"`
+		}{},
+		&struct {
+			Get string `path:"/users"`
+		}{},
+		struct{}{},
+	}
+	for i, e := range tests {
+		err := Implement(c, e)
+		assert.ErrorIs(t, err, ErrInvalidDefinition, "#%d", i)
+	}
+}
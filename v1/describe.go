@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bww/go-util/v1/ext"
+)
+
+// A description of a client's effective configuration. Sensitive values are
+// redacted, so a description is suitable for inclusion in diagnostics and
+// support requests. Components such as authorizers and rate limiters are
+// described by their type.
+type ConfigDescription struct {
+	BaseURL      string                       `json:"base_url,omitempty"`
+	FallbackURLs []string                     `json:"fallback_urls,omitempty"`
+	Timeout      string                       `json:"timeout"`
+	RetryStatus  []int                        `json:"retry_status"`
+	RetryDelay   string                       `json:"retry_delay"`
+	Methods      map[string]PolicyDescription `json:"methods,omitempty"`
+	RateLimiter  string                       `json:"rate_limiter,omitempty"`
+	Authorizer   string                       `json:"authorizer,omitempty"`
+	Header       http.Header                  `json:"header,omitempty"`
+	Correlation  []string                     `json:"correlation,omitempty"`
+	ContentType  string                       `json:"content_type"`
+	Validator    string                       `json:"validator,omitempty"`
+	Observers    []string                     `json:"observers,omitempty"`
+	RedactParams []string                     `json:"redact_params"`
+	Singleflight bool                         `json:"singleflight"`
+	Cache        string                       `json:"cache,omitempty"`
+	PauseFail    bool                         `json:"pause_fail"`
+	Paused       bool                         `json:"paused"`
+	Debug        bool                         `json:"debug"`
+	Verbose      bool                         `json:"verbose"`
+}
+
+// A description of a method policy
+type PolicyDescription struct {
+	RateLimiter string `json:"rate_limiter,omitempty"`
+	RetryStatus []int  `json:"retry_status"`
+	RetryDelay  string `json:"retry_delay"`
+}
+
+// DescribeConfig produces a redacted, serializable snapshot of the client's
+// effective configuration.
+func (c *Client) DescribeConfig() ConfigDescription {
+	var timeout time.Duration
+	if c.Client != nil {
+		timeout = c.Client.Timeout
+	}
+	desc := ConfigDescription{
+		BaseURL:      c.redact.url(c.base),
+		Timeout:      timeout.String(),
+		RetryStatus:  statusList(c.retry),
+		RetryDelay:   ext.Coalesce(c.backoff, backoffDefault).String(),
+		RateLimiter:  typeName(c.limiter),
+		Authorizer:   typeName(c.auth),
+		Header:       sanitizeHeaders(c.header, c.sensitive.allow),
+		ContentType:  c.dctype,
+		Validator:    typeName(c.valid),
+		RedactParams: paramList(c.redact),
+		Singleflight: c.flight != nil,
+		Cache:        typeName(c.cache),
+		PauseFail:    c.pfail,
+		Debug:        c.debug.Debug,
+		Verbose:      c.debug.Verbose,
+	}
+	_, _, desc.Paused = c.Paused()
+	if len(c.methods) > 0 {
+		desc.Methods = make(map[string]PolicyDescription)
+		for k, v := range c.methods {
+			p := v.resolve(policy{limiter: c.limiter, retry: c.retry, backoff: c.backoff})
+			desc.Methods[k] = PolicyDescription{
+				RateLimiter: typeName(p.limiter),
+				RetryStatus: statusList(p.retry),
+				RetryDelay:  ext.Coalesce(p.backoff, backoffDefault).String(),
+			}
+		}
+	}
+	if c.bases != nil {
+		for _, e := range c.bases.bases[1:] {
+			desc.FallbackURLs = append(desc.FallbackURLs, c.redact.url(e.url))
+		}
+	}
+	for _, e := range c.correl {
+		desc.Correlation = append(desc.Correlation, e.Header)
+	}
+	for _, e := range c.observe {
+		desc.Observers = append(desc.Observers, typeName(e))
+	}
+	return desc
+}
+
+func typeName(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func statusList(s map[int]struct{}) []int {
+	res := make([]int, 0, len(s))
+	for k := range s {
+		res = append(res, k)
+	}
+	sort.Ints(res)
+	return res
+}
+
+func paramList(r redactor) []string {
+	res := make([]string, 0, len(r))
+	for k := range r {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
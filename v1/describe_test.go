@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeConfig(t *testing.T) {
+	c, err := New(
+		WithBaseURL("https://example.com/v1/?token=secret"),
+		WithAuthorizer(NewBearerAuthorizer("token")),
+		WithRetryStatus(http.StatusServiceUnavailable, http.StatusBadGateway),
+		WithMethodPolicy(http.MethodPost, Policy{RetryStatus: NoRetries}),
+		WithHeader("Authorization", "secret"),
+		WithHeader("X-Test", "yes"),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	desc := c.DescribeConfig()
+	assert.Equal(t, "https://example.com/v1/?token=REDACTED", desc.BaseURL)
+	assert.Equal(t, "api.BearerAuthorizer", desc.Authorizer)
+	assert.Equal(t, []int{http.StatusBadGateway, http.StatusServiceUnavailable}, desc.RetryStatus)
+	assert.Equal(t, []int{}, desc.Methods[http.MethodPost].RetryStatus)
+	assert.Equal(t, "yes", desc.Header.Get("X-Test"))
+	assert.NotContains(t, desc.Header.Get("Authorization"), "secret")
+}
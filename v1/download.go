@@ -0,0 +1,385 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("Checksum mismatch")
+	ErrInvalidChecksum  = errors.New("Invalid checksum")
+)
+
+// File configuration applies to transferring files with DownloadFile and
+// UploadFile. Options which only apply to one of them are ignored by the other.
+type FileConfig struct {
+	Hash        func() hash.Hash
+	Checksum    []byte
+	Resume      bool
+	Mode        os.FileMode
+	Method      string
+	ContentType string
+	Field       string
+	Filename    string
+	Progress    func(n, total int64)
+	Options     []Option
+	err         error // an invalid option, which fails the transfer before it starts
+}
+
+func (c FileConfig) WithOptions(opts []FileOption) FileConfig {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type FileOption func(FileConfig) FileConfig
+
+// WithChecksum requires that the downloaded file has the provided checksum
+// when computed by the provided hash. When no checksum is provided, one is
+// verified if the response has a Digest, Repr-Digest, or Content-MD5 header.
+func WithChecksum(h func() hash.Hash, sum []byte) FileOption {
+	return func(c FileConfig) FileConfig {
+		c.Hash, c.Checksum = h, sum
+		return c
+	}
+}
+
+// WithSHA256 requires that the downloaded file has the provided hex-encoded
+// SHA-256 checksum. A checksum which is not valid fails the download with
+// ErrInvalidChecksum before anything is requested.
+func WithSHA256(sum string) FileOption {
+	return func(c FileConfig) FileConfig {
+		b, err := hex.DecodeString(sum)
+		if err == nil && len(b) != sha256.Size {
+			err = fmt.Errorf("expected %d bytes, got %d", sha256.Size, len(b))
+		}
+		if err != nil {
+			c.err = fmt.Errorf("%w: SHA-256 %q: %v", ErrInvalidChecksum, sum, err)
+			return c
+		}
+		c.Hash, c.Checksum = sha256.New, b
+		return c
+	}
+}
+
+// WithResume causes an interrupted download to be resumed from where it left
+// off, using a range request, the next time the same file is downloaded. The
+// partial file is kept alongside the destination with the suffix ".download"
+// and the entity tag or modification time of the resource is kept with the
+// suffix ".download.validator", so that a resource which has changed since is
+// downloaded again from the start.
+func WithResume() FileOption {
+	return func(c FileConfig) FileConfig {
+		c.Resume = true
+		return c
+	}
+}
+
+// WithFileMode sets the permissions of the downloaded file; by default, 0644.
+func WithFileMode(m os.FileMode) FileOption {
+	return func(c FileConfig) FileConfig {
+		c.Mode = m
+		return c
+	}
+}
+
+// WithProgress sets a function which is periodically provided the number of
+// bytes of a file which have been transferred and the total, which is -1 if it
+// is not known.
+func WithProgress(fn func(n, total int64)) FileOption {
+	return func(c FileConfig) FileConfig {
+		c.Progress = fn
+		return c
+	}
+}
+
+// WithRequestOptions sets per-request options which are used to perform the
+// request which transfers a file.
+func WithRequestOptions(opts ...Option) FileOption {
+	return func(c FileConfig) FileConfig {
+		c.Options = append(c.Options, opts...)
+		return c
+	}
+}
+
+// DownloadFile downloads the resource at the provided URL to a file at the
+// provided path. The response is streamed to a temporary file in the same
+// directory, its checksum is verified, if one is expected, and only then is it
+// renamed to the destination, so the destination never contains a partial or
+// corrupt download. The returned response describes the download; its body
+// has already been consumed.
+func (c *Client) DownloadFile(cxt context.Context, u, path string, opts ...FileOption) (*http.Response, error) {
+	conf := FileConfig{Mode: 0644}.WithOptions(opts)
+	if conf.err != nil {
+		return nil, conf.err
+	}
+
+	var f *os.File
+	var err error
+	if conf.Resume {
+		f, err = os.OpenFile(path+".download", os.O_RDWR|os.O_CREATE, conf.Mode)
+	} else {
+		f, err = os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.download")
+	}
+	if err != nil {
+		return nil, err
+	}
+	vpath := path + ".download.validator"
+	keep := false
+	defer func() {
+		f.Close()
+		if !keep {
+			os.Remove(f.Name())
+			if conf.Resume {
+				os.Remove(vpath)
+			}
+		}
+	}()
+
+	var offset int64
+	var validator string
+	if conf.Resume {
+		offset, err = f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if v, err := os.ReadFile(vpath); err == nil {
+			validator = strings.TrimSpace(string(v))
+		}
+	}
+
+	req, err := http.NewRequestWithContext(cxt, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	ropts := append([]Option(nil), conf.Options...)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator) // the entire resource is sent instead if it has changed
+		}
+		ropts = append(ropts, WithSuccessStatuses(func(s int) bool {
+			return isSuccess(s) || s == http.StatusRequestedRangeNotSatisfiable
+		}))
+	}
+	rsp, err := c.ExecRaw(req, ropts...)
+	if err != nil {
+		keep = conf.Resume
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusPartialContent:
+		start, ok := contentRangeStart(rsp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return nil, fmt.Errorf("Could not resume download at %d: unexpected range: %s", offset, rsp.Header.Get("Content-Range"))
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if total, ok := contentRangeTotal(rsp.Header.Get("Content-Range")); (ok && total == offset) || conf.Hash != nil {
+			break // the partial file is already complete, or its checksum will determine if it is
+		}
+		// the partial file cannot be shown to be the resource; start over
+		if err := f.Truncate(0); err != nil {
+			return nil, err
+		}
+		keep = true // the partial file belongs to the download which starts over
+		return c.DownloadFile(cxt, u, path, opts...)
+	default:
+		if err := f.Truncate(0); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		offset = 0
+		if conf.Resume {
+			if err := saveValidator(vpath, rsp.Header, conf.Mode); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	hfn, expect := conf.Hash, conf.Checksum
+	if hfn == nil {
+		hfn, expect = digestFromHeader(rsp.Header, rsp.StatusCode == http.StatusOK)
+	}
+	var sum hash.Hash
+	if hfn != nil {
+		sum = hfn()
+		if offset > 0 { // include the part we already have
+			if _, err := io.Copy(sum, io.NewSectionReader(f, 0, offset)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var dst io.Writer = f
+	if sum != nil {
+		dst = io.MultiWriter(f, sum)
+	}
+	if rsp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		var src io.Reader = rsp.Body
+		if conf.Progress != nil {
+			total := int64(-1)
+			if rsp.ContentLength >= 0 {
+				total = offset + rsp.ContentLength
+			}
+			src = &progressReader{Reader: src, n: offset, total: total, fn: conf.Progress}
+		}
+		_, err = io.Copy(dst, src)
+		if err != nil {
+			keep = conf.Resume
+			return nil, err
+		}
+	}
+
+	if sum != nil {
+		if actual := sum.Sum(nil); !bytes.Equal(actual, expect) {
+			return nil, fmt.Errorf("%w: expected %x, got %x", ErrChecksumMismatch, expect, actual)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(conf.Mode); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return nil, err
+	}
+	keep = true
+	if conf.Resume {
+		os.Remove(vpath)
+	}
+	return rsp, nil
+}
+
+// Record the validator with which a partial download of the resource
+// described by response headers may be resumed: its entity tag, if it is
+// strong, or its modification time. If there is neither, any previous
+// validator is removed.
+func saveValidator(path string, hdr http.Header, mode os.FileMode) error {
+	v := hdr.Get("ETag")
+	if v == "" || strings.HasPrefix(v, "W/") { // weak tags cannot be used with If-Range
+		v = hdr.Get("Last-Modified")
+	}
+	if v == "" {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return os.WriteFile(path, []byte(v), mode)
+}
+
+// Parse the complete length from a Content-Range header, if it is known
+func contentRangeTotal(v string) (int64, bool) {
+	_, v, ok := strings.Cut(v, "/")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	return n, err == nil
+}
+
+// Parse the first byte position from a Content-Range header
+func contentRangeStart(v string) (int64, bool) {
+	v, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	v, _, ok = strings.Cut(v, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	return n, err == nil
+}
+
+// Produce the hash and the expected checksum described by the headers of a
+// response, if any. Repr-Digest (RFC 9530) and Digest (RFC 3230) describe the
+// entire resource; Content-MD5 describes the response body, so it is only
+// considered when the body is the entire resource.
+func digestFromHeader(hdr http.Header, whole bool) (func() hash.Hash, []byte) {
+	for _, e := range hdr.Values("Repr-Digest") {
+		for _, d := range strings.Split(e, ",") {
+			k, v, ok := strings.Cut(strings.TrimSpace(d), "=")
+			if !ok {
+				continue
+			}
+			if fn := digestHash(k); fn != nil {
+				if sum, err := base64.StdEncoding.DecodeString(strings.Trim(v, ":")); err == nil {
+					return fn, sum
+				}
+			}
+		}
+	}
+	for _, e := range hdr.Values("Digest") {
+		for _, d := range strings.Split(e, ",") {
+			k, v, ok := strings.Cut(strings.TrimSpace(d), "=")
+			if !ok {
+				continue
+			}
+			if fn := digestHash(k); fn != nil {
+				if sum, err := base64.StdEncoding.DecodeString(v); err == nil {
+					return fn, sum
+				}
+			}
+		}
+	}
+	if v := hdr.Get("Content-MD5"); v != "" && whole {
+		if sum, err := base64.StdEncoding.DecodeString(v); err == nil {
+			return md5.New, sum
+		}
+	}
+	return nil, nil
+}
+
+func digestHash(alg string) func() hash.Hash {
+	switch strings.ToLower(alg) {
+	case "sha-256":
+		return sha256.New
+	case "sha-512":
+		return sha512.New
+	case "md5":
+		return md5.New
+	default:
+		return nil
+	}
+}
+
+// A reader which reports its progress
+type progressReader struct {
+	io.Reader
+	n, total int64
+	fn       func(n, total int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.n += int64(n)
+		r.fn(r.n, r.total)
+	}
+	return n, err
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadFile(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(data)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		if req.URL.Path == "/digest" {
+			rsp.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		if req.URL.Path == "/corrupt" {
+			rsp.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(make([]byte, 32)))
+		}
+		http.ServeContent(rsp, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	cxt := context.Background()
+	dir := t.TempDir()
+
+	c, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	dst := filepath.Join(dir, "a")
+	_, err = c.DownloadFile(cxt, "/digest", dst)
+	if assert.NoError(t, err) {
+		have, _ := os.ReadFile(dst)
+		assert.Equal(t, data, have)
+	}
+
+	dst = filepath.Join(dir, "b")
+	_, err = c.DownloadFile(cxt, "/corrupt", dst)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = os.Stat(dst)
+	assert.True(t, os.IsNotExist(err), "the destination is not created")
+
+	_, err = c.DownloadFile(cxt, "/plain", dst, WithSHA256(hex.EncodeToString(make([]byte, 32))))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	ranges = nil
+	for _, e := range []string{"not hex", "abcd"} {
+		_, err = c.DownloadFile(cxt, "/plain", dst, WithSHA256(e))
+		assert.ErrorIs(t, err, ErrInvalidChecksum, e)
+	}
+	assert.Len(t, ranges, 0, "nothing is requested with an invalid checksum")
+
+	dst = filepath.Join(dir, "c")
+	assert.NoError(t, os.WriteFile(dst+".download", data[:4000], 0644))
+	ranges = nil
+	rsp, err := c.DownloadFile(cxt, "/digest", dst, WithResume(), WithSHA256(hex.EncodeToString(sum[:])), WithFileMode(0600))
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusPartialContent, rsp.StatusCode)
+		assert.Equal(t, []string{"bytes=4000-"}, ranges)
+		have, _ := os.ReadFile(dst)
+		assert.Equal(t, data, have)
+		info, err := os.Stat(dst)
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		}
+		_, err = os.Stat(dst + ".download")
+		assert.True(t, os.IsNotExist(err), "the partial file is moved into place")
+	}
+
+	assert.NoError(t, os.WriteFile(dst+".download", data, 0644))
+	_, err = c.DownloadFile(cxt, "/digest", dst, WithResume())
+	if assert.NoError(t, err, "a complete partial file is not downloaded again") {
+		have, _ := os.ReadFile(dst)
+		assert.Equal(t, data, have)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if assert.NoError(t, err) {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		assert.Equal(t, []string{"a", "c"}, names, "temporary files are removed")
+	}
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	etag := `"v2"`
+	var ranges, validators []string
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		validators = append(validators, req.Header.Get("If-Range"))
+		rsp.Header().Set("ETag", etag)
+		if req.URL.Path == "/interrupted" {
+			rsp.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			rsp.Write(data[:4000])
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(rsp, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	cxt := context.Background()
+	dst := filepath.Join(t.TempDir(), "a")
+
+	c, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = c.DownloadFile(cxt, "/interrupted", dst, WithResume())
+	assert.Error(t, err)
+	v, err := os.ReadFile(dst + ".download.validator")
+	if assert.NoError(t, err, "the validator is kept with the partial file") {
+		assert.Equal(t, etag, string(v))
+	}
+
+	ranges, validators = nil, nil
+	rsp, err := c.DownloadFile(cxt, "/file", dst, WithResume())
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusPartialContent, rsp.StatusCode)
+		assert.Equal(t, []string{"bytes=4000-"}, ranges)
+		assert.Equal(t, []string{etag}, validators)
+		have, _ := os.ReadFile(dst)
+		assert.Equal(t, data, have)
+		_, err = os.Stat(dst + ".download.validator")
+		assert.True(t, os.IsNotExist(err), "the validator is removed once the download is complete")
+	}
+
+	// the resource has changed since the partial file was downloaded
+	assert.NoError(t, os.WriteFile(dst+".download", bytes.Repeat([]byte("x"), 4000), 0644))
+	assert.NoError(t, os.WriteFile(dst+".download.validator", []byte(`"v1"`), 0644))
+	ranges, validators = nil, nil
+	rsp, err = c.DownloadFile(cxt, "/file", dst, WithResume())
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, rsp.StatusCode)
+		assert.Equal(t, []string{`"v1"`}, validators)
+		have, _ := os.ReadFile(dst)
+		assert.Equal(t, data, have, "the download starts over")
+	}
+
+	// the partial file is longer than the resource, so it cannot be complete
+	assert.NoError(t, os.WriteFile(dst+".download", append(data, "extra"...), 0644))
+	assert.NoError(t, os.WriteFile(dst+".download.validator", []byte(etag), 0644))
+	ranges = nil
+	rsp, err = c.DownloadFile(cxt, "/file", dst, WithResume())
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, rsp.StatusCode)
+		assert.Equal(t, []string{fmt.Sprintf("bytes=%d-", len(data)+5), ""}, ranges)
+		have, _ := os.ReadFile(dst)
+		assert.Equal(t, data, have, "the download starts over")
+	}
+}
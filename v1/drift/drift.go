@@ -0,0 +1,211 @@
+// Package drift provides an observer which detects changes in the shape of
+// responses produced by an API over time. This can give early warning of
+// vendor API changes before they break strict decoding.
+package drift
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	api "github.com/bww/go-apiclient/v1"
+	"github.com/bww/go-apiclient/v1/events"
+)
+
+// A shape maps the path of every field in a response to its JSON type
+type Shape map[string]string
+
+// Fields returns the paths of every field in the shape in lexical order
+func (s Shape) Fields() []string {
+	res := make([]string, 0, len(s))
+	for k := range s {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// A keyer derives an endpoint identifier from a request
+type Keyer func(*http.Request) string
+
+// DefaultKeyer identifies an endpoint by its method and path
+func DefaultKeyer(req *http.Request) string {
+	return req.Method + " " + req.URL.Path
+}
+
+type Config struct {
+	Keyer    Keyer
+	Listener events.Listener
+}
+
+func (c Config) WithOptions(opts []Option) Config {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type Option func(Config) Config
+
+// WithKeyer sets the function used to identify endpoints. Endpoints with
+// variable path components should generally be normalized by the keyer, e.g.
+// "/users/123" to "/users/{id}".
+func WithKeyer(k Keyer) Option {
+	return func(c Config) Config {
+		c.Keyer = k
+		return c
+	}
+}
+
+// WithListener sets the listener which receives drift events
+func WithListener(l events.Listener) Option {
+	return func(c Config) Config {
+		c.Listener = l
+		return c
+	}
+}
+
+// A recorder fingerprints the shape of JSON responses per endpoint and
+// reports fields which appear, disappear, or change type relative to the
+// previously observed response from the same endpoint.
+type Recorder struct {
+	sync.Mutex
+	keyer  Keyer
+	listen events.Listener
+	shapes map[string]Shape
+}
+
+var _ api.Observer = (*Recorder)(nil)
+
+func New(opts ...Option) *Recorder {
+	conf := Config{
+		Keyer: DefaultKeyer,
+	}.WithOptions(opts)
+	return &Recorder{
+		keyer:  conf.Keyer,
+		listen: conf.Listener,
+		shapes: make(map[string]Shape),
+	}
+}
+
+// Shape returns the most recently observed shape for an endpoint, if any
+func (r *Recorder) Shape(endpoint string) Shape {
+	r.Lock()
+	defer r.Unlock()
+	return r.shapes[endpoint]
+}
+
+func (r *Recorder) Preflight(req *http.Request) error {
+	return nil
+}
+
+func (r *Recorder) Failure(req *http.Request, err error) {}
+
+func (r *Recorder) Postflight(req *http.Request, rsp *http.Response) error {
+	m, _, err := mime.ParseMediaType(rsp.Header.Get("Content-Type"))
+	if err != nil || strings.ToLower(m) != api.JSON || rsp.Body == nil {
+		return nil // only JSON responses can be fingerprinted
+	}
+
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	rsp.Body = io.NopCloser(bytes.NewBuffer(data))
+
+	var v interface{}
+	err = json.Unmarshal(data, &v)
+	if err != nil {
+		return nil // not our problem; unmarshaling will report this
+	}
+
+	r.Record(r.keyer(req), Fingerprint(v))
+	return nil
+}
+
+// Record the shape of a response for an endpoint, reporting any drift
+// relative to the previously recorded shape.
+func (r *Recorder) Record(endpoint string, shape Shape) {
+	r.Lock()
+	prev, ok := r.shapes[endpoint]
+	r.shapes[endpoint] = shape
+	r.Unlock()
+	if !ok || r.listen == nil {
+		return // nothing to compare with or nobody to tell
+	}
+	if d, ok := compare(endpoint, prev, shape); ok {
+		r.listen.Receive(d)
+	}
+}
+
+func compare(endpoint string, prev, curr Shape) (events.SchemaDrift, bool) {
+	d := events.SchemaDrift{
+		Endpoint: endpoint,
+		Added:    make(map[string]string),
+		Removed:  make(map[string]string),
+		Changed:  make(map[string]string),
+	}
+	for k, v := range curr {
+		if p, ok := prev[k]; !ok {
+			d.Added[k] = v
+		} else if p != v {
+			d.Changed[k] = v
+		}
+	}
+	for k, v := range prev {
+		if _, ok := curr[k]; !ok {
+			d.Removed[k] = v
+		}
+	}
+	return d, len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Changed) > 0
+}
+
+// Fingerprint computes the shape of a decoded JSON value. Array elements are
+// merged under the path component '#'.
+func Fingerprint(v interface{}) Shape {
+	s := make(Shape)
+	fingerprint(s, "", v)
+	return s
+}
+
+func fingerprint(s Shape, p string, v interface{}) {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		if p != "" {
+			s[p] = "object"
+		}
+		for k, e := range c {
+			fingerprint(s, join(p, k), e)
+		}
+	case []interface{}:
+		if p != "" {
+			s[p] = "array"
+		}
+		for _, e := range c {
+			fingerprint(s, join(p, "#"), e)
+		}
+	case string:
+		s[p] = "string"
+	case float64, json.Number:
+		s[p] = "number"
+	case bool:
+		s[p] = "boolean"
+	case nil:
+		if _, ok := s[p]; !ok { // null is less specific than any other type
+			s[p] = "null"
+		}
+	}
+}
+
+func join(p, k string) string {
+	if p == "" {
+		return k
+	}
+	return p + "." + k
+}
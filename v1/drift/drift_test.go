@@ -0,0 +1,44 @@
+package drift
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bww/go-apiclient/v1/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func shapeOf(t *testing.T, s string) Shape {
+	var v interface{}
+	err := json.Unmarshal([]byte(s), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Fingerprint(v)
+}
+
+func TestDrift(t *testing.T) {
+	var evts []events.Event
+	r := New(WithListener(events.ListenerFunc(func(e events.Event) {
+		evts = append(evts, e)
+	})))
+
+	r.Record("GET /a", shapeOf(t, `{"id": "a", "items": [{"n": 1}], "opt": null}`))
+	assert.Len(t, evts, 0)
+
+	r.Record("GET /a", shapeOf(t, `{"id": "a", "items": [{"n": 1}], "opt": null}`))
+	assert.Len(t, evts, 0)
+
+	r.Record("GET /a", shapeOf(t, `{"id": 1, "items": [{"n": 1, "m": true}]}`))
+	if assert.Len(t, evts, 1) {
+		assert.Equal(t, events.SchemaDrift{
+			Endpoint: "GET /a",
+			Added:    map[string]string{"items.#.m": "boolean"},
+			Removed:  map[string]string{"opt": "null"},
+			Changed:  map[string]string{"id": "number"},
+		}, evts[0])
+	}
+
+	r.Record("GET /b", shapeOf(t, `{"other": true}`))
+	assert.Len(t, evts, 1)
+}
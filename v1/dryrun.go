@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var ErrDryRun = errors.New("Dry run")
+
+// A dry-run error is produced in place of a response when a request is made
+// in dry-run mode. It carries the request as it would have been sent.
+type DryRunError struct {
+	Request *http.Request
+}
+
+func (e *DryRunError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Request.Method, defaultRedactor.url(e.Request.URL), ErrDryRun)
+}
+
+func (e *DryRunError) Unwrap() error {
+	return ErrDryRun
+}
+
+// WithDryRun causes requests to be prepared exactly as they would be sent,
+// including resolving their URL, authorizing and finalizing them, and setting
+// the client's headers, but not sent. In place of a response, a *DryRunError
+// carrying the prepared request is returned. Requests are logged as usual when
+// debugging is enabled. This may be used as a client or per-request option.
+func WithDryRun() Option {
+	return func(c Config) Config {
+		c.DryRun = true
+		return c
+	}
+}
+
+// Prepare produces the request as it would be sent by the client without
+// sending it. The returned request may be the provided request.
+func (c *Client) Prepare(req *http.Request, opts ...Option) (*http.Request, error) {
+	_, err := c.Exec(req, nil, append(opts, WithDryRun())...)
+	var dry *DryRunError
+	if !errors.As(err, &dry) {
+		return nil, err
+	}
+	return dry.Request, nil
+}
+
+// Prepare a request and return it without sending it. Since nothing is sent,
+// nothing is rate limited, shared, cached, recorded, or observed.
+func (c *Client) dryRun(req *http.Request, conf Config) (*http.Response, error) {
+	req.URL = c.resolve(req.URL)
+	err := c.prepare(req, c.metrics.get())
+	if err != nil {
+		return nil, err
+	}
+	err = c.finalize(req, conf)
+	if err != nil {
+		return nil, err
+	}
+	if c.isVerbose(req) || c.isDebug(req) {
+		fmt.Fprintf(c.debug.Writer, "api: [dry run] %v %v\n", req.Method, c.redact.url(req.URL))
+	}
+	err = c.debugReq(req)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &DryRunError{Request: req}
+}
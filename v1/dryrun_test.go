@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := New(
+		WithBaseURL(server.URL+"/v1/"),
+		WithAuthorizer(NewBearerAuthorizer("secret")),
+		WithHeader("X-Client", "test"),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt := context.Background()
+
+	_, err = client.Post(cxt, "things", map[string]string{"a": "b"}, nil, WithDryRun(), WithHeader("X-Request", "yes"))
+	var dry *DryRunError
+	if assert.True(t, errors.As(err, &dry)) {
+		assert.ErrorIs(t, err, ErrDryRun)
+		req := dry.Request
+		assert.Equal(t, server.URL+"/v1/things", req.URL.String())
+		assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+		assert.Equal(t, "test", req.Header.Get("X-Client"))
+		assert.Equal(t, "yes", req.Header.Get("X-Request"))
+		data, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"a":"b"}`, string(data))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "things", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	req, err = client.Prepare(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, server.URL+"/v1/things", req.URL.String())
+	}
+
+	assert.Equal(t, int64(0), atomic.LoadInt64(&hits), "nothing is sent")
+	assert.Len(t, client.Health(), 0, "nothing is recorded")
+
+	_, err = client.Get(cxt, "things", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&hits))
+}
+
+func TestDryRunFinalizers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	sign := FinalizerFunc(func(req *http.Request) error {
+		req.Header.Set("X-Signature", "signed:"+req.URL.Path)
+		return nil
+	})
+	client, err := New(WithBaseURL(server.URL), WithFinalizers(sign), WithCurlDebug(true), WithDebugWriter(buf))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/dry", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	req, err = client.Prepare(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "signed:/dry", req.Header.Get("X-Signature"), "a prepared request is finalized")
+	}
+	assert.Contains(t, buf.String(), "signed:/dry", "a dry run shows the finalized request")
+
+	_, err = client.Get(context.Background(), "/sent", nil)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "signed:/sent", "debugging output shows the finalized request")
+}
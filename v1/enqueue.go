@@ -0,0 +1,484 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/queue"
+)
+
+var (
+	ErrQueueFull     = errors.New("Request queue is full")
+	ErrQueueClosed   = errors.New("Request queue is closed")
+	ErrInvalidQueued = errors.New("Queued request is invalid")
+)
+
+const (
+	defaultQueueWorkers  = 4
+	defaultQueueCapacity = 1024
+	defaultQueueRetries  = 3
+	defaultQueueBackoff  = time.Second
+	defaultQueueMaxDelay = time.Minute
+)
+
+// A queue sends requests in the background, for fire-and-forget requests such
+// as telemetry which should not delay the caller. Requests are enqueued with
+// Client.Enqueue and sent by a pool of workers once the client enqueues its
+// first request. When a store is provided, requests are persisted until they
+// have been sent, and requests which remain in the store from a previous run
+// are sent when the queue starts.
+//
+// A request enqueued with an idempotency key is identified by its key, and
+// enqueuing a request with the same key as one which has not yet been sent
+// produces the handle of the request which is already enqueued.
+type Queue struct {
+	// The number of workers sending requests; defaults to 4
+	Workers int
+	// The number of requests which may wait to be sent; defaults to 1024
+	Capacity int
+	// The number of times a request which fails is sent again, in addition to
+	// any retries performed by the client; defaults to 3, negative disables
+	Retries int
+	// The delay before a request is sent again, which increases progressively;
+	// defaults to one second
+	Backoff time.Duration
+	// Persists requests until they are sent; by default they are not persisted.
+	// A store should not be shared by more than one queue at a time.
+	Store queue.Store
+	// A durable queue delivers requests at least once: a request which fails is
+	// sent again until it succeeds, regardless of Retries, unless the service
+	// rejects it, it cannot be constructed, or it is canceled, and it remains
+	// in the store until then.
+	Durable bool
+	// The longest delay before a request in a durable queue is sent again;
+	// defaults to one minute
+	MaxBackoff time.Duration
+	// Called with a request which failed and will not be sent again, other than
+	// one which was canceled, before it is removed from the store. This may be
+	// used to record requests which could not be delivered.
+	Failed func(*queue.Entry, error)
+}
+
+// WithQueue configures the queue used by Client.Enqueue. Without it, a queue
+// with the default configuration is used.
+func WithQueue(q Queue) Option {
+	return func(c Config) Config {
+		c.Queue = &q
+		return c
+	}
+}
+
+// A handle to an enqueued request
+type Enqueued struct {
+	id     string
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+	finish sync.Once
+	status int
+	err    error
+}
+
+func newEnqueued(id string, cancel context.CancelCauseFunc) *Enqueued {
+	return &Enqueued{
+		id:     id,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// ID returns the identifier of the request in the queue's store
+func (e *Enqueued) ID() string {
+	return e.id
+}
+
+// Done returns a channel which is closed once the request has been sent or
+// has failed.
+func (e *Enqueued) Done() <-chan struct{} {
+	return e.done
+}
+
+// Wait until the request has been sent or has failed, or the context ends.
+// The error which caused the request to fail is returned, if any.
+func (e *Enqueued) Wait(cxt context.Context) error {
+	select {
+	case <-e.done:
+		return e.err
+	case <-cxt.Done():
+		return cxt.Err()
+	}
+}
+
+// Status returns the status of the response to the request once it has been
+// sent, or zero if it has not been.
+func (e *Enqueued) Status() int {
+	select {
+	case <-e.done:
+		return e.status
+	default:
+		return 0
+	}
+}
+
+// Cancel the request. A request which has not been sent is discarded and a
+// request in flight is aborted.
+func (e *Enqueued) Cancel() {
+	e.cancel(context.Canceled)
+}
+
+func (e *Enqueued) complete(status int, err error) {
+	e.finish.Do(func() {
+		e.status, e.err = status, err
+		e.cancel(nil)
+		close(e.done)
+	})
+}
+
+// A request waiting in the queue
+type queued struct {
+	client *Client // the client which sends it
+	entry  *queue.Entry
+	cxt    context.Context
+	opts   []Option
+	handle *Enqueued
+}
+
+// A request queue sends enqueued requests
+type requestQueue struct {
+	sync.Mutex
+	conf   Queue
+	items  chan *queued
+	ids    map[string]*Enqueued
+	start  sync.Once
+	cxt    context.Context
+	stop   context.CancelFunc
+	closed bool
+}
+
+func newRequestQueue(conf *Queue) *requestQueue {
+	var q Queue
+	if conf != nil {
+		q = *conf
+	}
+	if q.Workers < 1 {
+		q.Workers = defaultQueueWorkers
+	}
+	if q.Capacity < 1 {
+		q.Capacity = defaultQueueCapacity
+	}
+	if q.Retries == 0 {
+		q.Retries = defaultQueueRetries
+	}
+	if q.Backoff <= 0 {
+		q.Backoff = defaultQueueBackoff
+	}
+	if q.MaxBackoff <= 0 {
+		q.MaxBackoff = defaultQueueMaxDelay
+	}
+	cxt, stop := context.WithCancel(context.Background())
+	return &requestQueue{
+		conf:  q,
+		items: make(chan *queued, q.Capacity),
+		ids:   make(map[string]*Enqueued),
+		cxt:   cxt,
+		stop:  stop,
+	}
+}
+
+// Enqueue a request to be sent in the background by the client's queue. The
+// request body is read in full before Enqueue returns. The request is not
+// bound to the context of the request, which may end before it is sent,
+// although values carried by the context are retained. Options apply to the
+// request as they would to Exec, however they are not persisted: a request
+// which is restored from the queue's store is sent with the client's
+// configuration alone.
+//
+// If the queue is full, ErrQueueFull is returned and the request is not
+// enqueued.
+func (c *Client) Enqueue(req *http.Request, opts ...Option) (*Enqueued, error) {
+	id := req.Header.Get(IdempotencyKeyHeader)
+	if id == "" {
+		id = newQueueID()
+	}
+	entry := &queue.Entry{
+		ID:       id,
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Header:   req.Header.Clone(),
+		Enqueued: time.Now(),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read request body: %w", err)
+		}
+		entry.Body = data
+	}
+	q := c.backlog
+	q.touch(c)
+	return q.enqueue(context.WithoutCancel(req.Context()), c, entry, opts)
+}
+
+// StartQueue starts the client's queue, which sends any requests that remain
+// in its store from a previous run. Otherwise, the queue is started when the
+// first request is enqueued.
+func (c *Client) StartQueue() {
+	c.backlog.touch(c)
+}
+
+// StopQueue stops the client's queue. Requests which have not been sent fail
+// with ErrQueueClosed and remain in its store, if there is one. A queue which
+// has been stopped may not be started again.
+func (c *Client) StopQueue() {
+	c.backlog.close()
+}
+
+func newQueueID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Start sending requests if the queue has not been started
+func (q *requestQueue) touch(c *Client) {
+	q.start.Do(func() {
+		for i := 0; i < q.conf.Workers; i++ {
+			go q.run()
+		}
+		if q.conf.Store != nil {
+			q.restore(c)
+		}
+	})
+}
+
+// Enqueue a request. Its identifier is reserved while it is persisted, so
+// that the store is not written with the queue locked.
+func (q *requestQueue) enqueue(cxt context.Context, c *Client, entry *queue.Entry, opts []Option) (*Enqueued, error) {
+	cxt, cancel := context.WithCancelCause(cxt)
+	item := &queued{
+		client: c,
+		entry:  entry,
+		cxt:    cxt,
+		opts:   opts,
+		handle: newEnqueued(entry.ID, cancel),
+	}
+	q.Lock()
+	if q.closed {
+		q.Unlock()
+		cancel(nil)
+		return nil, ErrQueueClosed
+	}
+	if h, ok := q.ids[entry.ID]; ok {
+		q.Unlock()
+		cancel(nil)
+		return h, nil // already enqueued and not yet sent
+	}
+	q.ids[entry.ID] = item.handle
+	q.Unlock()
+
+	if s := q.conf.Store; s != nil {
+		err := s.Put(context.Background(), entry)
+		if err != nil {
+			err = fmt.Errorf("Could not persist request: %w", err)
+			q.finish(item, 0, err)
+			return nil, err
+		}
+	}
+
+	q.Lock()
+	err := ErrQueueClosed
+	if !q.closed {
+		select {
+		case q.items <- item:
+			q.Unlock()
+			return item.handle, nil
+		default:
+			err = ErrQueueFull
+		}
+	}
+	q.Unlock()
+	q.discard(item, err)
+	return nil, err
+}
+
+// Enqueue requests which remain in the store from a previous run. They are
+// listed before anything else is enqueued, so that no request is sent twice,
+// and they wait for room in the queue rather than being rejected when it is
+// full. They are sent by the client which started the queue, whereas other
+// requests are sent by the client which enqueued them.
+func (q *requestQueue) restore(c *Client) {
+	entries, err := q.conf.Store.List(q.cxt)
+	if err != nil {
+		if c.debug.Verbose {
+			fmt.Fprintf(c.debug.Writer, "api: could not restore queued requests: %v\n", err)
+		}
+		return
+	}
+	items := make([]*queued, len(entries))
+	q.Lock()
+	for i, e := range entries {
+		cxt, cancel := context.WithCancelCause(context.Background())
+		items[i] = &queued{client: c, entry: e, cxt: cxt, handle: newEnqueued(e.ID, cancel)}
+		q.ids[e.ID] = items[i].handle
+	}
+	q.Unlock()
+	go func() {
+		for i, item := range items {
+			select {
+			case q.items <- item:
+			case <-q.cxt.Done():
+				for _, e := range items[i:] {
+					q.finish(e, 0, ErrQueueClosed)
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (q *requestQueue) run() {
+	for {
+		select {
+		case <-q.cxt.Done():
+			return
+		case item := <-q.items:
+			q.send(item.client, item)
+		}
+	}
+}
+
+// Send a request, trying again if it fails, until it succeeds, fails
+// permanently, or is canceled
+func (q *requestQueue) send(c *Client, item *queued) {
+	stop := context.AfterFunc(q.cxt, func() {
+		item.handle.cancel(ErrQueueClosed)
+	})
+	defer stop()
+
+	var status int
+	var err error
+	for i := 0; ; i++ {
+		if item.cxt.Err() != nil {
+			err = context.Cause(item.cxt)
+			break
+		}
+		status, err = q.attempt(c, item)
+		if err == nil || (!q.conf.Durable && i >= q.conf.Retries) || !retryQueued(item.cxt, err) {
+			break
+		}
+		if werr := wait(item.cxt, q.backoff(i), "queued retry"); werr != nil {
+			err = werr
+			break
+		}
+	}
+	if errors.Is(context.Cause(item.cxt), ErrQueueClosed) {
+		err = ErrQueueClosed // leave the request in the store to be sent by the next run
+	} else {
+		if err != nil && item.cxt.Err() == nil && q.conf.Failed != nil {
+			q.conf.Failed(item.entry, err)
+		}
+		if s := q.conf.Store; s != nil {
+			if derr := s.Delete(context.Background(), item.entry.ID); derr != nil && c.debug.Verbose {
+				fmt.Fprintf(c.debug.Writer, "api: could not remove queued request %s: %v\n", item.entry.ID, derr)
+			}
+		}
+	}
+	q.finish(item, status, err)
+}
+
+// Determine the delay before a request which has failed n+1 times is sent
+// again. A durable queue retries indefinitely, so its delay is limited.
+func (q *requestQueue) backoff(n int) time.Duration {
+	d := q.conf.Backoff * time.Duration(n+1)
+	if q.conf.Durable && d > q.conf.MaxBackoff {
+		d = q.conf.MaxBackoff
+	}
+	return d
+}
+
+// Complete a request which is no longer enqueued
+func (q *requestQueue) finish(item *queued, status int, err error) {
+	q.Lock()
+	if q.ids[item.entry.ID] == item.handle {
+		delete(q.ids, item.entry.ID)
+	}
+	q.Unlock()
+	item.handle.complete(status, err)
+}
+
+func (q *requestQueue) attempt(c *Client, item *queued) (int, error) {
+	e := item.entry
+	var body io.Reader
+	if e.Body != nil {
+		body = bytes.NewReader(e.Body)
+	}
+	req, err := http.NewRequestWithContext(item.cxt, e.Method, e.URL, body)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidQueued, err)
+	}
+	for k, v := range e.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	rsp, err := c.Exec(req, nil, append(item.opts, WithRawBody())...)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, rsp.Body)
+	rsp.Body.Close()
+	return rsp.StatusCode, nil
+}
+
+// Determine whether a queued request which failed should be sent again. A
+// request which was canceled, which could not be constructed, or which was
+// rejected by the service is not.
+func retryQueued(cxt context.Context, err error) bool {
+	if cxt.Err() != nil || errors.Is(err, ErrInvalidQueued) {
+		return false
+	}
+	var apierr *Error
+	if errors.As(err, &apierr) && apierr.Status >= 400 && apierr.Status < 500 {
+		return apierr.Status == http.StatusRequestTimeout || apierr.Status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// Stop sending requests. Requests which have not been sent fail with
+// ErrQueueClosed and remain in the store, if there is one.
+func (q *requestQueue) close() {
+	if q == nil {
+		return
+	}
+	q.Lock()
+	if q.closed {
+		q.Unlock()
+		return
+	}
+	q.closed = true
+	q.Unlock()
+	q.stop()
+	for {
+		select {
+		case item := <-q.items:
+			q.finish(item, 0, ErrQueueClosed)
+		default:
+			return
+		}
+	}
+}
+
+// Discard a request which was persisted but not enqueued. Anyone who enqueued
+// the same request while it was persisted receives the error.
+func (q *requestQueue) discard(item *queued, err error) {
+	if s := q.conf.Store; s != nil {
+		s.Delete(context.Background(), item.entry.ID)
+	}
+	q.finish(item, 0, err)
+}
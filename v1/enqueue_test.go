@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/queue"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnqueue(t *testing.T) {
+	var lock sync.Mutex
+	var received []string
+	var failures atomic.Int64
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/flaky":
+			if failures.Add(1) <= 2 {
+				rsp.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		case "/invalid":
+			rsp.WriteHeader(http.StatusBadRequest)
+			return
+		case "/blocked":
+			select {
+			case <-block:
+			case <-req.Context().Done():
+				return
+			}
+		}
+		data, _ := io.ReadAll(req.Body)
+		lock.Lock()
+		if v := req.Header.Get("X-Client"); v != "" {
+			data = append(data, "+"+v...)
+		}
+		received = append(received, req.URL.Path+":"+string(data))
+		lock.Unlock()
+		rsp.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer close(block)
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	newRequest := func(path, body string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		return req
+	}
+
+	t.Run("Send", func(t *testing.T) {
+		client, err := New(WithBaseURL(server.URL), WithQueue(Queue{Backoff: time.Millisecond}))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer client.Close()
+
+		h, err := client.Enqueue(newRequest("/ok", "A"))
+		if assert.NoError(t, err) && assert.NoError(t, h.Wait(cxt)) {
+			assert.Equal(t, http.StatusAccepted, h.Status())
+		}
+
+		h, err = client.Enqueue(newRequest("/flaky", "B")) // retried by the queue
+		if assert.NoError(t, err) && assert.NoError(t, h.Wait(cxt)) {
+			assert.Equal(t, int64(3), failures.Load())
+		}
+
+		h, err = client.Enqueue(newRequest("/invalid", "C")) // not retried
+		if assert.NoError(t, err) {
+			assert.ErrorIs(t, h.Wait(cxt), ErrBadRequest)
+		}
+
+		lock.Lock()
+		assert.Equal(t, []string{"/ok:A", "/flaky:B"}, received)
+		lock.Unlock()
+	})
+
+	t.Run("Derived", func(t *testing.T) {
+		lock.Lock()
+		received = nil
+		lock.Unlock()
+
+		client, err := New(WithBaseURL(server.URL+"/a/"), WithQueue(Queue{Workers: 1}))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer client.Close()
+		derived := client.WithHeader("X-Client", "b")
+		cloned, err := client.Clone(WithBaseURL(server.URL + "/c/"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		// each request is sent by the client which enqueued it, although the
+		// queue is shared and it was started by the first
+		for _, e := range []*Client{client, derived, cloned} {
+			h, err := e.Enqueue(newRequest("ok", "A"))
+			if assert.NoError(t, err) {
+				assert.NoError(t, h.Wait(cxt))
+			}
+		}
+		lock.Lock()
+		assert.Equal(t, []string{"/a/ok:A", "/a/ok:A+b", "/c/ok:A"}, received)
+		lock.Unlock()
+	})
+
+	t.Run("Capacity", func(t *testing.T) {
+		client, err := New(WithBaseURL(server.URL), WithQueue(Queue{Workers: 1, Capacity: 1}))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer client.Close()
+
+		a, err := client.Enqueue(newRequest("/blocked", "A"))
+		assert.NoError(t, err)
+		for len(client.backlog.items) > 0 { // wait for the worker to take it
+			time.Sleep(time.Millisecond)
+		}
+		b, err := client.Enqueue(newRequest("/blocked", "B"))
+		assert.NoError(t, err)
+		_, err = client.Enqueue(newRequest("/blocked", "C"))
+		assert.ErrorIs(t, err, ErrQueueFull)
+
+		a.Cancel()
+		assert.ErrorIs(t, a.Wait(cxt), context.Canceled)
+		b.Cancel()
+		assert.ErrorIs(t, b.Wait(cxt), context.Canceled)
+	})
+
+	t.Run("Unlocked", func(t *testing.T) {
+		disk, err := queue.NewDisk(t.TempDir())
+		if !assert.NoError(t, err) {
+			return
+		}
+		store := &slowStore{Store: disk, started: make(chan struct{}), release: make(chan struct{})}
+		client, err := New(WithBaseURL(server.URL), WithQueue(Queue{Store: store}))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer client.Close()
+
+		slow := make(chan *Enqueued, 1)
+		go func() {
+			req := newRequest("/ok", "slow")
+			req.Header.Set(IdempotencyKeyHeader, "slow")
+			h, err := client.Enqueue(req)
+			assert.NoError(t, err)
+			slow <- h
+		}()
+		<-store.started
+		h, err := client.Enqueue(newRequest("/ok", "fast"))
+		if assert.NoError(t, err, "the queue must not be locked while a request is persisted") {
+			assert.NoError(t, h.Wait(cxt))
+		}
+		close(store.release)
+		assert.NoError(t, (<-slow).Wait(cxt))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		store, err := queue.NewDisk(t.TempDir())
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, store.Put(cxt, &queue.Entry{ID: "invalid", Method: "NOT VALID", URL: "/ok"}))
+
+		failed := make(chan error, 1)
+		client, err := New(WithBaseURL(server.URL), WithQueue(Queue{Store: store, Durable: true, Backoff: time.Millisecond, Failed: func(e *queue.Entry, err error) {
+			failed <- err
+		}}))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer client.Close()
+		client.StartQueue()
+		select {
+		case err := <-failed:
+			assert.ErrorIs(t, err, ErrInvalidQueued, "a request which cannot be constructed is never sent again")
+		case <-cxt.Done():
+			t.Fatal("the invalid request was not given up on")
+		}
+	})
+
+	t.Run("Persist", func(t *testing.T) {
+		store, err := queue.NewDisk(t.TempDir())
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		client, err := New(WithBaseURL(server.URL), WithQueue(Queue{Workers: 1, Store: store}))
+		if !assert.NoError(t, err) {
+			return
+		}
+		a, err := client.Enqueue(newRequest("/blocked", "A"))
+		assert.NoError(t, err)
+		b, err := client.Enqueue(newRequest("/ok", "B"))
+		assert.NoError(t, err)
+		client.Close() // the requests have not been sent, so they remain in the store
+		assert.ErrorIs(t, a.Wait(cxt), ErrQueueClosed)
+		assert.ErrorIs(t, b.Wait(cxt), ErrQueueClosed)
+		_, err = client.Enqueue(newRequest("/ok", "C"))
+		assert.ErrorIs(t, err, ErrQueueClosed)
+
+		entries, err := store.List(cxt)
+		if assert.NoError(t, err) && assert.Len(t, entries, 2) {
+			assert.Equal(t, a.ID(), entries[0].ID)
+			assert.Equal(t, b.ID(), entries[1].ID)
+		}
+
+		lock.Lock()
+		received = nil
+		lock.Unlock()
+
+		client, err = New(WithBaseURL(server.URL), WithQueue(Queue{Store: store}))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer client.Close()
+		store.Delete(cxt, a.ID()) // don't wait on the blocked request again
+		h, err := client.Enqueue(newRequest("/ok", "D"))
+		if assert.NoError(t, err) {
+			assert.NoError(t, h.Wait(cxt))
+		}
+		for {
+			entries, err := store.List(cxt)
+			if !assert.NoError(t, err) || len(entries) == 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		lock.Lock()
+		assert.ElementsMatch(t, []string{"/ok:B", "/ok:D"}, received)
+		lock.Unlock()
+	})
+}
+
+// A store which blocks while persisting the request identified as "slow"
+type slowStore struct {
+	queue.Store
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slowStore) Put(cxt context.Context, e *queue.Entry) error {
+	if e.ID == "slow" {
+		close(s.started)
+		<-s.release
+	}
+	return s.Store.Put(cxt, e)
+}
@@ -28,6 +28,7 @@ type EntityUnmarshaler interface {
 type Entity struct {
 	ContentType string
 	Data        []byte
+	Truncated   bool // the data is a prefix of the original entity
 }
 
 func (e Entity) String() string {
@@ -39,7 +40,21 @@ func (e Entity) String() string {
 	} else {
 		d = string(e.Data)
 	}
-	return fmt.Sprintf("---\n%s (%s)\n---\n%s\n#", e.ContentType, humanize.Bytes(uint64(len(e.Data))), d)
+	size := humanize.Bytes(uint64(len(e.Data)))
+	if e.Truncated {
+		size += ", truncated"
+	}
+	return fmt.Sprintf("---\n%s (%s)\n---\n%s\n#", e.ContentType, size, d)
+}
+
+// Unmarshal the entity data into the provided value according to its content
+// type, in the same way a response would be unmarshaled.
+func (e Entity) Unmarshal(entity interface{}) error {
+	return Unmarshal(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{e.ContentType}},
+		Body:       io.NopCloser(bytes.NewReader(e.Data)),
+	}, entity)
 }
 
 var (
@@ -53,17 +68,28 @@ func init() {
 	formDecoder.IgnoreUnknownKeys(true)
 }
 
-func entityReader(ctype string, entity interface{}) (io.ReadCloser, error) {
+// Produce a reader for a request entity. Entities which are encoded by the
+// client are produced as *bytes.Reader, which allows requests to determine
+// their length and to replay them when they are retried.
+func entityReader(ctype string, entity interface{}) (io.Reader, error) {
 	switch v := entity.(type) {
 	case []byte:
-		return ioutil.NopCloser(bytes.NewBuffer(v)), nil
+		return bytes.NewReader(v), nil
 	case io.ReadCloser:
 		return v, nil
 	case io.Reader:
 		return ioutil.NopCloser(v), nil
-	default:
-		return Marshal(ctype, entity)
 	}
+	r, err := Marshal(ctype, entity)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
 }
 
 func Marshal(ctype string, entity interface{}) (io.ReadCloser, error) {
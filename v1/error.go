@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 )
 
@@ -12,20 +13,85 @@ var (
 	ErrUnsupportedMimetype       = errors.New("Unsupported content type")
 	ErrUnexpectedStatusCode      = errors.New("Unexpected status code")
 	ErrCouldNotAuthorize         = errors.New("Could not authorize request")
+	ErrCouldNotFinalize          = errors.New("Could not finalize request")
 	ErrCouldNotUnmarshalResponse = errors.New("Could not unmarshal response")
 )
 
+// The maximum number of bytes of a response body which are captured by default
+// as the entity of an error
+const DefaultErrorEntityLimit = 1 << 20
+
 // Sentinal errors are wrapped to provide a simpler test for common conditions
 // that are related to response status codes.
 var (
-	ErrNotFound            = errors.New("Not found")
-	ErrBadRequest          = errors.New("Bad request")
-	ErrUnauthorized        = errors.New("Unauthorized")
-	ErrForbidden           = errors.New("Forbidden")
-	ErrUnprocessableEntity = errors.New("Unprocessable entity")
-	ErrInternalServerError = errors.New("Internal server error")
+	ErrNotModified           = errors.New("Not modified")
+	ErrNotFound              = errors.New("Not found")
+	ErrBadRequest            = errors.New("Bad request")
+	ErrUnauthorized          = errors.New("Unauthorized")
+	ErrPaymentRequired       = errors.New("Payment required")
+	ErrForbidden             = errors.New("Forbidden")
+	ErrMethodNotAllowed      = errors.New("Method not allowed")
+	ErrNotAcceptable         = errors.New("Not acceptable")
+	ErrRequestTimeout        = errors.New("Request timeout")
+	ErrConflict              = errors.New("Conflict")
+	ErrGone                  = errors.New("Gone")
+	ErrPreconditionFailed    = errors.New("Precondition failed")
+	ErrRequestEntityTooLarge = errors.New("Request entity too large")
+	ErrUnsupportedMediaType  = errors.New("Unsupported media type")
+	ErrUnprocessableEntity   = errors.New("Unprocessable entity")
+	ErrLocked                = errors.New("Locked")
+	ErrTooEarly              = errors.New("Too early")
+	ErrPreconditionRequired  = errors.New("Precondition required")
+	ErrTooManyRequests       = errors.New("Too many requests")
+	ErrInternalServerError   = errors.New("Internal server error")
+	ErrBadGateway            = errors.New("Bad gateway")
+	ErrServiceUnavailable    = errors.New("Service unavailable")
+	ErrGatewayTimeout        = errors.New("Gateway timeout")
 )
 
+var statusSentinels = map[int]error{
+	http.StatusNotModified:           ErrNotModified,
+	http.StatusBadRequest:            ErrBadRequest,
+	http.StatusUnauthorized:          ErrUnauthorized,
+	http.StatusPaymentRequired:       ErrPaymentRequired,
+	http.StatusForbidden:             ErrForbidden,
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusMethodNotAllowed:      ErrMethodNotAllowed,
+	http.StatusNotAcceptable:         ErrNotAcceptable,
+	http.StatusRequestTimeout:        ErrRequestTimeout,
+	http.StatusConflict:              ErrConflict,
+	http.StatusGone:                  ErrGone,
+	http.StatusPreconditionFailed:    ErrPreconditionFailed,
+	http.StatusRequestEntityTooLarge: ErrRequestEntityTooLarge,
+	http.StatusUnsupportedMediaType:  ErrUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   ErrUnprocessableEntity,
+	http.StatusLocked:                ErrLocked,
+	http.StatusTooEarly:              ErrTooEarly,
+	http.StatusPreconditionRequired:  ErrPreconditionRequired,
+	http.StatusTooManyRequests:       ErrTooManyRequests,
+	http.StatusInternalServerError:   ErrInternalServerError,
+	http.StatusBadGateway:            ErrBadGateway,
+	http.StatusServiceUnavailable:    ErrServiceUnavailable,
+	http.StatusGatewayTimeout:        ErrGatewayTimeout,
+}
+
+// StatusOf produces the response status of an error, if it was produced by a
+// response.
+func StatusOf(err error) (int, bool) {
+	var apierr *Error
+	if errors.As(err, &apierr) && apierr.Status > 0 {
+		return apierr.Status, true
+	}
+	return 0, false
+}
+
+// IsStatus reports whether an error was produced by a response with the
+// provided status.
+func IsStatus(err error, status int) bool {
+	s, ok := StatusOf(err)
+	return ok && s == status
+}
+
 var RecoverableStatuses = []int{
 	http.StatusInternalServerError,
 	http.StatusBadGateway,
@@ -56,29 +122,47 @@ func isSuccess(status int) bool {
 	return status >= 200 && status < 300
 }
 
-func checkErr(reqid int64, req *http.Request, rsp *http.Response) error {
-	if !isSuccess(rsp.StatusCode) {
-		err := Errorf(rsp.StatusCode, "Unexpected status code: %d %s", rsp.StatusCode, http.StatusText(rsp.StatusCode)).SetId(reqid).SetRequest(req).SetEntityFromResponse(rsp)
+func checkErr(reqid int64, req *http.Request, rsp *http.Response, limit int64) error {
+	return checkStatus(reqid, req, rsp, limit, isSuccess)
+}
+
+// Check that the response status is considered successful by the provided
+// function, producing an error which describes the response if it is not.
+func checkStatus(reqid int64, req *http.Request, rsp *http.Response, limit int64, success func(int) bool) error {
+	if !success(rsp.StatusCode) {
+		err := Errorf(rsp.StatusCode, "Unexpected status code: %d %s", rsp.StatusCode, http.StatusText(rsp.StatusCode)).SetId(reqid).SetRequest(req).SetEntityFromResponseLimit(rsp, limit)
+		cdn := err.summarizeHTML(rsp.Header)
 		// Wrap a sentinel error for common status codes, which makes this error easier to test for
-		switch rsp.StatusCode {
-		case http.StatusBadRequest:
-			err.SetCause(ErrBadRequest)
-		case http.StatusUnauthorized:
-			err.SetCause(ErrUnauthorized)
-		case http.StatusForbidden:
-			err.SetCause(ErrForbidden)
-		case http.StatusNotFound:
-			err.SetCause(ErrNotFound)
-		case http.StatusUnprocessableEntity:
-			err.SetCause(ErrUnprocessableEntity)
-		case http.StatusInternalServerError:
-			err.SetCause(ErrInternalServerError)
+		if cause, ok := statusSentinels[rsp.StatusCode]; ok {
+			err.SetCause(cause)
+		}
+		if cdn != nil {
+			err.setBlocked(cdn)
 		}
 		return err
 	}
 	return nil
 }
 
+// Check that the response status is one of the expected statuses, if any are
+// specified. This is intended to be used after checkErr has already verified
+// that the response is successful.
+func checkExpected(reqid int64, req *http.Request, rsp *http.Response, expect []int, limit int64) error {
+	if len(expect) == 0 {
+		return nil
+	}
+	for _, e := range expect {
+		if rsp.StatusCode == e {
+			return nil
+		}
+	}
+	err := Errorf(rsp.StatusCode, "Unexpected status code: %d %s; expected one of: %v", rsp.StatusCode, http.StatusText(rsp.StatusCode), expect).SetId(reqid).SetRequest(req).SetEntityFromResponseLimit(rsp, limit).SetCause(ErrUnexpectedStatusCode)
+	if cdn := err.summarizeHTML(rsp.Header); cdn != nil {
+		err.setBlocked(cdn)
+	}
+	return err
+}
+
 type Error struct {
 	ReqId   int64
 	Status  int
@@ -103,7 +187,7 @@ func (e *Error) SetId(id int64) *Error {
 
 func (e *Error) SetRequest(req *http.Request) *Error {
 	e.Method = req.Method
-	e.URL = req.URL.String()
+	e.URL = defaultRedactor.url(req.URL)
 	return e
 }
 
@@ -112,13 +196,30 @@ func (e *Error) SetEntity(ent *Entity) *Error {
 	return e
 }
 
+// SetEntityFromResponse sets the error's entity from the response body, up to
+// DefaultErrorEntityLimit bytes.
 func (e *Error) SetEntityFromResponse(rsp *http.Response) *Error {
-	data, err := io.ReadAll(rsp.Body)
+	return e.SetEntityFromResponseLimit(rsp, DefaultErrorEntityLimit)
+}
+
+// SetEntityFromResponseLimit sets the error's entity from at most n bytes of
+// the response body. If the body is longer, the entity is marked as truncated
+// and the remainder of the body is not read. If n is negative, the body is not
+// read and no entity is set.
+func (e *Error) SetEntityFromResponseLimit(rsp *http.Response, n int64) *Error {
+	if n < 0 || rsp.Body == nil {
+		return e
+	}
+	data, err := io.ReadAll(io.LimitReader(rsp.Body, n+1))
 	if err == nil {
-		e.SetEntity(&Entity{
+		ent := &Entity{
 			ContentType: rsp.Header.Get("Content-Type"),
 			Data:        data,
-		})
+		}
+		if int64(len(data)) > n {
+			ent.Data, ent.Truncated = data[:n], true
+		}
+		e.SetEntity(ent)
 	}
 	return e
 }
@@ -143,6 +244,130 @@ func (e *Error) Error() string {
 	return b
 }
 
+// StatusClass describes the class of the error's status, e.g., "4xx", or is
+// empty if the error was not produced by a response.
+func (e *Error) StatusClass() string {
+	if e.Status <= 0 {
+		return ""
+	}
+	return statusClass(e.Status)
+}
+
+// Temporary reports whether the error's status describes a condition which is
+// expected to resolve itself, such as a rate limit or an unavailable service.
+func (e *Error) Temporary() bool {
+	switch e.Status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsRetryable reports whether the request which produced the error may
+// succeed if it is performed again; that is, the error is temporary or its
+// status is one of RecoverableStatuses.
+func (e *Error) IsRetryable() bool {
+	if e.Temporary() {
+		return true
+	}
+	for _, s := range RecoverableStatuses {
+		if e.Status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// The maximum length of an entity included in the structured representation
+// of an error
+const maxStructuredEntity = 1 << 10
+
+type structuredError struct {
+	Status  int               `json:"status,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	ReqId   int64             `json:"req_id,omitempty"`
+	Message string            `json:"message"`
+	Cause   string            `json:"cause,omitempty"`
+	Entity  *structuredEntity `json:"entity,omitempty"`
+}
+
+type structuredEntity struct {
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size"`
+	Truncated   bool   `json:"truncated,omitempty"`
+	Data        string `json:"data,omitempty"` // omitted for binary entities
+}
+
+func (e *Error) structured() structuredError {
+	s := structuredError{
+		Status:  e.Status,
+		Method:  e.Method,
+		URL:     e.URL,
+		ReqId:   e.ReqId,
+		Message: e.Message,
+	}
+	if e.Cause != nil {
+		s.Cause = e.Cause.Error()
+	}
+	if x := e.Entity; x != nil {
+		s.Entity = &structuredEntity{
+			ContentType: x.ContentType,
+			Size:        len(x.Data),
+			Truncated:   x.Truncated,
+		}
+		if !isMimetypeBinary(x.ContentType) {
+			if len(x.Data) > maxStructuredEntity {
+				s.Entity.Data = string(x.Data[:maxStructuredEntity]) + "..."
+				s.Entity.Truncated = true
+			} else {
+				s.Entity.Data = string(x.Data)
+			}
+		}
+	}
+	return s
+}
+
+// MarshalJSON encodes the error's fields, including a truncated entity, which
+// is suitable for structured logging.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.structured())
+}
+
+// LogValue implements slog.LogValuer, which describes the error's fields,
+// including a truncated entity.
+func (e *Error) LogValue() slog.Value {
+	s := e.structured()
+	attrs := []slog.Attr{slog.String("message", s.Message)}
+	if s.Status > 0 {
+		attrs = append(attrs, slog.Int("status", s.Status))
+	}
+	if s.Method != "" {
+		attrs = append(attrs, slog.String("method", s.Method))
+	}
+	if s.URL != "" {
+		attrs = append(attrs, slog.String("url", s.URL))
+	}
+	if s.ReqId != 0 {
+		attrs = append(attrs, slog.Int64("req_id", s.ReqId))
+	}
+	if s.Cause != "" {
+		attrs = append(attrs, slog.String("cause", s.Cause))
+	}
+	if x := s.Entity; x != nil {
+		ent := []any{slog.String("content_type", x.ContentType), slog.Int("size", x.Size)}
+		if x.Truncated {
+			ent = append(ent, slog.Bool("truncated", true))
+		}
+		if x.Data != "" {
+			ent = append(ent, slog.String("data", x.Data))
+		}
+		attrs = append(attrs, slog.Group("entity", ent...))
+	}
+	return slog.GroupValue(attrs...)
+}
+
 func (e *Error) Redacted() error {
 	return encodableError{
 		Method:  e.Method,
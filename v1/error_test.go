@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		Status    int
+		Class     string
+		Temporary bool
+		Retryable bool
+	}{
+		{0, "", false, false},
+		{http.StatusNotModified, "3xx", false, false},
+		{http.StatusNotFound, "4xx", false, false},
+		{http.StatusRequestTimeout, "4xx", true, true},
+		{http.StatusTooManyRequests, "4xx", true, true},
+		{http.StatusInternalServerError, "5xx", false, true},
+		{http.StatusNotImplemented, "5xx", false, false},
+		{http.StatusServiceUnavailable, "5xx", true, true},
+	}
+	for _, e := range tests {
+		err := Errorf(e.Status, "Failed")
+		assert.Equal(t, e.Class, err.StatusClass(), "%d", e.Status)
+		assert.Equal(t, e.Temporary, err.Temporary(), "%d", e.Status)
+		assert.Equal(t, e.Retryable, err.IsRetryable(), "%d", e.Status)
+	}
+}
+
+func TestErrorStructured(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/things?token=abc", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	apierr := Errorf(http.StatusNotFound, "Not here").SetId(7).SetRequest(req).SetCause(ErrNotFound).SetEntity(&Entity{
+		ContentType: PlainText,
+		Data:        []byte(strings.Repeat("x", maxStructuredEntity+10)),
+	})
+
+	data, err := json.Marshal(apierr)
+	if assert.NoError(t, err) {
+		var v map[string]interface{}
+		assert.NoError(t, json.Unmarshal(data, &v))
+		assert.Equal(t, float64(404), v["status"])
+		assert.Equal(t, "GET", v["method"])
+		assert.Equal(t, "https://example.com/things?token=REDACTED", v["url"])
+		assert.Equal(t, float64(7), v["req_id"])
+		assert.Equal(t, "Not here", v["message"])
+		assert.Equal(t, "Not found", v["cause"])
+		if ent, ok := v["entity"].(map[string]interface{}); assert.True(t, ok) {
+			assert.Equal(t, float64(maxStructuredEntity+10), ent["size"])
+			assert.Equal(t, strings.Repeat("x", maxStructuredEntity)+"...", ent["data"])
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	slog.New(slog.NewTextHandler(buf, nil)).Error("Request failed", "err", apierr)
+	out := buf.String()
+	assert.Contains(t, out, "err.status=404")
+	assert.Contains(t, out, "err.req_id=7")
+	assert.Contains(t, out, "err.entity.content_type=text/plain")
+}
+
+func TestStatusSentinels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		s, _ := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/"))
+		rsp.WriteHeader(s)
+	}))
+	defer server.Close()
+
+	client, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for status, sentinel := range statusSentinels {
+		_, err := client.Get(context.Background(), fmt.Sprintf("/%d", status), nil)
+		assert.ErrorIs(t, err, sentinel, "%d", status)
+		assert.True(t, IsStatus(err, status), "%d", status)
+		assert.False(t, IsStatus(err, status+1), "%d", status)
+		s, ok := StatusOf(err)
+		assert.True(t, ok)
+		assert.Equal(t, status, s)
+	}
+
+	_, ok := StatusOf(errors.New("Not an API error"))
+	assert.False(t, ok)
+	assert.False(t, IsStatus(nil, http.StatusOK))
+}
+
+func TestErrorEntityLimit(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.Header().Set("Content-Type", PlainText)
+		rsp.WriteHeader(http.StatusBadRequest)
+		io.WriteString(rsp, body)
+	}))
+	defer server.Close()
+	cxt := context.Background()
+
+	entityOf := func(err error) *Entity {
+		var apierr *Error
+		if assert.True(t, errors.As(err, &apierr)) {
+			return apierr.Entity
+		}
+		return nil
+	}
+
+	client, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Get(cxt, "/", nil)
+	if ent := entityOf(err); assert.NotNil(t, ent) {
+		assert.Equal(t, body, string(ent.Data))
+		assert.False(t, ent.Truncated)
+	}
+
+	client, err = New(WithBaseURL(server.URL), WithErrorEntityLimit(10))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Get(cxt, "/", nil)
+	if ent := entityOf(err); assert.NotNil(t, ent) {
+		assert.Equal(t, body[:10], string(ent.Data))
+		assert.True(t, ent.Truncated)
+		assert.Contains(t, err.Error(), "truncated")
+	}
+	_, err = client.Get(cxt, "/", nil, WithoutErrorEntity())
+	assert.Nil(t, entityOf(err))
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
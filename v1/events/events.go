@@ -0,0 +1,118 @@
+// Package events describes events that are emitted by a client or its
+// components over the lifecycle of requests.
+package events
+
+import (
+	"net/http"
+	"time"
+)
+
+// An event describes something that happened
+type Event interface {
+	Kind() string
+}
+
+// A listener receives events
+type Listener interface {
+	Receive(Event)
+}
+
+type ListenerFunc func(Event)
+
+func (f ListenerFunc) Receive(e Event) {
+	f(e)
+}
+
+// Listeners dispatches events to every listener in a set
+type Listeners []Listener
+
+func (l Listeners) Receive(e Event) {
+	for _, x := range l {
+		x.Receive(e)
+	}
+}
+
+// SchemaDrift is emitted when the shape of responses from an endpoint changes
+// relative to previously observed responses. Fields are identified by a path
+// and described by their JSON type.
+type SchemaDrift struct {
+	Endpoint string
+	Added    map[string]string
+	Removed  map[string]string
+	Changed  map[string]string
+}
+
+func (e SchemaDrift) Kind() string {
+	return "schema_drift"
+}
+
+// ReservationReturned is emitted when a rate limiter reservation is returned
+// because the request it was made for was canceled before it was sent.
+type ReservationReturned struct {
+	Reserved time.Time
+}
+
+func (e ReservationReturned) Kind() string {
+	return "reservation_returned"
+}
+
+// ReservationReused is emitted when a returned reservation is used by another
+// request instead of reserving a new one.
+type ReservationReused struct {
+	Reserved time.Time
+}
+
+func (e ReservationReused) Kind() string {
+	return "reservation_reused"
+}
+
+// AttemptStarted is emitted when a client sends an attempt of a request.
+// Attempts are numbered from one; retries of the same request are subsequent
+// attempts of it.
+type AttemptStarted struct {
+	Attempt int
+	Req     *http.Request
+}
+
+func (e AttemptStarted) Kind() string {
+	return "attempt_started"
+}
+
+// AttemptFinished is emitted when an attempt of a request produces a response
+// or fails to. A response which will be retried finishes its attempt like any
+// other; its status is described by the response.
+type AttemptFinished struct {
+	Attempt  int
+	Req      *http.Request
+	Rsp      *http.Response
+	Err      error
+	Duration time.Duration
+}
+
+func (e AttemptFinished) Kind() string {
+	return "attempt_finished"
+}
+
+// WaitStarted is emitted when a request begins waiting before it is sent or
+// retried, such as for rate limits.
+type WaitStarted struct {
+	Reason   string
+	Duration time.Duration
+	Req      *http.Request
+}
+
+func (e WaitStarted) Kind() string {
+	return "wait_started"
+}
+
+// GaveUp is emitted when a request which was attempted at least once fails
+// and will not be attempted again.
+type GaveUp struct {
+	Attempts int
+	Req      *http.Request
+	Err      error
+}
+
+func (e GaveUp) Kind() string {
+	return "gave_up"
+}
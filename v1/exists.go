@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// The range requested from a service which does not support HEAD requests,
+// which limits the response to the first byte of a resource
+const existsRange = "bytes=0-0"
+
+// Exists determines whether a resource exists by requesting it with a HEAD
+// request. A 404 Not Found or 410 Gone response produces false rather than an
+// error. When the service does not support HEAD requests, indicated by a 405
+// Method Not Allowed or 501 Not Implemented response, the resource is
+// requested with GET instead, with a Range header which limits the response
+// to its first byte.
+func (c *Client) Exists(cxt context.Context, u string, opts ...Option) (bool, error) {
+	req, err := http.NewRequestWithContext(cxt, http.MethodHead, u, nil)
+	if err != nil {
+		return false, err
+	}
+	exists, err := c.probe(req, opts)
+	if IsStatus(err, http.StatusMethodNotAllowed) || IsStatus(err, http.StatusNotImplemented) {
+		req, err = http.NewRequestWithContext(cxt, http.MethodGet, u, nil)
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Range", existsRange)
+		exists, err = c.probe(req, opts)
+	}
+	return exists, err
+}
+
+// Request a resource to determine whether it exists
+func (c *Client) probe(req *http.Request, opts []Option) (bool, error) {
+	rsp, err := c.Exec(req, nil, append(opts, WithRawBody())...)
+	if err != nil {
+		status, _ := StatusOf(err)
+		switch status {
+		case http.StatusNotFound, http.StatusGone:
+			return false, nil
+		case http.StatusRequestedRangeNotSatisfiable: // the resource is empty
+			return true, nil
+		default:
+			return false, err
+		}
+	}
+	io.Copy(io.Discard, rsp.Body)
+	rsp.Body.Close()
+	return true, nil
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExists(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		head := req.Method == http.MethodHead
+		switch req.URL.Path {
+		case "/present":
+			rsp.WriteHeader(http.StatusOK)
+		case "/gone":
+			rsp.WriteHeader(http.StatusGone)
+		case "/forbidden":
+			rsp.WriteHeader(http.StatusForbidden)
+		case "/nohead":
+			if head {
+				rsp.WriteHeader(http.StatusMethodNotAllowed)
+			} else if req.Header.Get("Range") == "bytes=0-0" {
+				rsp.WriteHeader(http.StatusPartialContent)
+				rsp.Write([]byte("A"))
+			} else {
+				rsp.WriteHeader(http.StatusBadRequest)
+			}
+		case "/empty":
+			if head {
+				rsp.WriteHeader(http.StatusNotImplemented)
+			} else {
+				rsp.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			}
+		default:
+			rsp.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt := context.Background()
+
+	tests := []struct {
+		Path   string
+		Expect bool
+		Err    error
+	}{
+		{"/present", true, nil},
+		{"/missing", false, nil},
+		{"/gone", false, nil},
+		{"/nohead", true, nil},
+		{"/empty", true, nil},
+		{"/forbidden", false, ErrForbidden},
+	}
+	for _, e := range tests {
+		exists, err := client.Exists(cxt, e.Path)
+		if e.Err != nil {
+			assert.ErrorIs(t, err, e.Err, e.Path)
+		} else if assert.NoError(t, err, e.Path) {
+			assert.Equal(t, e.Expect, exists, e.Path)
+		}
+	}
+}
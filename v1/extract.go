@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrPathNotFound = errors.New("Path not found")
+
+// An Extractor is an entity which unmarshals a single value from a JSON
+// response identified by a path, rather than the entire response. It is
+// intended to be used as the output entity of a request:
+//
+//	var ids []string
+//	_, err := client.Get(cxt, "/items", api.Extract("data.items.#.id", &ids))
+//
+// Paths are a sequence of dot-separated components, each of which is one of:
+//
+//   - a key, which selects a field from an object;
+//   - an integer, which selects an element from an array by index;
+//   - '#', which applies the remainder of the path to every element of an
+//     array, producing an array; or, if it is the last component, produces the
+//     length of the array.
+//
+// A literal '.' in a key may be escaped as '\.'.
+type Extractor struct {
+	path []string
+	dest interface{}
+}
+
+// Extract creates an extractor which unmarshals the value at the provided path
+// into the destination.
+func Extract(path string, dest interface{}) *Extractor {
+	return &Extractor{
+		path: splitPath(path),
+		dest: dest,
+	}
+}
+
+func (e *Extractor) UnmarshalJSON(data []byte) error {
+	var src interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // numbers must not lose precision on their way to the destination
+	err := dec.Decode(&src)
+	if err != nil {
+		return err
+	}
+	val, err := extractPath(src, e.path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.Join(e.path, "."))
+	}
+	// round-trip the extracted value so that the destination can be of any
+	// type that is compatible with its JSON representation
+	data, err = json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, e.dest)
+}
+
+func splitPath(p string) []string {
+	if p == "" {
+		return nil
+	}
+	var res []string
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case c == '\\' && i+1 < len(p) && p[i+1] == '.':
+			b.WriteByte('.')
+			i++
+		case c == '.':
+			res = append(res, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(res, b.String())
+}
+
+func extractPath(src interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return src, nil
+	}
+	c, rest := path[0], path[1:]
+	switch v := src.(type) {
+	case map[string]interface{}:
+		e, ok := v[c]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		return extractPath(e, rest)
+	case []interface{}:
+		if c == "#" {
+			if len(rest) == 0 {
+				return len(v), nil
+			}
+			res := make([]interface{}, 0, len(v))
+			for _, e := range v {
+				x, err := extractPath(e, rest)
+				if errors.Is(err, ErrPathNotFound) {
+					continue // elements which don't contain the path are omitted
+				} else if err != nil {
+					return nil, err
+				}
+				res = append(res, x)
+			}
+			return res, nil
+		}
+		x, err := strconv.Atoi(c)
+		if err != nil || x < 0 || x >= len(v) {
+			return nil, ErrPathNotFound
+		}
+		return extractPath(v[x], rest)
+	default:
+		return nil, ErrPathNotFound
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtract(t *testing.T) {
+	data := []byte(`{
+		"data": {
+			"count": 3,
+			"id": 9007199254740993,
+			"items": [
+				{"id": "a", "tags": ["x", "y"]},
+				{"id": "b", "tags": []},
+				{"name": "c"}
+			],
+			"dotted.key": true
+		}
+	}`)
+
+	tests := []struct {
+		Path   string
+		Dest   func() interface{}
+		Expect interface{}
+		Error  error
+	}{
+		{
+			"data.count",
+			func() interface{} { var v int; return &v },
+			3,
+			nil,
+		},
+		{
+			"data.id",
+			func() interface{} { var v int64; return &v },
+			int64(9007199254740993),
+			nil,
+		},
+		{
+			"data.items.#.id",
+			func() interface{} { var v []string; return &v },
+			[]string{"a", "b"},
+			nil,
+		},
+		{
+			"data.items.#",
+			func() interface{} { var v int; return &v },
+			3,
+			nil,
+		},
+		{
+			"data.items.0.tags.1",
+			func() interface{} { var v string; return &v },
+			"y",
+			nil,
+		},
+		{
+			"data.items.#.tags.#",
+			func() interface{} { var v []int; return &v },
+			[]int{2, 0},
+			nil,
+		},
+		{
+			`data.dotted\.key`,
+			func() interface{} { var v bool; return &v },
+			true,
+			nil,
+		},
+		{
+			"data.missing",
+			func() interface{} { var v string; return &v },
+			nil,
+			ErrPathNotFound,
+		},
+		{
+			"data.items.9.id",
+			func() interface{} { var v string; return &v },
+			nil,
+			ErrPathNotFound,
+		},
+	}
+	for i, e := range tests {
+		dest := e.Dest()
+		err := json.Unmarshal(data, Extract(e.Path, dest))
+		if e.Error != nil {
+			assert.ErrorIs(t, err, e.Error, fmt.Sprintf("[#%d]", i))
+		} else if assert.NoError(t, err, fmt.Sprintf("[#%d]", i)) {
+			assert.Equal(t, e.Expect, derefTest(dest), fmt.Sprintf("[#%d]", i))
+		}
+	}
+}
+
+func derefTest(v interface{}) interface{} {
+	switch c := v.(type) {
+	case *int:
+		return *c
+	case *int64:
+		return *c
+	case *string:
+		return *c
+	case *bool:
+		return *c
+	case *[]int:
+		return *c
+	case *[]string:
+		return *c
+	default:
+		return v
+	}
+}
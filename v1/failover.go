@@ -0,0 +1,212 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/events"
+)
+
+// The default period for which an unhealthy base URL is avoided
+const defaultFailoverRecovery = time.Second * 30
+
+// A failover policy determines when requests made by a client with fallback
+// base URLs are retried against the next base URL. Requests always fail over
+// when a connection to the host cannot be established.
+type Failover struct {
+	// Response statuses which also cause a request to fail over. These are
+	// evaluated after the client has exhausted any retries for the status.
+	Status []int
+	// The number of consecutive failures after which a base URL is considered
+	// unhealthy and is tried after healthy ones; defaults to 1
+	Threshold int
+	// The period for which an unhealthy base URL is avoided before it is tried
+	// first again; defaults to 30 seconds
+	Recovery time.Duration
+}
+
+// WithBaseURLs sets the client's primary base URL and the fallback base URLs
+// which requests with relative URLs fail over to, in order, as determined by
+// the client's failover policy; see WithFailover. Requests prefer the primary
+// base URL and return to it once it has recovered.
+func WithBaseURLs(primary string, fallbacks ...string) Option {
+	return func(c Config) Config {
+		c.BaseURL = primary
+		c.FallbackURLs = append([]string(nil), fallbacks...)
+		return c
+	}
+}
+
+// WithFailover sets the policy which determines when requests fail over to
+// the client's fallback base URLs.
+func WithFailover(f Failover) Option {
+	return func(c Config) Config {
+		c.Failover = &f
+		return c
+	}
+}
+
+// Bases returns the client's base URLs in the order they are currently tried;
+// unhealthy base URLs are tried last.
+func (c *Client) Bases() []*url.URL {
+	if c.bases == nil {
+		if c.base == nil {
+			return nil
+		}
+		return []*url.URL{c.base}
+	}
+	var res []*url.URL
+	for _, e := range c.bases.order(time.Now()) {
+		res = append(res, e.url)
+	}
+	return res
+}
+
+// Failover state is shared by a client and every client derived from it
+// which uses the same base URLs.
+type failover struct {
+	sync.Mutex
+	conf   Failover
+	status map[int]struct{}
+	bases  []*baseState
+}
+
+type baseState struct {
+	url      *url.URL
+	failures int
+	until    time.Time
+}
+
+func newFailover(conf *Failover, base *url.URL, fallbacks []string) (*failover, error) {
+	if base == nil || len(fallbacks) == 0 {
+		return nil, nil
+	}
+	var f Failover
+	if conf != nil {
+		f = *conf
+	}
+	if f.Threshold <= 0 {
+		f.Threshold = 1
+	}
+	if f.Recovery <= 0 {
+		f.Recovery = defaultFailoverRecovery
+	}
+	bases := []*baseState{{url: base}}
+	for _, e := range fallbacks {
+		u, err := url.Parse(e)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid fallback base URL: %v", err)
+		}
+		bases = append(bases, &baseState{url: u})
+	}
+	return &failover{
+		conf:   f,
+		status: retrySet(f.Status),
+		bases:  bases,
+	}, nil
+}
+
+// Produce the base URLs in the order they should be tried: healthy ones in
+// order of preference, followed by unhealthy ones.
+func (f *failover) order(now time.Time) []*baseState {
+	f.Lock()
+	defer f.Unlock()
+	res := make([]*baseState, 0, len(f.bases))
+	for _, e := range f.bases {
+		if !now.Before(e.until) {
+			res = append(res, e)
+		}
+	}
+	for _, e := range f.bases {
+		if now.Before(e.until) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Record the outcome of a request to a base URL and report whether the
+// request should fail over to the next one.
+func (f *failover) record(b *baseState, err error) bool {
+	fail := f.isFailover(err)
+	f.Lock()
+	defer f.Unlock()
+	if !fail {
+		b.failures, b.until = 0, time.Time{}
+		return false
+	}
+	b.failures++
+	if b.failures >= f.conf.Threshold {
+		b.until = time.Now().Add(f.conf.Recovery)
+	}
+	return true
+}
+
+func (f *failover) isFailover(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apierr *Error
+	if errors.As(err, &apierr) && apierr.Status > 0 {
+		_, ok := f.status[apierr.Status]
+		return ok
+	}
+	var operr *net.OpError
+	if errors.As(err, &operr) && operr.Op == "dial" {
+		return true
+	}
+	var dnserr *net.DNSError
+	return errors.As(err, &dnserr)
+}
+
+// Perform a request against the client's base URLs in turn until one of them
+// produces a result that does not require failing over. Requests with an
+// absolute URL are not resolved against a base URL and never fail over, nor
+// do requests whose body cannot be produced again. Once the request has been
+// attempted and will not be attempted again, GaveUp is emitted if it failed.
+func (c *Client) dispatch(req *http.Request, conf Config) (rsp *http.Response, err error) {
+	var attempts int
+	if len(c.events) > 0 {
+		defer func() {
+			if err != nil && attempts > 0 {
+				c.events.Receive(events.GaveUp{Attempts: attempts, Req: req, Err: err})
+			}
+		}()
+	}
+	if c.bases == nil || req.URL.IsAbs() {
+		return c.record(req, conf, &attempts)
+	}
+	cxt := req.Context()
+	orig := req.Clone(cxt)
+	ref := req.URL
+	for i, b := range c.bases.order(time.Now()) {
+		r := req
+		if i > 0 {
+			if req.Body != nil && req.GetBody == nil {
+				break // we can't send the body again
+			}
+			if c.isVerbose(req) {
+				fmt.Fprintf(c.debug.Writer, "api: %v %v: failing over to %v: %v\n", req.Method, c.redact.url(req.URL), c.redact.url(b.url), err)
+			}
+			r = orig.Clone(cxt)
+			if req.GetBody != nil {
+				r.Body, err = req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		r.URL = resolveURL(b.url, ref, c.resolution)
+		rsp, err = c.record(r, conf, &attempts)
+		req.URL = r.URL // the caller observes the URL which was used
+		if cxt.Err() != nil || !c.bases.record(b, err) {
+			break
+		}
+	}
+	return rsp, err
+}
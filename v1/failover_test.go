@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailover(t *testing.T) {
+	var down atomic.Bool
+	var hits [2]int64
+	var servers [2]*httptest.Server
+	for i := range servers {
+		n := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+			atomic.AddInt64(&hits[n], 1)
+			if n == 0 && down.Load() {
+				rsp.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			data, _ := io.ReadAll(req.Body)
+			rsp.Header().Set("Content-Type", JSON)
+			rsp.Write(data)
+		}))
+		defer servers[i].Close()
+	}
+	cxt := context.Background()
+
+	client, err := New(
+		WithBaseURLs(servers[0].URL+"/v1/", servers[1].URL+"/v1/"),
+		WithFailover(Failover{Status: []int{http.StatusServiceUnavailable}, Recovery: time.Millisecond * 100}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var out string
+	_, err = client.Post(cxt, "things", "A", &out)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "A", out)
+		assert.Equal(t, []int64{1, 0}, []int64{atomic.LoadInt64(&hits[0]), atomic.LoadInt64(&hits[1])})
+	}
+
+	down.Store(true)
+	rsp, err := client.Post(cxt, "things", "B", &out)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "B", out, "the body must be sent again")
+		assert.Equal(t, servers[1].URL+"/v1/things", rsp.Request.URL.String())
+		assert.Equal(t, []int64{2, 1}, []int64{atomic.LoadInt64(&hits[0]), atomic.LoadInt64(&hits[1])})
+	}
+	assert.Equal(t, servers[1].URL+"/v1/", client.Bases()[0].String())
+
+	_, err = client.Post(cxt, "things", "C", &out)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{2, 2}, []int64{atomic.LoadInt64(&hits[0]), atomic.LoadInt64(&hits[1])}, "the unhealthy primary is avoided")
+	}
+
+	down.Store(false)
+	time.Sleep(time.Millisecond * 150)
+	_, err = client.Post(cxt, "things", "D", &out)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{3, 2}, []int64{atomic.LoadInt64(&hits[0]), atomic.LoadInt64(&hits[1])}, "the primary is used once it recovers")
+	}
+
+	_, err = client.Get(cxt, servers[0].URL+"/v1/things", nil)
+	assert.NoError(t, err)
+	down.Store(true)
+	_, err = client.Get(cxt, servers[0].URL+"/v1/things", nil)
+	var apierr *Error
+	if assert.True(t, errors.As(err, &apierr), "absolute URLs never fail over") {
+		assert.Equal(t, http.StatusServiceUnavailable, apierr.Status)
+	}
+}
+
+func TestFailoverConnect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	lnr, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	addr := lnr.Addr().String()
+	lnr.Close() // nothing is listening here now
+
+	client, err := New(WithBaseURLs("http://"+addr+"/", server.URL+"/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	rsp, err := client.Get(context.Background(), "things", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+	}
+	failures := make(map[string]int)
+	for _, e := range client.Health() {
+		failures[e.Host] = e.ConsecutiveFailures
+	}
+	assert.Equal(t, map[string]int{addr: 1, server.Listener.Addr().String(): 0}, failures)
+}
+
+func TestFailoverEvents(t *testing.T) {
+	var servers [2]*httptest.Server
+	for i := range servers {
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+			rsp.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer servers[i].Close()
+	}
+
+	var evts []events.Event
+	client, err := New(
+		WithBaseURLs(servers[0].URL+"/", servers[1].URL+"/"),
+		WithFailover(Failover{Status: []int{http.StatusServiceUnavailable}}),
+		WithEvents(events.ListenerFunc(func(e events.Event) {
+			evts = append(evts, e)
+		})),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = client.Get(context.Background(), "things", nil)
+	assert.ErrorIs(t, err, ErrServiceUnavailable)
+	var kinds []string
+	var attempts []int
+	for _, e := range evts {
+		kinds = append(kinds, e.Kind())
+		if s, ok := e.(events.AttemptStarted); ok {
+			attempts = append(attempts, s.Attempt)
+		}
+	}
+	assert.Equal(t, []string{"attempt_started", "attempt_finished", "attempt_started", "attempt_finished", "gave_up"}, kinds, "a request gives up once, after failing over")
+	assert.Equal(t, []int{1, 2}, attempts, "attempts are counted over every host")
+	if e, ok := evts[len(evts)-1].(events.GaveUp); assert.True(t, ok) {
+		assert.Equal(t, 2, e.Attempts)
+	}
+}
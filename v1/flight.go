@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// The headers which always distinguish otherwise identical requests from
+// each other when single-flight is enabled.
+var DefaultSingleflightHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language", "Authorization", "Cookie", "Range"}
+
+// A single-flight group shares the result of one in-flight request among all
+// of the identical requests made while it is in flight.
+type flight struct {
+	sync.Mutex
+	headers []string
+	calls   map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	rsp     *http.Response
+	data    []byte
+	err     error
+}
+
+func newFlight(headers []string) *flight {
+	hdrs := make([]string, 0, len(DefaultSingleflightHeaders)+len(headers))
+	for _, e := range DefaultSingleflightHeaders {
+		hdrs = append(hdrs, http.CanonicalHeaderKey(e))
+	}
+	for _, e := range headers {
+		hdrs = append(hdrs, http.CanonicalHeaderKey(e))
+	}
+	return &flight{
+		headers: hdrs,
+		calls:   make(map[string]*flightCall),
+	}
+}
+
+// Produce the key which identifies a request, if it is eligible to share a
+// flight. Only GET and HEAD requests whose bodies are buffered by the client
+// are eligible. A flight is performed with the configuration of the request
+// that started it, so requests with per-request options which change how they
+// are performed are not eligible either; headers set per request are part of
+// the key instead.
+func (f *flight) key(req *http.Request, conf Config) (string, bool) {
+	if f == nil || !sharable(conf) {
+		return "", false
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return "", false
+	}
+	hdrs := f.headers
+	if len(conf.Header) > 0 {
+		hdrs = slices.Clone(hdrs)
+		for k := range conf.Header {
+			if k = http.CanonicalHeaderKey(k); !slices.Contains(hdrs, k) {
+				hdrs = append(hdrs, k)
+			}
+		}
+		slices.Sort(hdrs[len(f.headers):])
+	}
+	b := &strings.Builder{}
+	b.WriteString(req.Method)
+	b.WriteString(" ")
+	b.WriteString(req.URL.String())
+	for _, e := range hdrs {
+		for _, v := range req.Header.Values(e) {
+			b.WriteString("\n")
+			b.WriteString(e)
+			b.WriteString(": ")
+			b.WriteString(v)
+		}
+	}
+	return b.String(), true
+}
+
+// Determine if a request with the provided per-request configuration may
+// share a flight. Headers are applied to the request and the content type is
+// negotiated before it is performed, and strict content type checking applies
+// to each caller's own copy of the response; any other option disqualifies it.
+func sharable(conf Config) bool {
+	conf.Header = nil
+	conf.ContentType = ""
+	conf.StrictContentType = nil
+	return reflect.ValueOf(conf).IsZero()
+}
+
+// Perform the provided function once for a key while it is in flight. Every
+// caller receives its own copy of the response. The function is performed
+// with a context which carries the values of the context of the request that
+// started the flight but not its cancellation; each caller stops waiting when
+// its own context is canceled, and the flight itself is only canceled once
+// every caller has stopped waiting for it.
+func (f *flight) do(cxt context.Context, key string, fn func(context.Context) (*http.Response, error)) (*http.Response, error) {
+	f.Lock()
+	c, ok := f.calls[key]
+	if !ok {
+		var fcxt context.Context
+		c = &flightCall{done: make(chan struct{})}
+		fcxt, c.cancel = context.WithCancel(context.WithoutCancel(cxt))
+		f.calls[key] = c
+		go f.run(fcxt, key, c, fn)
+	}
+	c.waiters++
+	f.Unlock()
+
+	select {
+	case <-c.done:
+		return c.result()
+	case <-cxt.Done():
+		f.leave(key, c)
+		return nil, cxt.Err()
+	}
+}
+
+// Perform the function of a flight and publish its result
+func (f *flight) run(cxt context.Context, key string, c *flightCall, fn func(context.Context) (*http.Response, error)) {
+	defer c.cancel()
+	c.rsp, c.err = fn(cxt)
+	if c.err == nil {
+		c.data, c.err = io.ReadAll(c.rsp.Body)
+		c.rsp.Body.Close()
+	}
+	f.Lock()
+	if f.calls[key] == c {
+		delete(f.calls, key)
+	}
+	f.Unlock()
+	close(c.done)
+}
+
+// Stop waiting for a flight. Once nobody is waiting for it, it is canceled
+// and subsequent requests start a new flight.
+func (f *flight) leave(key string, c *flightCall) {
+	f.Lock()
+	defer f.Unlock()
+	c.waiters--
+	if c.waiters == 0 {
+		c.cancel()
+		if f.calls[key] == c {
+			delete(f.calls, key)
+		}
+	}
+}
+
+func (c *flightCall) result() (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	rsp := *c.rsp
+	rsp.Header = c.rsp.Header.Clone()
+	rsp.Body = io.NopCloser(bytes.NewReader(c.data))
+	return &rsp, nil
+}
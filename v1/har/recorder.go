@@ -0,0 +1,431 @@
+package har
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	api "github.com/bww/go-apiclient/v1"
+)
+
+const (
+	redactedValue      = "REDACTED"
+	defaultMaxEntries  = 1000
+	defaultMaxBodySize = 1 << 20
+)
+
+type Config struct {
+	MaxEntries  int
+	MaxBodySize int64
+	Headers     []string
+	Params      []string
+	Fields      []string
+}
+
+func (c Config) WithOptions(opts []Option) Config {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type Option func(Config) Config
+
+// WithMaxEntries sets the number of entries retained by a recorder, after
+// which the oldest entries are discarded; defaults to 1000
+func WithMaxEntries(n int) Option {
+	return func(c Config) Config {
+		c.MaxEntries = n
+		return c
+	}
+}
+
+// WithMaxBodySize sets the size of the largest request or response body which
+// is recorded; defaults to 1MiB. The content of a larger body is omitted from
+// its entry, and only as much of it as is needed to determine that it is too
+// large is buffered.
+func WithMaxBodySize(n int64) Option {
+	return func(c Config) Config {
+		c.MaxBodySize = n
+		return c
+	}
+}
+
+// WithRedactedHeaders replaces the headers whose values are redacted; see
+// api.DefaultSensitiveHeaders
+func WithRedactedHeaders(names ...string) Option {
+	return func(c Config) Config {
+		c.Headers = append([]string{}, names...)
+		return c
+	}
+}
+
+// WithRedactedParams replaces the query parameters whose values are
+// redacted; see api.DefaultRedactedParams
+func WithRedactedParams(names ...string) Option {
+	return func(c Config) Config {
+		c.Params = append([]string{}, names...)
+		return c
+	}
+}
+
+// WithRedactedFields replaces the body fields whose values are redacted, at
+// any depth in JSON bodies and in form-encoded bodies; see
+// api.DefaultRedactedFields
+func WithRedactedFields(names ...string) Option {
+	return func(c Config) Config {
+		c.Fields = append([]string{}, names...)
+		return c
+	}
+}
+
+// A recorder is an observer which records the requests performed by a
+// client and their responses. Bodies up to the maximum size are buffered in
+// order to record them, including those of requests made with
+// api.WithRawBody.
+type Recorder struct {
+	sync.Mutex
+	max     int
+	maxBody int64
+	headers map[string]struct{}
+	params  map[string]struct{}
+	query   api.Redactor
+	fields  api.Redactor
+	pending map[*http.Request]pending
+	entries []Entry
+}
+
+type pending struct {
+	start time.Time
+	entry Entry
+}
+
+var _ api.Observer = (*Recorder)(nil)
+
+func New(opts ...Option) *Recorder {
+	conf := Config{
+		MaxEntries:  defaultMaxEntries,
+		MaxBodySize: defaultMaxBodySize,
+		Headers:     api.DefaultSensitiveHeaders,
+		Params:      api.DefaultRedactedParams,
+		Fields:      api.DefaultRedactedFields,
+	}.WithOptions(opts)
+	headers := make(map[string]struct{})
+	for _, e := range conf.Headers {
+		headers[http.CanonicalHeaderKey(e)] = struct{}{}
+	}
+	return &Recorder{
+		max:     max(1, conf.MaxEntries),
+		maxBody: max(0, conf.MaxBodySize),
+		headers: headers,
+		params:  nameSet(conf.Params),
+		query:   api.NewRedactor(conf.Params),
+		fields:  api.NewRedactor(conf.Fields),
+		pending: make(map[*http.Request]pending),
+	}
+}
+
+func nameSet(names []string) map[string]struct{} {
+	res := make(map[string]struct{})
+	for _, e := range names {
+		res[strings.ToLower(e)] = struct{}{}
+	}
+	return res
+}
+
+// HAR produces an archive of the entries recorded so far
+func (r *Recorder) HAR() *HAR {
+	r.Lock()
+	defer r.Unlock()
+	return &HAR{
+		Log: Log{
+			Version: Version,
+			Creator: Creator{Name: "go-apiclient", Version: "v1"},
+			Entries: append([]Entry{}, r.entries...),
+		},
+	}
+}
+
+// WriteTo writes an archive of the entries recorded so far as JSON
+func (r *Recorder) WriteTo(w io.Writer) (int64, error) {
+	return r.HAR().WriteTo(w)
+}
+
+// Reset discards every recorded entry
+func (r *Recorder) Reset() {
+	r.Lock()
+	defer r.Unlock()
+	r.entries = nil
+}
+
+func (r *Recorder) Preflight(req *http.Request) error {
+	ent, err := r.request(req)
+	if err != nil {
+		return err
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.pending[req] = pending{start: time.Now(), entry: ent}
+	return nil
+}
+
+func (r *Recorder) Postflight(req *http.Request, rsp *http.Response) error {
+	wait := time.Now()
+	p, ok := r.take(req)
+	if !ok {
+		return nil // we didn't see this request dispatched
+	}
+	var data []byte
+	var omitted bool
+	if rsp.Body != nil {
+		var err error
+		data, omitted, rsp.Body, err = r.readBody(rsp.Body)
+		if err != nil {
+			return err
+		}
+	}
+	done := time.Now()
+
+	ent := p.entry
+	ent.Response = Response{
+		Status:      rsp.StatusCode,
+		StatusText:  http.StatusText(rsp.StatusCode),
+		HTTPVersion: rsp.Proto,
+		Cookies:     r.cookies(rsp.Cookies()),
+		Headers:     r.header(rsp.Header),
+		Content:     r.content(rsp.Header.Get("Content-Type"), data, omitted),
+		RedirectURL: rsp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(data),
+	}
+	if omitted {
+		ent.Response.BodySize = int(rsp.ContentLength) // -1 when it is not known
+		ent.Response.Content.Size = max(ent.Response.BodySize, 0)
+	}
+	ent.Timings.Wait = millis(wait.Sub(p.start))
+	ent.Timings.Receive = millis(done.Sub(wait))
+	ent.Time = millis(done.Sub(p.start))
+	r.add(ent)
+	return nil
+}
+
+func (r *Recorder) Failure(req *http.Request, err error) {
+	p, ok := r.take(req)
+	if !ok {
+		return // never dispatched; there is nothing to record
+	}
+	ent := p.entry
+	ent.Response = Response{
+		Cookies:     []NameValue{},
+		Headers:     []NameValue{},
+		Content:     Content{MimeType: "x-unknown"},
+		HeadersSize: -1,
+	}
+	var apierr *api.Error
+	if errors.As(err, &apierr) && apierr.Status > 0 { // the request failed with a response
+		ent.Response.Status = apierr.Status
+		ent.Response.StatusText = http.StatusText(apierr.Status)
+		if x := apierr.Entity; x != nil {
+			ent.Response.Content = r.content(x.ContentType, x.Data, false)
+			ent.Response.BodySize = len(x.Data)
+		}
+	}
+	ent.Time = millis(time.Since(p.start))
+	ent.Timings.Wait = ent.Time
+	ent.Error = err.Error()
+	r.add(ent)
+}
+
+func (r *Recorder) take(req *http.Request) (pending, bool) {
+	r.Lock()
+	defer r.Unlock()
+	p, ok := r.pending[req]
+	delete(r.pending, req)
+	return p, ok
+}
+
+func (r *Recorder) add(ent Entry) {
+	r.Lock()
+	defer r.Unlock()
+	if n := len(r.entries) + 1 - r.max; n > 0 {
+		r.entries = append(r.entries[:0:0], r.entries[n:]...)
+	}
+	r.entries = append(r.entries, ent)
+}
+
+// Produce an entry describing a request, without its response
+func (r *Recorder) request(req *http.Request) (Entry, error) {
+	data, omitted, err := r.requestBody(req)
+	if err != nil {
+		return Entry{}, err
+	}
+	hreq := Request{
+		Method:      req.Method,
+		URL:         r.url(req.URL),
+		HTTPVersion: ext(req.Proto, "HTTP/1.1"),
+		Cookies:     r.cookies(req.Cookies()),
+		Headers:     r.header(req.Header),
+		QueryString: r.queryString(req.URL.Query()),
+		HeadersSize: -1,
+		BodySize:    len(data),
+	}
+	if omitted {
+		hreq.BodySize = int(req.ContentLength) // -1 when it is not known
+		hreq.PostData = &PostData{MimeType: ext(req.Header.Get("Content-Type"), "x-unknown"), Comment: r.omitted()}
+	} else if len(data) > 0 {
+		c := r.content(req.Header.Get("Content-Type"), data, false)
+		hreq.PostData = &PostData{MimeType: c.MimeType, Text: c.Text}
+	}
+	return Entry{
+		StartedDateTime: time.Now(),
+		Request:         hreq,
+		Timings:         Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+	}, nil
+}
+
+func ext(v, d string) string {
+	if v == "" {
+		return d
+	}
+	return v
+}
+
+// Read a copy of a request's body, up to the maximum size, replacing the body
+// if it must be consumed to do so. A body which exceeds the maximum size is
+// reported as omitted.
+func (r *Recorder) requestBody(req *http.Request) ([]byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, false, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, false, err
+		}
+		defer body.Close()
+		data, err := io.ReadAll(io.LimitReader(body, r.maxBody+1))
+		if err != nil {
+			return nil, false, err
+		}
+		return data, int64(len(data)) > r.maxBody, nil
+	}
+	var data []byte
+	var omitted bool
+	var err error
+	data, omitted, req.Body, err = r.readBody(req.Body)
+	return data, omitted, err
+}
+
+// Read a body up to the maximum size, producing its data, whether it exceeds
+// the maximum size, and a body which produces the entire original content. No
+// more of the body is read than is needed to determine that it is too large.
+func (r *Recorder) readBody(body io.ReadCloser) ([]byte, bool, io.ReadCloser, error) {
+	data, err := io.ReadAll(io.LimitReader(body, r.maxBody+1))
+	rest := struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), body), body}
+	if err != nil {
+		return nil, false, rest, err
+	}
+	if int64(len(data)) > r.maxBody {
+		return nil, true, rest, nil
+	}
+	body.Close()
+	return data, false, io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (r *Recorder) omitted() string {
+	return fmt.Sprintf("Body omitted; it exceeds %d bytes", r.maxBody)
+}
+
+func (r *Recorder) url(u *url.URL) string {
+	return r.query.URL(u)
+}
+
+func (r *Recorder) queryString(q url.Values) []NameValue {
+	res := []NameValue{}
+	for k, v := range q {
+		_, redact := r.params[strings.ToLower(k)]
+		for _, e := range v {
+			if redact {
+				e = redactedValue
+			}
+			res = append(res, NameValue{Name: k, Value: e})
+		}
+	}
+	sortNameValues(res)
+	return res
+}
+
+func (r *Recorder) header(hdr http.Header) []NameValue {
+	res := []NameValue{}
+	for k, v := range hdr {
+		_, redact := r.headers[http.CanonicalHeaderKey(k)]
+		for _, e := range v {
+			if redact {
+				e = redactedValue
+			}
+			res = append(res, NameValue{Name: k, Value: e})
+		}
+	}
+	sortNameValues(res)
+	return res
+}
+
+// Cookie values are redacted along with cookie headers
+func (r *Recorder) cookies(c []*http.Cookie) []NameValue {
+	_, redactReq := r.headers["Cookie"]
+	_, redactRsp := r.headers["Set-Cookie"]
+	res := []NameValue{}
+	for _, e := range c {
+		v := e.Value
+		if redactReq || redactRsp {
+			v = redactedValue
+		}
+		res = append(res, NameValue{Name: e.Name, Value: v})
+	}
+	return res
+}
+
+func sortNameValues(v []NameValue) {
+	sort.SliceStable(v, func(i, j int) bool { return v[i].Name < v[j].Name })
+}
+
+// Describe body content, redacting fields from JSON and form-encoded data and
+// encoding binary data. The content of a body which was omitted is not
+// described.
+func (r *Recorder) content(ctype string, data []byte, omitted bool) Content {
+	c := Content{
+		Size:     len(data),
+		MimeType: ext(ctype, "x-unknown"),
+	}
+	if omitted {
+		c.Comment = r.omitted()
+		return c
+	}
+	if len(data) == 0 {
+		return c
+	}
+	data = r.fields.Body(ctype, data)
+	if utf8.Valid(data) {
+		c.Text = string(data)
+	} else {
+		c.Text = base64.StdEncoding.EncodeToString(data)
+		c.Encoding = "base64"
+	}
+	return c
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,144 @@
+package har
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	api "github.com/bww/go-apiclient/v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/missing" {
+			http.Error(rsp, "Nope", http.StatusNotFound)
+			return
+		}
+		data, _ := io.ReadAll(req.Body)
+		rsp.Header().Set("Content-Type", api.JSON)
+		rsp.Write(data)
+	}))
+	defer server.Close()
+
+	rec := New(WithMaxEntries(2))
+	client, err := api.New(
+		api.WithBaseURL(server.URL),
+		api.WithAuthorizer(api.NewBearerAuthorizer("secret")),
+		api.WithObservers(rec),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt := context.Background()
+
+	var out map[string]string
+	_, err = client.Post(cxt, "/login?token=abc&page=1", map[string]string{"user": "a", "password": "hunter2"}, &out)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hunter2", out["password"], "the response is not affected")
+	}
+	_, err = client.Get(cxt, "/missing", nil)
+	assert.ErrorIs(t, err, api.ErrNotFound)
+
+	h := rec.HAR()
+	assert.Equal(t, Version, h.Log.Version)
+	if assert.Len(t, h.Log.Entries, 2) {
+		e := h.Log.Entries[0]
+		assert.Equal(t, http.MethodPost, e.Request.Method)
+		assert.Equal(t, server.URL+"/login?token=REDACTED&page=1", e.Request.URL)
+		assert.Contains(t, e.Request.Headers, NameValue{Name: "Authorization", Value: "REDACTED"})
+		assert.Equal(t, []NameValue{{"page", "1"}, {"token", "REDACTED"}}, e.Request.QueryString)
+		if assert.NotNil(t, e.Request.PostData) {
+			assert.JSONEq(t, `{"user":"a","password":"REDACTED"}`, e.Request.PostData.Text)
+		}
+		assert.Equal(t, http.StatusOK, e.Response.Status)
+		assert.JSONEq(t, `{"user":"a","password":"REDACTED"}`, e.Response.Content.Text)
+		assert.True(t, e.Time >= 0)
+		assert.Equal(t, float64(-1), e.Timings.DNS)
+
+		e = h.Log.Entries[1]
+		assert.Equal(t, http.StatusNotFound, e.Response.Status)
+		assert.Equal(t, "Nope\n", e.Response.Content.Text)
+		assert.NotEmpty(t, e.Error)
+	}
+
+	_, err = client.Get(cxt, "/other", nil)
+	assert.NoError(t, err)
+	h = rec.HAR()
+	if assert.Len(t, h.Log.Entries, 2, "the oldest entry is discarded") {
+		assert.Equal(t, server.URL+"/other", h.Log.Entries[1].Request.URL)
+	}
+
+	buf := &bytes.Buffer{}
+	_, err = rec.WriteTo(buf)
+	if assert.NoError(t, err) {
+		var v HAR
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &v))
+		assert.Len(t, v.Log.Entries, 2)
+	}
+
+	rec.Reset()
+	assert.Len(t, rec.HAR().Log.Entries, 0)
+}
+
+func TestRecorderBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		rsp.Header().Set("Content-Type", req.Header.Get("Content-Type"))
+		rsp.Write(data)
+	}))
+	defer server.Close()
+
+	rec := New(WithMaxBodySize(32))
+	client, err := api.New(api.WithBaseURL(server.URL), api.WithObservers(rec))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt := context.Background()
+
+	req, err := http.NewRequestWithContext(cxt, http.MethodPost, "/form", strings.NewReader("user=a&password=b"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	req.Header.Set("Content-Type", api.URLEncoded)
+	_, err = client.Exec(req, nil)
+	assert.NoError(t, err)
+
+	large := strings.Repeat("x", 100)
+	req, err = http.NewRequestWithContext(cxt, http.MethodPost, "/large", io.NopCloser(strings.NewReader(large))) // cannot be read again
+	if !assert.NoError(t, err) {
+		return
+	}
+	req.Header.Set("Content-Type", api.PlainText)
+	rsp, err := client.ExecRaw(req)
+	if assert.NoError(t, err) {
+		data, err := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, large, string(data), "the entire body is sent and received")
+	}
+
+	h := rec.HAR()
+	if assert.Len(t, h.Log.Entries, 2) {
+		e := h.Log.Entries[0]
+		if assert.NotNil(t, e.Request.PostData) {
+			assert.Equal(t, "user=a&password=REDACTED", e.Request.PostData.Text)
+		}
+		assert.Equal(t, "user=a&password=REDACTED", e.Response.Content.Text)
+
+		e = h.Log.Entries[1]
+		if assert.NotNil(t, e.Request.PostData) {
+			assert.Equal(t, "", e.Request.PostData.Text)
+			assert.NotEmpty(t, e.Request.PostData.Comment)
+		}
+		assert.Equal(t, "", e.Response.Content.Text)
+		assert.NotEmpty(t, e.Response.Content.Comment)
+		assert.Equal(t, 100, e.Response.BodySize)
+	}
+}
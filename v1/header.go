@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	typeTime            = reflect.TypeOf(time.Time{})
+	typeDuration        = reflect.TypeOf(time.Duration(0))
+	typeTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// UnmarshalHeader populates the fields of the struct pointed to by entity from
+// response headers. Only fields with a `header` tag naming the header they are
+// mapped from are populated, for example:
+//
+//	type Meta struct {
+//	  ETag     string    `header:"ETag"`
+//	  Length   int64     `header:"Content-Length"`
+//	  Modified time.Time `header:"Last-Modified"`
+//	}
+//
+// Fields may be strings, string slices (which receive every value of the
+// header), booleans, numbers, time.Time (parsed as an HTTP date),
+// time.Duration (parsed as a number of seconds), or implement
+// encoding.TextUnmarshaler. Headers which are not present leave their fields
+// unmodified.
+//
+// This is used to unmarshal the response to a HEAD request.
+func UnmarshalHeader(hdr http.Header, entity interface{}) error {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Cannot unmarshal headers into %T; must be a pointer to a struct", entity)
+	}
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("header")
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		vals := hdr.Values(name)
+		if len(vals) == 0 {
+			continue
+		}
+		if err := setHeaderField(v.Field(i), vals); err != nil {
+			return fmt.Errorf("Could not unmarshal header %s into %s: %w", name, f.Name, err)
+		}
+	}
+	return nil
+}
+
+func setHeaderField(f reflect.Value, vals []string) error {
+	if f.Kind() == reflect.Pointer {
+		p := reflect.New(f.Type().Elem())
+		if err := setHeaderField(p.Elem(), vals); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+	if reflect.PointerTo(f.Type()).Implements(typeTextUnmarshaler) {
+		return f.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(vals[0]))
+	}
+	s := vals[0]
+	switch f.Type() {
+	case typeTime:
+		t, err := http.ParseTime(s)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	case typeDuration:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(time.Duration(n) * time.Second))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Slice:
+		if f.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("Unsupported type: %v", f.Type())
+		}
+		l := reflect.MakeSlice(f.Type(), len(vals), len(vals))
+		for i, e := range vals {
+			l.Index(i).SetString(e)
+		}
+		f.Set(l)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("Unsupported type: %v", f.Type())
+	}
+	return nil
+}
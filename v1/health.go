@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrUnhealthy = errors.New("Service is unhealthy")
+
+// The number of recent latency samples retained per host for health reporting
+const healthSamples = 256
+
+// Latency percentiles observed for a host
+type Latency struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+}
+
+// The health of a host, as observed by a client. A host is considered to
+// have failed a request when the request could not be performed or the host
+// responded with a server error or 429 Too Many Requests; other error
+// statuses indicate the host is responding normally. Requests which are
+// canceled by the caller or never sent are not considered failures.
+type HostHealth struct {
+	Host                string    `json:"host"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastFailure         time.Time `json:"last_failure,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	InFlight            int       `json:"in_flight"`
+	NewConns            int64     `json:"new_conns"`
+	ReusedConns         int64     `json:"reused_conns"`
+	Latency             Latency   `json:"latency"`
+}
+
+// Health state is shared by a client and every client derived from it
+type health struct {
+	sync.Mutex
+	hosts map[string]*hostHealth
+}
+
+type hostHealth struct {
+	HostHealth
+	latency latencyWindow
+}
+
+func newHealth() *health {
+	return &health{hosts: make(map[string]*hostHealth)}
+}
+
+// Obtain the state for a host; the caller must hold the lock
+func (h *health) host(host string) *hostHealth {
+	e, ok := h.hosts[host]
+	if !ok {
+		e = &hostHealth{HostHealth: HostHealth{Host: host}}
+		h.hosts[host] = e
+	}
+	return e
+}
+
+func (h *health) Begin(host string) {
+	h.Lock()
+	defer h.Unlock()
+	h.host(host).InFlight++
+}
+
+func (h *health) End(host string) {
+	h.Lock()
+	defer h.Unlock()
+	h.host(host).InFlight--
+}
+
+// Record the outcome of a request
+func (h *health) Record(host string, start time.Time, err error) {
+	now := time.Now()
+	h.Lock()
+	defer h.Unlock()
+	e := h.host(host)
+	if isHostFailure(err) {
+		e.LastFailure = now
+		e.LastError = err.Error()
+		e.ConsecutiveFailures++
+	} else {
+		e.LastSuccess = now
+		e.ConsecutiveFailures = 0
+		e.latency.add(now.Sub(start), healthSamples)
+	}
+}
+
+func isHostFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrInterrupted) || errors.Is(err, ErrWouldExceedDeadline) || errors.Is(err, ErrPaused) || errors.Is(err, ErrCouldNotAuthorize) {
+		return false // these are not the host's fault
+	}
+	var apierr *Error
+	if errors.As(err, &apierr) && apierr.Status > 0 {
+		return apierr.Status >= 500 || apierr.Status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// Produce a client trace which tracks connection use for a host
+func (h *health) connTrace(host string) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			h.Lock()
+			defer h.Unlock()
+			if info.Reused {
+				h.host(host).ReusedConns++
+			} else {
+				h.host(host).NewConns++
+			}
+		},
+	}
+}
+
+// Snapshot the health of every host
+func (h *health) Snapshot() []HostHealth {
+	h.Lock()
+	defer h.Unlock()
+	res := make([]HostHealth, 0, len(h.hosts))
+	for _, e := range h.hosts {
+		s := e.latency.sorted()
+		v := e.HostHealth
+		v.Latency = Latency{
+			P50: percentile(s, 0.5),
+			P90: percentile(s, 0.9),
+			P99: percentile(s, 0.99),
+		}
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Host < res[j].Host })
+	return res
+}
+
+// Health reports the health of every host the client, or any client derived
+// from it, has made requests to, ordered by host. This is intended to allow
+// services to incorporate the health of their dependencies into their own
+// health and readiness checks.
+func (c *Client) Health() []HostHealth {
+	if c.health == nil {
+		return nil
+	}
+	return c.health.Snapshot()
+}
+
+// A probe is a request which determines whether the service a client uses is
+// healthy. The path is resolved against the client's base URL; an empty path
+// probes the base URL itself.
+type Probe struct {
+	Method       string
+	Path         string
+	ExpectStatus []int         // statuses which indicate health; by default, any successful status
+	Timeout      time.Duration // by default, five seconds
+}
+
+const defaultProbeTimeout = time.Second * 5
+
+// WithProbe sets the probe used by Healthy. By default, the probe is a GET
+// request for the base URL.
+func WithProbe(p Probe) Option {
+	return func(c Config) Config {
+		c.Probe = &p
+		return c
+	}
+}
+
+// Healthy performs the client's probe and returns nil if the service appears
+// to be healthy, or an error which wraps ErrUnhealthy otherwise. The probe is
+// authorized like any other request, but it is never retried, it does not
+// wait for rate limits, and it fails immediately if the client is paused,
+// which makes it suitable for readiness checks.
+func (c *Client) Healthy(cxt context.Context) error {
+	p := Probe{Method: http.MethodGet, Timeout: defaultProbeTimeout}
+	if c.conf.Probe != nil {
+		v := *c.conf.Probe
+		if v.Method != "" {
+			p.Method = v.Method
+		}
+		if v.Path != "" {
+			p.Path = v.Path
+		}
+		if v.Timeout > 0 {
+			p.Timeout = v.Timeout
+		}
+		p.ExpectStatus = v.ExpectStatus
+	}
+
+	cxt, cancel := context.WithTimeout(cxt, p.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(cxt, p.Method, p.Path, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnhealthy, err)
+	}
+	opts := []Option{WithRetryBudget(NewRetryBudget(0)), WithScheduled(), WithPauseFailFast(true)}
+	if len(p.ExpectStatus) > 0 {
+		opts = append(opts, WithSuccessStatuses(func(s int) bool {
+			return slices.Contains(p.ExpectStatus, s)
+		}))
+	}
+	rsp, err := c.roundTrip(req, Config{}.WithOptions(opts))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnhealthy, err)
+	}
+	c.metrics.get().drain(req.URL.Host, rsp)
+	return nil
+}
+
+// A checker reports whether a dependency is healthy, in the form used by many
+// readiness check libraries.
+type Checker interface {
+	Name() string
+	Check(context.Context) error
+}
+
+type clientChecker struct {
+	name   string
+	client *Client
+}
+
+func (c clientChecker) Name() string {
+	return c.name
+}
+
+func (c clientChecker) Check(cxt context.Context) error {
+	return c.client.Healthy(cxt)
+}
+
+// Checker adapts the client's probe to a checker with the provided name
+func (c *Client) Checker(name string) Checker {
+	return clientChecker{name, c}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Sentinel errors which identify requests blocked by a CDN or web application
+// firewall in front of a service, rather than by the service itself.
+var (
+	ErrCloudflareBlocked = errors.New("Blocked by Cloudflare")
+	ErrAkamaiBlocked     = errors.New("Blocked by Akamai")
+)
+
+// The maximum length of an HTML error page retained in an error entity
+const maxHTMLEntity = 1 << 10
+
+var (
+	htmlTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlH1    = regexp.MustCompile(`(?is)<h1[^>]*>(.*?)</h1>`)
+	htmlTag   = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlSpace = regexp.MustCompile(`\s+`)
+)
+
+func isHTML(ctype string) bool {
+	m, _, err := mime.ParseMediaType(ctype)
+	return err == nil && strings.EqualFold(m, "text/html")
+}
+
+// Summarize an HTML error page, such as one produced by a proxy or CDN, by
+// extracting its title into the error message and truncating the entity.
+// If the page is recognized as a CDN block page, a sentinel is returned.
+func (e *Error) summarizeHTML(hdr http.Header) error {
+	ent := e.Entity
+	if ent == nil || !isHTML(ent.ContentType) {
+		return nil
+	}
+	cdn := detectCDN(hdr, ent.Data)
+	if t := htmlSummary(ent.Data); t != "" {
+		e.Message += ": " + t
+	}
+	if len(ent.Data) > maxHTMLEntity {
+		ent.Data = append(ent.Data[:maxHTMLEntity:maxHTMLEntity], []byte("...")...)
+		ent.Truncated = true
+	}
+	return cdn
+}
+
+// Set the cause of an error to a CDN sentinel, in addition to any existing cause
+func (e *Error) setBlocked(cdn error) {
+	if e.Cause != nil {
+		e.Cause = fmt.Errorf("%w: %w", cdn, e.Cause)
+	} else {
+		e.Cause = cdn
+	}
+}
+
+// Extract the title of an HTML page, or its first heading if it has none
+func htmlSummary(data []byte) string {
+	for _, r := range []*regexp.Regexp{htmlTitle, htmlH1} {
+		if m := r.FindSubmatch(data); m != nil {
+			t := htmlTag.ReplaceAllString(string(m[1]), " ")
+			t = strings.TrimSpace(htmlSpace.ReplaceAllString(html.UnescapeString(t), " "))
+			if t != "" {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// Identify common CDN block pages
+func detectCDN(hdr http.Header, data []byte) error {
+	body := strings.ToLower(string(data))
+	server := strings.ToLower(hdr.Get("Server"))
+	switch {
+	case hdr.Get("Cf-Mitigated") != "",
+		(server == "cloudflare" || hdr.Get("Cf-Ray") != "") && (strings.Contains(body, "error 1020") || strings.Contains(body, "access denied") || strings.Contains(body, "attention required")):
+		return ErrCloudflareBlocked
+	case strings.Contains(server, "akamaighost") && strings.Contains(body, "access denied"),
+		strings.Contains(body, "errors.edgesuite.net"):
+		return ErrAkamaiBlocked
+	}
+	return nil
+}
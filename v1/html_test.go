@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTMLErrors(t *testing.T) {
+	long := strings.Repeat("<p>Lorem ipsum dolor sit amet.</p>\n", 100)
+	tests := []struct {
+		Status  int
+		Header  http.Header
+		Body    string
+		Message string
+		Cause   []error
+	}{
+		{
+			http.StatusBadGateway,
+			http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+			"<html><head><title>502 Bad\n  Gateway</title></head><body>" + long + "</body></html>",
+			"Unexpected status code: 502 Bad Gateway: 502 Bad Gateway",
+			nil,
+		},
+		{
+			http.StatusServiceUnavailable,
+			http.Header{"Content-Type": {"text/html"}},
+			"<html><body><h1>Service <b>Temporarily</b> Unavailable &amp; Down</h1></body></html>",
+			"Unexpected status code: 503 Service Unavailable: Service Temporarily Unavailable & Down",
+			nil,
+		},
+		{
+			http.StatusForbidden,
+			http.Header{"Content-Type": {"text/html"}, "Server": {"cloudflare"}, "Cf-Ray": {"8a1b2c3d4e5f-SJC"}},
+			"<html><head><title>Access denied | api.example.com used Cloudflare to restrict access</title></head><body><h1>Error 1020</h1></body></html>",
+			"Unexpected status code: 403 Forbidden: Access denied | api.example.com used Cloudflare to restrict access",
+			[]error{ErrCloudflareBlocked, ErrForbidden},
+		},
+		{
+			http.StatusForbidden,
+			http.Header{"Content-Type": {"text/html"}, "Server": {"AkamaiGHost"}},
+			"<HTML><HEAD>\n<TITLE>Access Denied</TITLE>\n</HEAD><BODY>\n<H1>Access Denied</H1>\nReference&#32;&#35;18&#46;2c3e4f&#46;1700000000&#46;abc\n<P>https&#58;&#47;&#47;errors&#46;edgesuite&#46;net</P></BODY></HTML>",
+			"Unexpected status code: 403 Forbidden: Access Denied",
+			[]error{ErrAkamaiBlocked, ErrForbidden},
+		},
+		{
+			http.StatusForbidden,
+			http.Header{"Content-Type": {"application/json"}, "Server": {"cloudflare"}},
+			`{"error":"access denied"}`,
+			"Unexpected status code: 403 Forbidden",
+			[]error{ErrForbidden},
+		},
+	}
+	req, err := http.NewRequest("GET", "https://api.example.com/v1/things", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, e := range tests {
+		rsp := &http.Response{
+			StatusCode: e.Status,
+			Header:     e.Header,
+			Body:       io.NopCloser(strings.NewReader(e.Body)),
+		}
+		err := checkErr(1, req, rsp, DefaultErrorEntityLimit)
+		var apierr *Error
+		if assert.True(t, errors.As(err, &apierr)) {
+			assert.Equal(t, e.Message, apierr.Message)
+			assert.LessOrEqual(t, len(apierr.Entity.Data), maxHTMLEntity+3)
+		}
+		for _, c := range e.Cause {
+			assert.ErrorIs(t, err, c)
+		}
+		if len(e.Cause) < 2 {
+			assert.False(t, errors.Is(err, ErrCloudflareBlocked) || errors.Is(err, ErrAkamaiBlocked))
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package httputil
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 )
 
 type Link struct {
 	URL    string
+	Rel    string
 	Params map[string]string
 }
 
@@ -13,27 +17,86 @@ func (l *Link) Results() bool {
 	return l.Params != nil && l.Params["results"] == "true"
 }
 
-// ParseNext parses the next link from the response header
-func ParseNext(rsp *http.Response) (*Link, error) {
+// The links of a response by their relation types, which are in lower case
+type Links map[string]*Link
+
+// Get returns the link with a relation type, if any. Relation types are
+// case-insensitive.
+func (l Links) Get(rel string) *Link {
+	return l[strings.ToLower(rel)]
+}
+
+// URL returns the URL of the link with a relation type, if any
+func (l Links) URL(rel string) string {
+	if v := l.Get(rel); v != nil {
+		return v.URL
+	}
+	return ""
+}
+
+// Next returns the URL of the next page, if any
+func (l Links) Next() string {
+	return l.URL("next")
+}
+
+// Prev returns the URL of the previous page, if any. Some services use the
+// relation type "previous" rather than "prev"; either is recognized.
+func (l Links) Prev() string {
+	if v := l.URL("prev"); v != "" {
+		return v
+	}
+	return l.URL("previous")
+}
+
+// First returns the URL of the first page, if any
+func (l Links) First() string {
+	return l.URL("first")
+}
+
+// Last returns the URL of the last page, if any
+func (l Links) Last() string {
+	return l.URL("last")
+}
+
+// ParseAll parses every link from the response header. A response without
+// links produces an empty set.
+func ParseAll(rsp *http.Response) (Links, error) {
+	res := make(Links)
 	if rsp == nil {
-		return nil, nil
+		return res, nil
 	}
-	hdr := rsp.Header.Get("Link")
+	hdr := linkHeader(rsp.Header)
 	if hdr == "" {
-		return nil, nil
+		return res, nil
 	}
 	links, err := parseLinks(hdr)
 	if err != nil {
 		return nil, err
 	}
-	next, ok := links["next"]
-	if !ok {
-		return nil, nil
+	for k, v := range links {
+		res[k] = &Link{
+			URL:    v.URL,
+			Rel:    v.Rel,
+			Params: v.Params,
+		}
+	}
+	return res, nil
+}
+
+// ParseRel parses the link with a relation type, such as "prev", "first", or
+// "last", from the response header. If there is no such link, nil is
+// returned.
+func ParseRel(rsp *http.Response, rel string) (*Link, error) {
+	links, err := ParseAll(rsp)
+	if err != nil {
+		return nil, err
 	}
-	return &Link{
-		URL:    next.URL,
-		Params: next.Params,
-	}, nil
+	return links.Get(rel), nil
+}
+
+// ParseNext parses the next link from the response header
+func ParseNext(rsp *http.Response) (*Link, error) {
+	return ParseRel(rsp, "next")
 }
 
 // NextPage returns the URL of the next link from the response header
@@ -54,3 +117,72 @@ func NextPage(rsp *http.Response) (string, error) {
 
 	return next.URL, nil
 }
+
+// Produce the value of every Link header, which may be provided in more than
+// one field
+func linkHeader(hdr http.Header) string {
+	return strings.Join(hdr.Values("Link"), ", ")
+}
+
+// FormatLinks produces the value of a Link header for the provided links, as
+// described by RFC 8288. The "rel" parameter of each link, or its relation
+// type if it has no such parameter, is produced first, followed by its other
+// parameters in order by name. Values are quoted when they are not tokens,
+// and extended parameters, whose names end in '*', are encoded as described
+// by RFC 8187.
+func FormatLinks(links ...Link) string {
+	var b strings.Builder
+	for i, l := range links {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("<" + l.URL + ">")
+		params := l.Params
+		if _, ok := params["rel"]; !ok && l.Rel != "" {
+			params = map[string]string{"rel": l.Rel}
+			for k, v := range l.Params {
+				params[k] = v
+			}
+		}
+		keys := make([]string, 0, len(params))
+		for k := range params {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i] == "rel" || keys[j] == "rel" {
+				return keys[i] == "rel"
+			}
+			return keys[i] < keys[j]
+		})
+		for _, k := range keys {
+			b.WriteString("; " + k + "=" + formatParam(k, params[k]))
+		}
+	}
+	return b.String()
+}
+
+// Format the value of a link parameter
+func formatParam(key, val string) string {
+	if strings.HasSuffix(key, "*") {
+		return "UTF-8''" + encodeExtValue(val)
+	}
+	if val != "" && !strings.ContainsAny(val, " \t=;,\"\\()<>@:/[]?{}") {
+		return val
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(val) + `"`
+}
+
+// Percent-encode a value as described by RFC 8187, leaving only the
+// characters permitted in an extended value unencoded
+func encodeExtValue(val string) string {
+	var b strings.Builder
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -70,3 +70,56 @@ func TestNextLink(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatLinks(t *testing.T) {
+	links := []Link{
+		{URL: "https://example.com/?page=2", Params: map[string]string{"rel": "next", "type": "application/json"}},
+		{URL: "https://example.com/?page=9", Params: map[string]string{"title": "The \"last\" page", "rel": "last", "title*": "€ rates"}},
+	}
+	hdr := FormatLinks(links...)
+	assert.Equal(t, `<https://example.com/?page=2>; rel=next; type="application/json", <https://example.com/?page=9>; rel=last; title="The \"last\" page"; title*=UTF-8''%E2%82%AC%20rates`, hdr)
+
+	parsed, err := parseLinks(hdr)
+	if assert.NoError(t, err) {
+		assert.Equal(t, links[0].Params, parsed["next"].Params)
+		assert.Equal(t, links[1].Params, parsed["last"].Params)
+	}
+
+	next, err := NextPage(&http.Response{Header: http.Header{"Link": []string{FormatLinks(links[1]), FormatLinks(links[0])}}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, links[0].URL, next) // links may be provided in several fields
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	rsp := responseWithLink(`<https://example.com/?page=1>; rel="first prev", <https://example.com/?page=3>; rel=next, <https://example.com/?page=9>; rel=LAST`)
+
+	links, err := ParseAll(rsp)
+	if assert.NoError(t, err) {
+		assert.Len(t, links, 4)
+		assert.Equal(t, "https://example.com/?page=1", links.First())
+		assert.Equal(t, "https://example.com/?page=1", links.Prev())
+		assert.Equal(t, "https://example.com/?page=3", links.Next())
+		assert.Equal(t, "https://example.com/?page=9", links.Last())
+		assert.Equal(t, "", links.URL("self"))
+	}
+
+	last, err := ParseRel(rsp, "Last")
+	if assert.NoError(t, err) && assert.NotNil(t, last) {
+		assert.Equal(t, "last", last.Rel)
+		assert.Equal(t, "https://example.com/?page=9", last.URL)
+	}
+	none, err := ParseRel(rsp, "self")
+	if assert.NoError(t, err) {
+		assert.Nil(t, none)
+	}
+
+	links, err = ParseAll(responseWithLink(`<https://example.com/?cursor=a>; rel="previous"`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://example.com/?cursor=a", links.Prev())
+	}
+	_, err = ParseAll(responseWithLink(`https://example.com/; rel=next`))
+	assert.Equal(t, errMalformedLinks, err)
+
+	assert.Equal(t, `<https://example.com/?page=2>; rel=next; type="application/json"`, FormatLinks(Link{URL: "https://example.com/?page=2", Rel: "next", Params: map[string]string{"type": "application/json"}}))
+}
@@ -2,9 +2,9 @@ package httputil
 
 import (
 	"errors"
-	"strconv"
+	"net/url"
 	"strings"
-	"unicode"
+	"unicode/utf8"
 )
 
 var (
@@ -17,93 +17,204 @@ type link struct {
 	Params   map[string]string
 }
 
-// Parse parses a raw Link header in the form:
+// Parse parses a raw Link header, as described by RFC 8288, in the form:
 //
 //	<url>; rel="foo", <url>; rel="bar"; wat="dis"
 //
-// ...returning a slice of Link structs
-//
-// NOTE: there is a known bug in link parsing which we can't be bothered to fix
-// at the moment. Specifically, we will not correctly handle a parameter that
-// contains a ';' character in its text due to the naieve approach we take to
-// delimiter handling. Specifically, the following will not work as intended:
-//
-//	<url>; rel="foo"; foo="contains; a literal semicolon"
+// ...returning a map of links by their relation types. A link with several
+// relation types, such as rel="next last", is produced under each of them,
+// and a later link with the same relation type replaces an earlier one.
+// Relation types and parameter names are case-insensitive, so they are
+// produced in lower case. Only the first occurrence of a parameter in a link
+// is considered. Extended parameters, such as title*, are decoded as described
+// by RFC 8187 and produced under their own names.
 func parseLinks(src string) (map[string]link, error) {
 	links := make(map[string]link)
-
-	for len(src) > 0 {
-		var part string
-		if x := strings.Index(src, ","); x > 0 {
-			part, src = src[:x], src[x+1:]
-		} else {
-			part, src = src, ""
+	p := &linkScanner{src: src}
+	for {
+		p.skip(" \t,") // empty list elements are permitted
+		if p.done() {
+			break
 		}
-
-		var url, arg string
-		if x := strings.Index(part, ";"); x > 0 {
-			url, arg = strings.TrimSpace(part[:x]), strings.TrimSpace(part[x+1:])
-		} else {
-			url = strings.TrimSpace(part)
+		url, err := p.target()
+		if err != nil {
+			return nil, err
 		}
-
-		if l := len(url); l < 2 {
-			return nil, errMalformedLinks
-		} else if url[0] != '<' || url[l-1] != '>' {
-			return nil, errMalformedLinks
-		} else {
-			url = url[1 : l-1]
+		params, err := p.params()
+		if err != nil {
+			return nil, err
 		}
-
-		params := make(map[string]string)
-		args := strings.Split(arg, ";")
-		for _, a := range args {
-			if len(a) > 0 {
-				key, val, err := parseParam(a)
-				if err != nil {
-					return nil, err
-				}
-				key = strings.TrimSpace(key)
-				val = strings.TrimSpace(val)
-				params[key] = val
-			}
+		rel, ok := params["rel"]
+		if !ok {
+			continue
 		}
-
-		if rel, ok := params["rel"]; ok {
-			links[rel] = link{
+		rels := strings.Fields(rel)
+		if len(rels) == 0 {
+			rels = []string{rel}
+		}
+		for _, e := range rels {
+			e = strings.ToLower(e)
+			links[e] = link{
 				URL:    url,
-				Rel:    rel,
+				Rel:    e,
 				Params: params,
 			}
 		}
+	}
+	return links, nil
+}
 
-		for i, r := range src {
-			if !unicode.IsSpace(r) {
-				src = src[i:]
-				break
-			}
-		}
+// A scanner which consumes a Link header
+type linkScanner struct {
+	src string
+	pos int
+}
+
+func (p *linkScanner) done() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *linkScanner) peek() byte {
+	if p.done() {
+		return 0
 	}
+	return p.src[p.pos]
+}
 
-	return links, nil
+// Skip any of the provided characters
+func (p *linkScanner) skip(chars string) {
+	for !p.done() && strings.IndexByte(chars, p.src[p.pos]) >= 0 {
+		p.pos++
+	}
 }
 
-func parseParam(src string) (string, string, error) {
-	var key, val string
-	if x := strings.Index(src, "="); x < 0 {
-		return "", "", errMalformedParam
-	} else {
-		key, val = src[:x], src[x+1:]
+// Consume the target URI of a link, which is enclosed in angle brackets
+func (p *linkScanner) target() (string, error) {
+	if p.peek() != '<' {
+		return "", errMalformedLinks
+	}
+	x := strings.IndexByte(p.src[p.pos:], '>')
+	if x < 0 {
+		return "", errMalformedLinks
+	}
+	u := p.src[p.pos+1 : p.pos+x]
+	if strings.ContainsAny(u, " \t<\"") {
+		return "", errMalformedLinks
+	}
+	p.pos += x + 1
+	return u, nil
+}
+
+// Consume the parameters of a link, up to the end of the link
+func (p *linkScanner) params() (map[string]string, error) {
+	params := make(map[string]string)
+	for {
+		p.skip(" \t")
+		switch p.peek() {
+		case 0:
+			return params, nil
+		case ',':
+			p.pos++
+			return params, nil
+		case ';':
+			p.pos++
+		default:
+			return nil, errMalformedLinks
+		}
+		p.skip(" \t")
+		if c := p.peek(); c == 0 || c == ',' || c == ';' {
+			continue // an empty parameter
+		}
+		key, val, err := p.param()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := params[key]; !ok {
+			params[key] = val
+		}
 	}
-	if len(key) < 1 {
+}
+
+// Consume a parameter, whose value is optional
+func (p *linkScanner) param() (string, string, error) {
+	key := strings.ToLower(p.token())
+	if key == "" {
 		return "", "", errMalformedParam
 	}
-	if len(val) > 0 && val[0] == '"' {
+	p.skip(" \t")
+	if p.peek() != '=' {
+		return key, "", nil
+	}
+	p.pos++
+	p.skip(" \t")
+	var val string
+	if p.peek() == '"' {
+		var err error
+		val, err = p.quoted()
+		if err != nil {
+			return "", "", err
+		}
+	} else {
+		val = p.token()
+	}
+	if strings.HasSuffix(key, "*") {
 		var err error
-		val, err = strconv.Unquote(val)
+		val, err = decodeExtValue(val)
 		if err != nil {
 			return "", "", err
 		}
 	}
 	return key, val, nil
 }
+
+// Consume a token, which ends at whitespace or a delimiter
+func (p *linkScanner) token() string {
+	start := p.pos
+	for !p.done() && strings.IndexByte(" \t=;,\"", p.src[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// Consume a quoted string, in which a backslash escapes the next character
+func (p *linkScanner) quoted() (string, error) {
+	var b strings.Builder
+	for p.pos++; !p.done(); p.pos++ {
+		switch c := p.src[p.pos]; c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			p.pos++
+			if p.done() {
+				return "", errMalformedParam
+			}
+			b.WriteByte(p.src[p.pos])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", errMalformedParam
+}
+
+// Decode an extended parameter value, as described by RFC 8187, in the form:
+//
+//	UTF-8'en'%E2%82%AC%20rates
+//
+// The language is discarded. Only the UTF-8 character set is supported, as
+// required by RFC 8187.
+func decodeExtValue(v string) (string, error) {
+	charset, rest, ok := strings.Cut(v, "'")
+	if !ok {
+		return "", errMalformedParam
+	}
+	_, enc, ok := strings.Cut(rest, "'")
+	if !ok || !strings.EqualFold(charset, "UTF-8") {
+		return "", errMalformedParam
+	}
+	val, err := url.PathUnescape(enc)
+	if err != nil || !utf8.ValidString(val) {
+		return "", errMalformedParam
+	}
+	return val, nil
+}
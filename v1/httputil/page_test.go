@@ -119,3 +119,79 @@ func TestParseLinks(t *testing.T) {
 		}
 	}
 }
+
+func TestParseLinksRFC8288(t *testing.T) {
+	tests := []struct {
+		Header string
+		Expect map[string]link
+		Error  error
+	}{
+		{
+			"<https://example.com/a;b,c>; rel=\"next\"; title=\"One; two, three\"",
+			map[string]link{
+				"next": link{
+					URL: "https://example.com/a;b,c",
+					Rel: "next",
+					Params: map[string]string{
+						"rel":   "next",
+						"title": "One; two, three",
+					},
+				},
+			},
+			nil,
+		},
+		{
+			"<https://example.com/2>; REL=\"Next Last\"; rel=ignored; Title*=UTF-8'de'n%c3%a4chstes%20Kapitel, , <https://example.com/1>; rel=prev; crossorigin",
+			map[string]link{
+				"next": link{
+					URL: "https://example.com/2",
+					Rel: "next",
+					Params: map[string]string{
+						"rel":    "Next Last",
+						"title*": "nächstes Kapitel",
+					},
+				},
+				"last": link{
+					URL: "https://example.com/2",
+					Rel: "last",
+					Params: map[string]string{
+						"rel":    "Next Last",
+						"title*": "nächstes Kapitel",
+					},
+				},
+				"prev": link{
+					URL: "https://example.com/1",
+					Rel: "prev",
+					Params: map[string]string{
+						"rel":         "prev",
+						"crossorigin": "",
+					},
+				},
+			},
+			nil,
+		},
+		{
+			"<https://example.com/>; rel=\"next",
+			nil,
+			errMalformedParam,
+		},
+		{
+			"<https://example.com/>; title*=latin1''caf%e9",
+			nil,
+			errMalformedParam,
+		},
+		{
+			"<https://example.com/> rel=next",
+			nil,
+			errMalformedLinks,
+		},
+	}
+	for i, e := range tests {
+		r, err := parseLinks(e.Header)
+		if e.Error != nil {
+			assert.Equal(t, e.Error, err, fmt.Sprintf("[#%d]", i))
+		} else if assert.Nil(t, err, fmt.Sprint(err)) {
+			assert.Equal(t, e.Expect, r, fmt.Sprintf("[#%d]", i))
+		}
+	}
+}
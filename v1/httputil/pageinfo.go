@@ -0,0 +1,134 @@
+package httputil
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PageInfo describes the pagination of a response, as reported by its
+// headers. Counts which are not reported are -1.
+type PageInfo struct {
+	// The total number of items in the collection
+	Total int
+	// The number of the current page
+	Page int
+	// The number of items in each page
+	PerPage int
+	// The number of pages in the collection
+	Pages int
+	// The offsets of the first and last items in the response, inclusive
+	Start, End int
+	// The URLs of adjacent pages, which are empty if they are not linked
+	Next, Prev, First, Last string
+}
+
+// ParsePageInfo parses the pagination metadata from the headers of a
+// response. The following are recognized:
+//
+//   - X-Total-Count or X-Total, the total number of items;
+//   - X-Page, X-Per-Page, and X-Total-Pages;
+//   - Link, from which the page URLs are taken and, when the last page has a
+//     "page" query parameter, the number of pages;
+//   - Content-Range, in the form "items 0-49/1230", from which the offsets of
+//     the items and the total number of items are taken. Ranges in any other
+//     unit, such as the "bytes" of a partial response, are ignored.
+//
+// Counts which are not reported directly are derived from the others when
+// possible. Headers which cannot be parsed are ignored, except for Link,
+// which produces an error.
+func ParsePageInfo(rsp *http.Response) (*PageInfo, error) {
+	info := &PageInfo{Total: -1, Page: -1, PerPage: -1, Pages: -1, Start: -1, End: -1}
+	if rsp == nil {
+		return info, nil
+	}
+	hdr := rsp.Header
+
+	info.Total = headerInt(hdr, "X-Total-Count", "X-Total")
+	info.Page = headerInt(hdr, "X-Page")
+	info.PerPage = headerInt(hdr, "X-Per-Page")
+	info.Pages = headerInt(hdr, "X-Total-Pages")
+
+	links, err := ParseAll(rsp)
+	if err != nil {
+		return nil, err
+	}
+	info.Next, info.Prev = links.Next(), links.Prev()
+	info.First, info.Last = links.First(), links.Last()
+	if info.Pages < 0 && info.Last != "" {
+		info.Pages = queryInt(info.Last, "page")
+	}
+
+	if start, end, total, ok := parseContentRange(hdr.Get("Content-Range")); ok {
+		info.Start, info.End = start, end
+		if info.Total < 0 {
+			info.Total = total
+		}
+	}
+
+	if info.Pages < 0 && info.Total >= 0 && info.PerPage > 0 {
+		info.Pages = (info.Total + info.PerPage - 1) / info.PerPage
+	}
+	return info, nil
+}
+
+// Parse the first of the provided headers which is present as an integer
+func headerInt(hdr http.Header, keys ...string) int {
+	for _, k := range keys {
+		if v := strings.TrimSpace(hdr.Get(k)); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return -1
+			}
+			return n
+		}
+	}
+	return -1
+}
+
+// Parse a query parameter of a URL as an integer
+func queryInt(u, key string) int {
+	p, err := url.Parse(u)
+	if err != nil {
+		return -1
+	}
+	n, err := strconv.Atoi(p.Query().Get(key))
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// Parse a Content-Range header in the form "items <start>-<end>/<total>",
+// where the total may be "*" if it is not known
+func parseContentRange(v string) (int, int, int, bool) {
+	unit, v, ok := strings.Cut(strings.TrimSpace(v), " ")
+	if !ok || !strings.EqualFold(unit, "items") {
+		return 0, 0, 0, false
+	}
+	r, t, ok := strings.Cut(v, "/")
+	if !ok {
+		return 0, 0, 0, false
+	}
+	s, e, ok := strings.Cut(r, "-")
+	if !ok {
+		return 0, 0, 0, false
+	}
+	start, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	end, err := strconv.Atoi(e)
+	if err != nil || end < start {
+		return 0, 0, 0, false
+	}
+	total := -1
+	if t != "*" {
+		total, err = strconv.Atoi(t)
+		if err != nil {
+			return 0, 0, 0, false
+		}
+	}
+	return start, end, total, true
+}
@@ -0,0 +1,69 @@
+package httputil
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePageInfo(t *testing.T) {
+	tests := []struct {
+		Header http.Header
+		Expect *PageInfo
+		Error  error
+	}{
+		{
+			Header: http.Header{},
+			Expect: &PageInfo{Total: -1, Page: -1, PerPage: -1, Pages: -1, Start: -1, End: -1},
+		},
+		{
+			Header: http.Header{
+				"X-Total-Count": []string{"95"},
+				"X-Page":        []string{"2"},
+				"X-Per-Page":    []string{"10"},
+			},
+			Expect: &PageInfo{Total: 95, Page: 2, PerPage: 10, Pages: 10, Start: -1, End: -1},
+		},
+		{
+			Header: http.Header{
+				"Link": []string{`<https://api.github.com/repos?page=3>; rel="next", <https://api.github.com/repos?page=34>; rel="last", <https://api.github.com/repos?page=1>; rel="prev"`},
+			},
+			Expect: &PageInfo{Total: -1, Page: -1, PerPage: -1, Pages: 34, Start: -1, End: -1, Next: "https://api.github.com/repos?page=3", Prev: "https://api.github.com/repos?page=1", Last: "https://api.github.com/repos?page=34"},
+		},
+		{
+			Header: http.Header{
+				"Content-Range": []string{"items 0-49/1230"},
+				"X-Per-Page":    []string{"50"},
+			},
+			Expect: &PageInfo{Total: 1230, Page: -1, PerPage: 50, Pages: 25, Start: 0, End: 49},
+		},
+		{
+			Header: http.Header{
+				"Content-Range": []string{"items 50-99/*"},
+				"X-Total":       []string{"nope"},
+			},
+			Expect: &PageInfo{Total: -1, Page: -1, PerPage: -1, Pages: -1, Start: 50, End: 99},
+		},
+		{
+			Header: http.Header{
+				"Content-Range": []string{"bytes 0-1023/4096"},
+			},
+			Expect: &PageInfo{Total: -1, Page: -1, PerPage: -1, Pages: -1, Start: -1, End: -1},
+		},
+		{
+			Header: http.Header{
+				"Link": []string{`https://example.com/; rel="next"`},
+			},
+			Error: errMalformedLinks,
+		},
+	}
+	for _, e := range tests {
+		info, err := ParsePageInfo(&http.Response{Header: e.Header})
+		if e.Error != nil {
+			assert.ErrorIs(t, err, e.Error)
+		} else if assert.NoError(t, err) {
+			assert.Equal(t, e.Expect, info)
+		}
+	}
+}
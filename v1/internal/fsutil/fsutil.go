@@ -0,0 +1,48 @@
+// Package fsutil provides file operations which are shared by the stores
+// that persist state to disk.
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes a file atomically, by writing a temporary file alongside
+// it and renaming it, so that an interruption never leaves the file partially
+// written
+func WriteFile(path string, data []byte) error {
+	tmp, err := WriteTemp(filepath.Dir(path), data)
+	if err != nil {
+		return err
+	}
+	return Publish(tmp, path)
+}
+
+// WriteTemp writes data to a uniquely named temporary file in a directory and
+// produces its path. The file is removed if it cannot be written.
+func WriteTemp(dir string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Publish replaces a file with a temporary file produced by WriteTemp. The
+// temporary file is removed if it cannot be renamed.
+func Publish(tmp, path string) error {
+	err := os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	for _, e := range []string{"first", "second"} {
+		if !assert.NoError(t, WriteFile(path, []byte(e))) {
+			return
+		}
+		data, err := os.ReadFile(path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, e, string(data))
+		}
+	}
+	ents, err := os.ReadDir(dir)
+	if assert.NoError(t, err) {
+		assert.Len(t, ents, 1, "no temporary files remain")
+	}
+
+	tmp, err := WriteTemp(dir, []byte("third"))
+	if assert.NoError(t, err) {
+		assert.Error(t, Publish(tmp, filepath.Join(dir, "missing", "file")))
+		_, err = os.Stat(tmp)
+		assert.ErrorIs(t, err, os.ErrNotExist, "the temporary file is removed when it cannot be published")
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Keep-alive requests are sent periodically to keep the network path to a
+// service warm, for example, through NAT gateways and proxies which close idle
+// connections. A request is only sent when the client has been idle for the
+// interval. Keep-alive requests are sent directly with the underlying HTTP
+// client: they are not authorized, rate limited, retried, or observed.
+type KeepAlive struct {
+	// The interval at which requests are sent while the client is idle
+	Interval time.Duration
+	// The method to use; defaults to HEAD
+	Method string
+	// The URL to request, which is resolved against the base URL
+	URL string
+}
+
+// WithKeepAlive enables keep-alive requests. They begin after the client
+// performs its first request and continue until the client is closed.
+func WithKeepAlive(k KeepAlive) Option {
+	return func(c Config) Config {
+		c.KeepAlive = &k
+		return c
+	}
+}
+
+// Close releases the client's background resources, such as its keep-alive
+// requests, stats snapshots, and request queue. Clients derived from the
+// client share these resources, so they are closed as well. Requests may still
+// be performed after a client is closed, however they may no longer be
+// enqueued.
+func (c *Client) Close() error {
+	c.pinger.close()
+	c.snaps.close()
+	c.backlog.close()
+	return nil
+}
+
+// A pinger sends keep-alive requests
+type pinger struct {
+	conf   KeepAlive
+	url    *url.URL
+	last   atomic.Int64
+	start  sync.Once
+	stop   sync.Once
+	done   chan struct{}
+	closed atomic.Bool
+}
+
+func newPinger(conf *KeepAlive, base *url.URL, mode URLResolution) (*pinger, error) {
+	if conf == nil || conf.Interval <= 0 {
+		return nil, nil
+	}
+	k := *conf
+	if k.Method == "" {
+		k.Method = http.MethodHead
+	}
+	u, err := url.Parse(k.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid keep-alive URL: %w", err)
+	}
+	return &pinger{
+		conf: k,
+		url:  resolveURL(base, u, mode),
+		done: make(chan struct{}),
+	}, nil
+}
+
+// Note activity, starting keep-alive requests if they have not been started
+func (p *pinger) touch(c *Client) {
+	if p == nil || p.closed.Load() {
+		return
+	}
+	p.last.Store(time.Now().UnixNano())
+	p.start.Do(func() {
+		go p.run(c)
+	})
+}
+
+func (p *pinger) run(c *Client) {
+	t := time.NewTicker(p.conf.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-t.C:
+			if now.Sub(time.Unix(0, p.last.Load())) < p.conf.Interval {
+				continue // the client has been active recently; no need to ping
+			}
+			if err := p.ping(c); err != nil && c.debug.Verbose {
+				fmt.Fprintf(c.debug.Writer, "api: %v %v: keep-alive failed: %v\n", p.conf.Method, c.redact.url(p.url), err)
+			}
+		}
+	}
+}
+
+func (p *pinger) ping(c *Client) error {
+	cxt, cancel := context.WithTimeout(context.Background(), p.conf.Interval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(cxt, p.conf.Method, p.url.String(), nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	c.metrics.get().drain(p.url.Host, rsp)
+	p.last.Store(time.Now().UnixNano())
+	return nil
+}
+
+func (p *pinger) close() {
+	if p == nil {
+		return
+	}
+	p.stop.Do(func() {
+		p.closed.Store(true)
+		close(p.done)
+	})
+}
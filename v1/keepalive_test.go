@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepAlive(t *testing.T) {
+	var pings int64
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead && req.URL.Path == "/ping" {
+			atomic.AddInt64(&pings, 1)
+		}
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer svr.Close()
+
+	client, err := New(WithBaseURL(svr.URL), WithKeepAlive(KeepAlive{Interval: time.Millisecond * 20, URL: "/ping"}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer client.Close()
+
+	time.Sleep(time.Millisecond * 60)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&pings), "keep-alive must not begin until the client is used")
+
+	_, err = client.Get(context.Background(), "/", nil)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&pings) >= 2 }, time.Second, time.Millisecond*5)
+
+	client.Close()
+	time.Sleep(time.Millisecond * 30) // allow any ping in progress to complete
+	n := atomic.LoadInt64(&pings)
+	time.Sleep(time.Millisecond * 60)
+	assert.Equal(t, n, atomic.LoadInt64(&pings), "keep-alive must stop when the client is closed")
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/events"
+
+	"github.com/bww/go-ratelimit/v1"
+)
+
+// A returnable limiter accepts the return of a reservation produced by Next.
+// When a request is canceled while it waits for its reservation, or before it
+// is sent, the client returns its reservation to a limiter which implements
+// this interface so that the canceled request does not consume quota.
+type ReturnableLimiter interface {
+	ratelimit.Limiter
+	Return(reserved time.Time) error
+}
+
+// A returnable adapter retains reservations which have been returned to it
+// and hands them out to subsequent requests before reserving new ones from
+// the limiter it wraps.
+type returnable struct {
+	ratelimit.Limiter
+	sync.Mutex
+	listen  events.Listener
+	credits []time.Time
+}
+
+// NewReturnableLimiter adapts a limiter so that reservations may be returned
+// to it. A returned reservation is reused by the next request which would
+// otherwise be scheduled after it; reservations whose time has passed are
+// discarded. Events describing returned and reused reservations are delivered
+// to the provided listener, which may be nil.
+func NewReturnableLimiter(l ratelimit.Limiter, listen events.Listener) ReturnableLimiter {
+	if r, ok := l.(ReturnableLimiter); ok {
+		return r
+	}
+	return &returnable{
+		Limiter: l,
+		listen:  listen,
+	}
+}
+
+func (l *returnable) Next(rel time.Time, opts ...ratelimit.Option) (time.Time, error) {
+	if t, ok := l.reuse(rel); ok {
+		return t, nil
+	}
+	return l.Limiter.Next(rel, opts...)
+}
+
+func (l *returnable) Wait(cxt context.Context, rel time.Time, opts ...ratelimit.Option) (time.Time, error) {
+	t, err := l.Next(rel, opts...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := wait(cxt, t.Sub(rel), "rate limits"); err != nil {
+		l.Return(t)
+		return t, ratelimit.ErrCanceled
+	}
+	return t, nil
+}
+
+func (l *returnable) Return(t time.Time) error {
+	if t.IsZero() {
+		return nil
+	}
+	l.Lock()
+	i := sort.Search(len(l.credits), func(i int) bool { return l.credits[i].After(t) })
+	l.credits = append(l.credits, time.Time{})
+	copy(l.credits[i+1:], l.credits[i:])
+	l.credits[i] = t
+	l.Unlock()
+	if l.listen != nil {
+		l.listen.Receive(events.ReservationReturned{Reserved: t})
+	}
+	return nil
+}
+
+// Take the earliest returned reservation which has not yet passed, if any
+func (l *returnable) reuse(rel time.Time) (time.Time, bool) {
+	l.Lock()
+	i := sort.Search(len(l.credits), func(i int) bool { return !l.credits[i].Before(rel) })
+	if i == len(l.credits) {
+		l.credits = l.credits[:0]
+		l.Unlock()
+		return time.Time{}, false
+	}
+	t := l.credits[i]
+	l.credits = l.credits[i+1:]
+	l.Unlock()
+	if l.listen != nil {
+		l.listen.Receive(events.ReservationReused{Reserved: t})
+	}
+	return t, true
+}
+
+// A token bucket limits requests to a fixed rate, allowing bursts of up to a
+// fixed number of requests, without relying on any rate limit headers in
+// responses. A bucket may be shared by clients which share a quota.
+type TokenBucket struct {
+	sync.Mutex
+	interval time.Duration // the time it takes to accrue one token
+	burst    int
+	tat      time.Time // the time at which the bucket will be full
+}
+
+// NewTokenBucket creates a limiter which permits rps requests per second on
+// average and up to burst requests at once.
+func NewTokenBucket(rps float64, burst int) *TokenBucket {
+	var interval time.Duration
+	if rps > 0 {
+		interval = time.Duration(float64(time.Second) / rps)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		interval: interval,
+		burst:    burst,
+	}
+}
+
+// Reserve a token, returning the time at which it is available
+func (l *TokenBucket) Next(rel time.Time, opts ...ratelimit.Option) (time.Time, error) {
+	l.Lock()
+	defer l.Unlock()
+	next, tat, _ := gcra(l.tat, rel, l.interval, l.burst, 0)
+	l.tat = tat
+	return next, nil
+}
+
+func (l *TokenBucket) Wait(cxt context.Context, rel time.Time, opts ...ratelimit.Option) (time.Time, error) {
+	t, err := l.Next(rel, opts...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := wait(cxt, t.Sub(rel), "rate limits"); err != nil {
+		l.Return(t)
+		return t, ratelimit.ErrCanceled
+	}
+	return t, nil
+}
+
+// Responses have no effect on a token bucket
+func (l *TokenBucket) Update(rel time.Time, opts ...ratelimit.Option) error {
+	return nil
+}
+
+func (l *TokenBucket) State(rel time.Time) ratelimit.State {
+	l.Lock()
+	defer l.Unlock()
+	rem := l.burst
+	if l.interval > 0 && l.tat.After(rel) {
+		rem -= int((l.tat.Sub(rel) + l.interval - 1) / l.interval)
+	}
+	if rem < 0 {
+		rem = 0
+	}
+	return ratelimit.State{
+		Limit:     l.burst,
+		Remaining: rem,
+		Reset:     l.tat,
+	}
+}
+
+// Return a token which was reserved but not used
+func (l *TokenBucket) Return(reserved time.Time) error {
+	if reserved.IsZero() {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+	if now := time.Now(); l.tat.After(now) {
+		l.tat = l.tat.Add(-l.interval)
+		if l.tat.Before(now) {
+			l.tat = now
+		}
+	}
+	return nil
+}
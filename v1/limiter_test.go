@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/events"
+
+	"github.com/bww/go-ratelimit/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// A limiter which reserves slots at a fixed interval
+type intervalLimiter struct {
+	sync.Mutex
+	interval time.Duration
+	last     time.Time
+}
+
+func (l *intervalLimiter) Next(rel time.Time, opts ...ratelimit.Option) (time.Time, error) {
+	l.Lock()
+	defer l.Unlock()
+	t := l.last.Add(l.interval)
+	if t.Before(rel) {
+		t = rel
+	}
+	l.last = t
+	return t, nil
+}
+
+func (l *intervalLimiter) Wait(cxt context.Context, rel time.Time, opts ...ratelimit.Option) (time.Time, error) {
+	return l.Next(rel, opts...)
+}
+
+func (l *intervalLimiter) Update(time.Time, ...ratelimit.Option) error { return nil }
+func (l *intervalLimiter) State(time.Time) ratelimit.State             { return ratelimit.State{} }
+
+func TestReturnReservation(t *testing.T) {
+	var evts []string
+	var lock sync.Mutex
+	lim := NewReturnableLimiter(&intervalLimiter{interval: time.Millisecond * 200}, events.ListenerFunc(func(e events.Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		evts = append(evts, e.Kind())
+	}))
+
+	api, err := New(WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())), WithRateLimiter(lim))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cxt := context.Background()
+	_, err = api.Get(cxt, "/status/200", nil) // consumes the first slot immediately
+	assert.NoError(t, err)
+
+	tcxt, cancel := context.WithTimeout(cxt, time.Millisecond*20)
+	defer cancel()
+	_, err = api.Get(tcxt, "/status/200", nil) // reserves the second slot, then gives up
+	assert.True(t, errors.Is(err, ErrWouldExceedDeadline), "expected deadline, got: %v", err)
+
+	start := time.Now()
+	_, err = api.Get(cxt, "/status/200", nil) // reuses the second slot, rather than waiting for a third
+	if assert.NoError(t, err) {
+		assert.Less(t, time.Since(start), time.Millisecond*300)
+	}
+	assert.Equal(t, []string{"reservation_returned", "reservation_reused"}, evts)
+}
+
+func TestTokenBucket(t *testing.T) {
+	l := NewTokenBucket(1, 2)
+	base := time.Now()
+	var next []time.Duration
+	for i := 0; i < 4; i++ {
+		n, err := l.Next(base)
+		assert.NoError(t, err)
+		next = append(next, n.Sub(base))
+	}
+	assert.Equal(t, []time.Duration{0, 0, time.Second, time.Second * 2}, next)
+	assert.Equal(t, ratelimit.State{Limit: 2, Remaining: 0, Reset: base.Add(time.Second * 4)}, l.State(base))
+
+	// tokens accrue while the bucket is idle, up to its burst
+	n, err := l.Next(base.Add(time.Second * 10))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second*10, n.Sub(base))
+	assert.Equal(t, 1, l.State(base.Add(time.Second*10)).Remaining)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+	c, err := New(WithBaseURL(s.URL), WithRequestsPerSecond(50, 1))
+	if !assert.NoError(t, err) {
+		return
+	}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := c.Get(context.Background(), "/", nil)
+		assert.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*40)
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/bww/go-metrics/v1"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A metrics sink creates the metrics which are recorded by a client. The
+// *metrics.Metrics type from go-metrics satisfies this interface, as do
+// GlobalMetrics and PrometheusSink.
+//
+// The metrics created by a sink are shared by every client which uses it, so
+// a sink must be a pointer or another comparable value which identifies it.
+// A client cannot be created with a sink which is not comparable.
+type MetricsSink interface {
+	RegisterCounterVec(name, desc string, opts []string) metrics.CounterVec
+	RegisterSamplerVec(name, desc string, opts []string) metrics.SamplerVec
+}
+
+var ErrInvalidMetricsSink = errors.New("Metrics sink is not comparable")
+
+var (
+	// GlobalMetrics registers metrics with go-metrics' shared registry. This
+	// is the default sink.
+	GlobalMetrics MetricsSink = globalSink{}
+	// NoMetrics is a sink which disables metrics entirely
+	NoMetrics MetricsSink = noopSink{}
+)
+
+type globalSink struct{}
+
+func (r globalSink) RegisterCounterVec(name, desc string, opts []string) metrics.CounterVec {
+	return metrics.RegisterCounterVec(name, desc, opts)
+}
+
+func (r globalSink) RegisterSamplerVec(name, desc string, opts []string) metrics.SamplerVec {
+	return metrics.RegisterSamplerVec(name, desc, opts)
+}
+
+type noopSink struct{}
+
+func (r noopSink) RegisterCounterVec(name, desc string, opts []string) metrics.CounterVec {
+	return noopCounterVec{}
+}
+
+func (r noopSink) RegisterSamplerVec(name, desc string, opts []string) metrics.SamplerVec {
+	return noopSamplerVec{}
+}
+
+type noopCounterVec struct{}
+
+func (v noopCounterVec) With(metrics.Tags) metrics.Counter { return noopCounter{} }
+
+type noopCounter struct{}
+
+func (c noopCounter) Inc()        {}
+func (c noopCounter) Add(float64) {}
+
+type noopSamplerVec struct{}
+
+func (v noopSamplerVec) With(metrics.Tags) metrics.Sampler { return noopSampler{} }
+
+type noopSampler struct{}
+
+func (s noopSampler) Observe(float64) {}
+
+// A sink which registers metrics directly with a Prometheus registerer
+type PrometheusSink struct {
+	reg       prometheus.Registerer
+	namespace string
+}
+
+// NewPrometheusSink creates a sink which registers metrics with the provided
+// registerer under a namespace, which may be empty.
+func NewPrometheusSink(reg prometheus.Registerer, namespace string) *PrometheusSink {
+	return &PrometheusSink{
+		reg:       reg,
+		namespace: namespace,
+	}
+}
+
+func (s *PrometheusSink) RegisterCounterVec(name, desc string, opts []string) metrics.CounterVec {
+	v := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: s.namespace,
+		Name:      name,
+		Help:      desc,
+	}, opts)
+	s.reg.MustRegister(v)
+	return prometheusCounterVec{v}
+}
+
+func (s *PrometheusSink) RegisterSamplerVec(name, desc string, opts []string) metrics.SamplerVec {
+	v := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:  s.namespace,
+		Name:       name,
+		Help:       desc,
+		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	}, opts)
+	s.reg.MustRegister(v)
+	return prometheusSamplerVec{v}
+}
+
+type prometheusCounterVec struct {
+	*prometheus.CounterVec
+}
+
+func (v prometheusCounterVec) With(t metrics.Tags) metrics.Counter {
+	return v.CounterVec.With(prometheus.Labels(t))
+}
+
+type prometheusSamplerVec struct {
+	*prometheus.SummaryVec
+}
+
+func (v prometheusSamplerVec) With(t metrics.Tags) metrics.Sampler {
+	return v.SummaryVec.With(prometheus.Labels(t))
+}
+
+// The set of metrics recorded by a client
+type clientMetrics struct {
+	requestDuration   metrics.SamplerVec
+	rateLimitDelay    metrics.SamplerVec
+	rateLimitRetry    metrics.SamplerVec
+	rateLimitReturned metrics.CounterVec
+	rateLimitAcquire  metrics.SamplerVec
+	rateLimitRejected metrics.CounterVec
+	failureRetry      metrics.SamplerVec
+	connection        metrics.CounterVec
+	drainedBytes      metrics.CounterVec
+	responses         metrics.CounterVec
+	retriesExhausted  metrics.CounterVec
+	authFailures      metrics.CounterVec
+	unmarshalFailures metrics.CounterVec
+}
+
+func newClientMetrics(r MetricsSink) *clientMetrics {
+	return &clientMetrics{
+		requestDuration:   r.RegisterSamplerVec("rest_client_perform_request", "Perform an HTTP request", []string{"domain"}),
+		rateLimitDelay:    r.RegisterSamplerVec("rest_client_rate_limit_delay", "Request delayed due to rate limiting", []string{"domain"}),
+		rateLimitRetry:    r.RegisterSamplerVec("rest_client_rate_limit_retry", "Request retried due to rate limiting", []string{"domain"}),
+		rateLimitReturned: r.RegisterCounterVec("rest_client_rate_limit_returned", "Rate limit reservation returned by a canceled request", []string{"domain"}),
+		rateLimitAcquire:  r.RegisterSamplerVec("rest_client_rate_limit_acquire", "Time taken to reserve a request from a rate limiter", []string{"domain"}),
+		rateLimitRejected: r.RegisterCounterVec("rest_client_rate_limit_rejected", "Request rejected because it would exceed a rate limit quota", []string{"domain"}),
+		failureRetry:      r.RegisterSamplerVec("rest_client_failure_retry", "Request retried due to recoverable failure", []string{"domain"}),
+		connection:        r.RegisterCounterVec("rest_client_connection", "Connection obtained for a request", []string{"domain", "reused"}),
+		drainedBytes:      r.RegisterCounterVec("rest_client_drained_bytes", "Response bytes discarded in order to reuse a connection", []string{"domain"}),
+		responses:         r.RegisterCounterVec("rest_client_response", "Response received, by status class", []string{"domain", "class"}),
+		retriesExhausted:  r.RegisterCounterVec("rest_client_retries_exhausted", "Request failed after exhausting retries", []string{"domain", "reason"}),
+		authFailures:      r.RegisterCounterVec("rest_client_auth_failure", "Request could not be authorized or was rejected as unauthorized", []string{"domain"}),
+		unmarshalFailures: r.RegisterCounterVec("rest_client_unmarshal_failure", "Response could not be unmarshaled", []string{"domain"}),
+	}
+}
+
+// Metrics are registered once per sink, since registering the same metric
+// more than once is generally an error.
+var (
+	metricsLock  sync.Mutex
+	metricsCache = map[MetricsSink]*clientMetrics{}
+)
+
+// Ensure that a sink can identify the metrics it creates, which requires
+// that it is comparable
+func checkSink(r MetricsSink) error {
+	if r != nil && !reflect.ValueOf(r).Comparable() {
+		return fmt.Errorf("%w: %T; use a pointer to it instead", ErrInvalidMetricsSink, r)
+	}
+	return nil
+}
+
+func metricsFor(r MetricsSink) *clientMetrics {
+	if r == nil {
+		r = GlobalMetrics
+	}
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	if m, ok := metricsCache[r]; ok {
+		return m
+	}
+	m := newClientMetrics(r)
+	metricsCache[r] = m
+	return m
+}
+
+// Metrics are registered lazily, when a client first records them, so that
+// merely importing this package or creating a client has no side effects.
+type lazyMetrics struct {
+	once    sync.Once
+	sink    MetricsSink
+	metrics *clientMetrics
+}
+
+func newLazyMetrics(sink MetricsSink) *lazyMetrics {
+	return &lazyMetrics{sink: sink}
+}
+
+func (m *lazyMetrics) get() *clientMetrics {
+	m.once.Do(func() {
+		m.metrics = metricsFor(m.sink)
+	})
+	return m.metrics
+}
+
+func statusClass(s int) string {
+	return fmt.Sprintf("%dxx", s/100)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A sink which is not comparable, since it has a map field
+type taggedSink struct {
+	*countingSink
+	tags map[string]string
+}
+
+func TestMetricsSinkNotComparable(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	tags := map[string]string{"env": "test"}
+	_, err := New(WithBaseURL(s.URL), WithMetrics(taggedSink{&countingSink{}, tags}))
+	assert.ErrorIs(t, err, ErrInvalidMetricsSink, "its metrics would be registered again for every client")
+
+	c, err := New(WithBaseURL(s.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Clone(WithMetrics(taggedSink{&countingSink{}, tags}))
+	assert.ErrorIs(t, err, ErrInvalidMetricsSink)
+
+	sink := &taggedSink{&countingSink{}, tags} // a pointer identifies the sink
+	for i := 0; i < 2; i++ {
+		c, err := New(WithBaseURL(s.URL), WithMetrics(sink))
+		if !assert.NoError(t, err) {
+			return
+		}
+		c, err = c.Clone()
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = c.Get(context.Background(), "/", nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, sink.count("rest_client_response"))
+}
@@ -1,7 +1,17 @@
 package multiplex
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"runtime/debug"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrRequestTimeout   = errors.New("Request timed out")
+	ErrDeadlineExceeded = errors.New("Batch deadline exceeded")
 )
 
 type ErrorHandler interface {
@@ -13,3 +23,115 @@ type ErrorHandlerFunc func(*http.Response, error) (*http.Response, error)
 func (f ErrorHandlerFunc) Handle(rsp *http.Response, err error) (*http.Response, error) {
 	return f(rsp, err)
 }
+
+// PanicError is produced when a request, or the error handler processing it,
+// panics. The panic is recovered and attributed to the index of the request
+// which caused it, rather than taking down the batch.
+type PanicError struct {
+	Index int
+	Value any
+	Stack []byte
+}
+
+func newPanicError(i int, v any) *PanicError {
+	return &PanicError{
+		Index: i,
+		Value: v,
+		Stack: debug.Stack(),
+	}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("Request [%d] panicked: %v", e.Index, e.Value)
+}
+
+// Unwrap returns the panic value if it is an error
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// FailFastError is produced when a batch is aborted because the number of
+// failures exceeded the configured threshold.
+type FailFastError struct {
+	Completed int
+	Failures  map[int]error
+}
+
+// Indexes returns the indexes of requests which failed in ascending order
+func (e *FailFastError) Indexes() []int {
+	idx := make([]int, 0, len(e.Failures))
+	for k := range e.Failures {
+		idx = append(idx, k)
+	}
+	sort.Ints(idx)
+	return idx
+}
+
+func (e *FailFastError) Error() string {
+	b := fmt.Sprintf("Aborted after %d of %d requests failed", len(e.Failures), e.Completed)
+	if idx := e.Indexes(); len(idx) > 0 {
+		b += fmt.Sprintf("; first failure: [%d] %v", idx[0], e.Failures[idx[0]])
+	}
+	return b
+}
+
+// The minimum number of requests that must complete before a failure ratio
+// is considered meaningful
+const minFailFastSample = 10
+
+// failFast tracks failures across a batch
+type failFast struct {
+	sync.Mutex
+	consecutive int
+	ratio       float64
+	count       int
+	completed   int
+	failures    map[int]error
+}
+
+func newFailFast(n int, ratio float64) *failFast {
+	return &failFast{
+		consecutive: n,
+		ratio:       ratio,
+		failures:    make(map[int]error),
+	}
+}
+
+// Success records a successful request
+func (f *failFast) Success(i int) {
+	f.Lock()
+	defer f.Unlock()
+	f.completed++
+	f.count = 0
+}
+
+// Failure records a failed request and returns a non-nil error if the batch
+// should be aborted as a result.
+func (f *failFast) Failure(i int, err error) error {
+	f.Lock()
+	defer f.Unlock()
+	f.completed++
+	f.count++
+	f.failures[i] = err
+	if f.consecutive > 0 && f.count >= f.consecutive {
+		return f.error()
+	}
+	if f.ratio > 0 && f.completed >= minFailFastSample && float64(len(f.failures))/float64(f.completed) >= f.ratio {
+		return f.error()
+	}
+	return nil
+}
+
+func (f *failFast) error() error {
+	failures := make(map[int]error, len(f.failures))
+	for k, v := range f.failures {
+		failures[k] = v
+	}
+	return &FailFastError{
+		Completed: f.completed,
+		Failures:  failures,
+	}
+}
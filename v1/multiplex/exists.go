@@ -0,0 +1,73 @@
+package multiplex
+
+import (
+	"context"
+	"net/http"
+
+	api "github.com/bww/go-apiclient/v1"
+)
+
+// ExistsAll determines whether each of the resources at the provided URLs
+// exists, in the same way as Client.Exists, performing the requests
+// concurrently. Results are produced in the same order as the URLs. If a
+// request fails for any reason other than the resource not existing, the batch
+// is canceled and the error is returned.
+func (m *Mux) ExistsAll(cxt context.Context, urls []string, opts ...Option) ([]bool, error) {
+	opts = append(opts, WithPartialFailures())
+	res := make([]bool, len(urls))
+
+	var fallback []int // services which don't support HEAD are asked again with GET
+	err := m.DoFunc(cxt, NewHead(urls), func(r *Result) error {
+		if api.IsStatus(r.Err, http.StatusMethodNotAllowed) || api.IsStatus(r.Err, http.StatusNotImplemented) {
+			fallback = append(fallback, r.Index)
+			return nil
+		}
+		exists, err := existence(r.Err)
+		res[r.Index] = exists
+		return err
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(fallback) == 0 {
+		return res, nil
+	}
+
+	producer := RequestProducerFunc(func(i int) (*http.Request, error) {
+		if i >= len(fallback) {
+			return nil, nil
+		}
+		req, err := http.NewRequest(http.MethodGet, urls[fallback[i]], nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", "bytes=0-0")
+		return req, nil
+	})
+	err = m.DoFunc(cxt, producer, func(r *Result) error {
+		exists, err := existence(r.Err)
+		res[fallback[r.Index]] = exists
+		return err
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Determine whether a resource exists from the error produced by requesting
+// it, if any
+func existence(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	status, _ := api.StatusOf(err)
+	switch status {
+	case http.StatusNotFound, http.StatusGone:
+		return false, nil
+	case http.StatusRequestedRangeNotSatisfiable: // the resource is empty
+		return true, nil
+	default:
+		return false, err
+	}
+}
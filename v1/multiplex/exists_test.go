@@ -0,0 +1,55 @@
+package multiplex
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	api "github.com/bww/go-apiclient/v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExistsAll(t *testing.T) {
+	var gets atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		switch req.URL.Path {
+		case "/present":
+			rsp.WriteHeader(http.StatusOK)
+		case "/forbidden":
+			rsp.WriteHeader(http.StatusForbidden)
+		case "/nohead":
+			if req.Method == http.MethodHead {
+				rsp.WriteHeader(http.StatusMethodNotAllowed)
+			} else if req.Header.Get("Range") == "bytes=0-0" {
+				rsp.WriteHeader(http.StatusPartialContent)
+			} else {
+				rsp.WriteHeader(http.StatusBadRequest)
+			}
+		default:
+			rsp.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cli, err := api.New(api.WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	px := New(cli, 4)
+	cxt := context.Background()
+
+	res, err := px.ExistsAll(cxt, []string{"/present", "/missing", "/nohead", "/present", "/missing"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []bool{true, false, true, true, false}, res)
+		assert.Equal(t, int64(1), gets.Load())
+	}
+
+	_, err = px.ExistsAll(cxt, []string{"/present", "/forbidden"})
+	assert.ErrorIs(t, err, api.ErrForbidden)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"reflect"
 	"sort"
 	"sync/atomic"
 	"time"
@@ -14,6 +16,7 @@ import (
 
 	"github.com/bww/go-exec/v1"
 	siter "github.com/bww/go-iterator/v1"
+	"github.com/bww/go-ratelimit/v1"
 	"github.com/bww/go-util/v1/ext"
 )
 
@@ -24,10 +27,24 @@ func nextReq() uint64 {
 }
 
 type Config struct {
-	Errors  ErrorHandler
-	Headers map[string]string
-	Verbose bool
-	Debug   bool
+	Errors        ErrorHandler
+	Headers       map[string]string
+	FailFastCount int
+	FailFastRatio float64
+	Cancel        bool
+	Partial       bool
+	Progress      func(Progress)
+	Name          string
+	Metrics       api.MetricsSink
+	Schedule      bool
+	RetryTotal    int
+	RetryEach     int
+	MaxPending    int
+	Prefetch      int
+	Timeout       time.Duration
+	Deadline      time.Time
+	Verbose       bool
+	Debug         bool
 }
 
 func (c Config) WithOptions(opts []Option) Config {
@@ -37,6 +54,19 @@ func (c Config) WithOptions(opts []Option) Config {
 	return c
 }
 
+// The time permitted for a request which starts now and the error produced
+// if it is exceeded, which is the lesser of the per-request timeout and the
+// time remaining until the batch deadline.
+func (c Config) timeout() (time.Duration, error, bool) {
+	d, cause := c.Timeout, ErrRequestTimeout
+	if !c.Deadline.IsZero() {
+		if r := time.Until(c.Deadline); d <= 0 || r < d {
+			d, cause = r, ErrDeadlineExceeded
+		}
+	}
+	return d, cause, c.Timeout > 0 || !c.Deadline.IsZero()
+}
+
 func (c Config) ConfigureRequest(req *http.Request) (*http.Request, error) {
 	for k, v := range c.Headers {
 		req.Header.Set(k, v)
@@ -65,6 +95,138 @@ func WithHeaders(h map[string]string) Option {
 	}
 }
 
+// WithFailFast tolerates individual request failures until either n
+// consecutive failures occur or the proportion of failed requests reaches
+// ratio, at which point the batch is aborted with a *FailFastError. Failed
+// requests that do not abort the batch are omitted from the results. Either
+// threshold may be disabled by passing zero.
+func WithFailFast(n int, ratio float64) Option {
+	return func(c Config) Config {
+		c.FailFastCount = n
+		c.FailFastRatio = ratio
+		return c
+	}
+}
+
+// WithCancelOnFailure aborts every in-flight request as soon as any request
+// in the batch fails, rather than allowing in-flight requests to complete
+// after the batch has stopped dispatching. When used with WithFailFast, the
+// batch is canceled when the failure threshold is reached.
+func WithCancelOnFailure() Option {
+	return func(c Config) Config {
+		c.Cancel = true
+		return c
+	}
+}
+
+// WithPartialFailures delivers the error produced by each failed request as
+// a result with its Err field set, rather than aborting the batch. This allows
+// successes and failures to be collected from a batch in a single pass. When
+// used with WithFailFast, failures are delivered as results until the failure
+// threshold is reached, at which point the batch is aborted.
+func WithPartialFailures() Option {
+	return func(c Config) Config {
+		c.Partial = true
+		return c
+	}
+}
+
+// WithProgress sets a function which is invoked with the progress of the
+// batch each time a request completes. The function is invoked serially and
+// should return promptly.
+func WithProgress(fn func(Progress)) Option {
+	return func(c Config) Config {
+		c.Progress = fn
+		return c
+	}
+}
+
+// WithName sets the name of the batch, which is used to tag its metrics
+func WithName(n string) Option {
+	return func(c Config) Config {
+		c.Name = n
+		return c
+	}
+}
+
+// WithMetrics sets the sink with which the multiplexer's metrics are
+// registered. By default, the shared go-metrics registry is used. A sink which
+// is not comparable fails the batch with api.ErrInvalidMetricsSink.
+func WithMetrics(m api.MetricsSink) Option {
+	return func(c Config) Config {
+		c.Metrics = m
+		return c
+	}
+}
+
+// WithScheduling dispatches requests according to the client's rate limiter.
+// Rather than every worker independently waiting on the limiter, which can
+// cause workers to stampede when a rate limit window resets, requests are
+// spaced out as they are dispatched and the client does not delay them again.
+func WithScheduling() Option {
+	return func(c Config) Config {
+		c.Schedule = true
+		return c
+	}
+}
+
+// WithRetryBudget bounds the retries performed by a batch. At most total
+// retries are performed across all requests in the batch and at most each
+// retries are performed for any single request. Either bound may be disabled
+// by passing zero.
+func WithRetryBudget(total, each int) Option {
+	return func(c Config) Config {
+		c.RetryTotal = total
+		c.RetryEach = each
+		return c
+	}
+}
+
+// WithMaxPending bounds the number of requests which have been produced but
+// not yet completed, including requests waiting to be dispatched and requests
+// in flight. Once the bound is reached, no more requests are produced until a
+// pending request completes. This limits the requests buffered by a batch when
+// its producer is much faster than the requests it produces.
+func WithMaxPending(n int) Option {
+	return func(c Config) Config {
+		c.MaxPending = n
+		return c
+	}
+}
+
+// WithPrefetch produces up to n requests ahead of dispatch on a separate
+// goroutine, which overlaps the work of producing requests with waiting to
+// dispatch them. Prefetched requests count toward the bound set by
+// WithMaxPending.
+func WithPrefetch(n int) Option {
+	return func(c Config) Config {
+		c.Prefetch = n
+		return c
+	}
+}
+
+// WithPerRequestTimeout limits the time each request in a batch may take to
+// produce a response, including any retries, so that a single slow request
+// cannot stall the batch. A request which times out fails with
+// ErrRequestTimeout. Reading the response body is not subject to the timeout.
+func WithPerRequestTimeout(d time.Duration) Option {
+	return func(c Config) Config {
+		c.Timeout = d
+		return c
+	}
+}
+
+// WithOverallDeadline sets a time by which a batch must complete, regardless
+// of the context it is run with. When the deadline passes, no more requests
+// are dispatched, requests in flight fail with ErrDeadlineExceeded, and the
+// batch is aborted with ErrDeadlineExceeded.
+func WithOverallDeadline(t time.Time) Option {
+	return func(c Config) Config {
+		c.Deadline = t
+		return c
+	}
+}
+
 type RequestProducer interface {
 	Request(int) (*http.Request, error)
 }
@@ -75,6 +237,25 @@ func (p RequestProducerFunc) Request(i int) (*http.Request, error) {
 	return p(i)
 }
 
+// A producer may optionally attach metadata to each request it produces,
+// such as the domain object the request concerns. The metadata is delivered
+// with the corresponding result.
+type MetaRequestProducer interface {
+	RequestProducer
+	RequestMeta(int) (*http.Request, any, error)
+}
+
+type MetaRequestProducerFunc func(int) (*http.Request, any, error)
+
+func (p MetaRequestProducerFunc) Request(i int) (*http.Request, error) {
+	req, _, err := p(i)
+	return req, err
+}
+
+func (p MetaRequestProducerFunc) RequestMeta(i int) (*http.Request, any, error) {
+	return p(i)
+}
+
 type StaticRequestProducer []*http.Request
 
 func (p StaticRequestProducer) Request(i int) (*http.Request, error) {
@@ -97,6 +278,13 @@ func NewGet(u []string) URLRequestProducer {
 	}
 }
 
+func NewHead(u []string) URLRequestProducer {
+	return URLRequestProducer{
+		method: http.MethodHead,
+		urls:   u,
+	}
+}
+
 func NewDelete(u []string) URLRequestProducer {
 	return URLRequestProducer{
 		method: http.MethodDelete,
@@ -117,7 +305,10 @@ func (p URLRequestProducer) Request(i int) (*http.Request, error) {
 
 type Result struct {
 	Index    int
+	Request  *http.Request
 	Response *http.Response
+	Meta     any
+	Err      error // set only under WithPartialFailures
 }
 
 type resultSet []*Result
@@ -126,11 +317,40 @@ func (r resultSet) Len() int           { return len(r) }
 func (r resultSet) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
 func (r resultSet) Less(i, j int) bool { return r[i].Index < r[j].Index }
 
+// Collect gathers every response produced by a batch, ordered by request
+// index. Under WithPartialFailures, the error of the first request which
+// failed is returned and every response body is closed. When a response is
+// consumed by an error handler, it is nil.
 func Collect(iter siter.Iterator[*Result], err error) ([]*http.Response, error) {
 	if err != nil {
 		return nil, err
 	}
+	buf, err := collect(iter)
+	if err != nil {
+		return nil, err
+	}
+	rsp := make([]*http.Response, len(buf))
+	for i, e := range buf {
+		if e.Err != nil {
+			closeResults(buf)
+			return nil, fmt.Errorf("Request [%d] failed: %w", e.Index, e.Err)
+		}
+		rsp[i] = e.Response
+	}
+	return rsp, nil
+}
 
+// Close the response body of every result
+func closeResults(res []*Result) {
+	for _, r := range res {
+		if r.Response != nil && r.Response.Body != nil {
+			r.Response.Body.Close()
+		}
+	}
+}
+
+// Gather every result produced by a batch, ordered by request index
+func collect(iter siter.Iterator[*Result]) ([]*Result, error) {
 	var buf []*Result
 	for {
 		res, err := iter.Next()
@@ -141,33 +361,120 @@ func Collect(iter siter.Iterator[*Result], err error) ([]*http.Response, error)
 		}
 		buf = append(buf, res)
 	}
-
 	sort.Sort(resultSet(buf))
-	rsp := make([]*http.Response, len(buf))
-	for i, e := range buf {
-		rsp[i] = e.Response
-	}
-
-	return rsp, nil
+	return buf, nil
 }
 
+// Unmarshal decodes every response produced by a batch, ordered by request
+// index. Under WithPartialFailures, the error of the first request which
+// failed is returned. When a response is consumed by an error handler, its
+// entity is the zero value.
 func Unmarshal[E any](iter siter.Iterator[*Result], ents []E) ([]E, error) {
-	rsps, err := Collect(iter, nil)
+	res, err := collect(iter)
 	if err != nil {
 		return nil, fmt.Errorf("Could not collect responses: %w", err)
 	}
+	defer closeResults(res) // close anything we didn't get to
 	ents = ents[0:0:len(ents)]
-	for _, r := range rsps {
+	for _, r := range res {
 		var e E
-		err := api.Unmarshal(r, &e)
-		if err != nil {
-			return nil, err
+		if r.Err != nil {
+			return nil, fmt.Errorf("Request [%d] failed: %w", r.Index, r.Err)
+		} else if r.Response != nil {
+			err := api.Unmarshal(r.Response, &e)
+			if err != nil {
+				return nil, err
+			}
 		}
 		ents = append(ents, e)
 	}
 	return ents, nil
 }
 
+// An iterator which decodes the results of a batch as they arrive
+type EntityIterator[E any] struct {
+	iter siter.Iterator[*Result]
+}
+
+// UnmarshalStream decodes each response produced by a batch into an entity
+// as it arrives, rather than collecting every response first. Responses are
+// produced in the order requests complete and each response body is closed
+// once it has been decoded.
+func UnmarshalStream[E any](iter siter.Iterator[*Result]) *EntityIterator[E] {
+	return &EntityIterator[E]{iter: iter}
+}
+
+// Next decodes the next result, returning the index of its request and its
+// entity. If the result cannot be decoded, or it is a failure delivered under
+// WithPartialFailures, its error is returned with its index and iteration may
+// continue. If the batch fails, the error is returned with an index of -1.
+// When every result has been consumed, siter.ErrClosed is returned.
+func (t *EntityIterator[E]) Next() (int, E, error) {
+	var e E
+	res, err := t.iter.Next()
+	if err != nil {
+		return -1, e, err
+	}
+	if res.Err != nil {
+		return res.Index, e, res.Err
+	}
+	if res.Response == nil {
+		return res.Index, e, nil
+	}
+	defer res.Response.Body.Close()
+	err = api.Unmarshal(res.Response, &e)
+	if err != nil {
+		return res.Index, e, fmt.Errorf("Could not unmarshal response [%d]: %w", res.Index, err)
+	}
+	return res.Index, e, nil
+}
+
+// Close discards any results which have not been consumed, closing their
+// response bodies. The batch should be canceled first if it has not finished,
+// otherwise Close waits for it to finish.
+func (t *EntityIterator[E]) Close() {
+	for {
+		res, err := t.iter.Next()
+		if errors.Is(err, siter.ErrClosed) {
+			return
+		} else if err != nil {
+			continue
+		}
+		if res.Response != nil && res.Response.Body != nil {
+			res.Response.Body.Close()
+		}
+	}
+}
+
+// Map builds a request for each input item, executes them in parallel, and
+// unmarshals each response into an output entity. Outputs are produced in the
+// same order as the inputs. If any request fails, the batch is canceled and
+// the error is returned. When a response is consumed by an error handler or
+// omitted under WithFailFast, its output is the zero value.
+func Map[I, O any](cxt context.Context, mux *Mux, items []I, build func(I) (*http.Request, error), opts ...Option) ([]O, error) {
+	res := make([]O, len(items))
+	producer := RequestProducerFunc(func(i int) (*http.Request, error) {
+		if i >= len(items) {
+			return nil, nil
+		}
+		return build(items[i])
+	})
+	err := mux.DoFunc(cxt, producer, func(r *Result) error {
+		if r.Err != nil {
+			return r.Err
+		}
+		err := api.Unmarshal(r.Response, &res[r.Index])
+		if err != nil {
+			return fmt.Errorf("Could not unmarshal response [%d]: %w", r.Index, err)
+		}
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 type Mux struct {
 	*api.Client
 	concur  int
@@ -186,79 +493,373 @@ func New(c *api.Client, n int) *Mux {
 }
 
 // Create a block for execution on a dispatcher
-func block(cxt context.Context, conf Config, mux *Mux, i int, req *http.Request, iter siter.Writer[*Result]) func() error {
+func block(cxt context.Context, cancel context.CancelCauseFunc, conf Config, mux *Mux, i int, req *http.Request, meta any, iter siter.Writer[*Result], ff *failFast, budget *api.RetryBudget, track *tracker, pending chan struct{}) func() error {
 	reqid := nextReq()
 	errh := ext.Coalesce(conf.Errors, mux.errors)
-	return func() error {
+	opts := []api.Option{api.WithRawBody()}
+	if conf.Schedule {
+		opts = append(opts, api.WithScheduled())
+	}
+	if conf.RetryEach > 0 && budget != nil {
+		opts = append(opts, api.WithRetryBudget(budget.Limit(conf.RetryEach)))
+	} else if conf.RetryEach > 0 {
+		opts = append(opts, api.WithRetryBudget(api.NewRetryBudget(conf.RetryEach)))
+	} else if budget != nil {
+		opts = append(opts, api.WithRetryBudget(budget))
+	}
+	run := func() error {
 		start := time.Now()
 		if mux.debug && mux.verbose {
-			fmt.Printf("api: mux: [%06d, %d] >>> %s %v\n", reqid, i, req.Method, req.URL)
+			fmt.Fprintf(mux.DebugWriter(), "api: mux: [%06d, %d] >>> %s %v\n", reqid, i, req.Method, mux.RedactURL(req.URL))
 		}
-		rsp, err := mux.Client.Do(req.WithContext(cxt))
-		if err != nil && errh != nil { // let the error handler process first if we have one
-			rsp, err = errh.Handle(rsp, err)
+		req := req.WithContext(cxt)
+		rsp, err := exchange(mux, conf, i, req, errh, opts)
+		if err != nil && ff != nil { // tolerate failures up to our threshold
+			if aerr := ff.Failure(i, err); aerr != nil || !conf.Partial {
+				return aerr
+			}
 		}
-		if err != nil {
+		if err != nil && conf.Partial { // deliver the failure as a result
+			return iter.Write(&Result{
+				Index:   i,
+				Request: req,
+				Meta:    meta,
+				Err:     err,
+			})
+		} else if err != nil {
 			return fmt.Errorf("Could not multiplex request: %w", err)
 		} else if rsp == nil {
 			return nil // error handler consumed response
 		}
+		if ff != nil {
+			ff.Success(i)
+		}
 		if mux.debug {
-			fmt.Printf("api: mux: [%06d, %d] <<< %s %v: %s in %v\n", reqid, i, req.Method, req.URL, rsp.Status, time.Now().Sub(start))
+			fmt.Fprintf(mux.DebugWriter(), "api: mux: [%06d, %d] <<< %s %v: %s in %v\n", reqid, i, req.Method, mux.RedactURL(req.URL), rsp.Status, time.Now().Sub(start))
 		}
 		return iter.Write(&Result{
 			Index:    i,
+			Request:  req,
 			Response: rsp,
+			Meta:     meta,
 		})
 	}
+	track.Dispatched()
+	return func() error {
+		if pending != nil {
+			defer func() { <-pending }()
+		}
+		track.Started()
+		err := run()
+		track.Completed(err)
+		if err != nil && cancel != nil { // abort anything else in flight
+			cancel(err)
+		}
+		return err
+	}
+}
+
+// Perform a request and let the error handler process its result, if there
+// is one. A panic in either is recovered and produced as a *PanicError.
+func exchange(mux *Mux, conf Config, i int, req *http.Request, errh ErrorHandler, opts []api.Option) (rsp *http.Response, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rsp, err = nil, newPanicError(i, r)
+		}
+	}()
+	rsp, err = perform(mux, conf, req, opts)
+	if err != nil && errh != nil { // let the error handler process first if we have one
+		rsp, err = errh.Handle(rsp, err)
+	}
+	return rsp, err
+}
+
+// Perform a request within the time permitted for it, if it is limited. The
+// request's context is released when the response body is closed.
+func perform(mux *Mux, conf Config, req *http.Request, opts []api.Option) (*http.Response, error) {
+	d, cause, ok := conf.timeout()
+	if !ok {
+		return mux.Client.Exec(req, nil, opts...)
+	}
+	cxt, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(d, func() {
+		cancel(cause)
+	})
+	rsp, err := mux.Client.Exec(req.WithContext(cxt), nil, opts...)
+	if !timer.Stop() { // the timer already fired; the request timed out
+		if err == nil && rsp.Body != nil {
+			rsp.Body.Close()
+		}
+		cancel(nil)
+		return nil, cause
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	rsp.Body = &cancelBody{ReadCloser: rsp.Body, cancel: cancel}
+	return rsp, nil
+}
+
+// A response body which releases its request context when it is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelCauseFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
+
+// Produce the request at an index. A panic in the producer is recovered and
+// produced as a *PanicError.
+func produce(p RequestProducer, i int) (req *http.Request, meta any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			req, meta, err = nil, nil, newPanicError(i, r)
+		}
+	}()
+	if mp, ok := p.(MetaRequestProducer); ok {
+		return mp.RequestMeta(i)
+	}
+	req, err = p.Request(i)
+	return req, nil, err
+}
+
+// A request produced for dispatch
+type production struct {
+	index int
+	req   *http.Request
+	meta  any
+	err   error
+}
+
+// Create a function which produces the next request to dispatch. No more
+// requests are produced than the pending queue permits. When requests are
+// prefetched they are produced on a separate goroutine until production ends
+// or stop is closed. Production ends with a nil request or an error.
+func producer(cxt context.Context, conf Config, p RequestProducer, pending chan struct{}, stop <-chan struct{}) func() production {
+	var i int
+	next := func() production {
+		if pending != nil {
+			select {
+			case pending <- struct{}{}:
+			case <-cxt.Done():
+				return production{} // the batch was canceled
+			}
+		}
+		req, meta, err := produce(p, i)
+		r := production{index: i, req: req, meta: meta, err: err}
+		i++
+		return r
+	}
+	if conf.Prefetch <= 0 {
+		return next
+	}
+
+	// one request is held by the goroutine while it waits to deliver it
+	prod := make(chan production, conf.Prefetch-1)
+	go func() {
+		defer close(prod)
+		for {
+			r := next()
+			select {
+			case prod <- r:
+			case <-stop:
+				return
+			case <-cxt.Done():
+				return
+			}
+			if r.req == nil || r.err != nil {
+				return
+			}
+		}
+	}()
+
+	return func() production {
+		select {
+		case r := <-prod:
+			return r // a closed channel produces the end of production
+		case <-cxt.Done():
+			return production{}
+		}
+	}
 }
 
 // Do executes requests in parallel, returning a set of counterpart responses.
 func (m *Mux) Do(cxt context.Context, p RequestProducer, opts ...Option) (siter.Iterator[*Result], error) {
 	conf := Config{}.WithOptions(opts)
+	if conf.Metrics != nil && !reflect.ValueOf(conf.Metrics).Comparable() {
+		return nil, fmt.Errorf("%w: %T; use a pointer to it instead", api.ErrInvalidMetricsSink, conf.Metrics)
+	}
+
+	var ff *failFast
+	if conf.FailFastCount > 0 || conf.FailFastRatio > 0 {
+		ff = newFailFast(conf.FailFastCount, conf.FailFastRatio)
+	}
+	var budget *api.RetryBudget
+	if conf.RetryTotal > 0 {
+		budget = api.NewRetryBudget(conf.RetryTotal)
+	}
+
+	track := newTracker(conf, p)
+
+	var cancel context.CancelCauseFunc
+	if conf.Cancel {
+		cxt, cancel = context.WithCancelCause(cxt)
+	}
+
+	// requests are dispatched until the deadline, if there is one; requests in
+	// flight are limited by the deadline individually, since their responses
+	// outlive dispatching
+	dcxt, release := cxt, context.CancelFunc(func() {})
+	if !conf.Deadline.IsZero() {
+		dcxt, release = context.WithDeadlineCause(cxt, conf.Deadline, ErrDeadlineExceeded)
+	}
 
 	dsp := exec.NewDispatcher(m.concur, m.concur)
-	err := dsp.Run(cxt)
+	err := dsp.Run(dcxt)
 	if err != nil {
+		release()
+		if cancel != nil {
+			cancel(err)
+		}
 		return nil, err
 	}
 
 	proc := make(chan siter.Result[*Result], m.concur)
 	iter := siter.New[*Result](proc)
 
+	var pending chan struct{}
+	if conf.MaxPending > 0 {
+		pending = make(chan struct{}, conf.MaxPending)
+	}
+	stop := make(chan struct{})
+	next := producer(dcxt, conf, p, pending, stop)
+
 	go func() {
+		var perr error
 		defer func() {
-			iter.Cancel(dsp.Error())
+			close(stop) // stop prefetching
+			err := dsp.Error()
+			// wait for anything still in flight to finish before the iterator is
+			// closed, otherwise a late result may be written to a closed iterator
+			for dsp.Error() != nil {
+			}
+			if perr != nil {
+				err = perr
+			} else if err == nil && errors.Is(context.Cause(dcxt), ErrDeadlineExceeded) {
+				err = ErrDeadlineExceeded
+			}
+			release()
+			iter.Cancel(err)
+			if cancel != nil {
+				cancel(nil) // release the context once the batch is finished
+			}
 		}()
 	outer:
-		for i := 0; ; i++ {
+		for {
 			select {
-			case <-cxt.Done():
+			case <-dcxt.Done():
 				break outer
 			default:
 				// proceed
 			}
-			req, err := p.Request(i)
+			r := next()
+			i, req, meta, err := r.index, r.req, r.meta, r.err
 			if err != nil {
-				iter.Cancel(err)
-				return
+				perr = err
+				break outer
 			} else if req == nil {
 				break outer // no more requests
 			}
 			req, err = conf.ConfigureRequest(req)
 			if err != nil {
-				iter.Cancel(err)
-				return
+				perr = err
+				break outer
+			}
+			if conf.Schedule {
+				err = m.schedule(dcxt, req)
+				if err != nil && dcxt.Err() != nil {
+					break outer // the batch was canceled while we were waiting
+				} else if err != nil {
+					iter.Cancel(err)
+					return
+				}
 			}
-			err = dsp.Exec(block(cxt, conf, m, i, req, iter))
+			err = dsp.Exec(block(cxt, cancel, conf, m, i, req, meta, iter, ff, budget, track, pending))
 			if errors.Is(err, exec.ErrCanceled) {
 				break outer // dispatcher stopped, probably due to a previous error
 			} else if err != nil {
-				iter.Cancel(err)
-				return
+				perr = err
+				break outer
 			}
 		}
 	}()
 
 	return iter, nil
 }
+
+// DoFunc executes requests in parallel and invokes fn with each result as it
+// becomes available, in the order requests complete. The response body of
+// each result is closed after fn returns. If fn returns an error, every
+// in-flight request is canceled and that error is returned. This is otherwise
+// equivalent to Do with WithCancelOnFailure.
+func (m *Mux) DoFunc(cxt context.Context, p RequestProducer, fn func(*Result) error, opts ...Option) error {
+	cxt, cancel := context.WithCancel(cxt)
+	defer cancel()
+
+	iter, err := m.Do(cxt, p, append(opts, WithCancelOnFailure())...)
+	if err != nil {
+		return err
+	}
+
+	var ferr error
+	for {
+		res, err := iter.Next()
+		if errors.Is(err, siter.ErrClosed) {
+			break
+		} else if err != nil {
+			if ferr == nil {
+				ferr = err
+			}
+			cancel()
+			continue // keep draining so nothing in flight blocks writing its result
+		}
+		if ferr == nil {
+			ferr = fn(res)
+			if ferr != nil {
+				cancel()
+			}
+		}
+		if res.Response != nil && res.Response.Body != nil {
+			res.Response.Body.Close()
+		}
+	}
+
+	return ferr
+}
+
+// Wait until the client's rate limiter permits a request to be dispatched
+func (m *Mux) schedule(cxt context.Context, req *http.Request) error {
+	l := m.RateLimiterFor(req)
+	if l == nil {
+		return nil
+	}
+	next, err := l.Next(time.Now(), ratelimit.WithRequest(req))
+	if err != nil {
+		return fmt.Errorf("Could not schedule request: %w", err)
+	}
+	if delay := time.Until(next); delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-cxt.Done():
+			return cxt.Err()
+		}
+	}
+	return nil
+}
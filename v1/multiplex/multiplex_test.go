@@ -1,18 +1,25 @@
 package multiplex
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"path"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	api "github.com/bww/go-apiclient/v1"
 
 	siter "github.com/bww/go-iterator/v1"
+	"github.com/bww/go-ratelimit/v1"
 	"github.com/bww/go-rest/v2"
 	"github.com/bww/go-router/v2"
 	"github.com/bww/go-util/v1/debug"
@@ -175,4 +182,473 @@ func TestMultiplex(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("Stream unmarshal", func(t *testing.T) {
+		urls := make([]string, n)
+		for i := 0; i < n; i++ {
+			if i == n/2 {
+				urls[i] = "hello/nan"
+			} else {
+				urls[i] = fmt.Sprintf("hello/%d", i)
+			}
+		}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		iter, err := px.Do(cxt, NewGet(urls))
+		if assert.NoError(t, err) {
+			ents := UnmarshalStream[number](iter)
+			defer ents.Close()
+			var count int
+			for {
+				i, e, err := ents.Next()
+				if i < 0 {
+					assert.ErrorIs(t, err, siter.ErrClosed)
+					break
+				} else if i == n/2 {
+					assert.Error(t, err)
+				} else if assert.NoError(t, err) {
+					assert.Equal(t, i, int(e))
+				}
+				count++
+			}
+			assert.Equal(t, n, count)
+		}
+
+		iter, err = px.Do(cxt, NewGet([]string{"hello/1", "missing"}))
+		if assert.NoError(t, err) {
+			ents := UnmarshalStream[number](iter)
+			defer ents.Close()
+			for {
+				i, _, err := ents.Next()
+				if err != nil {
+					var apierr *api.Error
+					if assert.ErrorAs(t, err, &apierr) {
+						assert.Equal(t, http.StatusNotFound, apierr.Status)
+					}
+					assert.Equal(t, -1, i)
+					break
+				}
+			}
+		}
+	})
+
+	t.Run("Fail fast", func(t *testing.T) {
+		urls := make([]string, n)
+		for i := 0; i < n; i++ {
+			if i%2 == 0 {
+				urls[i] = fmt.Sprintf("hello/%d", i)
+			} else {
+				urls[i] = fmt.Sprintf("%d", i)
+			}
+		}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		rsps, err := Collect(px.Do(cxt, NewGet(urls), WithFailFast(0, 0.75)))
+		if assert.NoError(t, err) {
+			assert.Len(t, rsps, n/2)
+		}
+
+		_, err = Collect(px.Do(cxt, NewGet(urls), WithFailFast(0, 0.25)))
+		var fferr *FailFastError
+		if assert.ErrorAs(t, err, &fferr) {
+			assert.True(t, len(fferr.Failures) > 0)
+			for _, e := range fferr.Indexes() {
+				assert.Equal(t, 1, e%2)
+			}
+		}
+	})
+
+	t.Run("Scheduling", func(t *testing.T) {
+		urls := make([]string, 20)
+		for i := range urls {
+			urls[i] = fmt.Sprintf("hello/%d", i)
+		}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		lim := ratelimit.NewLinear(ratelimit.Config{Window: time.Millisecond * 200, Events: 20})
+		sx := New(cli.WithRateLimiter(lim), 20)
+
+		start := time.Now()
+		rsps, err := Collect(sx.Do(cxt, NewGet(urls), WithScheduling(), WithRetryBudget(10, 1)))
+		if assert.NoError(t, err) {
+			assert.Len(t, rsps, len(urls))
+			assert.True(t, time.Since(start) >= time.Millisecond*150, "dispatches should be spaced by the limiter")
+		}
+	})
+
+	t.Run("Stream results", func(t *testing.T) {
+		urls := make([]string, n)
+		for i := 0; i < n; i++ {
+			urls[i] = fmt.Sprintf("hello/%d", i)
+		}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var count int
+		err := px.DoFunc(cxt, NewGet(urls), func(res *Result) error {
+			data, err := io.ReadAll(res.Response.Body)
+			if assert.NoError(t, err) {
+				assert.Equal(t, []byte(fmt.Sprintf("%d", res.Index)), data)
+			}
+			count++
+			return nil
+		})
+		if assert.NoError(t, err) {
+			assert.Equal(t, n, count)
+		}
+
+		stop := fmt.Errorf("Stop")
+		count = 0
+		err = px.DoFunc(cxt, NewGet(urls), func(res *Result) error {
+			count++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, count)
+
+		urls[n/2] = "missing"
+		err = px.DoFunc(cxt, NewGet(urls), func(res *Result) error {
+			return nil
+		})
+		var apierr *api.Error
+		if assert.ErrorAs(t, err, &apierr) {
+			assert.Equal(t, http.StatusNotFound, apierr.Status)
+		}
+	})
+
+	t.Run("Map items", func(t *testing.T) {
+		items := make([]int, 100)
+		for i := range items {
+			items[i] = i * 2
+		}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		res, err := Map[int, number](cxt, px, items, func(e int) (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, fmt.Sprintf("hello/%d", e), nil)
+		})
+		if assert.NoError(t, err) && assert.Len(t, res, len(items)) {
+			for i, e := range res {
+				assert.Equal(t, items[i], int(e))
+			}
+		}
+	})
+
+	t.Run("Request metadata", func(t *testing.T) {
+		items := []string{"a", "b", "c", "d"}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		err := px.DoFunc(cxt, MetaRequestProducerFunc(func(i int) (*http.Request, any, error) {
+			if i >= len(items) {
+				return nil, nil, nil
+			}
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("hello/%d", i), nil)
+			return req, items[i], err
+		}), func(res *Result) error {
+			assert.Equal(t, items[res.Index], res.Meta)
+			if assert.NotNil(t, res.Request) {
+				assert.Equal(t, fmt.Sprintf("/hello/%d", res.Index), res.Request.URL.Path)
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Partial failures", func(t *testing.T) {
+		urls := make([]string, 100)
+		for i := range urls {
+			if i%2 == 0 {
+				urls[i] = fmt.Sprintf("hello/%d", i)
+			} else {
+				urls[i] = fmt.Sprintf("%d", i)
+			}
+		}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var succeeded, failed int
+		err := px.DoFunc(cxt, NewGet(urls), func(res *Result) error {
+			var apierr *api.Error
+			if res.Index%2 == 0 {
+				assert.NoError(t, res.Err)
+				succeeded++
+			} else if assert.ErrorAs(t, res.Err, &apierr) {
+				assert.Equal(t, http.StatusNotFound, apierr.Status)
+				failed++
+			}
+			return nil
+		}, WithPartialFailures())
+		if assert.NoError(t, err) {
+			assert.Equal(t, len(urls)/2, succeeded)
+			assert.Equal(t, len(urls)/2, failed)
+		}
+	})
+
+	t.Run("Unmarshal partial failures", func(t *testing.T) {
+		urls := []string{"hello/0", "hello/1", "2", "hello/3"}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		iter, err := px.Do(cxt, NewGet(urls), WithPartialFailures())
+		if assert.NoError(t, err) {
+			var nums []number
+			_, err = Unmarshal(iter, nums)
+			var apierr *api.Error
+			if assert.ErrorAs(t, err, &apierr) {
+				assert.Equal(t, http.StatusNotFound, apierr.Status)
+			}
+		}
+	})
+
+	t.Run("Collect partial failures", func(t *testing.T) {
+		urls := []string{"hello/0", "hello/1", "2", "hello/3"}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		rsps, err := Collect(px.Do(cxt, NewGet(urls), WithPartialFailures()))
+		assert.Nil(t, rsps)
+		var apierr *api.Error
+		if assert.ErrorAs(t, err, &apierr) {
+			assert.Equal(t, http.StatusNotFound, apierr.Status)
+		}
+	})
+
+	t.Run("Progress", func(t *testing.T) {
+		urls := make([]string, 100)
+		for i := range urls {
+			urls[i] = fmt.Sprintf("hello/%d", i)
+		}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var calls int
+		var last Progress
+		rsps, err := Collect(px.Do(cxt, NewGet(urls), WithName("test"), WithMetrics(api.NoMetrics), WithProgress(func(p Progress) {
+			calls++
+			last = p
+		})))
+		if assert.NoError(t, err) {
+			assert.Len(t, rsps, len(urls))
+			assert.Equal(t, len(urls), calls)
+			assert.Equal(t, len(urls), last.Completed)
+			assert.Equal(t, len(urls), last.Total)
+			assert.True(t, last.Rate > 0)
+		}
+	})
+
+	t.Run("Panics", func(t *testing.T) {
+		urls := make([]string, 100)
+		for i := range urls {
+			if i == 50 {
+				urls[i] = "missing"
+			} else {
+				urls[i] = fmt.Sprintf("hello/%d", i)
+			}
+		}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		errh := WithErrorHandler(ErrorHandlerFunc(func(rsp *http.Response, err error) (*http.Response, error) {
+			panic("handler")
+		}))
+
+		_, err := Collect(px.Do(cxt, NewGet(urls), errh))
+		var perr *PanicError
+		if assert.ErrorAs(t, err, &perr) {
+			assert.Equal(t, 50, perr.Index)
+			assert.Equal(t, "handler", perr.Value)
+			assert.NotEmpty(t, perr.Stack)
+		}
+
+		var failed []int
+		err = px.DoFunc(cxt, NewGet(urls), func(res *Result) error {
+			if res.Err != nil {
+				assert.ErrorAs(t, res.Err, &perr)
+				failed = append(failed, res.Index)
+			}
+			return nil
+		}, errh, WithPartialFailures())
+		if assert.NoError(t, err) {
+			assert.Equal(t, []int{50}, failed)
+		}
+
+		stop := fmt.Errorf("Stop")
+		_, err = Collect(px.Do(cxt, RequestProducerFunc(func(i int) (*http.Request, error) {
+			if i == 10 {
+				panic(stop)
+			}
+			return http.NewRequest(http.MethodGet, fmt.Sprintf("hello/%d", i), nil)
+		})))
+		if assert.ErrorAs(t, err, &perr) {
+			assert.Equal(t, 10, perr.Index)
+		}
+		assert.ErrorIs(t, err, stop)
+	})
+
+	t.Run("Backpressure", func(t *testing.T) {
+		for _, opts := range [][]Option{
+			{WithMaxPending(1)},
+			{WithMaxPending(1), WithPrefetch(3)},
+		} {
+			var produced atomic.Int64
+			producer := RequestProducerFunc(func(i int) (*http.Request, error) {
+				if i >= 100 {
+					return nil, nil
+				}
+				produced.Add(1)
+				return http.NewRequest(http.MethodGet, fmt.Sprintf("hello/%d", i), nil)
+			})
+
+			cxt, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// two results are buffered by the iterator and one is pending while it
+			// waits to be delivered; nothing else is produced until they are read
+			bx := New(cli, 2)
+			iter, err := bx.Do(cxt, producer, opts...)
+			if assert.NoError(t, err) {
+				time.Sleep(time.Millisecond * 100)
+				assert.Equal(t, int64(3), produced.Load())
+				rsps, err := Collect(iter, nil)
+				if assert.NoError(t, err) {
+					assert.Len(t, rsps, 100)
+				}
+			}
+		}
+	})
+
+	t.Run("Prefetch", func(t *testing.T) {
+		urls := make([]string, n)
+		for i := 0; i < n; i++ {
+			urls[i] = fmt.Sprintf("hello/%d", i)
+		}
+
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		res, err := Map[string, number](cxt, px, urls, func(e string) (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, e, nil)
+		}, WithPrefetch(10))
+		if assert.NoError(t, err) && assert.Len(t, res, n) {
+			for i, e := range res {
+				assert.Equal(t, i, int(e))
+			}
+		}
+	})
+}
+
+func TestDeadlines(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/slow/") {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		fmt.Fprint(w, path.Base(r.URL.Path))
+	}))
+	defer svr.Close()
+
+	cli, err := api.NewWithConfig(api.Config{BaseURL: svr.URL + "/"})
+	assert.NoError(t, err)
+	px := New(cli, 4)
+
+	urls := make([]string, 20)
+	for i := range urls {
+		if i == 10 {
+			urls[i] = fmt.Sprintf("slow/%d", i)
+		} else {
+			urls[i] = fmt.Sprintf("fast/%d", i)
+		}
+	}
+
+	t.Run("Per request", func(t *testing.T) {
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var failed []int
+		err := px.DoFunc(cxt, NewGet(urls), func(res *Result) error {
+			if res.Err != nil {
+				assert.ErrorIs(t, res.Err, ErrRequestTimeout)
+				failed = append(failed, res.Index)
+				return nil
+			}
+			data, err := io.ReadAll(res.Response.Body)
+			if assert.NoError(t, err) {
+				assert.Equal(t, fmt.Sprint(res.Index), string(data))
+			}
+			return nil
+		}, WithPerRequestTimeout(time.Millisecond*100), WithPartialFailures())
+		if assert.NoError(t, err) {
+			assert.Equal(t, []int{10}, failed)
+		}
+
+		_, err = Collect(px.Do(cxt, NewGet(urls), WithPerRequestTimeout(time.Millisecond*100)))
+		assert.ErrorIs(t, err, ErrRequestTimeout)
+	})
+
+	t.Run("Overall", func(t *testing.T) {
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		start := time.Now()
+		_, err := Collect(px.Do(cxt, NewGet(urls), WithOverallDeadline(time.Now().Add(time.Millisecond*100))))
+		assert.ErrorIs(t, err, ErrDeadlineExceeded)
+		assert.True(t, time.Since(start) < time.Millisecond*500, "the batch should end at its deadline")
+
+		rsps, err := Collect(px.Do(cxt, NewGet(urls[:10]), WithOverallDeadline(time.Now().Add(time.Second*5))))
+		if assert.NoError(t, err) {
+			assert.Len(t, rsps, 10)
+		}
+	})
+}
+
+func TestDebugWriter(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {}))
+	defer s.Close()
+
+	t.Setenv("DEBUG_API_MUX", "true")
+	buf := &syncBuffer{}
+	cli, err := api.New(api.WithBaseURL(s.URL), api.WithDebugWriter(buf))
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = New(cli, 2).DoFunc(context.Background(), NewGet([]string{"a", "b"}), func(*Result) error { return nil })
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, strings.Count(buf.String(), "api: mux: "))
+	}
+}
+
+// A buffer which may be written concurrently
+type syncBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.String()
 }
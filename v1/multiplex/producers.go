@@ -0,0 +1,99 @@
+package multiplex
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	api "github.com/bww/go-apiclient/v1"
+	"github.com/bww/go-apiclient/v1/httputil"
+)
+
+// ChanProducer produces requests as they are received from a channel, which
+// allows a pipeline to feed a batch as it runs. Production ends when the
+// channel is closed; until then, the batch waits for the next request, so the
+// channel must be closed for the batch to finish. If the context ends first,
+// production fails with its error.
+func ChanProducer(cxt context.Context, ch <-chan *http.Request) RequestProducer {
+	return RequestProducerFunc(func(int) (*http.Request, error) {
+		select {
+		case req := <-ch:
+			return req, nil // a closed channel produces nil, which ends the batch
+		case <-cxt.Done():
+			return nil, cxt.Err()
+		}
+	})
+}
+
+// A function which produces requests from a page of a listing
+type PageFunc func(*http.Response) ([]*http.Request, error)
+
+// A producer which produces requests from the pages of a listing
+type pageProducer struct {
+	cxt    context.Context
+	client *api.Client
+	next   string
+	fn     PageFunc
+	opts   []api.Option
+	buf    []*http.Request
+}
+
+// PageProducer produces requests from a paginated listing, such as a request
+// for each resource in a list of resources. The first page is fetched from u
+// and fn produces the requests for each page. Once those requests have been
+// produced, the next page is fetched from the page's "next" link, until a page
+// has no such link. The response body is closed after fn returns.
+func PageProducer(cxt context.Context, client *api.Client, u string, fn PageFunc, opts ...api.Option) RequestProducer {
+	return &pageProducer{
+		cxt:    cxt,
+		client: client,
+		next:   u,
+		fn:     fn,
+		opts:   opts,
+	}
+}
+
+func (p *pageProducer) Request(i int) (*http.Request, error) {
+	for len(p.buf) == 0 {
+		if p.next == "" {
+			return nil, nil // no more pages
+		}
+		err := p.fetch()
+		if err != nil {
+			return nil, err
+		}
+	}
+	req := p.buf[0]
+	p.buf = p.buf[1:]
+	return req, nil
+}
+
+// Fetch the next page and produce its requests
+func (p *pageProducer) fetch() error {
+	u := p.next
+	p.next = ""
+	rsp, err := p.client.Get(p.cxt, u, nil, append(p.opts, api.WithRawBody())...)
+	if err != nil {
+		return fmt.Errorf("Could not fetch page: %w", err)
+	}
+	defer rsp.Body.Close()
+
+	p.buf, err = p.fn(rsp)
+	if err != nil {
+		return err
+	}
+	next, err := httputil.NextPage(rsp)
+	if err != nil {
+		return fmt.Errorf("Could not parse page links: %w", err)
+	}
+	if next != "" && rsp.Request != nil && rsp.Request.URL != nil {
+		ref, err := url.Parse(next)
+		if err != nil {
+			return fmt.Errorf("Could not parse next page: %w", err)
+		}
+		next = rsp.Request.URL.ResolveReference(ref).String()
+	}
+	p.next = next
+	return nil
+}
@@ -0,0 +1,39 @@
+//go:build go1.23
+
+package multiplex
+
+import (
+	"iter"
+	"net/http"
+)
+
+// A producer which produces the requests in a sequence
+type SeqRequestProducer struct {
+	next func() (*http.Request, bool)
+	stop func()
+}
+
+// SeqProducer produces requests from a sequence as they are needed, without
+// materializing it. If the batch ends before the sequence does, Stop should
+// be called to release it.
+func SeqProducer(seq iter.Seq[*http.Request]) *SeqRequestProducer {
+	next, stop := iter.Pull(seq)
+	return &SeqRequestProducer{
+		next: next,
+		stop: stop,
+	}
+}
+
+func (p *SeqRequestProducer) Request(i int) (*http.Request, error) {
+	req, ok := p.next()
+	if !ok {
+		p.stop()
+		return nil, nil
+	}
+	return req, nil
+}
+
+// Stop releases the sequence. It is safe to call Stop more than once.
+func (p *SeqRequestProducer) Stop() {
+	p.stop()
+}
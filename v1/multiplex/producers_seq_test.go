@@ -0,0 +1,50 @@
+//go:build go1.23
+
+package multiplex
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	api "github.com/bww/go-apiclient/v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeqProducer(t *testing.T) {
+	svc := &testService{}
+	svc.Run()
+
+	cli, err := api.NewWithConfig(api.Config{BaseURL: fmt.Sprintf("http://%s/", svc.Addr())})
+	assert.NoError(t, err)
+	px := New(cli, 4)
+
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var yielded int
+	p := SeqProducer(func(yield func(*http.Request) bool) {
+		for i := 0; i < 10; i++ {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("hello/%d", i), nil)
+			if err != nil || !yield(req) {
+				return
+			}
+			yielded++
+		}
+	})
+	defer p.Stop()
+
+	rsps, err := Collect(px.Do(cxt, p))
+	if assert.NoError(t, err) && assert.Len(t, rsps, 10) {
+		for i, e := range rsps {
+			data, err := io.ReadAll(e.Body)
+			if assert.NoError(t, err) {
+				assert.Equal(t, fmt.Sprint(i), string(data))
+			}
+		}
+	}
+	assert.Equal(t, 10, yielded)
+}
@@ -0,0 +1,129 @@
+package multiplex
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/bww/go-apiclient/v1"
+
+	"github.com/bww/go-util/v1/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducers(t *testing.T) {
+	const pages, perPage = 4, 5
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/items":
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if page < pages-1 {
+				w.Header().Set("Link", fmt.Sprintf(`</items?page=%d>; rel="next"`, page+1))
+			}
+			ids := make([]string, perPage)
+			for i := range ids {
+				ids[i] = strconv.Itoa(page*perPage + i)
+			}
+			fmt.Fprint(w, strings.Join(ids, ","))
+		case strings.HasPrefix(r.URL.Path, "/items/"):
+			fmt.Fprint(w, strings.TrimPrefix(r.URL.Path, "/items/"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svr.Close()
+
+	cli, err := api.NewWithConfig(api.Config{BaseURL: svr.URL + "/"})
+	assert.NoError(t, err)
+	px := New(cli, 4)
+
+	item := func(i int) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("items/%d", i), nil)
+		assert.NoError(t, err)
+		return req
+	}
+	check := func(t *testing.T, n int, rsps []*http.Response, err error) {
+		if assert.NoError(t, err) && assert.Len(t, rsps, n) {
+			for i, e := range rsps {
+				data, err := io.ReadAll(e.Body)
+				if assert.NoError(t, err) {
+					assert.Equal(t, strconv.Itoa(i), string(data))
+				}
+			}
+		}
+	}
+
+	t.Run("Channel", func(t *testing.T) {
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch := make(chan *http.Request)
+		go func() {
+			defer close(ch)
+			for i := 0; i < 10; i++ {
+				ch <- item(i)
+			}
+		}()
+
+		rsps, err := Collect(px.Do(cxt, ChanProducer(cxt, ch)))
+		check(t, 10, rsps, err)
+	})
+
+	t.Run("Channel canceled", func(t *testing.T) {
+		cxt, cancel := context.WithCancel(context.Background())
+		ch := make(chan *http.Request) // never closed
+		go func() {
+			ch <- item(0)
+			time.Sleep(time.Millisecond * 50) // the batch is now waiting for the next request
+			cancel()
+		}()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			Collect(px.Do(cxt, ChanProducer(cxt, ch)))
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second * 5):
+			t.Fatal("the producer did not stop when its context was canceled")
+		}
+	})
+
+	t.Run("Pages", func(t *testing.T) {
+		cxt, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var fetched int
+		p := PageProducer(cxt, cli, "items", func(rsp *http.Response) ([]*http.Request, error) {
+			fetched++
+			data, err := io.ReadAll(rsp.Body)
+			if err != nil {
+				return nil, err
+			}
+			var reqs []*http.Request
+			for _, e := range strings.Split(string(data), ",") {
+				reqs = append(reqs, item(errors.Must(strconv.Atoi(e))))
+			}
+			return reqs, nil
+		})
+
+		rsps, err := Collect(px.Do(cxt, p))
+		check(t, pages*perPage, rsps, err)
+		assert.Equal(t, pages, fetched)
+
+		_, err = Collect(px.Do(cxt, PageProducer(cxt, cli, "missing", func(*http.Response) ([]*http.Request, error) {
+			return nil, nil
+		})))
+		var apierr *api.Error
+		if assert.ErrorAs(t, err, &apierr) {
+			assert.Equal(t, http.StatusNotFound, apierr.Status)
+		}
+	})
+}
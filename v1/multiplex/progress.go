@@ -0,0 +1,134 @@
+package multiplex
+
+import (
+	"sync"
+	"time"
+
+	api "github.com/bww/go-apiclient/v1"
+
+	"github.com/bww/go-metrics/v1"
+)
+
+// A request producer may optionally report the total number of requests it
+// will produce, which is used to report progress.
+type SizedRequestProducer interface {
+	RequestProducer
+	Len() int
+}
+
+func (p StaticRequestProducer) Len() int {
+	return len(p)
+}
+
+func (p URLRequestProducer) Len() int {
+	return len(p.urls)
+}
+
+// The progress of a batch
+type Progress struct {
+	Completed int           // the number of requests completed, whether or not they succeeded
+	Total     int           // the total number of requests, or -1 if unknown
+	Elapsed   time.Duration // the time elapsed since the batch started
+	Rate      float64       // the average number of completions per second
+}
+
+// Tracks the progress of a batch and records its metrics
+type tracker struct {
+	sync.Mutex
+	name       string
+	fn         func(Progress)
+	metrics    *muxMetrics
+	start      time.Time
+	total      int
+	dispatched int
+	started    int
+	completed  int
+}
+
+func newTracker(conf Config, p RequestProducer) *tracker {
+	total := -1
+	if s, ok := p.(SizedRequestProducer); ok {
+		total = s.Len()
+	}
+	return &tracker{
+		name:    conf.Name,
+		fn:      conf.Progress,
+		metrics: metricsFor(conf.Metrics),
+		start:   time.Now(),
+		total:   total,
+	}
+}
+
+// A request has been dispatched and is waiting to be started
+func (t *tracker) Dispatched() {
+	t.Lock()
+	defer t.Unlock()
+	t.dispatched++
+	t.metrics.queue.With(metrics.Tags{"mux": t.name}).Observe(float64(t.dispatched - t.started))
+}
+
+// A request has started
+func (t *tracker) Started() {
+	t.Lock()
+	defer t.Unlock()
+	t.started++
+	t.metrics.inflight.With(metrics.Tags{"mux": t.name}).Observe(float64(t.started - t.completed))
+}
+
+// A request has completed. Progress callbacks are invoked serially.
+func (t *tracker) Completed(err error) {
+	t.Lock()
+	defer t.Unlock()
+	t.completed++
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	t.metrics.completions.With(metrics.Tags{"mux": t.name, "result": result}).Inc()
+	if t.fn != nil {
+		elapsed := time.Since(t.start)
+		var rate float64
+		if elapsed > 0 {
+			rate = float64(t.completed) / elapsed.Seconds()
+		}
+		t.fn(Progress{
+			Completed: t.completed,
+			Total:     t.total,
+			Elapsed:   elapsed,
+			Rate:      rate,
+		})
+	}
+}
+
+type muxMetrics struct {
+	queue       metrics.SamplerVec
+	inflight    metrics.SamplerVec
+	completions metrics.CounterVec
+}
+
+var (
+	metricsLock  sync.Mutex
+	metricsCache = map[api.MetricsSink]*muxMetrics{}
+)
+
+func metricsFor(r api.MetricsSink) *muxMetrics {
+	if r == nil {
+		r = api.GlobalMetrics
+	}
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	if m, ok := metricsCache[r]; ok {
+		return m
+	}
+	m := newMuxMetrics(r)
+	metricsCache[r] = m
+	return m
+}
+
+func newMuxMetrics(r api.MetricsSink) *muxMetrics {
+	return &muxMetrics{
+		queue:       r.RegisterSamplerVec("rest_client_mux_queue_depth", "Requests dispatched to a multiplexer but not yet started", []string{"mux"}),
+		inflight:    r.RegisterSamplerVec("rest_client_mux_in_flight", "Requests in flight in a multiplexer", []string{"mux"}),
+		completions: r.RegisterCounterVec("rest_client_mux_completion", "Request completed by a multiplexer", []string{"mux", "result"}),
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrUnexpectedContentType is returned, when strict content types are
+// enforced, if a response has a content type which cannot be unmarshaled into
+// the output entity; see WithStrictContentType.
+var ErrUnexpectedContentType = errors.New("Unexpected content type")
+
+// WithStrictContentType causes requests with an output entity to fail with
+// ErrUnexpectedContentType, before the response body is unmarshaled, when
+// the response has a content type which cannot be unmarshaled into the
+// entity. This may be used as a client or per-request option; when used as a
+// per-request option, it takes precedence over the client's setting.
+func WithStrictContentType(on bool) Option {
+	return func(c Config) Config {
+		c.StrictContentType = &on
+		return c
+	}
+}
+
+// Produce the Accept header for a request whose response is unmarshaled into
+// the provided entity. The client's default content type is preferred; other
+// types which the entity can be unmarshaled from are accepted at a lower
+// priority.
+func acceptFor(ctype string, entity interface{}) string {
+	m, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		m = JSON
+	}
+	accept := []string{m}
+	if m != PlainText && acceptsText(entity) {
+		accept = append(accept, PlainText+";q=0.9")
+	}
+	if _, ok := entity.(EntityUnmarshaler); ok {
+		accept = append(accept, "*/*;q=0.5")
+	}
+	return strings.Join(accept, ", ")
+}
+
+// Set the Accept header for a request whose response is unmarshaled into the
+// provided entity, preferring the provided content type, unless it has
+// already been set or the client sets it by default.
+func (c *Client) negotiate(req *http.Request, ctype string, entity interface{}) {
+	if entity == nil || req.Method == http.MethodHead {
+		return
+	}
+	if req.Header.Get("Accept") != "" || c.header.Get("Accept") != "" {
+		return
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set("Accept", acceptFor(ctype, entity))
+}
+
+// Determine whether a response with the provided content type can be
+// unmarshaled into the provided entity, as by Unmarshal.
+func canUnmarshal(ctype string, entity interface{}) bool {
+	m, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(m) {
+	case JSON, URLEncoded, Multipart:
+		return true
+	case PlainText:
+		return acceptsText(entity)
+	}
+	_, ok := entity.(EntityUnmarshaler)
+	return ok
+}
+
+func acceptsText(entity interface{}) bool {
+	switch entity.(type) {
+	case encoding.TextUnmarshaler, *string, *[]byte:
+		return true
+	default:
+		return false
+	}
+}
+
+// Check that a response can be unmarshaled into the provided entity before
+// its body is read.
+func (c *Client) checkContentType(req *http.Request, rsp *http.Response, entity interface{}, limit int64) error {
+	if rsp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	ctype := rsp.Header.Get("Content-Type")
+	if canUnmarshal(ctype, entity) {
+		return nil
+	}
+	return c.redactErr(req, Errorf(rsp.StatusCode, "Response with content type %q cannot be unmarshaled into %T", ctype, entity).
+		SetRequest(req).
+		SetEntityFromResponseLimit(rsp, limit).
+		SetCause(fmt.Errorf("%w: %w", ErrCouldNotUnmarshalResponse, ErrUnexpectedContentType)))
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type anyEntity struct {
+	Type string
+}
+
+func (e *anyEntity) UnmarshalEntity(ctype string, data []byte) error {
+	e.Type = ctype
+	return nil
+}
+
+func TestAccept(t *testing.T) {
+	tests := []struct {
+		ContentType string
+		Entity      interface{}
+		Expect      string
+	}{
+		{JSON, &struct{}{}, "application/json"},
+		{JSON, new(string), "application/json, text/plain;q=0.9"},
+		{JSON, &anyEntity{}, "application/json, */*;q=0.5"},
+		{PlainText, new([]byte), "text/plain"},
+		{URLEncoded + "; charset=utf-8", &struct{}{}, URLEncoded},
+	}
+	for _, e := range tests {
+		assert.Equal(t, e.Expect, acceptFor(e.ContentType, e.Entity), "%s: %T", e.ContentType, e.Entity)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		accept = req.Header.Get("Accept")
+		if req.URL.Path == "/html" {
+			rsp.Header().Set("Content-Type", "text/html")
+			rsp.Write([]byte("<html>Oops</html>"))
+			return
+		}
+		rsp.Header().Set("Content-Type", JSON)
+		rsp.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	cxt := context.Background()
+
+	client, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var out struct{}
+	_, err = client.Get(cxt, "/json", &out)
+	if assert.NoError(t, err) {
+		assert.Equal(t, JSON, accept)
+	}
+	_, err = client.Get(cxt, "/json", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "", accept, "no entity, no accept")
+	}
+	_, err = client.Get(cxt, "/json", &out, WithHeader("Accept", "application/vnd.thing+json"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "application/vnd.thing+json", accept)
+	}
+
+	_, err = client.Get(cxt, "/html", &out)
+	assert.ErrorIs(t, err, ErrCouldNotUnmarshalResponse)
+	assert.NotErrorIs(t, err, ErrUnexpectedContentType)
+	_, err = client.Get(cxt, "/html", &out, WithStrictContentType(true))
+	assert.ErrorIs(t, err, ErrUnexpectedContentType)
+	assert.ErrorIs(t, err, ErrCouldNotUnmarshalResponse)
+	var apierr *Error
+	if assert.ErrorAs(t, err, &apierr) && assert.NotNil(t, apierr.Entity) {
+		assert.Contains(t, apierr.Message, `"text/html"`)
+		assert.Equal(t, "<html>Oops</html>", string(apierr.Entity.Data))
+	}
+
+	var ent anyEntity
+	_, err = client.Get(cxt, "/html", &ent, WithStrictContentType(true))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "text/html", ent.Type)
+	}
+
+	strict, err := client.Clone(WithStrictContentType(true))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = strict.Get(cxt, "/html", &out)
+	assert.ErrorIs(t, err, ErrUnexpectedContentType)
+	_, err = strict.Get(cxt, "/html", &out, WithStrictContentType(false))
+	assert.NotErrorIs(t, err, ErrUnexpectedContentType, "the request's setting takes precedence")
+
+	client, err = New(WithBaseURL(server.URL), WithHeader("Accept", "*/*"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Get(cxt, "/json", &out)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "*/*", accept, "the client's default is used")
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// An observer is notified over the lifecycle of a request. Preflight is
+// invoked immediately before a request is dispatched, after it has been
+// fully prepared. Postflight is invoked after a successful response has
+// been received and Failure is invoked when a request fails. Postflight and
+// Failure are invoked with the same request as Preflight, which may be a copy
+// of the request that was provided to the client; a request which fails over
+// to another base URL is observed once for each URL it is sent to.
+//
+// An error returned from Preflight or Postflight aborts the request, unless
+// the observer's policy is FailOpen. Every observer is invoked even when
+// another returns an error, and when a request is aborted by an observer,
+// Failure is invoked on every observer.
+type Observer interface {
+	Preflight(*http.Request) error
+	Postflight(*http.Request, *http.Response) error
+	Failure(*http.Request, error)
+}
+
+// An observer policy determines how an error returned by an observer is
+// handled.
+type ObserverPolicy int
+
+const (
+	FailClosed ObserverPolicy = iota // the error aborts the request; this is the default
+	FailOpen                         // the error is logged, when the client is verbose, and the request continues
+)
+
+// An observer may determine its own policy, which overrides the client's
+type PolicyObserver interface {
+	Observer
+	ObserverPolicy() ObserverPolicy
+}
+
+type policyObserver struct {
+	Observer
+	policy ObserverPolicy
+}
+
+func (o policyObserver) ObserverPolicy() ObserverPolicy {
+	return o.policy
+}
+
+// ObserverWithPolicy wraps an observer so that its errors are handled
+// according to the provided policy, regardless of the client's policy.
+func ObserverWithPolicy(o Observer, p ObserverPolicy) Observer {
+	return policyObserver{Observer: o, policy: p}
+}
+
+// WithObserverPolicy sets the policy for errors returned by the client's
+// observers, except for those which determine their own. By default, an
+// observer error aborts the request.
+func WithObserverPolicy(p ObserverPolicy) Option {
+	return func(c Config) Config {
+		c.ObserverPolicy = p
+		return c
+	}
+}
+
+func policyFor(o Observer, def ObserverPolicy) ObserverPolicy {
+	if p, ok := o.(PolicyObserver); ok {
+		return p.ObserverPolicy()
+	}
+	return def
+}
+
+type observers []Observer
+
+// Invoke every observer. The first error returned by an observer which fails
+// closed is returned; errors from observers which fail open are passed to
+// ignore.
+func (o observers) Preflight(req *http.Request, def ObserverPolicy, ignore func(error)) error {
+	var first error
+	for _, e := range o {
+		err := e.Preflight(req)
+		if err == nil {
+			continue
+		}
+		if policyFor(e, def) == FailOpen {
+			ignore(err)
+		} else if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Invoke every observer, handling errors as Preflight does
+func (o observers) Postflight(req *http.Request, rsp *http.Response, def ObserverPolicy, ignore func(error)) error {
+	var first error
+	for _, e := range o {
+		err := e.Postflight(req, rsp)
+		if err == nil {
+			continue
+		}
+		if policyFor(e, def) == FailOpen {
+			ignore(err)
+		} else if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (o observers) Failure(req *http.Request, err error) {
+	for _, e := range o {
+		e.Failure(req, err)
+	}
+}
+
+// Create a function which handles errors from observers which fail open
+func (c *Client) ignoreObserver(reqid int64, req *http.Request) func(error) {
+	return func(err error) {
+		if c.isVerbose(req) {
+			fmt.Fprintf(c.debug.Writer, "api: [%06d] %v %v: ignoring observer error: %v\n", reqid, req.Method, c.redact.url(req.URL), err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingObserver struct {
+	pre, post  error
+	preflights int
+	postflight int
+	failures   int
+}
+
+func (o *countingObserver) Preflight(*http.Request) error {
+	o.preflights++
+	return o.pre
+}
+
+func (o *countingObserver) Postflight(*http.Request, *http.Response) error {
+	o.postflight++
+	return o.post
+}
+
+func (o *countingObserver) Failure(*http.Request, error) {
+	o.failures++
+}
+
+func TestObserverPolicy(t *testing.T) {
+	errPre, errPost := errors.New("Preflight"), errors.New("Postflight")
+	cxt := context.Background()
+	base := WithBaseURL(fmt.Sprintf("http://%s/", service.Addr()))
+
+	t.Run("Fail closed", func(t *testing.T) {
+		a, b := &countingObserver{pre: errPre}, &countingObserver{}
+		client, err := New(base, WithObservers(a, b))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = client.Get(cxt, "/status/200", nil)
+		assert.ErrorIs(t, err, errPre)
+		for _, e := range []*countingObserver{a, b} { // every observer runs and observes the failure
+			assert.Equal(t, 1, e.preflights)
+			assert.Equal(t, 0, e.postflight)
+			assert.Equal(t, 1, e.failures)
+		}
+
+		a, b = &countingObserver{post: errPost}, &countingObserver{}
+		client, err = New(base, WithObservers(a, b))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = client.Get(cxt, "/status/200", nil)
+		assert.ErrorIs(t, err, errPost)
+		for _, e := range []*countingObserver{a, b} {
+			assert.Equal(t, 1, e.postflight)
+			assert.Equal(t, 1, e.failures)
+		}
+	})
+
+	t.Run("Fail open", func(t *testing.T) {
+		a, b := &countingObserver{pre: errPre, post: errPost}, &countingObserver{}
+		client, err := New(base, WithObservers(a, b), WithObserverPolicy(FailOpen))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = client.Get(cxt, "/status/200", nil)
+		assert.NoError(t, err)
+		for _, e := range []*countingObserver{a, b} {
+			assert.Equal(t, 1, e.preflights)
+			assert.Equal(t, 1, e.postflight)
+			assert.Equal(t, 0, e.failures)
+		}
+	})
+
+	t.Run("Per observer", func(t *testing.T) {
+		a, b := &countingObserver{pre: errPre}, &countingObserver{post: errPost}
+		client, err := New(base, WithObservers(ObserverWithPolicy(a, FailOpen), b))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = client.Get(cxt, "/status/200", nil)
+		assert.ErrorIs(t, err, errPost)
+		assert.NotErrorIs(t, err, errPre)
+
+		client, err = New(base, WithObservers(a, ObserverWithPolicy(b, FailOpen)), WithObserverPolicy(FailOpen))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = client.Get(cxt, "/status/200", nil)
+		assert.NoError(t, err)
+	})
+}
+
+// An observer which verifies that every request it sees in preflight is
+// concluded with the same request
+type pairingObserver struct {
+	sync.Mutex
+	pending   map[*http.Request]struct{}
+	unmatched int
+	failures  int
+}
+
+func (o *pairingObserver) Preflight(req *http.Request) error {
+	o.Lock()
+	defer o.Unlock()
+	if o.pending == nil {
+		o.pending = make(map[*http.Request]struct{})
+	}
+	o.pending[req] = struct{}{}
+	return nil
+}
+
+func (o *pairingObserver) Postflight(req *http.Request, rsp *http.Response) error {
+	o.conclude(req)
+	return nil
+}
+
+func (o *pairingObserver) Failure(req *http.Request, err error) {
+	o.conclude(req)
+	o.Lock()
+	defer o.Unlock()
+	o.failures++
+}
+
+func (o *pairingObserver) conclude(req *http.Request) {
+	o.Lock()
+	defer o.Unlock()
+	if _, ok := o.pending[req]; !ok {
+		o.unmatched++
+	}
+	delete(o.pending, req)
+}
+
+func TestObserverPairing(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+	cxt := context.Background()
+
+	t.Run("Singleflight", func(t *testing.T) {
+		o := &pairingObserver{}
+		client, err := New(WithBaseURL(s.URL), WithObservers(o), WithSingleflight())
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = client.Get(cxt, "/missing", nil)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, 1, o.failures)
+		assert.Equal(t, 0, o.unmatched)
+		assert.Len(t, o.pending, 0)
+	})
+
+	t.Run("Failover", func(t *testing.T) {
+		o := &pairingObserver{}
+		client, err := New(WithBaseURLs(s.URL+"/a/", s.URL+"/b/"), WithFailover(Failover{Status: []int{http.StatusNotFound}}), WithObservers(o))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = client.Get(cxt, "missing", nil)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, 2, o.failures, "each base URL is observed")
+		assert.Equal(t, 0, o.unmatched)
+		assert.Len(t, o.pending, 0)
+	})
+}
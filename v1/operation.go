@@ -0,0 +1,271 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrNoOperation     = errors.New("Accepted response does not identify an operation")
+	ErrOperationFailed = errors.New("Operation failed")
+)
+
+// The headers which identify the endpoint that reports the status of a
+// long-running operation, in order of preference
+var OperationHeaders = []string{"Operation-Location", "Azure-AsyncOperation", "Location"}
+
+var (
+	defaultOperationSucceeded = []string{"succeeded", "success", "successful", "completed", "complete", "done"}
+	defaultOperationFailed    = []string{"failed", "failure", "canceled", "cancelled", "error"}
+)
+
+// Operation configuration applies to following long-running operations with
+// ExecOperation and FollowOperation
+type OperationConfig struct {
+	StatusField string
+	Succeeded   []string
+	Failed      []string
+	ResultField string
+	Poll        []PollOption
+	Options     []Option
+}
+
+func (c OperationConfig) WithOptions(opts []OperationOption) OperationConfig {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type OperationOption func(OperationConfig) OperationConfig
+
+// WithStatusField sets the path of the field which reports the state of an
+// operation in the responses of its status endpoint, and the states which
+// indicate that it succeeded or failed; any other state indicates that it is
+// still running. States are compared without regard to case. By default, the
+// field is "status" and the common terminal states are recognized.
+func WithStatusField(path string, succeeded, failed []string) OperationOption {
+	return func(c OperationConfig) OperationConfig {
+		c.StatusField = path
+		c.Succeeded, c.Failed = succeeded, failed
+		return c
+	}
+}
+
+// WithResultField sets the path of the field which contains the result of an
+// operation in the final response of its status endpoint, for services which
+// embed the result in the operation rather than providing its location.
+func WithResultField(path string) OperationOption {
+	return func(c OperationConfig) OperationConfig {
+		c.ResultField = path
+		return c
+	}
+}
+
+// WithOperationPolling sets the options used to poll the status endpoint of
+// an operation. Any condition set with Until is ignored, since polling ends
+// when the operation reaches a terminal state.
+func WithOperationPolling(opts ...PollOption) OperationOption {
+	return func(c OperationConfig) OperationConfig {
+		c.Poll = append(c.Poll, opts...)
+		return c
+	}
+}
+
+// WithOperationRequestOptions sets per-request options which are used to
+// perform every request made while following an operation.
+func WithOperationRequestOptions(opts ...Option) OperationOption {
+	return func(c OperationConfig) OperationConfig {
+		c.Options = append(c.Options, opts...)
+		return c
+	}
+}
+
+// ExecOperation performs a request which may start a long-running operation
+// and unmarshals its result into an entity, following the operation as
+// FollowOperation does.
+func (c *Client) ExecOperation(req *http.Request, entity interface{}, opts ...OperationOption) (*http.Response, error) {
+	conf := OperationConfig{}.WithOptions(opts)
+	rsp, err := c.Exec(req, nil, append(append([]Option(nil), conf.Options...), WithRawBody())...)
+	if err != nil {
+		return nil, err
+	}
+	return c.FollowOperation(req.Context(), rsp, entity, opts...)
+}
+
+// FollowOperation follows the long-running operation started by a request
+// which produced a 202 Accepted response, and unmarshals its result into an
+// entity. A response with any other status is not an operation; it is
+// unmarshaled into the entity directly.
+//
+// The operation's status endpoint is identified by the first of the
+// OperationHeaders present in the response, and it is polled until the
+// operation reaches a terminal state: either its status field reports that it
+// succeeded or failed, or a response without a status field and with a status
+// other than 202 Accepted is produced, which is taken to be the result. An
+// operation which failed produces an error which wraps ErrOperationFailed.
+//
+// The result of an operation which succeeded is the result field of its final
+// status, if one is configured; otherwise, the resource identified by the
+// Location header of the original response, if it differs from the status
+// endpoint; otherwise, the final status itself. The returned response is that
+// which produced the result, with its body consumed.
+func (c *Client) FollowOperation(cxt context.Context, rsp *http.Response, entity interface{}, opts ...OperationOption) (*http.Response, error) {
+	conf := OperationConfig{
+		StatusField: "status",
+		Succeeded:   defaultOperationSucceeded,
+		Failed:      defaultOperationFailed,
+	}.WithOptions(opts)
+	if rsp.StatusCode != http.StatusAccepted {
+		return rsp, unmarshalOperation(rsp, entity, "")
+	}
+	rsp.Body.Close()
+
+	monitor, result, err := operationLocations(rsp)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(cxt, http.MethodGet, monitor, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var state string
+	var terminal bool
+	popts := append(append([]PollOption(nil), conf.Poll...), WithPollRequestOptions(conf.Options...), Until(func(rsp *http.Response) (bool, error) {
+		if rsp.StatusCode == http.StatusAccepted {
+			return false, nil
+		}
+		state, terminal = conf.state(rsp)
+		return terminal || state == "", nil
+	}))
+	rsp, err = c.Poll(cxt, req, popts...)
+	if err != nil {
+		return nil, err
+	}
+	if conf.failed(state) {
+		return nil, Errorf(rsp.StatusCode, "Operation ended in state: %s", state).SetRequest(req).SetEntityFromResponse(rsp).SetCause(ErrOperationFailed)
+	}
+
+	if conf.ResultField != "" || result == "" || state == "" {
+		return rsp, unmarshalOperation(rsp, entity, conf.ResultField)
+	}
+	rsp.Body.Close()
+	req, err = http.NewRequestWithContext(cxt, http.MethodGet, result, nil)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err = c.Exec(req, nil, append(append([]Option(nil), conf.Options...), WithRawBody())...)
+	if err != nil {
+		return nil, err
+	}
+	return rsp, unmarshalOperation(rsp, entity, "")
+}
+
+// Determine the state of an operation from a response of its status endpoint
+// and whether it is terminal. A response which does not report a state
+// produces the empty string.
+func (c OperationConfig) state(rsp *http.Response) (string, bool) {
+	data, err := io.ReadAll(rsp.Body)
+	rsp.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil || c.StatusField == "" {
+		return "", false
+	}
+	var src any
+	if json.Unmarshal(data, &src) != nil {
+		return "", false
+	}
+	val, err := extractPath(src, splitPath(c.StatusField))
+	if err != nil || val == nil {
+		return "", false
+	}
+	state := fmt.Sprint(val)
+	return state, c.succeeded(state) || c.failed(state)
+}
+
+func (c OperationConfig) succeeded(state string) bool {
+	return containsFold(c.Succeeded, state)
+}
+
+func (c OperationConfig) failed(state string) bool {
+	return containsFold(c.Failed, state)
+}
+
+func containsFold(set []string, v string) bool {
+	for _, e := range set {
+		if strings.EqualFold(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Determine the status endpoint of an operation from an accepted response and
+// the location of its result, if it is provided separately, resolved against
+// the URL of the request
+func operationLocations(rsp *http.Response) (string, string, error) {
+	var base *url.URL
+	if rsp.Request != nil {
+		base = rsp.Request.URL
+	}
+	var monitor string
+	for _, e := range OperationHeaders {
+		if v := rsp.Header.Get(e); v != "" {
+			monitor = v
+			break
+		}
+	}
+	if monitor == "" {
+		return "", "", ErrNoOperation
+	}
+	monitor, err := resolveLocation(base, monitor)
+	if err != nil {
+		return "", "", err
+	}
+	result := rsp.Header.Get("Location")
+	if result != "" {
+		result, err = resolveLocation(base, result)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if result == monitor {
+		result = ""
+	}
+	return monitor, result, nil
+}
+
+func resolveLocation(base *url.URL, v string) (string, error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		return "", fmt.Errorf("Could not parse operation location: %w", err)
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	return u.String(), nil
+}
+
+// Unmarshal the result of an operation into an entity, if there is one
+func unmarshalOperation(rsp *http.Response, entity interface{}, field string) error {
+	if entity == nil {
+		io.Copy(io.Discard, rsp.Body)
+		rsp.Body.Close()
+		return nil
+	}
+	if field != "" {
+		entity = Extract(field, entity)
+	}
+	err := Unmarshal(rsp, entity)
+	if err != nil {
+		return fmt.Errorf("Could not unmarshal operation result: %w", err)
+	}
+	return nil
+}
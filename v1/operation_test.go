@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperation(t *testing.T) {
+	var lock sync.Mutex
+	polls := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		polls[req.URL.Path]++
+		n := polls[req.URL.Path]
+		lock.Unlock()
+		hdr := rsp.Header()
+		switch req.URL.Path {
+		case "/sync":
+			hdr.Set("Content-Type", "application/json")
+			rsp.Write([]byte(`{"name":"sync"}`))
+		case "/azure":
+			hdr.Set("Operation-Location", "/operations/1")
+			hdr.Set("Location", "/things/1")
+			rsp.WriteHeader(http.StatusAccepted)
+		case "/operations/1":
+			hdr.Set("Content-Type", "application/json")
+			if n < 3 {
+				hdr.Set("Retry-After", "0")
+				rsp.Write([]byte(`{"status":"Running"}`))
+			} else {
+				rsp.Write([]byte(`{"status":"Succeeded"}`))
+			}
+		case "/things/1":
+			hdr.Set("Content-Type", "application/json")
+			rsp.Write([]byte(`{"name":"azure"}`))
+		case "/failed":
+			hdr.Set("Location", "/operations/2")
+			rsp.WriteHeader(http.StatusAccepted)
+		case "/operations/2":
+			hdr.Set("Content-Type", "application/json")
+			rsp.Write([]byte(`{"status":"Failed","error":"Boom"}`))
+		case "/embedded":
+			hdr.Set("Location", "operations/3")
+			rsp.WriteHeader(http.StatusAccepted)
+		case "/operations/3":
+			hdr.Set("Content-Type", "application/json")
+			if n < 2 {
+				rsp.Write([]byte(`{"done":false}`))
+			} else {
+				rsp.Write([]byte(`{"done":true,"response":{"name":"embedded"}}`))
+			}
+		case "/plain":
+			hdr.Set("Location", "/jobs/4")
+			rsp.WriteHeader(http.StatusAccepted)
+		case "/jobs/4":
+			if n < 2 {
+				rsp.WriteHeader(http.StatusAccepted)
+				return
+			}
+			hdr.Set("Content-Type", "application/json")
+			rsp.Write([]byte(`{"name":"plain"}`))
+		case "/unidentified":
+			rsp.WriteHeader(http.StatusAccepted)
+		default:
+			rsp.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	fast := WithOperationPolling(WithPollInterval(time.Millisecond, time.Millisecond))
+
+	type thing struct {
+		Name string `json:"name"`
+	}
+	tests := []struct {
+		Path   string
+		Opts   []OperationOption
+		Expect string
+		Err    error
+	}{
+		{"/sync", nil, "sync", nil},
+		{"/azure", nil, "azure", nil},
+		{"/failed", nil, "", ErrOperationFailed},
+		{"/embedded", []OperationOption{WithStatusField("done", []string{"true"}, nil), WithResultField("response")}, "embedded", nil},
+		{"/plain", nil, "plain", nil},
+		{"/unidentified", nil, "", ErrNoOperation},
+	}
+	for _, e := range tests {
+		req, err := http.NewRequestWithContext(cxt, http.MethodPost, e.Path, nil)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		var res thing
+		_, err = client.ExecOperation(req, &res, append(e.Opts, fast)...)
+		if e.Err != nil {
+			assert.ErrorIs(t, err, e.Err, e.Path)
+		} else if assert.NoError(t, err, e.Path) {
+			assert.Equal(t, e.Expect, res.Name, e.Path)
+		}
+	}
+
+	lock.Lock()
+	assert.Equal(t, 3, polls["/operations/1"])
+	assert.Equal(t, 1, polls["/things/1"])
+	assert.Equal(t, 2, polls["/operations/3"])
+	lock.Unlock()
+}
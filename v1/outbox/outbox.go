@@ -0,0 +1,141 @@
+// Package outbox delivers requests at least once, for services which forward
+// webhooks or events to other services. A request is journaled to a store
+// before it is sent and removed from the store once it has been delivered, and
+// requests which remain in the store when a program exits are delivered when
+// an outbox is next opened on the same store.
+//
+// Every request carries an idempotency key, so a service which supports them
+// performs a request which is delivered more than once, such as one which was
+// sent just before a program exited, only once. A request which is sent with
+// the key of a request that has not yet been delivered is not journaled again.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	api "github.com/bww/go-apiclient/v1"
+	"github.com/bww/go-apiclient/v1/queue"
+)
+
+type Config struct {
+	Workers    int
+	Capacity   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	DeadLetter func(*queue.Entry, error)
+}
+
+func (c Config) WithOptions(opts []Option) Config {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type Option func(Config) Config
+
+// WithWorkers sets the number of requests which are delivered concurrently
+func WithWorkers(n int) Option {
+	return func(c Config) Config {
+		c.Workers = n
+		return c
+	}
+}
+
+// WithCapacity sets the number of requests which may wait to be delivered.
+// Once it is reached, Send fails with api.ErrQueueFull.
+func WithCapacity(n int) Option {
+	return func(c Config) Config {
+		c.Capacity = n
+		return c
+	}
+}
+
+// WithBackoff sets the initial delay before a request which could not be
+// delivered is sent again, and the longest delay it may increase to.
+func WithBackoff(d, max time.Duration) Option {
+	return func(c Config) Config {
+		c.Backoff = d
+		c.MaxBackoff = max
+		return c
+	}
+}
+
+// WithDeadLetter sets a function which is called with a request that the
+// service rejected, before it is removed from the outbox. A request which
+// fails for any other reason is never given up on.
+func WithDeadLetter(fn func(*queue.Entry, error)) Option {
+	return func(c Config) Config {
+		c.DeadLetter = fn
+		return c
+	}
+}
+
+// An outbox delivers requests in the background
+type Outbox struct {
+	client *api.Client
+	store  queue.Store
+}
+
+// New opens an outbox which delivers requests with the provided client and
+// journals them to a store. Requests which remain in the store from a
+// previous run are delivered immediately. A store must not be shared by more
+// than one outbox at a time.
+func New(client *api.Client, store queue.Store, opts ...Option) (*Outbox, error) {
+	conf := Config{}.WithOptions(opts)
+	c, err := client.Clone(api.WithQueue(api.Queue{
+		Workers:    conf.Workers,
+		Capacity:   conf.Capacity,
+		Backoff:    conf.Backoff,
+		MaxBackoff: conf.MaxBackoff,
+		Store:      store,
+		Durable:    true,
+		Failed:     conf.DeadLetter,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	c.StartQueue()
+	return &Outbox{
+		client: c,
+		store:  store,
+	}, nil
+}
+
+// Send journals a request and delivers it in the background. The returned
+// handle reports when the request has been delivered. The request is
+// identified by the provided idempotency key; when it is empty, a key is
+// generated, in which case a request which is sent again by the caller is
+// delivered again. A request which represents something with an identity of
+// its own, such as an event, should use a key derived from that identity.
+func (o *Outbox) Send(req *http.Request, key string, opts ...api.Option) (*api.Enqueued, error) {
+	if key == "" {
+		key = newKey()
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(api.IdempotencyKeyHeader, key)
+	return o.client.Enqueue(req, opts...)
+}
+
+// Pending lists the requests which have been journaled but not yet delivered
+func (o *Outbox) Pending(cxt context.Context) ([]*queue.Entry, error) {
+	return o.store.List(cxt)
+}
+
+// Close stops delivering requests. Requests which have not been delivered
+// remain in the store and are delivered when an outbox is next opened on it.
+// The client the outbox was created with is unaffected.
+func (o *Outbox) Close() error {
+	o.client.StopQueue()
+	return nil
+}
+
+func newKey() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,162 @@
+package outbox
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/bww/go-apiclient/v1"
+	"github.com/bww/go-apiclient/v1/queue"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	var lock sync.Mutex
+	var received []string
+	var failures atomic.Int64
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/flaky":
+			if failures.Add(1) <= 5 {
+				rsp.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		case "/invalid":
+			rsp.WriteHeader(http.StatusBadRequest)
+			return
+		case "/blocked":
+			select {
+			case <-block:
+			case <-req.Context().Done():
+				return
+			}
+		}
+		data, _ := io.ReadAll(req.Body)
+		lock.Lock()
+		received = append(received, req.URL.Path+":"+string(data)+":"+req.Header.Get(api.IdempotencyKeyHeader))
+		lock.Unlock()
+		rsp.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer close(block)
+
+	client, err := api.New(api.WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	newRequest := func(path, body string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		return req
+	}
+	reset := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		r := received
+		received = nil
+		return r
+	}
+
+	t.Run("Deliver", func(t *testing.T) {
+		var dead []string
+		box, err := New(client, queue.NewMemory(), WithBackoff(time.Millisecond, time.Millisecond*5), WithDeadLetter(func(e *queue.Entry, err error) {
+			dead = append(dead, e.ID)
+		}))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer box.Close()
+
+		h, err := box.Send(newRequest("/flaky", "A"), "a") // retried beyond the default number of retries
+		if assert.NoError(t, err) && assert.NoError(t, h.Wait(cxt)) {
+			assert.Equal(t, "a", h.ID())
+			assert.Equal(t, int64(6), failures.Load())
+		}
+
+		h, err = box.Send(newRequest("/invalid", "B"), "b") // rejected and not retried
+		if assert.NoError(t, err) {
+			assert.ErrorIs(t, h.Wait(cxt), api.ErrBadRequest)
+			assert.Equal(t, []string{"b"}, dead)
+		}
+
+		pending, err := box.Pending(cxt)
+		if assert.NoError(t, err) {
+			assert.Len(t, pending, 0)
+		}
+		assert.Equal(t, []string{"/flaky:A:a"}, reset())
+	})
+
+	t.Run("Deduplicate", func(t *testing.T) {
+		box, err := New(client, queue.NewMemory(), WithWorkers(1))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer box.Close()
+
+		a, err := box.Send(newRequest("/blocked", "A"), "a")
+		assert.NoError(t, err)
+		b, err := box.Send(newRequest("/blocked", "B"), "a")
+		assert.NoError(t, err)
+		assert.Same(t, a, b)
+
+		pending, err := box.Pending(cxt)
+		if assert.NoError(t, err) && assert.Len(t, pending, 1) {
+			assert.Equal(t, "a", pending[0].ID)
+			assert.Equal(t, "A", string(pending[0].Body))
+		}
+
+		c, err := box.Send(newRequest("/ok", "C"), "")
+		assert.NoError(t, err)
+		assert.NotEqual(t, a.ID(), c.ID())
+		a.Cancel()
+		assert.ErrorIs(t, a.Wait(cxt), context.Canceled)
+		assert.NoError(t, c.Wait(cxt))
+		assert.Equal(t, []string{"/ok:C:" + c.ID()}, reset())
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		store, err := queue.NewDisk(t.TempDir())
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		box, err := New(client, store, WithWorkers(1))
+		if !assert.NoError(t, err) {
+			return
+		}
+		a, err := box.Send(newRequest("/blocked", "A"), "a")
+		assert.NoError(t, err)
+		b, err := box.Send(newRequest("/ok", "B"), "b")
+		assert.NoError(t, err)
+		box.Close() // neither request has been delivered, so both remain journaled
+		assert.ErrorIs(t, a.Wait(cxt), api.ErrQueueClosed)
+		assert.ErrorIs(t, b.Wait(cxt), api.ErrQueueClosed)
+
+		store.Delete(cxt, "a") // don't wait on the blocked request again
+		box, err = New(client, store)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer box.Close()
+		for {
+			pending, err := box.Pending(cxt)
+			if !assert.NoError(t, err) || len(pending) == 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, []string{"/ok:B:b"}, reset())
+	})
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/bww/go-apiclient/v1/httputil"
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// ErrPageLimit is produced when a paginated collection has more pages or
+// items than the limits set for collecting it
+var ErrPageLimit = errors.New("Page limit reached")
+
+// Page configuration applies to collecting a paginated collection with
+// CollectPages and StreamPages
+type PageConfig struct {
+	MaxPages   int
+	MaxItems   int
+	Checkpoint Checkpointer
+	Options    []Option
+}
+
+func (c PageConfig) WithOptions(opts []PageOption) PageConfig {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type PageOption func(PageConfig) PageConfig
+
+// WithMaxPages limits the number of pages which are fetched. A collection
+// which has more pages produces ErrPageLimit once the items of the pages which
+// were fetched have been produced.
+func WithMaxPages(n int) PageOption {
+	return func(c PageConfig) PageConfig {
+		c.MaxPages = n
+		return c
+	}
+}
+
+// WithMaxItems limits the number of items which are produced. A collection
+// which has more items produces ErrPageLimit once the limit is reached.
+func WithMaxItems(n int) PageOption {
+	return func(c PageConfig) PageConfig {
+		c.MaxItems = n
+		return c
+	}
+}
+
+// WithCheckpoint persists the progress of a collection with a checkpointer,
+// so that collecting it may resume from the page after the last one which was
+// completed rather than starting over. A page is completed once each of its
+// items has been produced and the next item is requested.
+func WithCheckpoint(cp Checkpointer) PageOption {
+	return func(c PageConfig) PageConfig {
+		c.Checkpoint = cp
+		return c
+	}
+}
+
+// WithPageRequestOptions sets per-request options which are used to fetch
+// each page.
+func WithPageRequestOptions(opts ...Option) PageOption {
+	return func(c PageConfig) PageConfig {
+		c.Options = append(c.Options, opts...)
+		return c
+	}
+}
+
+// A function which identifies the next page of a collection from a page and
+// the response which produced it. It returns false if there is no next page.
+type NextPageFunc[P any] func(P, *http.Response) (string, bool)
+
+// CollectPages fetches every page of a paginated collection and produces the
+// items of all of them. The first page is fetched from u and each page is
+// unmarshaled into a P, from which extract produces its items. The next page
+// is identified by next, which may use a cursor in the page or its response;
+// when next is nil, the "next" link in the Link header of the response is
+// followed. Relative page URLs are resolved against the URL of the page which
+// referred to them.
+//
+// If a page cannot be fetched, the items which were collected before it are
+// returned along with the error.
+func CollectPages[P, T any](cxt context.Context, client *Client, u string, extract func(P) []T, next NextPageFunc[P], opts ...PageOption) ([]T, error) {
+	iter := StreamPages(cxt, client, u, extract, next, opts...)
+	var res []T
+	for {
+		e, err := iter.Next()
+		if errors.Is(err, siter.ErrClosed) {
+			return res, nil
+		} else if err != nil {
+			return res, err
+		}
+		res = append(res, e)
+	}
+}
+
+// StreamPages produces the items of a paginated collection as it is
+// iterated, in the same manner as CollectPages. Each page is fetched only
+// once the items of the previous page have been consumed.
+func StreamPages[P, T any](cxt context.Context, client *Client, u string, extract func(P) []T, next NextPageFunc[P], opts ...PageOption) *PageIterator[P, T] {
+	return &PageIterator[P, T]{
+		cxt:     cxt,
+		client:  client,
+		conf:    PageConfig{}.WithOptions(opts),
+		next:    u,
+		extract: extract,
+		nextfn:  next,
+	}
+}
+
+// A page iterator produces the items of a paginated collection
+type PageIterator[P, T any] struct {
+	cxt     context.Context
+	client  *Client
+	conf    PageConfig
+	next    string
+	extract func(P) []T
+	nextfn  NextPageFunc[P]
+	buf     []T
+	pages   int
+	items   int
+	resumed bool
+	err     error
+}
+
+func (t *PageIterator[P, T]) Meta() siter.Meta {
+	return siter.Meta{}
+}
+
+// Next produces the next item of the collection. Once every item has been
+// produced, siter.ErrClosed is returned. An error which ends iteration is
+// returned by every subsequent call.
+func (t *PageIterator[P, T]) Next() (T, error) {
+	var zero T
+	for len(t.buf) == 0 {
+		if t.err != nil {
+			return zero, t.err
+		}
+		t.err = t.fetch()
+	}
+	if t.conf.MaxItems > 0 && t.items >= t.conf.MaxItems {
+		t.buf, t.err = nil, fmt.Errorf("%w: %d items", ErrPageLimit, t.conf.MaxItems)
+		return zero, t.err
+	}
+	e := t.buf[0]
+	t.buf = t.buf[1:]
+	t.items++
+	return e, nil
+}
+
+// Close ends iteration; no further pages are fetched
+func (t *PageIterator[P, T]) Close() {
+	t.buf, t.err = nil, siter.ErrClosed
+}
+
+// Fetch the next page, if there is one. The error which ends iteration is
+// produced once there are no more pages.
+func (t *PageIterator[P, T]) fetch() error {
+	if c := t.conf.Checkpoint; c != nil {
+		err := t.checkpoint(c)
+		if err != nil {
+			return err
+		}
+	}
+	if t.next == "" {
+		return siter.ErrClosed
+	}
+	if t.conf.MaxPages > 0 && t.pages >= t.conf.MaxPages {
+		return fmt.Errorf("%w: %d pages", ErrPageLimit, t.conf.MaxPages)
+	}
+	u := t.next
+	t.next = ""
+	t.pages++
+
+	var page P
+	rsp, err := t.client.Get(t.cxt, u, &page, t.conf.Options...)
+	if err != nil {
+		return fmt.Errorf("Could not fetch page %d: %w", t.pages, err)
+	}
+	t.buf = t.extract(page)
+
+	var next string
+	if t.nextfn != nil {
+		var ok bool
+		if next, ok = t.nextfn(page, rsp); !ok {
+			next = ""
+		}
+	} else {
+		next, err = httputil.NextPage(rsp)
+		if err != nil {
+			return fmt.Errorf("Could not parse page links: %w", err)
+		}
+	}
+	if next != "" && rsp.Request != nil && rsp.Request.URL != nil {
+		ref, err := url.Parse(next)
+		if err != nil {
+			return fmt.Errorf("Could not parse next page: %w", err)
+		}
+		next = rsp.Request.URL.ResolveReference(ref).String()
+	}
+	t.next = next
+	return nil
+}
+
+// Resume from the checkpoint before the first page is fetched; thereafter,
+// record that the pages which were fetched have been completed
+func (t *PageIterator[P, T]) checkpoint(c Checkpointer) error {
+	if !t.resumed {
+		t.resumed = true
+		u, err := c.Load(t.cxt)
+		if err != nil {
+			return fmt.Errorf("Could not load checkpoint: %w", err)
+		}
+		if u != "" {
+			t.next = u
+		}
+		return nil
+	}
+	err := c.Save(t.cxt, t.next)
+	if err != nil {
+		return fmt.Errorf("Could not save checkpoint: %w", err)
+	}
+	return nil
+}
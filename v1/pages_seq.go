@@ -0,0 +1,26 @@
+//go:build go1.23
+
+package api
+
+import (
+	"errors"
+	"iter"
+
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// All produces the remaining items of the collection as a sequence. An error
+// which ends iteration is produced with the zero value as the last element of
+// the sequence.
+func (t *PageIterator[P, T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for {
+			e, err := t.Next()
+			if errors.Is(err, siter.ErrClosed) {
+				return
+			} else if !yield(e, err) || err != nil {
+				return
+			}
+		}
+	}
+}
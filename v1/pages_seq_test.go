@@ -0,0 +1,38 @@
+//go:build go1.23
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagesSeq(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.Header().Set("Content-Type", "application/json")
+		if req.URL.Query().Get("page") == "" {
+			rsp.Header().Set("Link", `</?page=1>; rel="next"`)
+			rsp.Write([]byte(`{"items":[1,2]}`))
+		} else {
+			rsp.Write([]byte(`{"items":[3]}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var res []int
+	for v, err := range StreamPages(context.Background(), client, "/", func(p testPage) []int { return p.Items }, nil).All() {
+		if assert.NoError(t, err) {
+			res = append(res, v)
+		}
+	}
+	assert.Equal(t, []int{1, 2, 3}, res)
+}
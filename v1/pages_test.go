@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPage struct {
+	Items  []int  `json:"items"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+func TestPages(t *testing.T) {
+	var fetched int
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		fetched++
+		n, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		page := testPage{Items: []int{n * 2, n*2 + 1}}
+		if n < 2 {
+			switch req.URL.Path {
+			case "/links":
+				rsp.Header().Set("Link", fmt.Sprintf(`<links?page=%d>; rel="next"`, n+1))
+			case "/cursors":
+				page.Cursor = strconv.Itoa(n + 1)
+			}
+		}
+		rsp.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(rsp, `{"items":[%d,%d],"cursor":%q}`, page.Items[0], page.Items[1], page.Cursor)
+	}))
+	defer server.Close()
+
+	client, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt := context.Background()
+	items := func(p testPage) []int { return p.Items }
+	cursor := func(p testPage, rsp *http.Response) (string, bool) {
+		return "/cursors?page=" + p.Cursor, p.Cursor != ""
+	}
+
+	t.Run("Links", func(t *testing.T) {
+		fetched = 0
+		res, err := CollectPages(cxt, client, "/links", items, nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, res)
+			assert.Equal(t, 3, fetched)
+		}
+	})
+
+	t.Run("Cursors", func(t *testing.T) {
+		fetched = 0
+		res, err := CollectPages(cxt, client, "/cursors", items, cursor)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, res)
+			assert.Equal(t, 3, fetched)
+		}
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		res, err := CollectPages(cxt, client, "/links", items, nil, WithMaxPages(2))
+		assert.ErrorIs(t, err, ErrPageLimit)
+		assert.Equal(t, []int{0, 1, 2, 3}, res)
+
+		res, err = CollectPages(cxt, client, "/links", items, nil, WithMaxPages(3))
+		assert.NoError(t, err)
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, res)
+
+		res, err = CollectPages(cxt, client, "/cursors", items, cursor, WithMaxItems(3))
+		assert.ErrorIs(t, err, ErrPageLimit)
+		assert.Equal(t, []int{0, 1, 2}, res)
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		fetched = 0
+		iter := StreamPages(cxt, client, "/links", items, nil)
+		for i := 0; i < 3; i++ {
+			v, err := iter.Next()
+			if assert.NoError(t, err) {
+				assert.Equal(t, i, v)
+			}
+		}
+		assert.Equal(t, 2, fetched) // pages are fetched as they are needed
+		iter.Close()
+		_, err := iter.Next()
+		assert.Error(t, err)
+		assert.Equal(t, 2, fetched)
+	})
+	t.Run("Checkpoint", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoint")
+		cp := NewFileCheckpointer(path)
+
+		iter := StreamPages(cxt, client, "/links", items, nil, WithCheckpoint(cp))
+		for i := 0; i < 3; i++ {
+			_, err := iter.Next()
+			assert.NoError(t, err)
+		}
+		iter.Close() // interrupted during the second page
+
+		u, err := cp.Load(cxt)
+		if assert.NoError(t, err) {
+			assert.Equal(t, server.URL+"/links?page=1", u)
+		}
+
+		fetched = 0
+		res, err := CollectPages(cxt, client, "/links", items, nil, WithCheckpoint(cp))
+		if assert.NoError(t, err) {
+			assert.Equal(t, []int{2, 3, 4, 5}, res) // resumed from the second page
+			assert.Equal(t, 2, fetched)
+		}
+		_, err = os.Stat(path)
+		assert.ErrorIs(t, err, os.ErrNotExist) // the collection was completed
+
+		fetched = 0
+		res, err = CollectPages(cxt, client, "/links", items, nil, WithCheckpoint(cp))
+		if assert.NoError(t, err) {
+			assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, res)
+			assert.Equal(t, 3, fetched)
+		}
+	})
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-querystring/query"
+
+	"github.com/bww/go-util/v1/ext"
+)
+
+type paramsConfig struct {
+	timeFormat string
+	unixTime   bool
+}
+
+type ParamsOption func(paramsConfig) paramsConfig
+
+// WithTimeFormat sets the layout with which time values are formatted when
+// they are encoded as query parameters; by default, time.RFC3339 is used.
+// Struct fields with an explicit `layout` tag or `unix` option are formatted
+// as they specify.
+func WithTimeFormat(layout string) ParamsOption {
+	return func(c paramsConfig) paramsConfig {
+		c.timeFormat, c.unixTime = layout, false
+		return c
+	}
+}
+
+// WithUnixTime causes time values to be encoded as query parameters as the
+// number of seconds since the Unix epoch.
+func WithUnixTime() ParamsOption {
+	return func(c paramsConfig) paramsConfig {
+		c.timeFormat, c.unixTime = "", true
+		return c
+	}
+}
+
+// URLWithParams encodes the provided parameters and adds them to the query of
+// the provided URL. Any query already present in the URL is preserved and the
+// encoded parameters follow it.
+//
+// Parameters may be url.Values, a map with string keys, or a struct, which is
+// encoded as by github.com/google/go-querystring using `url` tags. The values
+// of a map may be slices, which produce a parameter for each element, and nil
+// values are omitted. A nil pointer produces no parameters.
+func URLWithParams(s string, params interface{}, opts ...ParamsOption) (string, error) {
+	u, err := ParseURLWithParams(s, params, opts...)
+	if err != nil {
+		return s, err
+	}
+	return u.String(), nil
+}
+
+// ParseURLWithParams is like URLWithParams but produces a parsed URL.
+func ParseURLWithParams(s string, params interface{}, opts ...ParamsOption) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	var conf paramsConfig
+	for _, opt := range opts {
+		conf = opt(conf)
+	}
+	q, err := encodeParams(params, conf)
+	if err != nil {
+		return nil, err
+	}
+	if len(q) > 0 {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += q.Encode()
+	}
+	return u, nil
+}
+
+func encodeParams(params interface{}, conf paramsConfig) (url.Values, error) {
+	switch p := params.(type) {
+	case nil:
+		return nil, nil
+	case url.Values:
+		return p, nil
+	case map[string][]string:
+		return url.Values(p), nil
+	}
+	v := reflect.ValueOf(params)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("Cannot encode parameters from %T; map keys must be strings", params)
+		}
+		q := make(url.Values)
+		iter := v.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			for _, e := range paramValues(iter.Value(), conf) {
+				q.Add(k, e)
+			}
+		}
+		return q, nil
+	case reflect.Struct:
+		q, err := query.Values(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		if conf.timeFormat != "" || conf.unixTime {
+			formatTimeFields(q, v, conf)
+		}
+		return q, nil
+	default:
+		return nil, fmt.Errorf("Cannot encode parameters from %T", params)
+	}
+}
+
+// Produce the query values for a single parameter value
+func paramValues(v reflect.Value, conf paramsConfig) []string {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Uint8 { // byte slices are encoded as strings
+			var res []string
+			for i := 0; i < v.Len(); i++ {
+				res = append(res, paramValues(v.Index(i), conf)...)
+			}
+			return res
+		}
+	}
+	return []string{paramValue(v, conf)}
+}
+
+func paramValue(v reflect.Value, conf paramsConfig) string {
+	if v.Type() == typeTime {
+		return formatTime(v.Interface().(time.Time), conf)
+	}
+	switch e := v.Interface().(type) {
+	case []byte:
+		return string(e)
+	case encoding.TextMarshaler:
+		if b, err := e.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func formatTime(t time.Time, conf paramsConfig) string {
+	if conf.unixTime {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return t.Format(ext.Coalesce(conf.timeFormat, time.RFC3339))
+}
+
+// Reformat the time-valued fields of a struct which was encoded by
+// go-querystring, which does not itself support a default layout. Fields
+// which specify how they are formatted are left alone.
+func formatTimeFields(q url.Values, v reflect.Value, conf paramsConfig) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("url")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fv := v.Field(i)
+		for fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if f.Anonymous && name == "" && fv.Kind() == reflect.Struct && fv.Type() != typeTime {
+			formatTimeFields(q, fv, conf)
+			continue
+		}
+		if fv.Kind() != reflect.Struct || fv.Type() != typeTime {
+			continue
+		}
+		if f.Tag.Get("layout") != "" || strings.Contains(","+opts+",", ",unix") {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := q[name]; ok {
+			q.Set(name, formatTime(fv.Interface().(time.Time), conf))
+		}
+	}
+}
+
+// A convenience for Get with query parameters, which are added to any
+// query already present in the URL as by URLWithParams.
+func (c *Client) GetWithParams(cxt context.Context, u string, params, output interface{}, opts ...Option) (*http.Response, error) {
+	u, err := URLWithParams(u, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(cxt, u, output, opts...)
+}
+
+// A convenience for Post with query parameters, which are added to any
+// query already present in the URL as by URLWithParams.
+func (c *Client) PostWithParams(cxt context.Context, u string, params, input, output interface{}, opts ...Option) (*http.Response, error) {
+	u, err := URLWithParams(u, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.Post(cxt, u, input, output, opts...)
+}
+
+// A convenience for Put with query parameters, which are added to any
+// query already present in the URL as by URLWithParams.
+func (c *Client) PutWithParams(cxt context.Context, u string, params, input, output interface{}, opts ...Option) (*http.Response, error) {
+	u, err := URLWithParams(u, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.Put(cxt, u, input, output, opts...)
+}
+
+// A convenience for Patch with query parameters, which are added to any
+// query already present in the URL as by URLWithParams.
+func (c *Client) PatchWithParams(cxt context.Context, u string, params, input, output interface{}, opts ...Option) (*http.Response, error) {
+	u, err := URLWithParams(u, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.Patch(cxt, u, input, output, opts...)
+}
+
+// A convenience for Delete with query parameters, which are added to any
+// query already present in the URL as by URLWithParams.
+func (c *Client) DeleteWithParams(cxt context.Context, u string, params, input, output interface{}, opts ...Option) (*http.Response, error) {
+	u, err := URLWithParams(u, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.Delete(cxt, u, input, output, opts...)
+}
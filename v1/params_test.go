@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithParams(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		query = req.URL.RawQuery
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt := context.Background()
+
+	type params struct {
+		Limit  int    `url:"limit,omitempty"`
+		Cursor string `url:"cursor,omitempty"`
+	}
+
+	tests := []struct {
+		URL    string
+		Params interface{}
+		Expect string
+	}{
+		{"/things", params{Limit: 10}, "limit=10"},
+		{"/things?sort=name", params{Limit: 10, Cursor: "abc"}, "sort=name&cursor=abc&limit=10"},
+		{"/things?sort=name", params{}, "sort=name"},
+		{"/things?sort=name", (*params)(nil), "sort=name"},
+		{"/things?sort=name", nil, "sort=name"},
+	}
+	for _, e := range tests {
+		_, err := client.GetWithParams(cxt, e.URL, e.Params, nil)
+		if assert.NoError(t, err, e.URL) {
+			assert.Equal(t, e.Expect, query, e.URL)
+		}
+	}
+
+	_, err = client.DeleteWithParams(cxt, "/things/1?force=true", params{Cursor: "x"}, nil, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "force=true&cursor=x", query)
+	}
+}
+
+func TestURLWithParams(t *testing.T) {
+	when := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	type embedded struct {
+		Since time.Time `url:"since"`
+	}
+	type params struct {
+		embedded
+		Until  time.Time  `url:"until"`
+		Stamp  time.Time  `url:"stamp,unix"`
+		Custom *time.Time `url:"custom" layout:"2006"`
+		Tags   []string   `url:"tag"`
+	}
+
+	tests := []struct {
+		URL     string
+		Params  interface{}
+		Options []ParamsOption
+		Expect  string
+		Error   bool
+	}{
+		{"/a?x=1", url.Values{"y": {"2", "3"}}, nil, "/a?x=1&y=2&y=3", false},
+		{"/a?x=1", map[string][]string{"y": {"2"}}, nil, "/a?x=1&y=2", false},
+		{"/a", map[string]interface{}{"b": true, "n": 5, "s": []int{1, 2}, "z": nil}, nil, "/a?b=true&n=5&s=1&s=2", false},
+		{"/a", map[string]interface{}{"t": when}, nil, "/a?t=2024-03-01T12%3A00%3A00Z", false},
+		{"/a", map[string]interface{}{"t": when}, []ParamsOption{WithTimeFormat(time.DateOnly)}, "/a?t=2024-03-01", false},
+		{"/a", map[string]time.Time{"t": when}, []ParamsOption{WithUnixTime()}, "/a?t=1709294400", false},
+		{"/a", params{embedded: embedded{when}, Until: when, Stamp: when, Custom: &when, Tags: []string{"x"}}, []ParamsOption{WithTimeFormat(time.DateOnly)}, "/a?custom=2024&since=2024-03-01&stamp=1709294400&tag=x&until=2024-03-01", false},
+		{"/a?x=1", (*params)(nil), nil, "/a?x=1", false},
+		{"/a", map[int]string{1: "a"}, nil, "", true},
+		{"/a", "nope", nil, "", true},
+	}
+	for _, e := range tests {
+		res, err := URLWithParams(e.URL, e.Params, e.Options...)
+		if e.Error {
+			assert.Error(t, err, e.URL)
+		} else if assert.NoError(t, err, e.URL) {
+			assert.Equal(t, e.Expect, res, e.URL)
+		}
+	}
+
+	u, err := ParseURLWithParams("https://example.com/a?x=1", url.Values{"y": {"2"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "x=1&y=2", u.RawQuery)
+		assert.Equal(t, "example.com", u.Host)
+	}
+}
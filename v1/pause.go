@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrPaused = errors.New("Client is paused")
+
+// Pause state is shared by a client and every client derived from it
+type pause struct {
+	sync.Mutex
+	until  time.Time
+	reason string
+	change chan struct{}
+}
+
+func newPause() *pause {
+	return &pause{change: make(chan struct{})}
+}
+
+func (p *pause) Set(until time.Time, reason string) {
+	p.Lock()
+	defer p.Unlock()
+	p.until, p.reason = until, reason
+	close(p.change) // wake anyone waiting on the previous state
+	p.change = make(chan struct{})
+}
+
+func (p *pause) State() (time.Time, string, <-chan struct{}) {
+	p.Lock()
+	defer p.Unlock()
+	return p.until, p.reason, p.change
+}
+
+// Wait until the pause has elapsed, the context is canceled, or, if fail is
+// set, return an error immediately if we are paused.
+func (p *pause) Wait(cxt context.Context, fail bool) error {
+	start := time.Now()
+	for {
+		until, reason, change := p.State()
+		delay := time.Until(until)
+		if delay <= 0 {
+			return nil
+		}
+		if fail {
+			return fmt.Errorf("%w until %v: %s", ErrPaused, until.Format(time.RFC3339), reason)
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-change: // pause was updated; re-evaluate it
+			t.Stop()
+		case <-cxt.Done():
+			t.Stop()
+			return interrupted(cxt, start, 0, "pause: "+reason)
+		}
+	}
+}
+
+// Pause causes subsequent requests performed by this client and any client
+// derived from it to wait until the specified time, or to fail immediately
+// with ErrPaused when the client is configured with WithPauseFailFast. This
+// is intended as an operational lever to stop making requests to a service,
+// for example, during an incident.
+func (c *Client) Pause(until time.Time, reason string) {
+	c.pause.Set(until, reason)
+}
+
+// Resume cancels any pause in effect. Requests waiting on the pause proceed
+// immediately.
+func (c *Client) Resume() {
+	c.pause.Set(time.Time{}, "")
+}
+
+// Paused returns the time until which the client is paused and the reason it
+// was paused, if it is currently paused.
+func (c *Client) Paused() (time.Time, string, bool) {
+	until, reason, _ := c.pause.State()
+	if time.Until(until) <= 0 {
+		return time.Time{}, "", false
+	}
+	return until, reason, true
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/cache"
+
+	"github.com/bww/go-ratelimit/v1"
+	"github.com/bww/go-util/v1/ext"
+)
+
+// NoRetries may be used as a policy's retry statuses to disable retries
+var NoRetries = []int{}
+
+// A policy overrides the client's rate limiting and retry behavior for a
+// subset of requests. Unset fields inherit the client's configuration.
+type Policy struct {
+	// The rate limiter to use; if nil, the client's limiter is used
+	RateLimiter ratelimit.Limiter
+	// The statuses which are retried; if nil, the client's retry statuses are
+	// used. An empty, non-nil slice, such as NoRetries, disables retries.
+	RetryStatus []int
+	// The base retry delay; if zero, the client's retry delay is used
+	RetryDelay time.Duration
+}
+
+// A resolved policy which is applied to a request
+type policy struct {
+	limiter ratelimit.Limiter
+	retry   map[int]struct{}
+	backoff time.Duration
+}
+
+func retrySet(s []int) map[int]struct{} {
+	retry := make(map[int]struct{})
+	for _, e := range s {
+		retry[e] = struct{}{}
+	}
+	return retry
+}
+
+// Resolve a policy relative to a base policy
+func (p Policy) resolve(base policy) policy {
+	res := base
+	if p.RateLimiter != nil {
+		res.limiter = p.RateLimiter
+	}
+	if p.RetryStatus != nil {
+		res.retry = retrySet(p.RetryStatus)
+	}
+	if p.RetryDelay > 0 {
+		res.backoff = p.RetryDelay
+	}
+	return res
+}
+
+// Resolve the policy that applies to a request
+func (c *Client) policyFor(req *http.Request) policy {
+	base := policy{
+		limiter: c.limiter,
+		retry:   c.retry,
+		backoff: c.backoff,
+	}
+	if p, ok := c.methods[strings.ToUpper(req.Method)]; ok {
+		return p.resolve(base)
+	}
+	return base
+}
+
+// A retry budget bounds the number of retries which may be performed by the
+// requests it is used with. A budget may be shared by many requests to bound
+// the total number of retries performed by a batch. A budget is safe for
+// concurrent use.
+type RetryBudget struct {
+	parent    *RetryBudget
+	remaining int64
+}
+
+// NewRetryBudget creates a budget which permits at most n retries
+func NewRetryBudget(n int) *RetryBudget {
+	return &RetryBudget{remaining: int64(n)}
+}
+
+// Limit derives a budget which permits at most n retries, each of which is
+// also drawn from the receiver. This may be used to bound retries both per
+// request and in aggregate.
+func (b *RetryBudget) Limit(n int) *RetryBudget {
+	return &RetryBudget{parent: b, remaining: int64(n)}
+}
+
+// Remaining returns the number of retries remaining in the budget, not
+// accounting for any parent budget.
+func (b *RetryBudget) Remaining() int {
+	return int(max(0, atomic.LoadInt64(&b.remaining)))
+}
+
+// Take consumes one retry from the budget, if any remain
+func (b *RetryBudget) Take() bool {
+	for {
+		n := atomic.LoadInt64(&b.remaining)
+		if n <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.remaining, n, n-1) {
+			break
+		}
+	}
+	if b.parent != nil && !b.parent.Take() {
+		atomic.AddInt64(&b.remaining, 1) // refund; the parent is exhausted
+		return false
+	}
+	return true
+}
+
+// Determine if a request may be retried. A nil budget is unlimited.
+func (b *RetryBudget) allow() bool {
+	return b == nil || b.Take()
+}
+
+// RateLimiterFor returns the rate limiter which applies to the provided
+// request, if any, after any method policy has been resolved.
+func (c *Client) RateLimiterFor(req *http.Request) ratelimit.Limiter {
+	return c.policyFor(req).limiter
+}
+
+// The effective policy which applies to a request, as resolved from the
+// client's configuration, any method policy, and per-request options
+type EffectivePolicy struct {
+	// The rate limiter, if any
+	RateLimiter ratelimit.Limiter
+	// The statuses which are retried
+	RetryStatus []int
+	// The base retry delay
+	RetryDelay time.Duration
+	// The overall timeout of the underlying HTTP client; zero is unbounded
+	Timeout time.Duration
+	// The adaptive timeout which currently applies to each attempt, if any
+	AttemptTimeout time.Duration
+	// The cache in which the response is stored, if any, and the windows in
+	// which a stale cached response may be served
+	Cache                cache.Store
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	// The authorizer, if any
+	Authorizer Authorizer
+}
+
+// PolicyFor returns the policy that would apply to the provided request if
+// it were performed with the provided per-request options. The request is
+// not modified.
+func (c *Client) PolicyFor(req *http.Request, opts ...Option) EffectivePolicy {
+	conf := Config{}.With(opts)
+	rreq := req.Clone(req.Context())
+	rreq.URL = c.resolve(req.URL)
+	pol := c.policyFor(rreq)
+	res := EffectivePolicy{
+		RateLimiter: pol.limiter,
+		RetryStatus: statusList(pol.retry),
+		RetryDelay:  ext.Coalesce(pol.backoff, backoffDefault),
+		Authorizer:  c.auth,
+	}
+	if c.Client != nil {
+		res.Timeout = c.Client.Timeout
+	}
+	if c.latency != nil {
+		res.AttemptTimeout, _ = c.latency.Timeout(rreq)
+	}
+	if store := c.cacheFor(rreq, conf); store != nil {
+		res.Cache = store
+		res.StaleWhileRevalidate = ext.Coalesce(conf.StaleWhileRevalidate, c.swr)
+		res.StaleIfError = ext.Coalesce(conf.StaleIfError, c.sie)
+	}
+	return res
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/cache"
+
+	"github.com/bww/go-ratelimit/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBudget(t *testing.T) {
+	total := NewRetryBudget(3)
+	a, b := total.Limit(2), total.Limit(2)
+
+	assert.True(t, a.Take())
+	assert.True(t, a.Take())
+	assert.False(t, a.Take(), "per-request budget is exhausted")
+	assert.True(t, b.Take())
+	assert.False(t, b.Take(), "shared budget is exhausted")
+	assert.Equal(t, 1, b.Remaining(), "retry is refunded when the parent is exhausted")
+	assert.Equal(t, 0, total.Remaining())
+
+	var unlimited *RetryBudget
+	assert.True(t, unlimited.allow())
+}
+
+func TestPolicyFor(t *testing.T) {
+	lim := ratelimit.NewLinear(ratelimit.Config{Events: 10, Window: time.Second})
+	post := ratelimit.NewLinear(ratelimit.Config{Events: 1, Window: time.Second})
+	auth := NewBearerAuthorizer("token")
+	store := cache.NewMemory()
+	c, err := New(
+		WithBaseURL("https://example.com/v1/"),
+		WithAuthorizer(auth),
+		WithRateLimiter(lim),
+		WithRetryStatus(http.StatusServiceUnavailable, http.StatusBadGateway),
+		WithRetryDelay(time.Second),
+		WithMethodPolicy(http.MethodPost, Policy{RateLimiter: post, RetryStatus: NoRetries}),
+		WithCache(store),
+		WithStaleIfError(time.Minute),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c = c.WithTimeout(time.Second * 30)
+
+	get, _ := http.NewRequest(http.MethodGet, "things", nil)
+	assert.Equal(t, EffectivePolicy{
+		RateLimiter:  lim,
+		RetryStatus:  []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+		RetryDelay:   time.Second,
+		Timeout:      time.Second * 30,
+		Cache:        store,
+		StaleIfError: time.Minute,
+		Authorizer:   auth,
+	}, c.PolicyFor(get))
+	assert.Equal(t, "things", get.URL.String(), "the request must not be modified")
+
+	assert.Equal(t, time.Hour, c.PolicyFor(get, WithStaleWhileRevalidate(time.Hour)).StaleWhileRevalidate)
+	assert.Nil(t, c.PolicyFor(get, WithRawBody()).Cache)
+
+	create, _ := http.NewRequest(http.MethodPost, "things", nil)
+	assert.Equal(t, EffectivePolicy{
+		RateLimiter: post,
+		RetryStatus: []int{},
+		RetryDelay:  time.Second,
+		Timeout:     time.Second * 30,
+		Authorizer:  auth,
+	}, c.PolicyFor(create))
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrPollTimeout is wrapped by the error produced when polling gives up
+// because the condition was not satisfied within the maximum duration.
+var ErrPollTimeout = errors.New("Polling timed out")
+
+const (
+	defaultPollInterval    = time.Second
+	defaultPollMaxInterval = time.Minute
+	defaultPollGrowth      = 2
+)
+
+// Poll configuration applies to polling a resource with Poll
+type PollConfig struct {
+	Interval    time.Duration
+	MaxInterval time.Duration
+	Growth      float64
+	MaxDuration time.Duration
+	Until       func(*http.Response) (bool, error)
+	Options     []Option
+}
+
+func (c PollConfig) WithOptions(opts []PollOption) PollConfig {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type PollOption func(PollConfig) PollConfig
+
+// WithPollInterval sets the initial interval between requests and the
+// longest interval it may grow to; by default, one second and one minute.
+func WithPollInterval(d, max time.Duration) PollOption {
+	return func(c PollConfig) PollConfig {
+		c.Interval, c.MaxInterval = d, max
+		return c
+	}
+}
+
+// WithPollGrowth sets the factor by which the interval between requests grows
+// after each request; by default, 2. A factor of 1 polls at a fixed interval.
+func WithPollGrowth(f float64) PollOption {
+	return func(c PollConfig) PollConfig {
+		c.Growth = f
+		return c
+	}
+}
+
+// WithMaxDuration limits how long a resource is polled for. Once the limit is
+// reached, polling fails with ErrPollTimeout. By default, a resource is
+// polled until its context ends.
+func WithMaxDuration(d time.Duration) PollOption {
+	return func(c PollConfig) PollConfig {
+		c.MaxDuration = d
+		return c
+	}
+}
+
+// Until sets the condition which ends polling. The function may read the
+// response body, which is restored before the response is returned. Polling
+// fails with the error returned by the function, if any.
+func Until(fn func(*http.Response) (bool, error)) PollOption {
+	return func(c PollConfig) PollConfig {
+		c.Until = fn
+		return c
+	}
+}
+
+// UntilStatus ends polling once a response has one of the provided statuses
+func UntilStatus(statuses ...int) PollOption {
+	return Until(func(rsp *http.Response) (bool, error) {
+		return slices.Contains(statuses, rsp.StatusCode), nil
+	})
+}
+
+// UntilField ends polling once the value of a field in a JSON response is
+// equal to one of the provided values. The field is identified by a path, as
+// it is by Extract; a response which does not contain it does not end
+// polling. Values are compared by their JSON representation.
+func UntilField(path string, values ...any) PollOption {
+	components := splitPath(path)
+	return Until(func(rsp *http.Response) (bool, error) {
+		var src any
+		err := json.NewDecoder(rsp.Body).Decode(&src)
+		if err != nil {
+			return false, fmt.Errorf("Could not unmarshal response: %w", err)
+		}
+		val, err := extractPath(src, components)
+		if errors.Is(err, ErrPathNotFound) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		have, err := json.Marshal(val)
+		if err != nil {
+			return false, err
+		}
+		for _, e := range values {
+			want, err := json.Marshal(e)
+			if err != nil {
+				return false, err
+			}
+			if bytes.Equal(have, want) {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// WithPollRequestOptions sets per-request options which are used to perform
+// each request.
+func WithPollRequestOptions(opts ...Option) PollOption {
+	return func(c PollConfig) PollConfig {
+		c.Options = append(c.Options, opts...)
+		return c
+	}
+}
+
+// Poll performs a request repeatedly until its response satisfies a
+// condition, which is useful for endpoints which report the status of a
+// long-running operation. By default, polling ends once the response is not
+// 202 Accepted. The interval between requests grows after each request, up to
+// a maximum; when a response has a Retry-After header, it is used as the
+// interval instead. A request which fails ends polling with its error.
+//
+// The response which satisfies the condition is returned with its body
+// unread.
+func (c *Client) Poll(cxt context.Context, req *http.Request, opts ...PollOption) (*http.Response, error) {
+	conf := PollConfig{
+		Interval:    defaultPollInterval,
+		MaxInterval: defaultPollMaxInterval,
+		Growth:      defaultPollGrowth,
+	}.WithOptions(opts)
+	until := conf.Until
+	if until == nil {
+		until = func(rsp *http.Response) (bool, error) {
+			return rsp.StatusCode != http.StatusAccepted, nil
+		}
+	}
+
+	body := req.GetBody
+	if req.Body != nil && req.Body != http.NoBody && body == nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read request body: %w", err)
+		}
+		body = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+
+	start := time.Now()
+	interval := conf.Interval
+	ropts := append(append([]Option(nil), conf.Options...), WithRawBody())
+	for n := 1; ; n++ {
+		r := req.Clone(cxt)
+		if body != nil {
+			b, err := body()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = b
+		}
+		rsp, err := c.Exec(r, nil, ropts...)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read response: %w", err)
+		}
+		rsp.Body = io.NopCloser(bytes.NewReader(data))
+		done, err := until(rsp)
+		if err != nil {
+			return nil, err
+		} else if done {
+			rsp.Body = io.NopCloser(bytes.NewReader(data))
+			return rsp, nil
+		}
+
+		delay := interval
+		if d, ok := retryAfter(rsp.Header.Get("Retry-After"), time.Now()); ok {
+			delay = d
+		}
+		if conf.MaxDuration > 0 && time.Since(start)+delay > conf.MaxDuration {
+			return nil, Errorf(0, "Condition not satisfied after polling %d times in %v", n, time.Since(start)).SetRequest(req).SetCause(ErrPollTimeout)
+		}
+		err = wait(cxt, delay, "poll")
+		if err != nil {
+			return nil, err
+		}
+		if conf.Growth > 1 {
+			interval = min(time.Duration(float64(interval)*conf.Growth), max(conf.MaxInterval, conf.Interval))
+		}
+	}
+}
+
+// Parse the value of a Retry-After header, which is either a number of
+// seconds or a date
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(n, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoll(t *testing.T) {
+	var polls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		n := polls.Add(1)
+		switch req.URL.Path {
+		case "/accepted":
+			if n < 3 {
+				rsp.Header().Set("Retry-After", "0")
+				rsp.WriteHeader(http.StatusAccepted)
+				return
+			}
+			data, _ := io.ReadAll(req.Body)
+			rsp.WriteHeader(http.StatusOK)
+			rsp.Write(data)
+		case "/status":
+			status := "running"
+			if n >= 3 {
+				status = "done"
+			}
+			rsp.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(rsp, `{"operation":{"status":%q}}`, status)
+		default:
+			rsp.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	t.Run("Accepted", func(t *testing.T) {
+		polls.Store(0)
+		req, err := http.NewRequest(http.MethodPost, "/accepted", io.NopCloser(strings.NewReader("Hello")))
+		if !assert.NoError(t, err) {
+			return
+		}
+		rsp, err := client.Poll(cxt, req, WithPollInterval(time.Hour, time.Hour)) // waits are set by Retry-After
+		if assert.NoError(t, err) {
+			data, err := io.ReadAll(rsp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, "Hello", string(data)) // the request body is sent every time
+			assert.Equal(t, int64(3), polls.Load())
+		}
+	})
+
+	t.Run("Field", func(t *testing.T) {
+		polls.Store(0)
+		req, err := http.NewRequest(http.MethodGet, "/status", nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		rsp, err := client.Poll(cxt, req, WithPollInterval(time.Millisecond, time.Millisecond*2), UntilField("operation.status", "done", "failed"))
+		if assert.NoError(t, err) {
+			var op struct {
+				Operation struct {
+					Status string `json:"status"`
+				} `json:"operation"`
+			}
+			assert.NoError(t, Unmarshal(rsp, &op))
+			assert.Equal(t, "done", op.Operation.Status)
+			assert.Equal(t, int64(3), polls.Load())
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		polls.Store(0)
+		req, err := http.NewRequest(http.MethodGet, "/pending", nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = client.Poll(cxt, req, WithPollInterval(time.Millisecond*10, time.Millisecond*40), WithMaxDuration(time.Millisecond*50))
+		assert.ErrorIs(t, err, ErrPollTimeout)
+		assert.Equal(t, int64(3), polls.Load()) // 10ms, 20ms, then 40ms would exceed the limit
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		Value  string
+		Expect time.Duration
+		OK     bool
+	}{
+		{"", 0, false},
+		{"5", time.Second * 5, true},
+		{"-1", 0, true},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{"soon", 0, false},
+	}
+	for _, e := range tests {
+		d, ok := retryAfter(e.Value, now)
+		assert.Equal(t, e.OK, ok, e.Value)
+		assert.Equal(t, e.Expect, d, e.Value)
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	ErrProxyConnect = errors.New("Could not connect via proxy")
+	ErrNoProxies    = errors.New("No proxies")
+)
+
+// WithProxy routes requests through the proxy at the provided URL. HTTP,
+// HTTPS, and SOCKS5 proxies are supported, e.g., "socks5://localhost:1080".
+// The proxy is configured on a copy of the underlying HTTP client's transport,
+// which must be an *http.Transport or nil; see ErrCustomTransport.
+func WithProxy(u string) Option {
+	return func(c Config) Config {
+		c.Proxy, c.ProxyFunc = u, nil
+		return c
+	}
+}
+
+// WithProxyFunc routes requests through the proxy produced by the provided
+// function for each request, as with http.Transport.Proxy. A nil proxy URL
+// means the request is made directly. See WithProxy.
+func WithProxyFunc(fn func(*http.Request) (*url.URL, error)) Option {
+	return func(c Config) Config {
+		c.Proxy, c.ProxyFunc = "", fn
+		return c
+	}
+}
+
+// Produce the proxy function for a configuration, if any
+func proxyFunc(conf Config) (func(*http.Request) (*url.URL, error), error) {
+	if conf.Proxy != "" {
+		u, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid proxy URL: %v", err)
+		}
+		return http.ProxyURL(u), nil
+	}
+	return conf.ProxyFunc, nil
+}
+
+// A proxy responded to a CONNECT request with a status other than 200 OK
+type proxyRejectedError struct {
+	status string
+}
+
+func (e *proxyRejectedError) Error() string {
+	return "Proxy rejected CONNECT: " + e.status
+}
+
+// Produce a hook for http.Transport.OnProxyConnectResponse which identifies a
+// rejected CONNECT request with a proxyRejectedError, since the transport
+// otherwise reports it as an untyped error. The previous hook, if any, is
+// called first.
+func rejectProxyConnect(prev func(context.Context, *url.URL, *http.Request, *http.Response) error) func(context.Context, *url.URL, *http.Request, *http.Response) error {
+	return func(cxt context.Context, proxy *url.URL, req *http.Request, rsp *http.Response) error {
+		if prev != nil {
+			err := prev(cxt, proxy, req, rsp)
+			if err != nil {
+				return err
+			}
+		}
+		if rsp.StatusCode != http.StatusOK {
+			return &proxyRejectedError{status: rsp.Status}
+		}
+		return nil
+	}
+}
+
+// Determine whether an error occurred while connecting to a proxy: either the
+// proxy could not be reached, it rejected a CONNECT request, or a SOCKS
+// handshake with it failed
+func isProxyErr(err error) bool {
+	var operr *net.OpError
+	if errors.As(err, &operr) && (operr.Op == "proxyconnect" || strings.HasPrefix(operr.Op, "socks ")) {
+		return true
+	}
+	var rejected *proxyRejectedError
+	return errors.As(err, &rejected)
+}
+
+// A proxy pool rotates requests through a set of proxies in turn
+type ProxyPool struct {
+	proxies []*url.URL
+	next    atomic.Uint64
+}
+
+// NewProxyPool creates a pool of the proxies at the provided URLs. Use it with
+// a client as:
+//
+//	WithProxyFunc(pool.Proxy)
+func NewProxyPool(urls ...string) (*ProxyPool, error) {
+	if len(urls) == 0 {
+		return nil, ErrNoProxies
+	}
+	p := &ProxyPool{}
+	for _, e := range urls {
+		u, err := url.Parse(e)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid proxy URL: %v", err)
+		}
+		p.proxies = append(p.proxies, u)
+	}
+	return p, nil
+}
+
+// Proxy produces the next proxy in the pool
+func (p *ProxyPool) Proxy(*http.Request) (*url.URL, error) {
+	n := p.next.Add(1) - 1
+	return p.proxies[n%uint64(len(p.proxies))], nil
+}
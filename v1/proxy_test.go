@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxy(t *testing.T) {
+	var hits [2]int64
+	var proxies [2]*httptest.Server
+	for i := range proxies {
+		n := i
+		proxies[i] = httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+			atomic.AddInt64(&hits[n], 1)
+			assert.Equal(t, "upstream.invalid", req.URL.Host, "proxied requests use the absolute URL")
+			rsp.WriteHeader(http.StatusNoContent)
+		}))
+		defer proxies[i].Close()
+	}
+	cxt := context.Background()
+
+	client, err := New(WithBaseURL("http://upstream.invalid/"), WithProxy(proxies[0].URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Get(cxt, "/things", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&hits[0]))
+	assert.NotSame(t, sharedClient, client.Client, "the shared client must not be modified")
+
+	pool, err := NewProxyPool(proxies[0].URL, proxies[1].URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	client, err = New(WithBaseURL("http://upstream.invalid/"), WithProxyFunc(pool.Proxy))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 4; i++ {
+		_, err = client.Get(cxt, "/things", nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(3), atomic.LoadInt64(&hits[0]))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&hits[1]))
+
+	lnr, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	addr := lnr.Addr().String()
+	lnr.Close() // nothing is listening here now
+	client, err = New(WithBaseURL("http://upstream.invalid/"), WithProxy("http://"+addr))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Get(cxt, "/things", nil)
+	assert.ErrorIs(t, err, ErrProxyConnect)
+	var apierr *Error
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Equal(t, "http://upstream.invalid/things", apierr.URL)
+	}
+}
+
+func TestProxyRejected(t *testing.T) {
+	cxt := context.Background()
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, http.MethodConnect, req.Method)
+		rsp.WriteHeader(http.StatusForbidden)
+	}))
+	defer proxy.Close()
+	client, err := New(WithBaseURL("https://upstream.invalid/"), WithProxy(proxy.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Get(cxt, "/things", nil)
+	assert.ErrorIs(t, err, ErrProxyConnect)
+
+	lnr, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer lnr.Close()
+	go func() {
+		for {
+			conn, err := lnr.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 16)
+			conn.Read(buf)                 // the greeting, which offers some authentication methods
+			conn.Write([]byte{0x05, 0xff}) // none of which are acceptable
+			conn.Close()
+		}
+	}()
+	client, err = New(WithBaseURL("http://upstream.invalid/"), WithProxy("socks5://"+lnr.Addr().String()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Get(cxt, "/things", nil)
+	assert.ErrorIs(t, err, ErrProxyConnect)
+}
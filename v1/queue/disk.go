@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bww/go-apiclient/v1/internal/fsutil"
+)
+
+const diskSuffix = ".json"
+
+// A store which persists each entry to a file in a directory, so that queued
+// requests survive across runs of a program. Files are replaced atomically,
+// so an entry is never observed partially written.
+type Disk struct {
+	dir string
+}
+
+// NewDisk creates a disk store in the provided directory, creating it if it
+// does not exist.
+func NewDisk(dir string) (*Disk, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return &Disk{dir: dir}, nil
+}
+
+// Entries are named for a hash of their identifier, which may be an arbitrary
+// idempotency key. Entries written by earlier versions, which were named for
+// their identifier itself, are renamed when they are listed.
+func (d *Disk) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+diskSuffix)
+}
+
+func (d *Disk) Put(cxt context.Context, e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(d.path(e.ID), data)
+}
+
+func (d *Disk) Delete(cxt context.Context, id string) error {
+	err := os.Remove(d.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (d *Disk) List(cxt context.Context) ([]*Entry, error) {
+	files, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []*Entry
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), diskSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(d.dir, f.Name()))
+		if errors.Is(err, os.ErrNotExist) { // removed from underneath us
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		e := &Entry{}
+		err = json.Unmarshal(data, e)
+		if err != nil {
+			continue // a corrupt entry is discarded
+		}
+		if p := d.path(e.ID); filepath.Base(p) != f.Name() {
+			err = os.Rename(filepath.Join(d.dir, f.Name()), p)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, e)
+	}
+	sortEntries(res)
+	return res, nil
+}
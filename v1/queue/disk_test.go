@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisk(t *testing.T) {
+	cxt := context.Background()
+	dir := t.TempDir()
+
+	d, err := NewDisk(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	a := &Entry{ID: "a", Method: http.MethodPost, URL: "/a", Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("A"), Enqueued: now.Add(time.Second)}
+	b := &Entry{ID: "b", Method: http.MethodPost, URL: "/b", Enqueued: now}
+	assert.NoError(t, d.Put(cxt, a))
+	assert.NoError(t, d.Put(cxt, b))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{"), 0o600))
+
+	d, err = NewDisk(dir) // entries survive a new store
+	if !assert.NoError(t, err) {
+		return
+	}
+	res, err := d.List(cxt)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*Entry{b, a}, res)
+	}
+
+	assert.NoError(t, d.Delete(cxt, "b"))
+	assert.NoError(t, d.Delete(cxt, "b"))
+	res, err = d.List(cxt)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*Entry{a}, res)
+	}
+}
+
+func TestDiskMigrate(t *testing.T) {
+	cxt := context.Background()
+	dir := t.TempDir()
+
+	// an entry named for its identifier, as earlier versions named them
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "legacy.json"), []byte(`{"id":"legacy","method":"POST","url":"/a"}`), 0o600))
+
+	d, err := NewDisk(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	res, err := d.List(cxt)
+	if assert.NoError(t, err) && assert.Len(t, res, 1) {
+		assert.Equal(t, "legacy", res[0].ID)
+	}
+	assert.NoError(t, d.Delete(cxt, "legacy"))
+	res, err = d.List(cxt)
+	if assert.NoError(t, err) {
+		assert.Len(t, res, 0, "a migrated entry can be deleted")
+	}
+}
@@ -0,0 +1,74 @@
+// Package queue defines storage for requests which are sent in the background
+package queue
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A queued request. The body is retained in full so that the request can be
+// sent again, after a failure or by another process.
+type Entry struct {
+	ID       string      `json:"id"`
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     []byte      `json:"body,omitempty"`
+	Enqueued time.Time   `json:"enqueued"`
+}
+
+// A store persists queued requests until they have been sent. A store may be
+// backed by anything which retains entries across runs of a program, such as
+// files or a database table.
+type Store interface {
+	// Put stores an entry, replacing any existing entry with the same ID
+	Put(context.Context, *Entry) error
+	// Delete removes the entry with an ID, if any
+	Delete(context.Context, string) error
+	// List returns every entry in the order they were enqueued
+	List(context.Context) ([]*Entry, error)
+}
+
+// An in-memory store
+type Memory struct {
+	sync.Mutex
+	entries map[string]*Entry
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]*Entry)}
+}
+
+func (m *Memory) Put(cxt context.Context, e *Entry) error {
+	m.Lock()
+	defer m.Unlock()
+	m.entries[e.ID] = e
+	return nil
+}
+
+func (m *Memory) Delete(cxt context.Context, id string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.entries, id)
+	return nil
+}
+
+func (m *Memory) List(cxt context.Context) ([]*Entry, error) {
+	m.Lock()
+	defer m.Unlock()
+	res := make([]*Entry, 0, len(m.entries))
+	for _, e := range m.entries {
+		res = append(res, e)
+	}
+	sortEntries(res)
+	return res, nil
+}
+
+func sortEntries(e []*Entry) {
+	sort.Slice(e, func(i, j int) bool {
+		return e[i].Enqueued.Before(e[j].Enqueued)
+	})
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bww/go-ratelimit/v1"
+)
+
+var ErrQuotaExceeded = errors.New("Rate limit quota exceeded")
+
+const defaultQuotaTimeout = time.Second * 5
+
+// Schedule a request with the generic cell rate algorithm, given the
+// theoretical arrival time of the next request. Returns the time at which the
+// request may be sent and the updated arrival time, or false if the request
+// would be delayed by more than max, when max is positive.
+func gcra(tat, now time.Time, interval time.Duration, burst int, max time.Duration) (time.Time, time.Time, bool) {
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(-time.Duration(burst-1) * interval)
+	if next.Before(now) {
+		next = now
+	}
+	if max > 0 && next.Sub(now) > max {
+		return time.Time{}, tat, false
+	}
+	return next, tat.Add(interval), true
+}
+
+// A quota store coordinates a rate limit among the processes which share it,
+// such as the replicas of a service which use the same API key. For each key,
+// a store maintains the time at which the next request is scheduled, and it
+// must update that time atomically.
+type QuotaStore interface {
+	// Reserve a request for the key, permitting one request per interval on
+	// average and bursts of up to burst requests. The returned delay is the
+	// time until the request may be sent, measured by the store's clock. If
+	// max is positive and the delay would exceed it, no request is reserved
+	// and ErrQuotaExceeded is returned.
+	Reserve(cxt context.Context, key string, interval time.Duration, burst int, max time.Duration) (time.Duration, error)
+	// Release a request which was reserved but not sent
+	Release(cxt context.Context, key string, interval time.Duration) error
+}
+
+// A quota store which coordinates the limiters of a single process
+type memoryQuotaStore struct {
+	sync.Mutex
+	tat map[string]time.Time
+}
+
+// NewMemoryQuotaStore creates a quota store which is shared by limiters in
+// the same process.
+func NewMemoryQuotaStore() QuotaStore {
+	return &memoryQuotaStore{tat: make(map[string]time.Time)}
+}
+
+func (s *memoryQuotaStore) Reserve(cxt context.Context, key string, interval time.Duration, burst int, max time.Duration) (time.Duration, error) {
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+	next, tat, ok := gcra(s.tat[key], now, interval, burst, max)
+	if !ok {
+		return 0, ErrQuotaExceeded
+	}
+	s.tat[key] = tat
+	return next.Sub(now), nil
+}
+
+func (s *memoryQuotaStore) Release(cxt context.Context, key string, interval time.Duration) error {
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+	if tat := s.tat[key].Add(-interval); tat.After(now) {
+		s.tat[key] = tat
+	} else {
+		delete(s.tat, key)
+	}
+	return nil
+}
+
+// A script runner evaluates a Lua script in Redis or a compatible store and
+// returns its result. With go-redis, for example:
+//
+//	func(cxt context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return rdb.Eval(cxt, script, keys, args...).Result()
+//	}
+type ScriptRunner func(cxt context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+
+// Times are represented in microseconds and measured by the store's clock, so
+// that the clocks of the processes which share a quota need not agree.
+const (
+	redisReserveScript = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then tat = now end
+local at = tat - (burst - 1) * interval
+if at < now then at = now end
+if max > 0 and at - now > max then return -1 end
+tat = tat + interval
+redis.call('SET', KEYS[1], tat, 'PX', math.ceil((tat - now) / 1000) + 1000)
+return at - now
+`
+	redisReleaseScript = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tat = tonumber(redis.call('GET', KEYS[1]) or 0) - tonumber(ARGV[1])
+if tat > now then
+	redis.call('SET', KEYS[1], tat, 'PX', math.ceil((tat - now) / 1000) + 1000)
+else
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`
+)
+
+type redisQuotaStore struct {
+	run ScriptRunner
+}
+
+// NewRedisQuotaStore creates a quota store backed by Redis, or any store which
+// evaluates Redis Lua scripts, using the provided runner.
+func NewRedisQuotaStore(run ScriptRunner) QuotaStore {
+	return redisQuotaStore{run}
+}
+
+func (s redisQuotaStore) Reserve(cxt context.Context, key string, interval time.Duration, burst int, max time.Duration) (time.Duration, error) {
+	res, err := s.run(cxt, redisReserveScript, []string{key}, interval.Microseconds(), burst, max.Microseconds())
+	if err != nil {
+		return 0, err
+	}
+	v, ok := res.(int64)
+	if !ok {
+		return 0, fmt.Errorf("Unexpected result from quota store: %T", res)
+	}
+	if v < 0 {
+		return 0, ErrQuotaExceeded
+	}
+	return time.Duration(v) * time.Microsecond, nil
+}
+
+func (s redisQuotaStore) Release(cxt context.Context, key string, interval time.Duration) error {
+	_, err := s.run(cxt, redisReleaseScript, []string{key}, interval.Microseconds())
+	return err
+}
+
+type QuotaConfig struct {
+	MaxWait time.Duration
+	Timeout time.Duration
+}
+
+func (c QuotaConfig) WithOptions(opts []QuotaOption) QuotaConfig {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type QuotaOption func(QuotaConfig) QuotaConfig
+
+// WithMaxWait rejects a request with ErrQuotaExceeded rather than reserving
+// it when it would wait longer than the provided duration for the quota.
+func WithMaxWait(d time.Duration) QuotaOption {
+	return func(c QuotaConfig) QuotaConfig {
+		c.MaxWait = d
+		return c
+	}
+}
+
+// WithStoreTimeout sets the time allowed for each operation on the store
+func WithStoreTimeout(d time.Duration) QuotaOption {
+	return func(c QuotaConfig) QuotaConfig {
+		c.Timeout = d
+		return c
+	}
+}
+
+// A shared limiter limits requests to a quota which is coordinated through a
+// store, so that every limiter using the same key respects the quota
+// collectively.
+type SharedLimiter struct {
+	store    QuotaStore
+	key      string
+	interval time.Duration
+	burst    int
+	max      time.Duration
+	timeout  time.Duration
+}
+
+// NewSharedLimiter creates a limiter which permits rps requests per second on
+// average and up to burst requests at once among all the limiters which use
+// the same store and key.
+func NewSharedLimiter(store QuotaStore, key string, rps float64, burst int, opts ...QuotaOption) *SharedLimiter {
+	conf := QuotaConfig{Timeout: defaultQuotaTimeout}.WithOptions(opts)
+	var interval time.Duration
+	if rps > 0 {
+		interval = time.Duration(float64(time.Second) / rps)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &SharedLimiter{
+		store:    store,
+		key:      key,
+		interval: interval,
+		burst:    burst,
+		max:      conf.MaxWait,
+		timeout:  conf.Timeout,
+	}
+}
+
+func (l *SharedLimiter) context() (context.Context, context.CancelFunc) {
+	if l.timeout > 0 {
+		return context.WithTimeout(context.Background(), l.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (l *SharedLimiter) Next(rel time.Time, opts ...ratelimit.Option) (time.Time, error) {
+	cxt, cancel := l.context()
+	defer cancel()
+	delay, err := l.store.Reserve(cxt, l.key, l.interval, l.burst, l.max)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return rel.Add(delay), nil
+}
+
+func (l *SharedLimiter) Wait(cxt context.Context, rel time.Time, opts ...ratelimit.Option) (time.Time, error) {
+	t, err := l.Next(rel, opts...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := wait(cxt, t.Sub(rel), "rate limits"); err != nil {
+		l.Return(t)
+		return t, ratelimit.ErrCanceled
+	}
+	return t, nil
+}
+
+// Responses have no effect on a shared limiter
+func (l *SharedLimiter) Update(rel time.Time, opts ...ratelimit.Option) error {
+	return nil
+}
+
+// The state of a shared quota is not known without consulting the store, so
+// only its limit is described.
+func (l *SharedLimiter) State(rel time.Time) ratelimit.State {
+	return ratelimit.State{Limit: l.burst}
+}
+
+func (l *SharedLimiter) Return(reserved time.Time) error {
+	if reserved.IsZero() {
+		return nil
+	}
+	cxt, cancel := l.context()
+	defer cancel()
+	return l.store.Release(cxt, l.key, l.interval)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bww/go-metrics/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// A metrics sink which counts observations by metric name
+type countingSink struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+func (s *countingSink) inc(name string) {
+	s.Lock()
+	defer s.Unlock()
+	if s.counts == nil {
+		s.counts = make(map[string]int)
+	}
+	s.counts[name]++
+}
+
+func (s *countingSink) count(name string) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.counts[name]
+}
+
+func (s *countingSink) RegisterCounterVec(name, desc string, opts []string) metrics.CounterVec {
+	return countingCounterVec{countingMetric{s, name}}
+}
+
+func (s *countingSink) RegisterSamplerVec(name, desc string, opts []string) metrics.SamplerVec {
+	return countingSamplerVec{countingMetric{s, name}}
+}
+
+type countingMetric struct {
+	sink *countingSink
+	name string
+}
+
+func (m countingMetric) Inc()            { m.sink.inc(m.name) }
+func (m countingMetric) Add(float64)     { m.sink.inc(m.name) }
+func (m countingMetric) Observe(float64) { m.sink.inc(m.name) }
+
+type countingCounterVec struct{ countingMetric }
+
+func (v countingCounterVec) With(metrics.Tags) metrics.Counter { return v.countingMetric }
+
+type countingSamplerVec struct{ countingMetric }
+
+func (v countingSamplerVec) With(metrics.Tags) metrics.Sampler { return v.countingMetric }
+
+func TestSharedLimiter(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	// two clients with their own limiters share a quota through the store
+	store := NewMemoryQuotaStore()
+	a, err := New(WithBaseURL(s.URL), WithRateLimiter(NewSharedLimiter(store, "key", 50, 1)))
+	assert.NoError(t, err)
+	b, err := New(WithBaseURL(s.URL), WithRateLimiter(NewSharedLimiter(store, "key", 50, 1)))
+	assert.NoError(t, err)
+	start := time.Now()
+	for _, c := range []*Client{a, b, a} {
+		_, err := c.Get(context.Background(), "/", nil)
+		assert.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*40)
+
+	// requests which would wait too long are rejected and counted
+	sink := &countingSink{}
+	c, err := New(WithBaseURL(s.URL), WithMetrics(sink), WithRateLimiter(NewSharedLimiter(store, "other", 1, 1, WithMaxWait(time.Millisecond*10))))
+	assert.NoError(t, err)
+	_, err = c.Get(context.Background(), "/", nil)
+	assert.NoError(t, err)
+	_, err = c.Get(context.Background(), "/", nil)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Equal(t, 2, sink.count("rest_client_rate_limit_acquire"))
+	assert.Equal(t, 1, sink.count("rest_client_rate_limit_rejected"))
+}
+
+func TestRedisQuotaStore(t *testing.T) {
+	var args [][]interface{}
+	result := interface{}(int64(2000))
+	store := NewRedisQuotaStore(func(cxt context.Context, script string, keys []string, a ...interface{}) (interface{}, error) {
+		args = append(args, append([]interface{}{keys[0]}, a...))
+		return result, nil
+	})
+
+	d, err := store.Reserve(context.Background(), "key", time.Millisecond*100, 5, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Millisecond*2, d)
+
+	result = int64(-1)
+	_, err = store.Reserve(context.Background(), "key", time.Millisecond*100, 5, 0)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	assert.NoError(t, store.Release(context.Background(), "key", time.Millisecond*100))
+	assert.Equal(t, [][]interface{}{
+		{"key", int64(100000), 5, int64(1000000)},
+		{"key", int64(100000), 5, int64(0)},
+		{"key", int64(100000)},
+	}, args)
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+const redactedValue = "REDACTED"
+
+// The query parameters which are redacted by default wherever a client renders
+// a URL, such as in errors and debugging output.
+var DefaultRedactedParams = []string{"token", "key", "signature", "access_token"}
+
+var defaultRedactor = newRedactor(DefaultRedactedParams)
+
+// The JSON body fields which are redacted by default, at any depth, wherever
+// a client renders an entity, such as in debugging output and errors.
+var DefaultRedactedFields = []string{"password", "token", "secret", "access_token", "refresh_token", "client_secret"}
+
+var defaultFieldRedactor = newRedactor(DefaultRedactedFields)
+
+// A redactor masks the values of sensitive query parameters or JSON fields.
+// Names are matched case-insensitively.
+type redactor map[string]struct{}
+
+func newRedactor(params []string) redactor {
+	r := make(redactor)
+	for _, e := range params {
+		r[strings.ToLower(e)] = struct{}{}
+	}
+	return r
+}
+
+// Render a URL with the values of sensitive query parameters and any password
+// redacted. The order of query parameters is preserved.
+func (r redactor) url(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	if u.RawQuery == "" || len(r) == 0 {
+		return u.Redacted()
+	}
+	d := *u
+	d.RawQuery = r.query(u.RawQuery)
+	return d.Redacted()
+}
+
+// Render an encoded query or form with the values of sensitive parameters
+// redacted. The order of parameters is preserved.
+func (r redactor) query(raw string) string {
+	parts := strings.Split(raw, "&")
+	for i, e := range parts {
+		k, _, ok := strings.Cut(e, "=")
+		if !ok {
+			continue
+		}
+		n, err := url.QueryUnescape(k)
+		if err != nil {
+			n = k
+		}
+		if _, ok := r[strings.ToLower(n)]; ok {
+			parts[i] = k + "=" + redactedValue
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// RedactURL renders a URL with the values of the client's sensitive query
+// parameters redacted.
+func (c *Client) RedactURL(u *url.URL) string {
+	return c.redact.url(u)
+}
+
+// Render a body with the values of sensitive fields redacted. JSON and
+// form-encoded bodies are redacted; bodies of any other type, as determined by
+// their content type, are returned as they are. A body without a content type
+// is redacted if it is valid JSON. A body which does not contain a sensitive
+// field is returned exactly as it is, rather than being re-encoded.
+func (r redactor) body(ctype string, data []byte) []byte {
+	if len(r) == 0 || len(data) == 0 {
+		return data
+	}
+	if ctype == "" {
+		return r.json(data)
+	}
+	m, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return data
+	} else if m == JSON || strings.HasSuffix(m, "+json") {
+		return r.json(data)
+	} else if m == URLEncoded {
+		return []byte(r.query(string(data)))
+	}
+	return data
+}
+
+// Render JSON data with the values of sensitive fields redacted. Data which is
+// not valid JSON is returned as it is.
+func (r redactor) json(data []byte) []byte {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // numbers must be rendered exactly as they were
+	err := dec.Decode(&v)
+	if err != nil || dec.More() {
+		return data // not valid JSON; leave it as it is
+	}
+	if !r.value(v) {
+		return data
+	}
+	res, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return res
+}
+
+// Redact the sensitive fields of a value in place, reporting whether any were
+// found
+func (r redactor) value(v interface{}) bool {
+	var found bool
+	switch c := v.(type) {
+	case map[string]interface{}:
+		for k, e := range c {
+			if _, ok := r[strings.ToLower(k)]; ok {
+				c[k], found = redactedValue, true
+			} else if r.value(e) {
+				found = true
+			}
+		}
+	case []interface{}:
+		for _, e := range c {
+			if r.value(e) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// Produce a copy of an entity with the values of sensitive fields redacted
+func (r redactor) entity(e *Entity) *Entity {
+	if e == nil {
+		return nil
+	}
+	return &Entity{
+		ContentType: e.ContentType,
+		Data:        r.body(e.ContentType, e.Data),
+		Truncated:   e.Truncated,
+	}
+}
+
+// A Redactor masks the values of sensitive query parameters and body fields in
+// the same manner as a client does wherever it renders a request or response.
+// Names are matched case-insensitively.
+type Redactor struct {
+	names redactor
+}
+
+// NewRedactor creates a redactor which masks the values of the named query
+// parameters and body fields
+func NewRedactor(names []string) Redactor {
+	return Redactor{newRedactor(names)}
+}
+
+// URL renders a URL with the values of sensitive query parameters and any
+// password redacted. The order of query parameters is preserved.
+func (r Redactor) URL(u *url.URL) string {
+	return r.names.url(u)
+}
+
+// Body renders a JSON or form-encoded body with the values of sensitive
+// fields redacted. Bodies of other types are returned as they are.
+func (r Redactor) Body(ctype string, data []byte) []byte {
+	return r.names.body(ctype, data)
+}
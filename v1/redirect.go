@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var ErrTooManyRedirects = errors.New("Too many redirects")
+
+// The number of redirects which are followed by default, which is the same
+// as the default for http.Client
+const defaultMaxRedirects = 10
+
+// WithNoRedirects causes redirect responses to be returned as they are rather
+// than followed. Since redirect statuses are not successful by default, this
+// is usually used along with WithSuccessStatuses.
+func WithNoRedirects() Option {
+	return func(c Config) Config {
+		c.MaxRedirects = -1
+		return c
+	}
+}
+
+// WithMaxRedirects sets the maximum number of redirects which are followed for
+// a request. When the limit is exceeded, the request fails with
+// ErrTooManyRedirects. A limit of zero is equivalent to WithNoRedirects. By
+// default, 10 redirects are followed.
+func WithMaxRedirects(n int) Option {
+	return func(c Config) Config {
+		if n <= 0 {
+			c.MaxRedirects = -1
+		} else {
+			c.MaxRedirects = n
+		}
+		return c
+	}
+}
+
+// WithRedirectAuth sets a function which decides whether sensitive headers,
+// such as Authorization and Cookie, are forwarded when a request is
+// redirected to a different host than the one it was originally sent to. The
+// function is provided the redirected request and the requests which preceded
+// it, oldest first. When it returns false the headers are removed from the
+// redirected request; otherwise, they are copied from the original request.
+// The client's sensitive headers are those in DefaultSensitiveHeaders and any
+// provided by WithSensitiveHeaders.
+//
+// By default, the underlying HTTP client forwards these headers only to the
+// original domain and its subdomains.
+func WithRedirectAuth(fn func(req *http.Request, via []*http.Request) bool) Option {
+	return func(c Config) Config {
+		c.RedirectAuth = fn
+		return c
+	}
+}
+
+// Determine whether a configuration customizes redirects
+func hasRedirectConfig(conf Config) bool {
+	return conf.MaxRedirects != 0 || conf.RedirectAuth != nil
+}
+
+// Produce a client whose redirect policy is customized by the configuration.
+// A copy of the underlying client is customized, so that the configuration of
+// a derived client is applied to the underlying client's own policy rather
+// than to the customized one. Any redirect policy the underlying client has is
+// consulted after the configured one.
+func redirectClient(client *http.Client, conf Config) *http.Client {
+	if !hasRedirectConfig(conf) {
+		return client
+	}
+	max, auth, check := conf.MaxRedirects, conf.RedirectAuth, client.CheckRedirect
+	sensitive := newHeaderSet(append(append([]string(nil), DefaultSensitiveHeaders...), conf.SensitiveHeaders...))
+
+	rc := *client
+	rc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if max < 0 {
+			return http.ErrUseLastResponse
+		}
+		if max > 0 && len(via) >= max {
+			return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, len(via))
+		}
+		if auth != nil && req.URL.Host != via[0].URL.Host {
+			forward := auth(req, via)
+			for k := range sensitive {
+				delete(req.Header, k)
+				if v, ok := via[0].Header[k]; ok && forward {
+					req.Header[k] = append([]string(nil), v...)
+				}
+			}
+		}
+		if check != nil {
+			return check(req, via)
+		}
+		if max == 0 && len(via) >= defaultMaxRedirects {
+			return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, len(via))
+		}
+		return nil
+	}
+	return &rc
+}
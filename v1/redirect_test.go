@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirects(t *testing.T) {
+	var auth string
+	target := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		auth = req.Header.Get("Authorization")
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/loop":
+			http.Redirect(rsp, req, "/loop", http.StatusFound)
+		default:
+			http.Redirect(rsp, req, target.URL+"/landed", http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+	cxt := context.Background()
+
+	c, err := New(WithBaseURL(origin.URL), WithMaxRedirects(3))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Get(cxt, "/loop", nil)
+	assert.ErrorIs(t, err, ErrTooManyRedirects)
+
+	c, err = New(WithBaseURL(origin.URL), WithNoRedirects())
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Get(cxt, "/away", nil)
+	var apierr *Error
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Equal(t, http.StatusFound, apierr.Status)
+	}
+	rsp, err := c.Get(cxt, "/away", nil, WithSuccessStatuses(func(s int) bool { return s < 400 }))
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusFound, rsp.StatusCode)
+		assert.Equal(t, target.URL+"/landed", rsp.Header.Get("Location"))
+	}
+
+	var forward bool
+	c, err = New(
+		WithBaseURL(origin.URL),
+		WithHeader("Authorization", "Bearer secret"),
+		WithRedirectAuth(func(req *http.Request, via []*http.Request) bool {
+			assert.Equal(t, "/landed", req.URL.Path)
+			assert.Len(t, via, 1)
+			return forward
+		}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rsp, err = c.Get(cxt, "/away", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+		assert.Equal(t, "", auth, "auth is not forwarded to another host")
+	}
+	forward = true
+	_, err = c.Get(cxt, "/away", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Bearer secret", auth)
+	}
+
+	d, err := c.Clone(WithTimeout(0))
+	if assert.NoError(t, err) {
+		forward = false
+		_, err = d.Get(cxt, "/away", nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "", auth, "derived clients inherit the redirect policy")
+		}
+	}
+
+	var checked int
+	c, err = NewWithConfig(Config{
+		BaseURL: origin.URL,
+		Client: &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			checked++
+			return nil
+		}},
+		MaxRedirects: -1,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	d, err = c.Clone(WithMaxRedirects(5))
+	if assert.NoError(t, err) {
+		rsp, err = d.Get(cxt, "/away", nil)
+		if assert.NoError(t, err, "the derived policy replaces the original rather than being chained to it") {
+			assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+			assert.Equal(t, 1, checked, "the underlying client's policy is consulted once")
+		}
+	}
+}
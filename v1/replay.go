@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// The header which carries an idempotency key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// The headers with which services indicate that a response was replayed for
+// a request with an idempotency key that was previously used, rather than
+// produced by performing the request again.
+var ReplayHeaders = []string{"Idempotent-Replayed", "X-Idempotent-Replayed"}
+
+// WithIdempotencyKey is a per-request option which sets the idempotency key
+// of a request. Services which support idempotency keys perform a request
+// with a given key at most once, which makes it safe to retry writes.
+func WithIdempotencyKey(key string) Option {
+	return WithHeader(IdempotencyKeyHeader, key)
+}
+
+// WithReplayOnConflict treats a 409 Conflict response to a request with an
+// idempotency key as a replay of the original response, which some services
+// use to indicate that the request was already performed. The response is
+// returned as if it were successful, with its status unchanged, and Replayed
+// reports true for it. This may be used as a client or per-request option;
+// when used as a per-request option, it takes precedence over the client's
+// setting.
+func WithReplayOnConflict(on bool) Option {
+	return func(c Config) Config {
+		c.ReplayOnConflict = &on
+		return c
+	}
+}
+
+// Replayed determines whether a response was replayed by the service for a
+// request with an idempotency key that was previously used.
+func Replayed(rsp *http.Response) bool {
+	if rsp == nil {
+		return false
+	}
+	for _, e := range ReplayHeaders {
+		if strings.EqualFold(rsp.Header.Get(e), "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// Determine whether conflicts are treated as replays for a request
+func (c *Client) replayFor(conf Config) bool {
+	if conf.ReplayOnConflict != nil {
+		return *conf.ReplayOnConflict
+	}
+	return c.replay
+}
+
+// Determine whether a response is a conflict which should be treated as a
+// replay and if so, mark it as one
+func (c *Client) replayConflict(req *http.Request, rsp *http.Response, conf Config) bool {
+	if rsp.StatusCode != http.StatusConflict || !c.replayFor(conf) {
+		return false
+	}
+	if req.Header.Get(IdempotencyKeyHeader) == "" {
+		return false
+	}
+	rsp.Header.Set(ReplayHeaders[0], "true")
+	return true
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotentReplay(t *testing.T) {
+	var lock sync.Mutex
+	seen := make(map[string][]byte)
+	attempts := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		data, _ := io.ReadAll(req.Body)
+		if req.URL.Path == "/flaky" {
+			if attempts++; attempts == 1 {
+				rsp.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		key := req.Header.Get(IdempotencyKeyHeader)
+		rsp.Header().Set("Content-Type", "application/json")
+		if prev, ok := seen[key]; ok {
+			if req.URL.Path == "/stripe" {
+				rsp.Header().Set("Idempotent-Replayed", "true")
+				rsp.WriteHeader(http.StatusOK)
+			} else {
+				rsp.WriteHeader(http.StatusConflict)
+			}
+			rsp.Write(prev)
+			return
+		}
+		if key != "" {
+			seen[key] = data
+		}
+		rsp.WriteHeader(http.StatusCreated)
+		rsp.Write(data)
+	}))
+	defer svr.Close()
+
+	cxt := context.Background()
+	client, err := New(WithBaseURL(svr.URL), WithRetryStatus(http.StatusServiceUnavailable), WithRetryDelay(time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	type charge struct {
+		Amount int `json:"amount"`
+	}
+	var res charge
+	rsp, err := client.Post(cxt, "/charges", charge{100}, &res, WithIdempotencyKey("a"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, charge{100}, res)
+		assert.False(t, Replayed(rsp))
+	}
+	var apierr *Error
+	_, err = client.Post(cxt, "/charges", charge{200}, &res, WithIdempotencyKey("a"))
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Equal(t, http.StatusConflict, apierr.Status, "conflicts are errors unless configured otherwise")
+	}
+
+	res = charge{}
+	rsp, err = client.Post(cxt, "/charges", charge{200}, &res, WithIdempotencyKey("a"), WithReplayOnConflict(true))
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusConflict, rsp.StatusCode)
+		assert.Equal(t, charge{100}, res, "the original resource is produced")
+		assert.True(t, Replayed(rsp))
+	}
+	_, err = client.Post(cxt, "/charges", charge{200}, &res, WithReplayOnConflict(true))
+	assert.NoError(t, err)
+	_, err = client.Post(cxt, "/charges", charge{200}, &res, WithReplayOnConflict(true))
+	assert.NoError(t, err, "requests without idempotency keys are never replayed")
+
+	_, err = client.Post(cxt, "/stripe", charge{300}, &res, WithIdempotencyKey("b"))
+	assert.NoError(t, err)
+	rsp, err = client.Post(cxt, "/stripe", charge{300}, &res, WithIdempotencyKey("b"))
+	if assert.NoError(t, err) {
+		assert.True(t, Replayed(rsp))
+	}
+
+	replay, err := client.Clone(WithReplayOnConflict(true))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = replay.Post(cxt, "/charges", charge{200}, &res, WithIdempotencyKey("a"))
+	assert.NoError(t, err)
+	_, err = replay.Post(cxt, "/charges", charge{200}, &res, WithIdempotencyKey("a"), WithReplayOnConflict(false))
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Equal(t, http.StatusConflict, apierr.Status, "the request's setting takes precedence")
+	}
+
+	var raw json.RawMessage
+	_, err = client.Post(cxt, "/flaky", charge{400}, &raw)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"amount":400}`, string(raw), "a retried request must send its body again")
+	}
+}
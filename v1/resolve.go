@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/url"
+	"strings"
+)
+
+// URL produces a URL under the client's base URL by appending the provided
+// path segments to the base path. Each segment is escaped, so a segment may
+// contain characters such as '/' or '?' which are then not interpreted as
+// part of the URL's structure. Empty segments are omitted. The query and
+// fragment of the base URL are not included.
+//
+// For example, with the base URL https://example.com/api/v2/:
+//
+//	c.URL("users", "a/b") // https://example.com/api/v2/users/a%2Fb
+func (c *Client) URL(segments ...string) *url.URL {
+	var u url.URL
+	if c.base != nil {
+		u = *c.base
+	}
+	u.RawQuery, u.Fragment, u.RawFragment, u.ForceQuery = "", "", "", false
+	p := u.EscapedPath()
+	for _, e := range segments {
+		if e != "" {
+			p = strings.TrimSuffix(p, "/") + "/" + url.PathEscape(e)
+		}
+	}
+	u.Path, _ = url.PathUnescape(p)
+	u.RawPath = p
+	return &u
+}
+
+// Resolve parses a reference and resolves it against the client's base URL in
+// the same way as the URL of a request performed by the client. Note that, by
+// default, a reference with an absolute path, such as "/users", replaces the
+// path of the base URL entirely; use a relative reference, such as "users",
+// URL, or the JoinPaths resolution to produce a URL under the base path.
+func (c *Client) Resolve(ref string) (*url.URL, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	return c.resolve(u), nil
+}
+
+// Resolve a request URL against the client's base URL
+func (c *Client) resolve(u *url.URL) *url.URL {
+	return resolveURL(c.base, u, c.resolution)
+}
+
+// A URL resolution determines how the URL of a request is resolved against
+// the base URL of a client.
+type URLResolution int
+
+const (
+	// ResolveReference resolves request URLs as references relative to the
+	// base URL, as described by RFC 3986 and implemented by
+	// url.URL.ResolveReference. With the base https://host/api/v2/, the
+	// reference "users" produces https://host/api/v2/users while "/users"
+	// produces https://host/users. This is the default.
+	ResolveReference URLResolution = iota
+	// JoinPaths appends the path of every request URL to the base path, so
+	// that both "users" and "/users" produce https://host/api/v2/users with
+	// the base https://host/api/v2/, regardless of whether either has a
+	// leading or trailing slash. The query and fragment of the request URL
+	// are used. Request URLs with a scheme or host are not resolved.
+	JoinPaths
+)
+
+func resolveURL(base, ref *url.URL, mode URLResolution) *url.URL {
+	if base == nil {
+		return ref
+	}
+	if mode != JoinPaths || ref.Scheme != "" || ref.Host != "" {
+		return base.ResolveReference(ref)
+	}
+	u := *base
+	p := base.EscapedPath()
+	if r := ref.EscapedPath(); r != "" {
+		p = strings.TrimSuffix(p, "/") + "/" + strings.TrimPrefix(r, "/")
+	}
+	u.Path, _ = url.PathUnescape(p)
+	u.RawPath = p
+	u.RawQuery, u.ForceQuery = ref.RawQuery, ref.ForceQuery
+	u.Fragment, u.RawFragment = ref.Fragment, ref.RawFragment
+	return &u
+}
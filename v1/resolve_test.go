@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientURL(t *testing.T) {
+	tests := []struct {
+		Base     string
+		Segments []string
+		Expect   string
+	}{
+		{"https://example.com/api/v2/", []string{"users", "a/b"}, "https://example.com/api/v2/users/a%2Fb"},
+		{"https://example.com/api/v2", []string{"users", "", "1"}, "https://example.com/api/v2/users/1"},
+		{"https://example.com/api/v2/?key=x#frag", []string{"a b", "c?d"}, "https://example.com/api/v2/a%20b/c%3Fd"},
+		{"https://example.com", []string{"users"}, "https://example.com/users"},
+		{"https://example.com/api/", nil, "https://example.com/api/"},
+		{"", []string{"users", "1"}, "/users/1"},
+	}
+	for _, e := range tests {
+		c, err := New(WithBaseURL(e.Base))
+		if assert.NoError(t, err) {
+			assert.Equal(t, e.Expect, c.URL(e.Segments...).String(), e.Base)
+		}
+	}
+
+	c, err := New(WithBaseURL("https://example.com/api/v2/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	c.URL("users").Path = "/changed"
+	assert.Equal(t, "/api/v2/", c.Base().Path, "the base is not modified")
+
+	for ref, expect := range map[string]string{
+		"users":                  "https://example.com/api/v2/users",
+		"/users":                 "https://example.com/users",
+		"../v1/users?x=1":        "https://example.com/api/v1/users?x=1",
+		"https://other.com/path": "https://other.com/path",
+	} {
+		u, err := c.Resolve(ref)
+		if assert.NoError(t, err, ref) {
+			assert.Equal(t, expect, u.String(), ref)
+		}
+	}
+	_, err = c.Resolve("%zz")
+	assert.Error(t, err)
+}
+
+func TestJoinPaths(t *testing.T) {
+	tests := []struct {
+		Base   string
+		Ref    string
+		Expect string
+	}{
+		{"https://host/api/v2/", "/users", "https://host/api/v2/users"},
+		{"https://host/api/v2/", "users", "https://host/api/v2/users"},
+		{"https://host/api/v2", "/users", "https://host/api/v2/users"},
+		{"https://host/api/v2", "users", "https://host/api/v2/users"},
+		{"https://host/api/v2/", "/users/", "https://host/api/v2/users/"},
+		{"https://host/api/v2/", "", "https://host/api/v2/"},
+		{"https://host/api/v2/", "?page=2", "https://host/api/v2/?page=2"},
+		{"https://host/api/v2/?key=x", "/users?page=2#top", "https://host/api/v2/users?page=2#top"},
+		{"https://host/api/v2/", "/users/a%2Fb", "https://host/api/v2/users/a%2Fb"},
+		{"https://host", "/users", "https://host/users"},
+		{"https://host/", "users", "https://host/users"},
+		{"https://host/api/v2/", "https://other/users", "https://other/users"},
+		{"https://host/api/v2/", "//other/users", "https://other/users"},
+	}
+	for _, e := range tests {
+		c, err := New(WithBaseURL(e.Base), WithURLResolution(JoinPaths))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		u, err := c.Resolve(e.Ref)
+		if assert.NoError(t, err, e.Ref) {
+			assert.Equal(t, e.Expect, u.String(), "%s + %s", e.Base, e.Ref)
+		}
+	}
+
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c, err := New(WithBaseURL(server.URL+"/api/v2/"), WithURLResolution(JoinPaths))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Get(context.Background(), "/users", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/api/v2/users", path)
+	}
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bww/go-util/v1/text"
+)
+
+const (
+	defaultSampleWindow   = time.Hour
+	defaultSampleBodySize = 1 << 16
+)
+
+// A capture is a complete record of a request and its response, or the error
+// it produced. Headers are sanitized and URLs redacted.
+type Capture struct {
+	Reason         string // why the request was captured: "sample" or "failure"
+	Time           time.Time
+	Duration       time.Duration
+	Method         string
+	URL            string
+	RequestHeader  http.Header
+	RequestBody    []byte
+	RequestOmitted bool // the request body exists but was not captured
+	Status         int
+	ResponseHeader http.Header
+	ResponseBody   []byte
+	Err            error
+}
+
+// A debug sink receives captured requests
+type DebugSink interface {
+	Capture(Capture)
+}
+
+type DebugSinkFunc func(Capture)
+
+func (f DebugSinkFunc) Capture(c Capture) {
+	f(c)
+}
+
+// NewWriterDebugSink creates a sink which writes captures to the provided
+// writer in the same format as debugging output
+func NewWriterDebugSink(w io.Writer) DebugSink {
+	var lock sync.Mutex
+	return DebugSinkFunc(func(c Capture) {
+		b := &bytes.Buffer{}
+		fmt.Fprintf(b, "api: [%s] %v %v", c.Reason, c.Method, c.URL)
+		if c.Status > 0 {
+			fmt.Fprintf(b, " -> %d %s", c.Status, http.StatusText(c.Status))
+		}
+		fmt.Fprintf(b, " (%v)\n", c.Duration)
+		if c.Err != nil {
+			fmt.Fprintf(b, "   ! %v\n", c.Err)
+		}
+		dumpCapture(b, c.RequestHeader, c.RequestBody, "   > ")
+		if c.RequestOmitted {
+			fmt.Fprintln(b, "   > (body omitted)")
+		}
+		dumpCapture(b, c.ResponseHeader, c.ResponseBody, "   < ")
+		lock.Lock()
+		defer lock.Unlock()
+		w.Write(b.Bytes())
+	})
+}
+
+func dumpCapture(w *bytes.Buffer, hdr http.Header, body []byte, prefix string) {
+	if len(hdr) > 0 {
+		h := &bytes.Buffer{}
+		hdr.Write(h)
+		fmt.Fprintln(w, text.Indent(h.String(), "   - "))
+	}
+	if len(body) > 0 {
+		fmt.Fprintln(w, text.Indent(string(body), prefix))
+	}
+}
+
+// Debug sampling captures complete requests and responses for a fraction of
+// requests, and for the first failures of each endpoint in a window of time,
+// so that problems in production can be diagnosed without enabling debugging
+// output for every request.
+type DebugSampling struct {
+	// The fraction of requests to capture, from 0 to 1
+	Rate float64
+	// The number of failed requests to capture per endpoint in each window
+	Failures int
+	// The window over which failures are counted; defaults to one hour
+	Window time.Duration
+	// Derives an endpoint identifier from a request; by default, the method
+	// and path are used
+	Keyer func(*http.Request) string
+	// The sink which receives captures; defaults to the client's debug writer
+	Sink DebugSink
+	// The size of the largest request body which is captured; defaults to
+	// 64KiB. Larger bodies, bodies of unknown length, and bodies which cannot
+	// be produced again without consuming them are omitted.
+	MaxBodySize int64
+}
+
+// WithDebugSampling enables sampled capture of requests and responses
+func WithDebugSampling(s DebugSampling) Option {
+	return func(c Config) Config {
+		c.DebugSampling = &s
+		return c
+	}
+}
+
+// A debug sampler selects requests to capture
+type debugSampler struct {
+	sync.Mutex
+	conf     DebugSampling
+	failures map[string]*failureBudget
+	swept    time.Time
+}
+
+type failureBudget struct {
+	start time.Time
+	count int
+}
+
+func newDebugSampler(conf *DebugSampling, w io.Writer) *debugSampler {
+	if conf == nil {
+		return nil
+	}
+	c := *conf
+	if c.Window <= 0 {
+		c.Window = defaultSampleWindow
+	}
+	if c.Keyer == nil {
+		c.Keyer = defaultEndpointKey
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = defaultSampleBodySize
+	}
+	if c.Sink == nil {
+		c.Sink = NewWriterDebugSink(w)
+	}
+	return &debugSampler{
+		conf:     c,
+		failures: make(map[string]*failureBudget),
+	}
+}
+
+// Determine whether a request is selected for capture in advance
+func (s *debugSampler) sample() bool {
+	return s != nil && s.conf.Rate > 0 && rand.Float64() < s.conf.Rate
+}
+
+// Determine whether a failed request is captured, consuming its endpoint's
+// budget if so
+func (s *debugSampler) failure(req *http.Request, err error) bool {
+	if s == nil || s.conf.Failures <= 0 || errors.Is(err, context.Canceled) {
+		return false
+	}
+	now := time.Now()
+	key := s.conf.Keyer(req)
+	s.Lock()
+	defer s.Unlock()
+	b, ok := s.failures[key]
+	if !ok || now.Sub(b.start) >= s.conf.Window {
+		s.evict(now)
+		b = &failureBudget{start: now}
+		s.failures[key] = b
+	}
+	if b.count >= s.conf.Failures {
+		return false
+	}
+	b.count++
+	return true
+}
+
+// Produce a copy of a request's body without consuming it. Only a body which
+// can be produced again and whose length is known and within the limit is
+// copied; any other body is reported as omitted.
+func (s *debugSampler) requestBody(req *http.Request) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, false
+	}
+	if req.GetBody == nil || req.ContentLength <= 0 || req.ContentLength > s.conf.MaxBodySize {
+		return nil, true
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, true
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, req.ContentLength))
+	if err != nil {
+		return nil, true
+	}
+	return data, false
+}
+
+// Discard the budgets of endpoints whose windows have expired, at most once
+// per window, so that budgets do not accumulate for endpoints which are no
+// longer failing. The sampler must be locked.
+func (s *debugSampler) evict(now time.Time) {
+	if now.Sub(s.swept) < s.conf.Window {
+		return
+	}
+	s.swept = now
+	for k, b := range s.failures {
+		if now.Sub(b.start) >= s.conf.Window {
+			delete(s.failures, k)
+		}
+	}
+}
+
+// Perform a request, capturing it if it is sampled or fails within budget
+func (c *Client) sampled(req *http.Request, conf Config, fn func() (*http.Response, error)) (*http.Response, error) {
+	s := c.sampler
+	if s == nil {
+		return fn()
+	}
+	start := time.Now()
+	sample := s.sample()
+	rsp, err := fn()
+	if !sample && (err == nil || !s.failure(req, err)) {
+		return rsp, err
+	}
+
+	capt := Capture{
+		Reason:        "sample",
+		Time:          start,
+		Duration:      time.Since(start),
+		Method:        req.Method,
+		URL:           c.redact.url(req.URL),
+		RequestHeader: sanitizeHeaders(req.Header, c.sensitive.allow),
+		Err:           err,
+	}
+	if err != nil {
+		capt.Reason = "failure"
+	}
+	if data, omitted := s.requestBody(req); data != nil {
+		capt.RequestBody = c.fields.body(req.Header.Get("Content-Type"), data)
+	} else {
+		capt.RequestOmitted = omitted
+	}
+	var apierr *Error
+	if rsp != nil {
+		capt.Status = rsp.StatusCode
+		capt.ResponseHeader = sanitizeHeaders(rsp.Header, c.sensitive.allow)
+		if !conf.RawBody {
+			data, rerr := io.ReadAll(rsp.Body)
+			rsp.Body.Close()
+			if rerr != nil {
+				return nil, rerr
+			}
+			rsp.Body = io.NopCloser(bytes.NewReader(data))
+			capt.ResponseBody = c.fields.body(rsp.Header.Get("Content-Type"), data)
+		}
+	} else if errors.As(err, &apierr) {
+		capt.Status = apierr.Status
+		if apierr.Entity != nil {
+			capt.ResponseBody = c.fields.body(apierr.Entity.ContentType, apierr.Entity.Data)
+		}
+	}
+	s.conf.Sink.Capture(capt)
+	return rsp, err
+}
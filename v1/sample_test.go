@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugSampling(t *testing.T) {
+	var lock sync.Mutex
+	var caps []Capture
+	sink := DebugSinkFunc(func(c Capture) {
+		lock.Lock()
+		defer lock.Unlock()
+		caps = append(caps, c)
+	})
+	cxt := context.Background()
+
+	client, err := New(
+		WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())),
+		WithAuthorizer(NewBearerAuthorizer("secret")),
+		WithDebugSampling(DebugSampling{Rate: 1, Sink: sink}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var res map[string]interface{}
+	_, err = client.Post(cxt, "/echo", map[string]string{"hello": "world"}, &res)
+	if assert.NoError(t, err) && assert.Len(t, caps, 1) {
+		c := caps[0]
+		assert.Equal(t, "sample", c.Reason)
+		assert.Equal(t, http.MethodPost, c.Method)
+		assert.Equal(t, http.StatusOK, c.Status)
+		assert.Equal(t, `{"hello":"world"}`, string(c.RequestBody))
+		assert.Contains(t, string(c.ResponseBody), `hello`)
+		assert.NotContains(t, c.RequestHeader.Get("Authorization"), "secret")
+		assert.Equal(t, `{"hello":"world"}`, res["data"], "the response must still be readable")
+	}
+
+	caps = nil
+	req, err := http.NewRequest(http.MethodPost, "/echo", io.NopCloser(strings.NewReader(`{"hello":"stream"}`)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	req.Header.Set("Content-Type", JSON)
+	_, err = client.Exec(req.WithContext(cxt), &res)
+	if assert.NoError(t, err) && assert.Len(t, caps, 1) {
+		assert.Nil(t, caps[0].RequestBody)
+		assert.True(t, caps[0].RequestOmitted, "a body which cannot be produced again is not consumed")
+		assert.Equal(t, `{"hello":"stream"}`, res["data"])
+	}
+
+	caps = nil
+	client, err = New(
+		WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())),
+		WithDebugSampling(DebugSampling{Rate: 1, Sink: sink, MaxBodySize: 8}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Post(cxt, "/echo", map[string]string{"hello": "world"}, &res)
+	if assert.NoError(t, err) && assert.Len(t, caps, 1) {
+		assert.Nil(t, caps[0].RequestBody)
+		assert.True(t, caps[0].RequestOmitted, "a body larger than the limit is omitted")
+	}
+
+	caps = nil
+	client, err = New(
+		WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())),
+		WithDebugSampling(DebugSampling{Failures: 2, Sink: sink}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 3; i++ {
+		_, err = client.Get(cxt, "/status/404", nil)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	_, err = client.Get(cxt, "/status/200", nil)
+	assert.NoError(t, err)
+	_, err = client.Get(cxt, "/status/400", nil)
+	assert.ErrorIs(t, err, ErrBadRequest)
+	if assert.Len(t, caps, 3) {
+		for _, c := range caps {
+			assert.Equal(t, "failure", c.Reason)
+			assert.Error(t, c.Err)
+		}
+		assert.Equal(t, http.StatusNotFound, caps[0].Status)
+		assert.Contains(t, string(caps[0].ResponseBody), "404")
+		assert.Equal(t, http.StatusBadRequest, caps[2].Status)
+	}
+
+	buf := &bytes.Buffer{}
+	client, err = New(
+		WithBaseURL(fmt.Sprintf("http://%s/", service.Addr())),
+		WithDebugWriter(buf),
+		WithDebugSampling(DebugSampling{Failures: 1}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Get(cxt, "/status/404", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Contains(t, buf.String(), "/status/404", "captures are written to the debug writer by default")
+}
+
+func TestDebugSamplingEviction(t *testing.T) {
+	var n int
+	s := newDebugSampler(&DebugSampling{
+		Failures: 1,
+		Window:   time.Millisecond * 20,
+		Keyer: func(*http.Request) string {
+			n++
+			return fmt.Sprint(n)
+		},
+		Sink: DebugSinkFunc(func(Capture) {}),
+	}, io.Discard)
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 100; i++ {
+		assert.True(t, s.failure(req, ErrNotFound))
+	}
+	assert.Len(t, s.failures, 100)
+	time.Sleep(time.Millisecond * 30)
+	assert.True(t, s.failure(req, ErrNotFound))
+	assert.Len(t, s.failures, 1, "expired budgets must be discarded")
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+)
+
+// A login function performs the requests necessary to establish a session
+// using the provided client, which stores any cookies that are set. The final
+// response is returned so that a CSRF token may be captured from it; its body
+// need not be readable.
+type LoginFunc func(context.Context, *Client) (*http.Response, error)
+
+type SessionConfig struct {
+	CSRFHeader   string
+	CSRFResponse string
+	CSRFCookie   string
+}
+
+func (c SessionConfig) WithOptions(opts []SessionOption) SessionConfig {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type SessionOption func(SessionConfig) SessionConfig
+
+// WithCSRFResponseHeader captures a CSRF token from a header of the login
+// response and sends it in the provided request header with every request
+// that is not safe, such as POST or DELETE.
+func WithCSRFResponseHeader(rsp, req string) SessionOption {
+	return func(c SessionConfig) SessionConfig {
+		c.CSRFResponse, c.CSRFCookie = rsp, ""
+		c.CSRFHeader = req
+		return c
+	}
+}
+
+// WithCSRFCookie reads a CSRF token from a cookie, as is conventional for
+// double-submit protection, and sends it in the provided request header with
+// every request that is not safe. The cookie is read for each request, so a
+// token which is rotated by the server is always current.
+func WithCSRFCookie(cookie, req string) SessionOption {
+	return func(c SessionConfig) SessionConfig {
+		c.CSRFCookie, c.CSRFResponse = cookie, ""
+		c.CSRFHeader = req
+		return c
+	}
+}
+
+// A session is a client for services which use cookie-based authentication.
+// A session logs in when it performs its first request and replays the
+// cookies and CSRF token it obtained with subsequent requests. When a request
+// is rejected as unauthorized the session is considered to have expired and
+// the next request logs in again.
+type Session struct {
+	*Client
+	sync.Mutex
+	base   *Client
+	prev   Authorizer
+	login  LoginFunc
+	conf   SessionConfig
+	token  string
+	active bool
+}
+
+// NewSession creates a session from a client. If the client has no cookie
+// jar, the session uses its own.
+func NewSession(c *Client, login LoginFunc, opts ...SessionOption) (*Session, error) {
+	base := c
+	if c.conf.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		base, err = c.Clone(WithCookieJar(jar))
+		if err != nil {
+			return nil, err
+		}
+	}
+	s := &Session{
+		base:  base,
+		prev:  base.Authorizer(),
+		login: login,
+		conf:  SessionConfig{}.WithOptions(opts),
+	}
+	s.Client = base.WithAuthorizer(s)
+	return s, nil
+}
+
+// Login establishes a new session, regardless of whether one is active
+func (s *Session) Login(cxt context.Context) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.establish(cxt)
+}
+
+// Logout discards the session state, so that the next request logs in again.
+// Cookies are not removed from the jar.
+func (s *Session) Logout() {
+	s.Lock()
+	defer s.Unlock()
+	s.active, s.token = false, ""
+}
+
+// Establish a session; the caller must hold the lock
+func (s *Session) establish(cxt context.Context) error {
+	rsp, err := s.login(cxt, s.base)
+	if err != nil {
+		return fmt.Errorf("Could not log in: %w", err)
+	}
+	if rsp != nil && rsp.Body != nil {
+		rsp.Body.Close()
+	}
+	s.token = ""
+	if n := s.conf.CSRFResponse; n != "" && rsp != nil {
+		s.token = rsp.Header.Get(n)
+	}
+	s.active = true
+	return nil
+}
+
+func (s *Session) Authorize(req *http.Request) error {
+	s.Lock()
+	if !s.active {
+		if err := s.establish(req.Context()); err != nil {
+			s.Unlock()
+			return err
+		}
+	}
+	token := s.token
+	s.Unlock()
+
+	if s.prev != nil {
+		if err := s.prev.Authorize(req); err != nil {
+			return err
+		}
+	}
+	if s.conf.CSRFHeader == "" || isSafeMethod(req.Method) {
+		return nil
+	}
+	if n := s.conf.CSRFCookie; n != "" && s.base.Jar != nil {
+		for _, e := range s.base.Jar.Cookies(req.URL) {
+			if e.Name == n {
+				token = e.Value
+			}
+		}
+	}
+	if token != "" {
+		req.Header.Set(s.conf.CSRFHeader, token)
+	}
+	return nil
+}
+
+func (s *Session) Feedback(req *http.Request, rsp *http.Response) {
+	if rsp.StatusCode == http.StatusUnauthorized {
+		s.Logout()
+	}
+	if fb, ok := s.prev.(FeedbackAuthorizer); ok {
+		fb.Feedback(req, rsp)
+	}
+}
+
+func isSafeMethod(m string) bool {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	var logins int64
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		sid := fmt.Sprintf("session-%d", atomic.LoadInt64(&logins))
+		switch req.URL.Path {
+		case "/login":
+			sid = fmt.Sprintf("session-%d", atomic.AddInt64(&logins, 1))
+			http.SetCookie(rsp, &http.Cookie{Name: "sid", Value: sid, Path: "/"})
+			rsp.Header().Set("X-Csrf-Token", "csrf-"+sid)
+			rsp.WriteHeader(http.StatusNoContent)
+			return
+		case "/expire":
+			atomic.AddInt64(&logins, 1) // invalidate the current session
+			rsp.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if c, err := req.Cookie("sid"); err != nil || c.Value != sid {
+			rsp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Method != http.MethodGet && req.Header.Get("X-Csrf-Token") != "csrf-"+sid {
+			rsp.WriteHeader(http.StatusForbidden)
+			return
+		}
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer svr.Close()
+
+	client, err := New(WithBaseURL(svr.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	sess, err := NewSession(client, func(cxt context.Context, c *Client) (*http.Response, error) {
+		return c.Post(cxt, "/login", map[string]string{"user": "alice"}, nil)
+	}, WithCSRFResponseHeader("X-Csrf-Token", "X-Csrf-Token"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cxt := context.Background()
+	_, err = sess.Get(cxt, "/me", nil)
+	assert.NoError(t, err)
+	_, err = sess.Post(cxt, "/things", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&logins))
+
+	_, err = client.Get(cxt, "/me", nil)
+	assert.ErrorIs(t, err, ErrUnauthorized, "the parent client must not share the session's cookies")
+
+	_, err = client.Get(cxt, "/expire", nil)
+	assert.NoError(t, err)
+	_, err = sess.Get(cxt, "/me", nil)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	_, err = sess.Post(cxt, "/things", nil, nil)
+	assert.NoError(t, err, "an expired session must log in again")
+	assert.Equal(t, int64(3), atomic.LoadInt64(&logins))
+}
+
+func TestCookieJarRetry(t *testing.T) {
+	var attempts int64
+	var cookies []string
+	svr := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		cookies = append(cookies, req.Header.Get("Cookie"))
+		if atomic.AddInt64(&attempts, 1) < 3 {
+			rsp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer svr.Close()
+
+	jar, err := cookiejar.New(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	u, err := url.Parse(svr.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	jar.SetCookies(u, []*http.Cookie{{Name: "sid", Value: "abc"}})
+
+	client, err := New(WithBaseURL(svr.URL), WithCookieJar(jar), WithRetryStatus(http.StatusServiceUnavailable), WithRetryDelay(time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Get(context.Background(), "/", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sid=abc", "sid=abc", "sid=abc"}, cookies, "cookies must not accumulate over retries")
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bww/go-apiclient/v1/cache"
+	"github.com/bww/go-apiclient/v1/events"
+
+	"github.com/bww/go-ratelimit/v1"
+	"github.com/bww/go-util/v1/ext"
+)
+
+// Settings are resolved from a client's configuration and are never modified
+// after they are created. Clients are derived by applying changes to their
+// configuration and resolving new settings from it, which guarantees that a
+// derived client cannot silently drop any part of the configuration.
+type settings struct {
+	auth       Authorizer
+	authonce   bool
+	final      []Finalizer
+	limiter    ratelimit.Limiter
+	retry      map[int]struct{}
+	backoff    time.Duration
+	success    func(int) bool
+	methods    map[string]Policy
+	base       *url.URL
+	resolution URLResolution
+	header     http.Header
+	correl     []Correlation
+	dctype     string
+	strict     bool
+	valid      ResponseValidator
+	observe    observers
+	opolicy    ObserverPolicy
+	events     events.Listeners
+	pfail      bool
+	dry        bool
+	redact     redactor
+	fields     redactor
+	entlim     int64
+	sensitive  headerSet
+	flight     *flight
+	cache      cache.Store
+	swr        time.Duration
+	sie        time.Duration
+	replay     bool
+	balance    Balancer
+	debug      Debug
+}
+
+// Resolve settings from a configuration. The base URL and debug settings are
+// parsed from the configuration and environment by the caller, since doing so
+// may fail.
+func newSettings(conf Config, base *url.URL, debug Debug) settings {
+	ctype := conf.ContentType
+	if ctype == "" {
+		ctype = JSON
+	}
+	methods := make(map[string]Policy)
+	for k, v := range conf.Methods {
+		methods[strings.ToUpper(k)] = v
+	}
+	redact := defaultRedactor
+	if conf.RedactParams != nil {
+		redact = newRedactor(conf.RedactParams)
+	}
+	fields := defaultFieldRedactor
+	if conf.RedactFields != nil {
+		fields = newRedactor(conf.RedactFields)
+	}
+	var group *flight
+	if conf.Singleflight {
+		group = newFlight(conf.SingleflightHeaders)
+	}
+	return settings{
+		auth:       conf.Authorizer,
+		authonce:   conf.AuthorizeOnce,
+		final:      conf.Finalizers,
+		limiter:    conf.RateLimiter,
+		retry:      retrySet(conf.RetryStatus),
+		backoff:    conf.RetryDelay,
+		success:    conf.SuccessStatus,
+		methods:    methods,
+		base:       base,
+		resolution: conf.URLResolution,
+		header:     conf.Header,
+		correl:     conf.Correlation,
+		dctype:     ctype,
+		strict:     conf.StrictContentType != nil && *conf.StrictContentType,
+		valid:      conf.Validator,
+		observe:    observers(conf.Observers),
+		opolicy:    conf.ObserverPolicy,
+		events:     events.Listeners(conf.Events),
+		pfail:      conf.PauseFail != nil && *conf.PauseFail,
+		dry:        conf.DryRun,
+		redact:     redact,
+		fields:     fields,
+		entlim:     ext.Coalesce(conf.ErrorEntityLimit, DefaultErrorEntityLimit),
+		sensitive:  newHeaderSet(append(append([]string(nil), DefaultSensitiveHeaders...), conf.SensitiveHeaders...)),
+		flight:     group,
+		cache:      conf.Cache,
+		swr:        conf.StaleWhileRevalidate,
+		sie:        conf.StaleIfError,
+		replay:     conf.ReplayOnConflict != nil && *conf.ReplayOnConflict,
+		balance:    conf.Balancer,
+		debug:      debug,
+	}
+}
+
+// Copy anything in a configuration which options may mutate in place, so
+// that a configuration derived from it does not affect the original.
+func (c Config) copy() Config {
+	d := c
+	d.Header = c.Header.Clone()
+	d.Correlation = append([]Correlation(nil), c.Correlation...)
+	d.Finalizers = append([]Finalizer(nil), c.Finalizers...)
+	d.Observers = append([]Observer(nil), c.Observers...)
+	d.Events = append([]events.Listener(nil), c.Events...)
+	d.SingleflightHeaders = append([]string(nil), c.SingleflightHeaders...)
+	d.SensitiveHeaders = append([]string(nil), c.SensitiveHeaders...)
+	d.FallbackURLs = append([]string(nil), c.FallbackURLs...)
+	return d
+}
+
+// Derive a client from the receiver which uses the provided configuration.
+// The derived client shares the receiver's metrics and pause state.
+func (c *Client) derive(conf Config, base *url.URL) *Client {
+	d := *c
+	d.Client = redirectClient(conf.Client, conf)
+	d.conf = conf
+	d.settings = newSettings(conf, base, c.debug)
+	return &d
+}
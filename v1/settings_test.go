@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bww/go-ratelimit/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type testValidator struct{}
+
+func (v testValidator) Validate(*http.Response, *Entity) error { return nil }
+
+func TestDeriveParity(t *testing.T) {
+	lim := ratelimit.NewHeaders(ratelimit.Config{Events: 10, Window: time.Second})
+	c, err := New(
+		WithBaseURL("https://example.com/v1/"),
+		WithAuthorizer(NewBasicAuthorizer("user", "pass")),
+		WithRateLimiter(lim),
+		WithRetryStatus(http.StatusBadGateway),
+		WithRetryDelay(time.Second),
+		WithMethodPolicy(http.MethodPost, Policy{RetryStatus: NoRetries}),
+		WithHeader("X-Test", "yes"),
+		WithResponseValidator(testValidator{}),
+		WithPauseFailFast(true),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	base, _ := url.Parse("https://other.com/")
+	auth := NewBearerAuthorizer("token")
+	tests := []struct {
+		Name   string
+		Client *Client
+		Expect func(settings) settings
+	}{
+		{
+			"WithBase", c.WithBase(base),
+			func(s settings) settings { s.base = base; return s },
+		},
+		{
+			"WithAuthorizer", c.WithAuthorizer(auth),
+			func(s settings) settings { s.auth = auth; return s },
+		},
+		{
+			"WithHeader", c.WithHeader("X-Other", "ok"),
+			func(s settings) settings { s.header = s.header.Clone(); s.header.Set("X-Other", "ok"); return s },
+		},
+		{
+			"WithTimeout", c.WithTimeout(time.Second),
+			func(s settings) settings { return s },
+		},
+		{
+			"WithRateLimiter", c.WithRateLimiter(nil),
+			func(s settings) settings { s.limiter = nil; return s },
+		},
+		{
+			"Clone", errorsMust(c.Clone()),
+			func(s settings) settings { return s },
+		},
+	}
+	for _, e := range tests {
+		assert.Equal(t, e.Expect(c.settings), e.Client.settings, e.Name)
+	}
+	assert.Equal(t, "yes", c.header.Get("X-Test"))
+	assert.Equal(t, "", c.header.Get("X-Other"), "receiver must not be modified")
+}
+
+func errorsMust(c *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
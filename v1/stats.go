@@ -0,0 +1,166 @@
+package api
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Runtime statistics for a client and every client derived from it. Counts
+// are cumulative from when the client was created.
+type Stats struct {
+	// Requests performed, not including retries or responses served from a cache
+	Requests int64 `json:"requests"`
+	// Attempts to perform a request again after a failure or rate limit
+	Retries int64 `json:"retries"`
+	// Times a request waited for rate limits before it was sent
+	RateLimitWaits int64 `json:"rate_limit_waits"`
+	// Requests which failed
+	Errors int64 `json:"errors"`
+	// Bytes of request bodies sent, where their size is known
+	BytesOut int64 `json:"bytes_out"`
+	// Bytes of response bodies read
+	BytesIn int64 `json:"bytes_in"`
+	// Connections in use by requests whose responses have not been consumed
+	OpenConns int64 `json:"open_conns"`
+	// When a request most recently failed, overall and by host
+	LastError  time.Time            `json:"last_error,omitempty"`
+	LastErrors map[string]time.Time `json:"last_errors,omitempty"`
+}
+
+// A stats observer receives periodic snapshots of a client's statistics
+type StatsObserver interface {
+	ObserveStats(Stats)
+}
+
+// A function which observes stats
+type StatsObserverFunc func(Stats)
+
+func (f StatsObserverFunc) ObserveStats(s Stats) {
+	f(s)
+}
+
+// Stats snapshots are delivered to an observer periodically
+type StatsSnapshots struct {
+	Interval time.Duration
+	Observer StatsObserver
+}
+
+// WithStatsSnapshots delivers a snapshot of the client's statistics to the
+// observer at the provided interval. Snapshots begin after the client performs
+// its first request and continue until the client is closed.
+func WithStatsSnapshots(interval time.Duration, o StatsObserver) Option {
+	return func(c Config) Config {
+		c.StatsSnapshots = &StatsSnapshots{Interval: interval, Observer: o}
+		return c
+	}
+}
+
+// Statistics are shared by a client and every client derived from it
+type stats struct {
+	requests, retries, waits, errors atomic.Int64
+	bytesOut, bytesIn, conns         atomic.Int64
+	sync.Mutex
+	last   time.Time
+	byHost map[string]time.Time
+}
+
+func newStats() *stats {
+	return &stats{byHost: make(map[string]time.Time)}
+}
+
+// Note that a request failed
+func (s *stats) failed(host string) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	s.errors.Add(1)
+	s.Lock()
+	defer s.Unlock()
+	s.last = now
+	if host != "" {
+		s.byHost[host] = now
+	}
+}
+
+func (s *stats) snapshot() Stats {
+	if s == nil {
+		return Stats{}
+	}
+	v := Stats{
+		Requests:       s.requests.Load(),
+		Retries:        s.retries.Load(),
+		RateLimitWaits: s.waits.Load(),
+		Errors:         s.errors.Load(),
+		BytesOut:       s.bytesOut.Load(),
+		BytesIn:        s.bytesIn.Load(),
+		OpenConns:      s.conns.Load(),
+	}
+	s.Lock()
+	defer s.Unlock()
+	v.LastError = s.last
+	if len(s.byHost) > 0 {
+		v.LastErrors = make(map[string]time.Time, len(s.byHost))
+		for k, e := range s.byHost {
+			v.LastErrors[k] = e
+		}
+	}
+	return v
+}
+
+// Stats reports runtime statistics for the client and every client derived
+// from it.
+func (c *Client) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// A snapshotter delivers stats snapshots
+type snapshotter struct {
+	conf  StatsSnapshots
+	start sync.Once
+	stop  sync.Once
+	done  chan struct{}
+}
+
+func newSnapshotter(conf *StatsSnapshots) *snapshotter {
+	if conf == nil || conf.Interval <= 0 || conf.Observer == nil {
+		return nil
+	}
+	return &snapshotter{
+		conf: *conf,
+		done: make(chan struct{}),
+	}
+}
+
+// Start delivering snapshots if they have not been started
+func (s *snapshotter) touch(c *Client) {
+	if s == nil {
+		return
+	}
+	s.start.Do(func() {
+		go s.run(c)
+	})
+}
+
+func (s *snapshotter) run(c *Client) {
+	t := time.NewTicker(s.conf.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			s.conf.Observer.ObserveStats(c.Stats())
+		}
+	}
+}
+
+func (s *snapshotter) close() {
+	if s == nil {
+		return
+	}
+	s.stop.Do(func() {
+		close(s.done)
+	})
+}
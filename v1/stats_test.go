@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	var n int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case n == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			io.WriteString(w, "0123456789")
+		}
+	}))
+	defer s.Close()
+
+	snaps := make(chan Stats, 100)
+	c, err := New(WithBaseURL(s.URL), WithRetryStatus(http.StatusServiceUnavailable), WithRetryDelay(time.Millisecond), WithStatsSnapshots(time.Millisecond*5, StatsObserverFunc(func(s Stats) {
+		snaps <- s
+	})))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+
+	var out string
+	_, err = c.Post(context.Background(), "/", []byte("abc"), &out, WithContentType(PlainText))
+	assert.NoError(t, err)
+	d, err := c.Clone() // derived clients share stats
+	assert.NoError(t, err)
+	_, err = d.Get(context.Background(), "/missing", nil)
+	assert.Error(t, err)
+
+	host := mustParseURL(s.URL).Host
+	stats := c.Stats()
+	assert.Equal(t, int64(2), stats.Requests)
+	assert.Equal(t, int64(1), stats.Retries)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.Equal(t, int64(6), stats.BytesOut) // the body was sent twice
+	assert.Equal(t, int64(10), stats.BytesIn)
+	assert.Equal(t, int64(0), stats.OpenConns)
+	assert.False(t, stats.LastError.IsZero())
+	assert.Equal(t, stats.LastError, stats.LastErrors[host])
+
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case v := <-snaps:
+			done = v.Requests == 2 // earlier snapshots may precede the second request
+		case <-timeout:
+			t.Error("No current stats snapshot was delivered")
+			done = true
+		}
+	}
+}
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
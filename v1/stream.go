@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// A streaming body produces a request body incrementally. Since the length of
+// a streamed body is not known in advance, it is sent using chunked transfer
+// encoding. Closing the body, which the transport does when the request
+// completes or is canceled, stops a pending read.
+type streamBody struct {
+	next   func() ([]byte, error)
+	buf    bytes.Buffer
+	err    error
+	done   chan struct{}
+	closer sync.Once
+}
+
+// StreamBody creates a request body from a function which is called to pull
+// each chunk of the body as it is sent. The function returns io.EOF after the
+// final chunk has been produced; any other error aborts the request.
+func StreamBody(next func() ([]byte, error)) io.ReadCloser {
+	return &streamBody{
+		next: next,
+		done: make(chan struct{}),
+	}
+}
+
+// ChannelBody creates a request body from a channel of chunks. The body ends
+// when the channel is closed.
+func ChannelBody(ch <-chan []byte) io.ReadCloser {
+	b := &streamBody{done: make(chan struct{})}
+	b.next = func() ([]byte, error) {
+		select {
+		case c, ok := <-ch:
+			if !ok {
+				return nil, io.EOF
+			}
+			return c, nil
+		case <-b.done:
+			return nil, io.ErrClosedPipe
+		}
+	}
+	return b
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	for b.buf.Len() == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		select {
+		case <-b.done:
+			return 0, io.ErrClosedPipe
+		default:
+		}
+		var c []byte
+		c, b.err = b.next()
+		b.buf.Write(c)
+	}
+	return b.buf.Read(p)
+}
+
+func (b *streamBody) Close() error {
+	b.closer.Do(func() { close(b.done) })
+	return nil
+}
+
+// NewStreamRequest creates a builder for a request whose body is streamed
+// from the provided reader, such as one produced by StreamBody or ChannelBody,
+// using chunked transfer encoding. A streamed body cannot be replayed, so the
+// request should generally be performed with retries disabled.
+func (c *Client) NewStreamRequest(method, u, contentType string, body io.Reader) RequestBuilder {
+	return func(cxt context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(cxt, method, u, body)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = -1 // unknown; use chunked encoding
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return req, nil
+	}
+}
@@ -0,0 +1,147 @@
+// Package stub serves test doubles of an API from the catalog of endpoints a
+// client uses to call it. Each endpoint is handled by a hook; endpoints with
+// no hook respond 501 Not Implemented, so a stub only needs to implement the
+// endpoints a test exercises.
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bww/go-apiclient/v1/catalog"
+)
+
+// A request to a stubbed endpoint
+type Request struct {
+	*http.Request
+	Endpoint catalog.Endpoint
+	Vars     catalog.Vars
+	Body     []byte
+}
+
+// Unmarshal the JSON request body into the provided value
+func (r *Request) Unmarshal(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// A hook handles requests to an endpoint
+type Hook func(http.ResponseWriter, *Request)
+
+// JSON produces a hook which always responds with the provided status and
+// entity, marshaled as JSON
+func JSON(status int, entity interface{}) Hook {
+	return func(rsp http.ResponseWriter, req *Request) {
+		WriteJSON(rsp, status, entity)
+	}
+}
+
+// WriteJSON writes a JSON response
+func WriteJSON(rsp http.ResponseWriter, status int, entity interface{}) {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		http.Error(rsp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rsp.Header().Set("Content-Type", "application/json")
+	rsp.WriteHeader(status)
+	rsp.Write(data)
+}
+
+// A stub server, which implements http.Handler
+type Server struct {
+	sync.Mutex
+	catalog *catalog.Catalog
+	hooks   map[string]Hook
+	calls   map[string][]*Request
+}
+
+// New creates a stub server for the endpoints in a catalog
+func New(cat *catalog.Catalog) *Server {
+	return &Server{
+		catalog: cat,
+		hooks:   make(map[string]Hook),
+		calls:   make(map[string][]*Request),
+	}
+}
+
+// Handle sets the hook for the named endpoint, replacing any existing hook.
+// It panics if the catalog has no such endpoint, which usually means the stub
+// and the catalog have diverged.
+func (s *Server) Handle(name string, h Hook) *Server {
+	if _, ok := s.catalog.Lookup(name); !ok {
+		panic(fmt.Errorf("No such endpoint: %s", name))
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.hooks[name] = h
+	return s
+}
+
+// Calls returns the requests which have been made to the named endpoint
+func (s *Server) Calls(name string) []*Request {
+	s.Lock()
+	defer s.Unlock()
+	return append([]*Request(nil), s.calls[name]...)
+}
+
+// Reset discards the requests which have been recorded
+func (s *Server) Reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.calls = make(map[string][]*Request)
+}
+
+func (s *Server) ServeHTTP(rsp http.ResponseWriter, req *http.Request) {
+	var allow []string
+	for _, e := range s.catalog.Endpoints() {
+		vars, ok := e.Match(req.URL.EscapedPath())
+		if !ok {
+			continue
+		}
+		if e.Method != req.Method {
+			allow = append(allow, e.Method)
+			continue
+		}
+		s.serve(rsp, req, e, vars)
+		return
+	}
+	if len(allow) > 0 {
+		rsp.Header().Set("Allow", strings.Join(allow, ", "))
+		http.Error(rsp, "Method not allowed", http.StatusMethodNotAllowed)
+	} else {
+		http.NotFound(rsp, req)
+	}
+}
+
+func (s *Server) serve(rsp http.ResponseWriter, req *http.Request, e catalog.Endpoint, vars catalog.Vars) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(rsp, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	sreq := &Request{
+		Request:  req,
+		Endpoint: e,
+		Vars:     vars,
+		Body:     body,
+	}
+
+	s.Lock()
+	s.calls[e.Name] = append(s.calls[e.Name], sreq)
+	h := s.hooks[e.Name]
+	s.Unlock()
+
+	if h == nil {
+		http.Error(rsp, fmt.Sprintf("Not implemented: %s", e.Name), http.StatusNotImplemented)
+		return
+	}
+	h(rsp, sreq)
+}
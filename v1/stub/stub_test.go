@@ -0,0 +1,84 @@
+package stub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	api "github.com/bww/go-apiclient/v1"
+	"github.com/bww/go-apiclient/v1/catalog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+var endpoints = catalog.New(
+	catalog.Endpoint{Name: "GetUser", Method: http.MethodGet, Path: "/users/{id}"},
+	catalog.Endpoint{Name: "UpdateUser", Method: http.MethodPut, Path: "/users/{id}"},
+	catalog.Endpoint{Name: "ListUsers", Method: http.MethodGet, Path: "/users"},
+)
+
+func TestStub(t *testing.T) {
+	stub := New(endpoints).
+		Handle("GetUser", func(rsp http.ResponseWriter, req *Request) {
+			WriteJSON(rsp, http.StatusOK, user{ID: req.Vars["id"], Name: "Alice"})
+		}).
+		Handle("UpdateUser", func(rsp http.ResponseWriter, req *Request) {
+			var u user
+			if err := req.Unmarshal(&u); err != nil {
+				WriteJSON(rsp, http.StatusBadRequest, err.Error())
+				return
+			}
+			u.ID = req.Vars["id"]
+			WriteJSON(rsp, http.StatusOK, u)
+		})
+	svr := httptest.NewServer(stub)
+	defer svr.Close()
+
+	cxt := context.Background()
+	client, err := api.New(api.WithBaseURL(svr.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ep, _ := endpoints.Lookup("GetUser")
+	u, err := ep.URL(catalog.Vars{"id": "a/b"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/users/a%2Fb", u)
+	}
+	var res user
+	_, err = client.Get(cxt, u, &res)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user{ID: "a/b", Name: "Alice"}, res)
+	}
+
+	ep, _ = endpoints.Lookup("UpdateUser")
+	u, _ = ep.URL(catalog.Vars{"id": "123"})
+	_, err = client.Put(cxt, u, user{Name: "Bob"}, &res)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user{ID: "123", Name: "Bob"}, res)
+	}
+	if calls := stub.Calls("UpdateUser"); assert.Len(t, calls, 1) {
+		assert.Equal(t, catalog.Vars{"id": "123"}, calls[0].Vars)
+	}
+
+	var apierr *api.Error
+	_, err = client.Get(cxt, "/users", nil)
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Equal(t, http.StatusNotImplemented, apierr.Status, "unhandled endpoints are not implemented")
+	}
+	_, err = client.Delete(cxt, "/users/123", nil, nil)
+	if assert.ErrorAs(t, err, &apierr) {
+		assert.Equal(t, http.StatusMethodNotAllowed, apierr.Status)
+	}
+	_, err = client.Get(cxt, "/missing", nil)
+	assert.ErrorIs(t, err, api.ErrNotFound)
+
+	_, err = ep.URL(nil)
+	assert.ErrorIs(t, err, catalog.ErrMissingVariable)
+}
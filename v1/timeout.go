@@ -0,0 +1,242 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrAttemptTimeout = errors.New("Request attempt timed out")
+
+const (
+	defaultAdaptivePercentile = 0.99
+	defaultAdaptiveFactor     = 3
+	defaultAdaptiveSamples    = 256
+	defaultAdaptiveMinSamples = 20
+	defaultAdaptiveEndpoints  = 1024
+)
+
+// Adaptive timeouts track the latency of each endpoint and limit the time
+// each attempt may wait for a response to a multiple of a latency percentile
+// for that endpoint, within a floor and ceiling. Latency is measured as the
+// time until response headers are received; reading the response body is
+// not subject to the adaptive timeout. An attempt which times out is recorded
+// with the latency of its timeout, which it took at least, so that timeouts
+// grow for an endpoint which becomes slower.
+//
+// Until an endpoint has accumulated enough samples, only the client's
+// overall timeout applies.
+type AdaptiveTimeout struct {
+	// The latency percentile to use, from 0 to 1; defaults to 0.99
+	Percentile float64
+	// The multiple of the percentile which is permitted; defaults to 3
+	Factor float64
+	// The minimum and maximum timeouts. A zero ceiling is unbounded.
+	Floor, Ceiling time.Duration
+	// The number of recent samples retained per endpoint; defaults to 256
+	Samples int
+	// The minimum number of samples required before timeouts are applied to
+	// an endpoint; defaults to 20
+	MinSamples int
+	// The number of endpoints tracked; beyond this, the least recently used
+	// endpoint is discarded. Defaults to 1024.
+	Endpoints int
+	// Derives an endpoint identifier from a request; by default, the method
+	// and path are used. Endpoints with variable path components should
+	// generally be normalized, e.g., "/users/123" to "/users/{id}".
+	Keyer func(*http.Request) string
+}
+
+// WithAdaptiveTimeout enables adaptive per-attempt timeouts
+func WithAdaptiveTimeout(a AdaptiveTimeout) Option {
+	return func(c Config) Config {
+		c.AdaptiveTimeout = &a
+		return c
+	}
+}
+
+func defaultEndpointKey(req *http.Request) string {
+	return req.Method + " " + req.URL.Path
+}
+
+// A latency tracker records recent latencies per endpoint, with
+// least-recently-used eviction of endpoints
+type latencyTracker struct {
+	sync.Mutex
+	conf      AdaptiveTimeout
+	endpoints map[string]*list.Element
+	order     *list.List
+}
+
+type latencyEntry struct {
+	key    string
+	window latencyWindow
+}
+
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+// Add a sample, retaining at most n samples
+func (w *latencyWindow) add(d time.Duration, n int) {
+	if len(w.samples) < n {
+		w.samples = append(w.samples, d)
+	} else {
+		w.samples[w.next] = d
+	}
+	w.next = (w.next + 1) % n
+}
+
+// Produce a sorted copy of the samples
+func (w *latencyWindow) sorted() []time.Duration {
+	s := append([]time.Duration(nil), w.samples...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s
+}
+
+// Select a percentile from sorted samples
+func percentile(s []time.Duration, p float64) time.Duration {
+	if len(s) == 0 {
+		return 0
+	}
+	return s[min(len(s)-1, int(float64(len(s))*p))]
+}
+
+func newLatencyTracker(conf *AdaptiveTimeout) *latencyTracker {
+	if conf == nil {
+		return nil
+	}
+	c := *conf
+	if c.Percentile <= 0 || c.Percentile > 1 {
+		c.Percentile = defaultAdaptivePercentile
+	}
+	if c.Factor <= 0 {
+		c.Factor = defaultAdaptiveFactor
+	}
+	if c.Samples <= 0 {
+		c.Samples = defaultAdaptiveSamples
+	}
+	if c.MinSamples <= 0 {
+		c.MinSamples = defaultAdaptiveMinSamples
+	}
+	if c.Endpoints <= 0 {
+		c.Endpoints = defaultAdaptiveEndpoints
+	}
+	if c.Keyer == nil {
+		c.Keyer = defaultEndpointKey
+	}
+	return &latencyTracker{
+		conf:      c,
+		endpoints: make(map[string]*list.Element),
+		order:     list.New(),
+	}
+}
+
+// Record the latency of a request
+func (t *latencyTracker) Record(req *http.Request, d time.Duration) {
+	k := t.conf.Keyer(req)
+	t.Lock()
+	defer t.Unlock()
+	e, ok := t.endpoints[k]
+	if ok {
+		t.order.MoveToFront(e)
+	} else {
+		e = t.order.PushFront(&latencyEntry{key: k})
+		t.endpoints[k] = e
+		for t.order.Len() > t.conf.Endpoints {
+			b := t.order.Back()
+			t.order.Remove(b)
+			delete(t.endpoints, b.Value.(*latencyEntry).key)
+		}
+	}
+	e.Value.(*latencyEntry).window.add(d, t.conf.Samples)
+}
+
+// Timeout produces the timeout for an attempt of a request, if one applies
+func (t *latencyTracker) Timeout(req *http.Request) (time.Duration, bool) {
+	k := t.conf.Keyer(req)
+	t.Lock()
+	e, ok := t.endpoints[k]
+	if !ok {
+		t.Unlock()
+		return 0, false
+	}
+	t.order.MoveToFront(e)
+	w := &e.Value.(*latencyEntry).window
+	if len(w.samples) < t.conf.MinSamples {
+		t.Unlock()
+		return 0, false
+	}
+	s := w.sorted()
+	t.Unlock()
+
+	d := time.Duration(float64(percentile(s, t.conf.Percentile)) * t.conf.Factor)
+	if d < t.conf.Floor {
+		d = t.conf.Floor
+	}
+	if c := t.conf.Ceiling; c > 0 && d > c {
+		d = c
+	}
+	return d, true
+}
+
+// Perform a single attempt of a request, applying an adaptive timeout if one
+// is in effect. The attempt's context is released when the response body is
+// closed.
+func (c *Client) attempt(req *http.Request) (*http.Response, error) {
+	if c.Client.Jar != nil { // the jar adds its cookies to the request it is given, which must not accumulate over retries
+		req = req.Clone(req.Context())
+	}
+	if c.latency == nil {
+		return c.Client.Do(req)
+	}
+	start := time.Now()
+	timeout, ok := c.latency.Timeout(req)
+	if !ok {
+		rsp, err := c.Client.Do(req)
+		if err == nil {
+			c.latency.Record(req, time.Since(start))
+		}
+		return rsp, err
+	}
+
+	cxt, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(timeout, func() {
+		cancel(ErrAttemptTimeout)
+	})
+	rsp, err := c.Client.Do(req.WithContext(cxt))
+	if !timer.Stop() { // the timer already fired; the attempt timed out
+		if err == nil {
+			rsp.Body.Close()
+		}
+		cancel(nil)
+		c.latency.Record(req, timeout) // it took at least this long; without this, an endpoint which slows down would never be waited for
+		return nil, fmt.Errorf("%w after %v", ErrAttemptTimeout, timeout)
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	c.latency.Record(req, time.Since(start))
+	rsp.Body = &cancelBody{ReadCloser: rsp.Body, cancel: cancel}
+	return rsp, nil
+}
+
+// A response body which releases its request context when it is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelCauseFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// The timings of the attempt which produced a response. Phases of connection
+// establishment are zero when an existing connection is reused. The transfer
+// duration and response size are known once the response body has been read
+// to its end or closed.
+type Timings struct {
+	// Whether an existing connection was reused
+	Reused bool
+	// Resolving the host
+	DNS time.Duration
+	// Establishing a TCP connection
+	Connect time.Duration
+	// Performing the TLS handshake
+	TLS time.Duration
+	// From the start of the attempt until the first byte of the response
+	TTFB time.Duration
+	// From the first byte of the response until its body was consumed
+	Transfer time.Duration
+	// From the start of the attempt until its body was consumed, or until the
+	// first byte of the response if its body has not yet been consumed
+	Total time.Duration
+	// The size of the request body, if it is known, or -1
+	RequestSize int64
+	// The number of bytes of the response body which have been read
+	ResponseSize int64
+}
+
+func (t Timings) String() string {
+	b := &strings.Builder{}
+	if t.Reused {
+		b.WriteString("reused")
+	} else {
+		fmt.Fprintf(b, "dns %v, connect %v", t.DNS, t.Connect)
+		if t.TLS > 0 {
+			fmt.Fprintf(b, ", tls %v", t.TLS)
+		}
+	}
+	fmt.Fprintf(b, ", ttfb %v", t.TTFB)
+	if t.Transfer > 0 {
+		fmt.Fprintf(b, ", transfer %v (%s)", t.Transfer, humanize.Bytes(uint64(t.ResponseSize)))
+	}
+	return b.String()
+}
+
+type timingKey struct{}
+
+// ResponseTimings produces the timings of the attempt which produced a
+// response, if they are available. Timings are available for responses
+// produced by the network, which includes responses provided to observers,
+// but not for those produced from a cache.
+func ResponseTimings(rsp *http.Response) (Timings, bool) {
+	if rsp == nil || rsp.Request == nil {
+		return Timings{}, false
+	}
+	t, ok := rsp.Request.Context().Value(timingKey{}).(*timing)
+	if !ok {
+		return Timings{}, false
+	}
+	return t.get(), true
+}
+
+// Timing records the timings of an attempt as it progresses
+type timing struct {
+	sync.Mutex
+	start, dns, connect, tls, first, done time.Time
+	timings                               Timings
+	stats                                 *stats
+	conn                                  bool // a connection is held and counted in stats
+}
+
+func newTiming(req *http.Request) *timing {
+	size := req.ContentLength
+	if size == 0 && req.Body != nil && req.Body != http.NoBody {
+		size = -1 // unknown
+	}
+	return &timing{
+		start:   time.Now(),
+		timings: Timings{RequestSize: size},
+	}
+}
+
+// Record the attempt in a client's stats
+func (t *timing) observe(s *stats) *timing {
+	t.stats = s
+	if s != nil && t.timings.RequestSize > 0 {
+		s.bytesOut.Add(t.timings.RequestSize)
+	}
+	return t
+}
+
+// Produce a request for an attempt which records its timings
+func (t *timing) request(req *http.Request) *http.Request {
+	cxt := context.WithValue(req.Context(), timingKey{}, t)
+	return req.WithContext(httptrace.WithClientTrace(cxt, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.Lock()
+			defer t.Unlock()
+			t.timings.Reused = info.Reused
+			if t.stats != nil && !t.conn && t.done.IsZero() {
+				t.stats.conns.Add(1)
+				t.conn = true
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mark(&t.dns)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.elapsed(t.dns, &t.timings.DNS)
+		},
+		ConnectStart: func(string, string) {
+			t.mark(&t.connect)
+		},
+		ConnectDone: func(string, string, error) {
+			t.elapsed(t.connect, &t.timings.Connect)
+		},
+		TLSHandshakeStart: func() {
+			t.mark(&t.tls)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.elapsed(t.tls, &t.timings.TLS)
+		},
+		GotFirstResponseByte: func() {
+			t.Lock()
+			defer t.Unlock()
+			t.first = time.Now()
+			t.timings.TTFB = t.first.Sub(t.start)
+		},
+	}))
+}
+
+func (t *timing) mark(v *time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	*v = time.Now()
+}
+
+func (t *timing) elapsed(since time.Time, v *time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	*v = time.Since(since)
+}
+
+// Record bytes of the response body which have been read
+func (t *timing) read(n int) {
+	t.Lock()
+	defer t.Unlock()
+	t.timings.ResponseSize += int64(n)
+	if t.stats != nil {
+		t.stats.bytesIn.Add(int64(n))
+	}
+}
+
+// Note that the response body has been consumed
+func (t *timing) finish() {
+	t.Lock()
+	defer t.Unlock()
+	if t.done.IsZero() {
+		t.done = time.Now()
+	}
+	t.releaseConn()
+}
+
+// Note that the connection, if any, is no longer held by the attempt
+func (t *timing) release() {
+	t.Lock()
+	defer t.Unlock()
+	t.releaseConn()
+}
+
+// The caller must hold the lock
+func (t *timing) releaseConn() {
+	if t.conn {
+		t.stats.conns.Add(-1)
+		t.conn = false
+	}
+}
+
+func (t *timing) get() Timings {
+	t.Lock()
+	defer t.Unlock()
+	v := t.timings
+	if !t.done.IsZero() {
+		if !t.first.IsZero() {
+			v.Transfer = t.done.Sub(t.first)
+		}
+		v.Total = t.done.Sub(t.start)
+	} else {
+		v.Total = v.TTFB
+	}
+	return v
+}
+
+// A response body which records its transfer
+type timedBody struct {
+	io.ReadCloser
+	timing *timing
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.timing.read(n)
+	if err == io.EOF {
+		b.timing.finish()
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	b.timing.finish()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type timingObserver struct {
+	timings []Timings
+}
+
+func (o *timingObserver) Preflight(*http.Request) error { return nil }
+func (o *timingObserver) Failure(*http.Request, error)  {}
+
+func (o *timingObserver) Postflight(req *http.Request, rsp *http.Response) error {
+	if t, ok := ResponseTimings(rsp); ok {
+		o.timings = append(o.timings, t)
+	}
+	return nil
+}
+
+func TestTimings(t *testing.T) {
+	body := strings.Repeat("x", 1024)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.Header().Set("Content-Type", PlainText)
+		io.WriteString(rsp, body)
+	}))
+	defer server.Close()
+
+	obs := &timingObserver{}
+	client, err := New(WithBaseURL(server.URL), WithObservers(obs))
+	if !assert.NoError(t, err) {
+		return
+	}
+	client = client.WithTimeout(0)
+	client.Client.Transport = server.Client().Transport
+	cxt := context.Background()
+
+	req, err := http.NewRequestWithContext(cxt, http.MethodGet, server.URL+"/a", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rsp, err := client.ExecRaw(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	tm, ok := ResponseTimings(rsp)
+	if assert.True(t, ok) {
+		assert.False(t, tm.Reused)
+		assert.True(t, tm.Connect > 0)
+		assert.True(t, tm.TLS > 0)
+		assert.True(t, tm.TTFB > 0)
+		assert.Equal(t, tm.TTFB, tm.Total)
+		assert.Equal(t, int64(0), tm.ResponseSize)
+	}
+	data, err := io.ReadAll(rsp.Body)
+	assert.NoError(t, err)
+	rsp.Body.Close()
+	assert.Len(t, data, len(body))
+	tm, _ = ResponseTimings(rsp)
+	assert.Equal(t, int64(len(body)), tm.ResponseSize)
+	assert.True(t, tm.Total >= tm.TTFB+tm.Transfer)
+
+	_, err = client.Get(cxt, "/b", nil)
+	assert.NoError(t, err)
+	if assert.Len(t, obs.timings, 2) {
+		assert.True(t, obs.timings[1].Reused)
+		assert.Equal(t, int64(0), obs.timings[1].RequestSize)
+	}
+
+	_, ok = ResponseTimings(&http.Response{Request: httptest.NewRequest(http.MethodGet, "/", nil)})
+	assert.False(t, ok)
+}
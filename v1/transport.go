@@ -0,0 +1,104 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var ErrCustomTransport = errors.New("Cannot configure a custom transport")
+
+// WithTLSConfig sets the TLS configuration used to connect to services. Other
+// TLS options are applied to a copy of this configuration.
+func WithTLSConfig(t *tls.Config) Option {
+	return func(c Config) Config {
+		c.TLSConfig = t
+		return c
+	}
+}
+
+// WithClientCertificate authenticates the client to services which require
+// mutual TLS using the certificate and key in the provided PEM files, which
+// are loaded when the client is created.
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(c Config) Config {
+		c.ClientCert, c.ClientKey = certFile, keyFile
+		return c
+	}
+}
+
+// WithRootCAs sets the certificate authorities which are trusted to verify
+// services, instead of the system's.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(c Config) Config {
+		c.RootCAs = pool
+		return c
+	}
+}
+
+// Determine whether a configuration customizes the transport
+func hasTransportConfig(conf Config) bool {
+	return conf.Proxy != "" || conf.ProxyFunc != nil || conf.TLSConfig != nil || conf.ClientCert != "" || conf.RootCAs != nil
+}
+
+// Produce a client whose transport is customized by the configuration. Since
+// the underlying client may be shared, a copy of it and its transport is
+// customized, which must be an *http.Transport or nil. Once the configuration
+// has been applied, the transport options are cleared from it, since clients
+// derived from it inherit the customized underlying client.
+func transportClient(client *http.Client, conf *Config) (*http.Client, error) {
+	if !hasTransportConfig(*conf) {
+		return client, nil
+	}
+	var tsp *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		tsp = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		tsp = t.Clone()
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrCustomTransport, t)
+	}
+
+	proxy, err := proxyFunc(*conf)
+	if err != nil {
+		return nil, err
+	}
+	if proxy != nil {
+		tsp.Proxy = proxy
+		tsp.OnProxyConnectResponse = rejectProxyConnect(tsp.OnProxyConnectResponse)
+	}
+
+	if conf.TLSConfig != nil || conf.ClientCert != "" || conf.RootCAs != nil {
+		cfg := tsp.TLSClientConfig
+		if conf.TLSConfig != nil {
+			cfg = conf.TLSConfig.Clone()
+		} else if cfg != nil {
+			cfg = cfg.Clone()
+		} else {
+			cfg = &tls.Config{}
+		}
+		if conf.RootCAs != nil {
+			cfg.RootCAs = conf.RootCAs
+		}
+		if conf.ClientCert != "" {
+			cert, err := tls.LoadX509KeyPair(conf.ClientCert, conf.ClientKey)
+			if err != nil {
+				return nil, fmt.Errorf("Could not load client certificate: %w", err)
+			}
+			cfg.Certificates = append(cfg.Certificates, cert)
+		}
+		tsp.TLSClientConfig = cfg
+	}
+
+	tc := *client
+	tc.Transport = tsp
+	if conf.Timeout > 0 {
+		tc.Timeout = conf.Timeout
+	}
+	conf.Proxy, conf.ProxyFunc = "", nil
+	conf.TLSConfig, conf.ClientCert, conf.ClientKey, conf.RootCAs = nil, "", "", nil
+	return &tc, nil
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Write a self-signed client certificate and its key to a directory
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	cert, certFile, keyFile := writeClientCert(t, t.TempDir())
+	clients := x509.NewCertPool()
+	clients.AddCert(cert)
+
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	svr.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clients}
+	svr.StartTLS()
+	defer svr.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(svr.Certificate())
+	cxt := context.Background()
+
+	client, err := New(WithBaseURL(svr.URL), WithRootCAs(roots))
+	if assert.NoError(t, err) {
+		_, err = client.Get(cxt, "/", nil)
+		assert.Error(t, err, "the server requires a client certificate")
+	}
+
+	client, err = New(WithBaseURL(svr.URL), WithRootCAs(roots), WithClientCertificate(certFile, keyFile), WithTimeout(time.Second*5))
+	if assert.NoError(t, err) {
+		_, err = client.Get(cxt, "/", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Second*5, client.Client.Timeout)
+		assert.Nil(t, sharedClient.Transport, "the shared client must not be modified")
+	}
+
+	clone, err := client.Clone(WithHeader("X-Test", "yes"))
+	if assert.NoError(t, err) {
+		assert.Same(t, client.Client, clone.Client, "derived clients inherit the customized transport")
+		_, err = clone.Get(cxt, "/", nil)
+		assert.NoError(t, err)
+	}
+
+	_, err = New(WithClientCertificate(filepath.Join(t.TempDir(), "missing.crt"), keyFile))
+	assert.Error(t, err)
+}
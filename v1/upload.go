@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithUploadMethod sets the method of the request which uploads a file; by
+// default, POST.
+func WithUploadMethod(m string) FileOption {
+	return func(c FileConfig) FileConfig {
+		c.Method = m
+		return c
+	}
+}
+
+// WithFileContentType sets the content type of an uploaded file. By default,
+// it is determined from the file's extension or, failing that, by sniffing
+// its content.
+func WithFileContentType(ctype string) FileOption {
+	return func(c FileConfig) FileConfig {
+		c.ContentType = ctype
+		return c
+	}
+}
+
+// WithMultipartField causes a file to be uploaded as a part of a
+// multipart/form-data request body with the provided field name, rather than
+// as the request body itself. The part's filename is the base name of the
+// file unless one is provided.
+func WithMultipartField(field, filename string) FileOption {
+	return func(c FileConfig) FileConfig {
+		c.Field, c.Filename = field, filename
+		return c
+	}
+}
+
+// UploadFile uploads the file at the provided path to the provided URL and
+// attempts to unmarshal the response into the provided entity. The file is
+// streamed as the request body, or as part of a multipart body, and the
+// request has a Content-Length. Since the file is opened again when the body
+// must be produced again, requests which upload a file may be retried.
+func (c *Client) UploadFile(cxt context.Context, u, path string, output interface{}, opts ...FileOption) (*http.Response, error) {
+	conf := FileConfig{Method: http.MethodPost}.WithOptions(opts)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	ctype := conf.ContentType
+	if ctype == "" {
+		ctype, err = detectFileType(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var prefix, suffix []byte
+	if conf.Field != "" {
+		name := conf.Filename
+		if name == "" {
+			name = filepath.Base(path)
+		}
+		b := &bytes.Buffer{}
+		mw := multipart.NewWriter(b)
+		hdr := make(textproto.MIMEHeader)
+		hdr.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(conf.Field), escapeQuotes(name)))
+		hdr.Set("Content-Type", ctype)
+		if _, err := mw.CreatePart(hdr); err != nil {
+			return nil, err
+		}
+		prefix = append([]byte(nil), b.Bytes()...)
+		b.Reset()
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+		suffix = append([]byte(nil), b.Bytes()...)
+		ctype = mw.FormDataContentType()
+	}
+
+	size := int64(len(prefix)) + info.Size() + int64(len(suffix))
+	open := func() (io.ReadCloser, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		var r io.Reader = f
+		if conf.Field != "" {
+			r = io.MultiReader(bytes.NewReader(prefix), f, bytes.NewReader(suffix))
+		}
+		if conf.Progress != nil {
+			r = &progressReader{Reader: r, total: size, fn: conf.Progress}
+		}
+		return fileBody{r, f}, nil
+	}
+
+	body, err := open()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(cxt, conf.Method, u, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	req.ContentLength = size
+	req.GetBody = open
+	req.Header.Set("Content-Type", ctype)
+	return c.Exec(req, output, conf.Options...)
+}
+
+// The body of a request which uploads a file
+type fileBody struct {
+	io.Reader
+	io.Closer
+}
+
+// Determine the content type of a file from its extension or its content
+func detectFileType(path string) (string, error) {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b := make([]byte, 512)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(b[:n]), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
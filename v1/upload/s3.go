@@ -0,0 +1,152 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	api "github.com/bww/go-apiclient/v1"
+)
+
+// S3 uploads to a service shaped like S3 multipart uploads: an upload is
+// initiated by a POST with the query parameter "uploads", parts are uploaded
+// by PUT with the query parameters "partNumber" and "uploadId", and the upload
+// is completed by a POST listing the ETag of each part. Requests are expected
+// to be authorized by the client's authorizer.
+type S3 struct {
+	URL string // the URL of the object
+}
+
+type s3Initiate struct {
+	UploadId string
+}
+
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3Complete struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []s3Part `xml:"Part"`
+}
+
+type s3Error struct {
+	XMLName xml.Name
+	Code    string
+	Message string
+}
+
+func (s S3) Create(cxt context.Context, c *api.Client, size int64) (Session, error) {
+	u, err := api.URLWithParams(s.URL, url.Values{"uploads": {""}})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(cxt, http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	var res s3Initiate
+	if err := s3Exec(c, req, &res); err != nil {
+		return nil, err
+	}
+	if res.UploadId == "" {
+		return nil, errors.New("Service did not provide an upload ID")
+	}
+	return &s3Session{conf: s, id: res.UploadId, etags: make(map[int]string)}, nil
+}
+
+type s3Session struct {
+	conf  S3
+	id    string
+	etags map[int]string
+}
+
+func (s *s3Session) url(params url.Values) (string, error) {
+	params.Set("uploadId", s.id)
+	return api.URLWithParams(s.conf.URL, params)
+}
+
+func (s *s3Session) Request(cxt context.Context, p Part) (*http.Request, error) {
+	u, err := s.url(url.Values{"partNumber": {strconv.Itoa(p.Number)}})
+	if err != nil {
+		return nil, err
+	}
+	return http.NewRequestWithContext(cxt, http.MethodPut, u, bytes.NewReader(p.Data))
+}
+
+func (s *s3Session) Uploaded(p Part, rsp *http.Response) error {
+	etag := rsp.Header.Get("ETag")
+	if etag == "" {
+		return errors.New("Part has no ETag")
+	}
+	s.etags[p.Number] = etag
+	return nil
+}
+
+func (s *s3Session) Finalize(cxt context.Context, c *api.Client) (*http.Response, error) {
+	var body s3Complete
+	for k, v := range s.etags {
+		body.Parts = append(body.Parts, s3Part{PartNumber: k, ETag: v})
+	}
+	sort.Slice(body.Parts, func(i, j int) bool { return body.Parts[i].PartNumber < body.Parts[j].PartNumber })
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.url(url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(cxt, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	rsp, err := c.ExecRaw(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	// the service may report a failure in the body of a successful response
+	data, err = io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var serr s3Error
+	if xml.Unmarshal(data, &serr) == nil && serr.XMLName.Local == "Error" {
+		return nil, fmt.Errorf("Could not complete upload: %s: %s", serr.Code, serr.Message)
+	}
+	rsp.Body = io.NopCloser(bytes.NewReader(data))
+	return rsp, nil
+}
+
+func (s *s3Session) Abort(cxt context.Context, c *api.Client) error {
+	u, err := s.url(url.Values{})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(cxt, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.Exec(req, nil)
+	return err
+}
+
+// Perform a request and unmarshal its XML response
+func s3Exec(c *api.Client, req *http.Request, entity interface{}) error {
+	rsp, err := c.ExecRaw(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	return xml.NewDecoder(rsp.Body).Decode(entity)
+}
@@ -0,0 +1,120 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	api "github.com/bww/go-apiclient/v1"
+)
+
+const tusVersion = "1.0.0"
+
+// TUS uploads to a tus.io server which supports the creation-with-upload and
+// concatenation extensions. Each part is uploaded in parallel as a partial
+// upload which is created along with its content, and the partial uploads are
+// then concatenated into a final upload. Aborting an upload requires the
+// termination extension.
+type TUS struct {
+	URL      string            // the creation endpoint
+	Metadata map[string]string // set on the final upload
+}
+
+func (t TUS) Create(cxt context.Context, c *api.Client, size int64) (Session, error) {
+	return &tusSession{conf: t, parts: make(map[int]string)}, nil
+}
+
+type tusSession struct {
+	conf  TUS
+	parts map[int]string // partial upload URLs by part number
+}
+
+func (s *tusSession) Request(cxt context.Context, p Part) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(cxt, http.MethodPost, s.conf.URL, bytes.NewReader(p.Data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Concat", "partial")
+	req.Header.Set("Upload-Length", strconv.Itoa(len(p.Data)))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	return req, nil
+}
+
+func (s *tusSession) Uploaded(p Part, rsp *http.Response) error {
+	loc, err := rsp.Location()
+	if err != nil {
+		return fmt.Errorf("Partial upload has no location: %w", err)
+	}
+	if v := rsp.Header.Get("Upload-Offset"); v != "" && v != strconv.Itoa(len(p.Data)) {
+		return fmt.Errorf("Partial upload is incomplete: %s of %d bytes", v, len(p.Data))
+	}
+	s.parts[p.Number] = loc.String()
+	return nil
+}
+
+func (s *tusSession) Finalize(cxt context.Context, c *api.Client) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(cxt, http.MethodPost, s.conf.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Concat", "final;"+strings.Join(s.urls(), " "))
+	if len(s.conf.Metadata) > 0 {
+		req.Header.Set("Upload-Metadata", tusMetadata(s.conf.Metadata))
+	}
+	return c.Exec(req, nil)
+}
+
+func (s *tusSession) Abort(cxt context.Context, c *api.Client) error {
+	var errs []error
+	for _, e := range s.urls() {
+		req, err := http.NewRequestWithContext(cxt, http.MethodDelete, e, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Tus-Resumable", tusVersion)
+		_, err = c.Exec(req, nil)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Could not terminate %d partial uploads; first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// The partial upload URLs in part order
+func (s *tusSession) urls() []string {
+	n := make([]int, 0, len(s.parts))
+	for k := range s.parts {
+		n = append(n, k)
+	}
+	sort.Ints(n)
+	res := make([]string, len(n))
+	for i, e := range n {
+		res[i] = s.parts[e]
+	}
+	return res
+}
+
+// Encode metadata as tus expects: comma-separated pairs of a key and its
+// base64-encoded value
+func tusMetadata(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + " " + base64.StdEncoding.EncodeToString([]byte(m[k]))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,225 @@
+// Package upload implements resumable uploads, in which a large entity is
+// split into parts which are uploaded in parallel, individually retried when
+// they fail, and finally assembled by the service. Services describe how this
+// is done with a Protocol; adapters are provided for tus.io and for services
+// shaped like S3 multipart uploads.
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	api "github.com/bww/go-apiclient/v1"
+	"github.com/bww/go-apiclient/v1/multiplex"
+)
+
+var ErrSizeMismatch = errors.New("Upload size mismatch")
+
+const (
+	defaultPartSize = 5 << 20 // the minimum part size for S3
+	defaultRetries  = 3
+)
+
+// A part of an upload. Parts are numbered from 1 in the order they appear in
+// the entity.
+type Part struct {
+	Number int
+	Offset int64
+	Data   []byte
+}
+
+// A protocol begins uploads to a service
+type Protocol interface {
+	// Create begins an upload of an entity with the provided size, which is -1
+	// if the size is not known in advance.
+	Create(cxt context.Context, c *api.Client, size int64) (Session, error)
+}
+
+// A session is an upload in progress
+type Session interface {
+	// Request produces the request which uploads a part. It may be called
+	// again for the same part if uploading it fails and the part is retried.
+	Request(cxt context.Context, p Part) (*http.Request, error)
+	// Uploaded records the response to a request which uploaded a part. It is
+	// never called concurrently.
+	Uploaded(p Part, rsp *http.Response) error
+	// Finalize assembles the uploaded parts once every part has been uploaded
+	Finalize(cxt context.Context, c *api.Client) (*http.Response, error)
+	// Abort discards an upload which could not be completed
+	Abort(cxt context.Context, c *api.Client) error
+}
+
+type Config struct {
+	PartSize int64
+	Retries  int
+	Progress func(n, total int64)
+	Options  []multiplex.Option
+}
+
+func (c Config) WithOptions(opts []Option) Config {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type Option func(Config) Config
+
+// WithPartSize sets the size of each part of an upload except the last, which
+// may be smaller; by default, 5 MiB.
+func WithPartSize(n int64) Option {
+	return func(c Config) Config {
+		c.PartSize = n
+		return c
+	}
+}
+
+// WithRetries sets the number of times parts which failed to upload are
+// retried before the upload is aborted; by default, 3. This is in addition to
+// any retries performed by the client for each request.
+func WithRetries(n int) Option {
+	return func(c Config) Config {
+		c.Retries = n
+		return c
+	}
+}
+
+// WithProgress sets a function which is invoked with the number of bytes that
+// have been uploaded, and the total, which is -1 if it is not known, each time
+// a part is uploaded. The function is invoked serially.
+func WithProgress(fn func(n, total int64)) Option {
+	return func(c Config) Config {
+		c.Progress = fn
+		return c
+	}
+}
+
+// WithMuxOptions sets options used to multiplex the requests which upload
+// parts.
+func WithMuxOptions(opts ...multiplex.Option) Option {
+	return func(c Config) Config {
+		c.Options = append(c.Options, opts...)
+		return c
+	}
+}
+
+// An uploader performs uploads using a protocol, uploading parts in parallel
+// with a multiplexer.
+type Uploader struct {
+	mux   *multiplex.Mux
+	proto Protocol
+	conf  Config
+}
+
+func New(mux *multiplex.Mux, proto Protocol, opts ...Option) *Uploader {
+	return &Uploader{
+		mux:   mux,
+		proto: proto,
+		conf:  Config{PartSize: defaultPartSize, Retries: defaultRetries}.WithOptions(opts),
+	}
+}
+
+// Upload reads an entity from the provided reader, which has the provided size
+// or -1 if its size is not known, and uploads it in parts. Parts are read as
+// they are dispatched, so at most a few parts per concurrent request are held
+// in memory at once. If any part cannot be uploaded after it has been retried,
+// the upload is aborted. The response to the request which finalized the
+// upload is returned; its body has been consumed.
+func (u *Uploader) Upload(cxt context.Context, r io.Reader, size int64) (*http.Response, error) {
+	sess, err := u.proto.Create(cxt, u.mux.Client, size)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create upload: %w", err)
+	}
+	rsp, err := u.upload(cxt, sess, r, size)
+	if err != nil {
+		if aerr := sess.Abort(context.WithoutCancel(cxt), u.mux.Client); aerr != nil {
+			err = fmt.Errorf("%w (could not abort upload: %v)", err, aerr)
+		}
+		return nil, err
+	}
+	return rsp, nil
+}
+
+func (u *Uploader) upload(cxt context.Context, sess Session, r io.Reader, size int64) (*http.Response, error) {
+	var offset, sent int64
+	var done bool
+	read := func(i int) (*Part, error) {
+		if done {
+			return nil, nil
+		}
+		buf := make([]byte, max(u.conf.PartSize, 1))
+		n, err := io.ReadFull(r, buf)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			done = true
+			if n == 0 && i > 0 {
+				return nil, nil
+			}
+		} else if err != nil {
+			return nil, fmt.Errorf("Could not read part %d: %w", i+1, err)
+		}
+		p := &Part{Number: i + 1, Offset: offset, Data: buf[:n]}
+		offset += int64(n)
+		return p, nil
+	}
+
+	next := func(i int) (*Part, error) { // initially, parts are read from the entity
+		return read(i)
+	}
+	var failed []Part
+	var cause error
+	for attempt := 0; ; attempt++ {
+		err := u.mux.DoFunc(cxt, multiplex.MetaRequestProducerFunc(func(i int) (*http.Request, any, error) {
+			p, err := next(i)
+			if err != nil || p == nil {
+				return nil, nil, err
+			}
+			req, err := sess.Request(cxt, *p)
+			if err != nil {
+				return nil, nil, err
+			}
+			return req, *p, nil
+		}), func(res *multiplex.Result) error {
+			p := res.Meta.(Part)
+			if res.Err != nil {
+				failed = append(failed, p)
+				if cause == nil {
+					cause = res.Err
+				}
+				return nil
+			}
+			if err := sess.Uploaded(p, res.Response); err != nil {
+				return fmt.Errorf("Could not upload part %d: %w", p.Number, err)
+			}
+			sent += int64(len(p.Data))
+			if u.conf.Progress != nil {
+				u.conf.Progress(sent, size)
+			}
+			return nil
+		}, append(u.conf.Options, multiplex.WithPartialFailures())...)
+		if err != nil {
+			return nil, err
+		}
+		if len(failed) == 0 {
+			break
+		}
+		if attempt >= u.conf.Retries {
+			return nil, fmt.Errorf("Could not upload %d parts: %w", len(failed), cause)
+		}
+		retry := failed
+		failed, cause = nil, nil
+		next = func(i int) (*Part, error) { // subsequently, only the parts that failed are uploaded
+			if i < len(retry) {
+				return &retry[i], nil
+			}
+			return nil, nil
+		}
+	}
+
+	if size >= 0 && offset != size {
+		return nil, fmt.Errorf("%w: expected %d bytes, read %d", ErrSizeMismatch, size, offset)
+	}
+	return sess.Finalize(cxt, u.mux.Client)
+}
@@ -0,0 +1,170 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	api "github.com/bww/go-apiclient/v1"
+	"github.com/bww/go-apiclient/v1/multiplex"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var content = []byte("The quick brown fox jumps over the lazy dog")
+
+// A fake tus server which fails the first attempt to upload one part
+type tusServer struct {
+	sync.Mutex
+	partials map[string][]byte
+	deleted  []string
+	final    string
+	meta     string
+	failed   bool
+}
+
+func (s *tusServer) ServeHTTP(rsp http.ResponseWriter, req *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	data, _ := io.ReadAll(req.Body)
+	switch {
+	case req.Method == http.MethodDelete:
+		s.deleted = append(s.deleted, req.URL.Path)
+		rsp.WriteHeader(http.StatusNoContent)
+	case req.Header.Get("Upload-Concat") == "partial":
+		if bytes.HasPrefix(data, []byte("jump")) && !s.failed {
+			s.failed = true
+			rsp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		loc := fmt.Sprintf("/files/%d", len(s.partials))
+		s.partials[loc] = data
+		rsp.Header().Set("Location", loc)
+		rsp.Header().Set("Upload-Offset", strconv.Itoa(len(data)))
+		rsp.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(req.Header.Get("Upload-Concat"), "final;"):
+		var res []byte
+		for _, e := range strings.Fields(strings.TrimPrefix(req.Header.Get("Upload-Concat"), "final;")) {
+			u, _ := req.URL.Parse(e)
+			res = append(res, s.partials[u.Path]...)
+		}
+		s.final, s.meta = string(res), req.Header.Get("Upload-Metadata")
+		rsp.Header().Set("Location", "/files/final")
+		rsp.WriteHeader(http.StatusCreated)
+	default:
+		rsp.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestTUS(t *testing.T) {
+	srv := &tusServer{partials: make(map[string][]byte)}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	c, err := api.New(api.WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var progress []int64
+	up := New(multiplex.New(c, 3), TUS{URL: "/files", Metadata: map[string]string{"filename": "fox.txt"}}, WithPartSize(5), WithProgress(func(n, total int64) {
+		assert.Equal(t, int64(len(content)), total)
+		progress = append(progress, n)
+	}))
+
+	rsp, err := up.Upload(context.Background(), bytes.NewReader(content), int64(len(content)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusCreated, rsp.StatusCode)
+		assert.Equal(t, string(content), srv.final)
+		assert.Equal(t, "filename Zm94LnR4dA==", srv.meta)
+		assert.True(t, srv.failed, "a part was retried")
+		assert.Len(t, progress, (len(content)+4)/5)
+		assert.Equal(t, int64(len(content)), progress[len(progress)-1])
+	}
+
+	up = New(multiplex.New(c, 3), TUS{URL: "/files"}, WithPartSize(5))
+	_, err = up.Upload(context.Background(), bytes.NewReader(content), 100)
+	assert.ErrorIs(t, err, ErrSizeMismatch)
+	assert.Len(t, srv.deleted, len(srv.partials)-(len(content)+4)/5, "partial uploads are terminated")
+}
+
+// A fake S3 server
+type s3Server struct {
+	sync.Mutex
+	parts     map[int][]byte
+	completed []byte
+	aborted   bool
+}
+
+func (s *s3Server) ServeHTTP(rsp http.ResponseWriter, req *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	q := req.URL.Query()
+	data, _ := io.ReadAll(req.Body)
+	switch {
+	case req.Method == http.MethodPost && q.Has("uploads"):
+		rsp.Write([]byte(`<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>`))
+	case q.Get("uploadId") != "u1":
+		rsp.WriteHeader(http.StatusNotFound)
+	case req.Method == http.MethodPut:
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		s.parts[n] = data
+		rsp.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, n))
+	case req.Method == http.MethodPost:
+		var body s3Complete
+		xml.Unmarshal(data, &body)
+		if !sort.SliceIsSorted(body.Parts, func(i, j int) bool { return body.Parts[i].PartNumber < body.Parts[j].PartNumber }) {
+			rsp.Write([]byte(`<Error><Code>InvalidPartOrder</Code><Message>Out of order</Message></Error>`))
+			return
+		}
+		for _, e := range body.Parts {
+			if e.ETag != fmt.Sprintf(`"etag-%d"`, e.PartNumber) {
+				rsp.Write([]byte(`<Error><Code>InvalidPart</Code><Message>Bad ETag</Message></Error>`))
+				return
+			}
+			s.completed = append(s.completed, s.parts[e.PartNumber]...)
+		}
+		rsp.Write([]byte(`<CompleteMultipartUploadResult/>`))
+	case req.Method == http.MethodDelete:
+		s.aborted = true
+		rsp.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3(t *testing.T) {
+	srv := &s3Server{parts: make(map[int][]byte)}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	c, err := api.New(api.WithBaseURL(server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	up := New(multiplex.New(c, 4), S3{URL: "/bucket/object"}, WithPartSize(8))
+
+	_, err = up.Upload(context.Background(), bytes.NewReader(content), -1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(content), string(srv.completed))
+		assert.Len(t, srv.parts, (len(content)+7)/8)
+	}
+
+	_, err = up.Upload(context.Background(), io.MultiReader(bytes.NewReader(content), failingReader{}), -1)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Could not read part")
+		assert.True(t, srv.aborted)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("Broken")
+}
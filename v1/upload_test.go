@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadFile(t *testing.T) {
+	type upload struct {
+		Method, Type, Body, Field, Filename, PartType string
+		Length                                        int64
+	}
+	var last upload
+	var fails int64
+	server := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt64(&fails, -1) >= 0 {
+			io.Copy(io.Discard, req.Body)
+			rsp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		last = upload{Method: req.Method, Type: req.Header.Get("Content-Type"), Length: req.ContentLength}
+		if strings.HasPrefix(last.Type, "multipart/") {
+			f, hdr, err := req.FormFile("file")
+			if assert.NoError(t, err) {
+				data, _ := io.ReadAll(f)
+				last.Body, last.Filename, last.PartType = string(data), hdr.Filename, hdr.Header.Get("Content-Type")
+			}
+		} else {
+			data, _ := io.ReadAll(req.Body)
+			last.Body = string(data)
+		}
+		rsp.Header().Set("Content-Type", JSON)
+		rsp.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+	cxt := context.Background()
+	dir := t.TempDir()
+
+	c, err := New(WithBaseURL(server.URL), WithRetryStatus(http.StatusServiceUnavailable), WithRetryDelay(time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	doc := filepath.Join(dir, "doc.json")
+	assert.NoError(t, os.WriteFile(doc, []byte(`{"a":1}`), 0644))
+	blob := filepath.Join(dir, "blob")
+	assert.NoError(t, os.WriteFile(blob, []byte("\x89PNG\r\n\x1a\n0000"), 0644))
+
+	var res struct {
+		OK bool `json:"ok"`
+	}
+	var sent, total int64
+	atomic.StoreInt64(&fails, 1)
+	_, err = c.UploadFile(cxt, "/files", doc, &res, WithProgress(func(n, t int64) { sent, total = n, t }))
+	if assert.NoError(t, err) {
+		assert.True(t, res.OK)
+		assert.Equal(t, upload{Method: http.MethodPost, Type: "application/json", Body: `{"a":1}`, Length: 7}, last, "the file is sent again when retried")
+		assert.Equal(t, int64(7), sent)
+		assert.Equal(t, int64(7), total)
+	}
+
+	_, err = c.UploadFile(cxt, "/files", blob, nil, WithUploadMethod(http.MethodPut))
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.MethodPut, last.Method)
+		assert.Equal(t, "image/png", last.Type, "sniffed from the content")
+	}
+
+	_, err = c.UploadFile(cxt, "/files", blob, nil, WithFileContentType("application/octet-stream"), WithMultipartField("file", ""))
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(last.Type, "multipart/form-data; boundary="))
+		assert.Equal(t, "blob", last.Filename)
+		assert.Equal(t, "application/octet-stream", last.PartType)
+		assert.Equal(t, "\x89PNG\r\n\x1a\n0000", last.Body)
+		assert.Greater(t, last.Length, int64(12))
+	}
+
+	_, err = c.UploadFile(cxt, "/files", filepath.Join(dir, "missing"), nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
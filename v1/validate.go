@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// A response validator inspects a successful response before it is
+// unmarshaled and may reject it by returning an error. This is useful for
+// APIs which report errors in the body of an otherwise successful response,
+// for example: {"ok": false, "error": "..."}.
+//
+// The validator is provided with the buffered response entity; the response
+// body is restored before it is unmarshaled, so the validator must not read
+// it directly.
+type ResponseValidator interface {
+	Validate(*http.Response, *Entity) error
+}
+
+type ResponseValidatorFunc func(*http.Response, *Entity) error
+
+func (f ResponseValidatorFunc) Validate(rsp *http.Response, ent *Entity) error {
+	return f(rsp, ent)
+}
+
+// Validate a response, converting any error produced by the validator into an
+// *Error which describes the request.
+func validateResponse(reqid int64, req *http.Request, rsp *http.Response, v ResponseValidator) error {
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	rsp.Body = io.NopCloser(bytes.NewBuffer(data))
+	ent := &Entity{
+		ContentType: rsp.Header.Get("Content-Type"),
+		Data:        data,
+	}
+
+	err = v.Validate(rsp, ent)
+	if err == nil {
+		return nil
+	}
+
+	var apierr *Error
+	if errors.As(err, &apierr) {
+		if apierr.ReqId == 0 {
+			apierr.SetId(reqid)
+		}
+		if apierr.URL == "" {
+			apierr.SetRequest(req)
+		}
+		if apierr.Entity == nil {
+			apierr.SetEntity(ent)
+		}
+		return apierr
+	}
+
+	return Errorf(rsp.StatusCode, "Invalid response: %v", err).SetId(reqid).SetRequest(req).SetEntity(ent).SetCause(err)
+}
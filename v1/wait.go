@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrInterrupted is wrapped by errors which describe a wait, such as for rate
+// limits or a retry, that was interrupted because its context ended.
+var ErrInterrupted = errors.New("Interrupted")
+
+// ErrWouldExceedDeadline is wrapped by errors which describe a wait that was
+// not attempted because it would not end before its context's deadline. Such
+// errors also wrap context.DeadlineExceeded, since the deadline would have
+// ended the wait.
+var ErrWouldExceedDeadline = errors.New("Wait would exceed deadline")
+
+// Wait for the specified duration or until the context is canceled. Unlike
+// time.After, the timer is released immediately when the context is canceled
+// rather than when it eventually fires. If the wait is interrupted, an error
+// describing the wait and the reason the context ended is returned. If the
+// wait would not end before the context's deadline, it fails immediately
+// instead of waiting only to fail once the deadline passes.
+func wait(cxt context.Context, d time.Duration, reason string) error {
+	if d <= 0 {
+		return nil
+	}
+	if deadline, ok := cxt.Deadline(); ok {
+		if remain := time.Until(deadline); d > remain {
+			return Errorf(0, "Waiting %v for %s would exceed the deadline in %v", d, reason, remain).SetCause(fmt.Errorf("%w: %w", ErrWouldExceedDeadline, context.DeadlineExceeded))
+		}
+	}
+	start := time.Now()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-cxt.Done():
+		return interrupted(cxt, start, d, reason)
+	}
+}
+
+// Wait on behalf of a request, describing the request in any error
+func waitRequest(reqid int64, req *http.Request, d time.Duration, reason string) error {
+	err := wait(req.Context(), d, reason)
+	var apierr *Error
+	if errors.As(err, &apierr) {
+		apierr.SetId(reqid).SetRequest(req)
+	}
+	return err
+}
+
+// Describe a wait which was interrupted because its context ended. The error
+// wraps both the context's error and its cause, if they differ. A duration of
+// zero describes an open-ended wait.
+func interrupted(cxt context.Context, start time.Time, d time.Duration, reason string) *Error {
+	var msg string
+	if d > 0 {
+		msg = fmt.Sprintf("Interrupted after waiting %v of %v for %s", time.Since(start), d, reason)
+	} else {
+		msg = fmt.Sprintf("Interrupted after waiting %v for %s", time.Since(start), reason)
+	}
+	err := cxt.Err()
+	if cause := context.Cause(cxt); cause != nil && cause != err {
+		err = fmt.Errorf("%w: %w", err, cause)
+	}
+	return Errorf(0, "%s", msg).SetCause(fmt.Errorf("%w: %w", ErrInterrupted, err))
+}
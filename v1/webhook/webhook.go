@@ -0,0 +1,373 @@
+// Package webhook verifies the webhooks which services deliver to an
+// integration, which is the inbound counterpart of the requests an integration
+// makes with a client. A verifier checks the HMAC signature of a webhook in
+// constant time, rejects webhooks whose timestamp falls outside a tolerance or
+// which have already been delivered, and unmarshals the payload in the same
+// way as a client unmarshals a response.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/bww/go-apiclient/v1"
+)
+
+var (
+	ErrMissingSignature = errors.New("Missing signature")
+	ErrInvalidSignature = errors.New("Invalid signature")
+	ErrMissingTimestamp = errors.New("Missing timestamp")
+	ErrInvalidTimestamp = errors.New("Invalid timestamp")
+	ErrExpired          = errors.New("Timestamp is outside the tolerance")
+	ErrReplayed         = errors.New("Webhook was already delivered")
+	ErrTooLarge         = errors.New("Payload is too large")
+)
+
+const (
+	defaultTolerance = time.Minute * 5
+	defaultMaxBody   = 1 << 20
+)
+
+// An encoding of a signature
+type Encoding int
+
+const (
+	Hex Encoding = iota
+	Base64
+)
+
+func (e Encoding) decode(s string) ([]byte, error) {
+	switch e {
+	case Base64:
+		return base64.StdEncoding.DecodeString(s)
+	default:
+		return hex.DecodeString(s)
+	}
+}
+
+// A signature scheme extracts the timestamp, if any, and the candidate
+// signatures from the headers of a webhook, and produces the payload which is
+// signed from the timestamp and body.
+type Scheme struct {
+	Extract func(hdr http.Header) (ts string, sigs []string, err error)
+	Payload func(hdr http.Header, ts string, body []byte) []byte
+}
+
+type Config struct {
+	Scheme    Scheme
+	Secrets   [][]byte
+	Hash      func() hash.Hash
+	Encoding  Encoding
+	Tolerance time.Duration
+	MaxBody   int64
+	Replay    bool
+	Now       func() time.Time
+}
+
+func (c Config) WithOptions(opts []Option) Config {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type Option func(Config) Config
+
+// WithScheme sets the signature scheme; by default, HeaderScheme with the
+// header X-Signature.
+func WithScheme(s Scheme) Option {
+	return func(c Config) Config {
+		c.Scheme = s
+		return c
+	}
+}
+
+// WithSecrets adds secrets which also verify webhooks, which allows secrets
+// to be rotated.
+func WithSecrets(s ...[]byte) Option {
+	return func(c Config) Config {
+		c.Secrets = append(c.Secrets, s...)
+		return c
+	}
+}
+
+// WithHash sets the hash used to compute signatures; by default, SHA-256.
+func WithHash(h func() hash.Hash) Option {
+	return func(c Config) Config {
+		c.Hash = h
+		return c
+	}
+}
+
+// WithEncoding sets the encoding of signatures; by default, Hex.
+func WithEncoding(e Encoding) Option {
+	return func(c Config) Config {
+		c.Encoding = e
+		return c
+	}
+}
+
+// WithTolerance sets the maximum difference between the timestamp of a
+// webhook and the current time; by default, 5 minutes. This only applies to
+// schemes with a timestamp.
+func WithTolerance(d time.Duration) Option {
+	return func(c Config) Config {
+		c.Tolerance = d
+		return c
+	}
+}
+
+// WithMaxBody sets the maximum size of a payload; by default, 1 MiB.
+func WithMaxBody(n int64) Option {
+	return func(c Config) Config {
+		c.MaxBody = n
+		return c
+	}
+}
+
+// WithReplayProtection rejects webhooks with ErrReplayed when a webhook with
+// the same signature has already been verified within the tolerance. Since
+// the timestamp is signed, a webhook cannot be replayed after that. This only
+// applies to schemes with a timestamp, and only within a single process.
+func WithReplayProtection() Option {
+	return func(c Config) Config {
+		c.Replay = true
+		return c
+	}
+}
+
+// WithClock sets the function which produces the current time
+func WithClock(now func() time.Time) Option {
+	return func(c Config) Config {
+		c.Now = now
+		return c
+	}
+}
+
+// HeaderScheme reads a signature from the provided header, after removing the
+// provided prefix, such as "sha256=". If a timestamp header is provided, the
+// timestamp is read from it and the signed payload is the timestamp and the
+// body joined by '.'; otherwise, the body alone is signed.
+func HeaderScheme(header, prefix, tsheader string) Scheme {
+	return Scheme{
+		Extract: func(hdr http.Header) (string, []string, error) {
+			var sigs []string
+			for _, e := range hdr.Values(header) {
+				for _, s := range strings.Fields(strings.ReplaceAll(e, ",", " ")) {
+					if v, ok := strings.CutPrefix(s, prefix); ok {
+						sigs = append(sigs, v)
+					}
+				}
+			}
+			var ts string
+			if tsheader != "" {
+				ts = hdr.Get(tsheader)
+			}
+			return ts, sigs, nil
+		},
+		Payload: func(hdr http.Header, ts string, body []byte) []byte {
+			if tsheader == "" {
+				return body
+			}
+			return append([]byte(ts+"."), body...)
+		},
+	}
+}
+
+// GitHub is the scheme GitHub uses: a hex HMAC-SHA256 of the body in the
+// X-Hub-Signature-256 header, prefixed by "sha256=".
+var GitHub = HeaderScheme("X-Hub-Signature-256", "sha256=", "")
+
+// Stripe is the scheme Stripe uses: the Stripe-Signature header carries the
+// timestamp as "t=" and hex HMAC-SHA256 signatures of the timestamp and body
+// joined by '.' as "v1=".
+var Stripe = Scheme{
+	Extract: func(hdr http.Header) (string, []string, error) {
+		var ts string
+		var sigs []string
+		for _, e := range strings.Split(hdr.Get("Stripe-Signature"), ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(e), "=")
+			switch k {
+			case "t":
+				ts = v
+			case "v1":
+				sigs = append(sigs, v)
+			}
+		}
+		return ts, sigs, nil
+	},
+	Payload: func(hdr http.Header, ts string, body []byte) []byte {
+		return append([]byte(ts+"."), body...)
+	},
+}
+
+// Slack is the scheme Slack uses: a hex HMAC-SHA256 of "v0:", the timestamp
+// from X-Slack-Request-Timestamp, ':', and the body, in the X-Slack-Signature
+// header prefixed by "v0=".
+var Slack = Scheme{
+	Extract: func(hdr http.Header) (string, []string, error) {
+		ts := hdr.Get("X-Slack-Request-Timestamp")
+		sig, ok := strings.CutPrefix(hdr.Get("X-Slack-Signature"), "v0=")
+		if !ok {
+			return ts, nil, nil
+		}
+		return ts, []string{sig}, nil
+	},
+	Payload: func(hdr http.Header, ts string, body []byte) []byte {
+		return append([]byte("v0:"+ts+":"), body...)
+	},
+}
+
+// A verifier checks the authenticity of webhooks
+type Verifier struct {
+	conf Config
+	sync.Mutex
+	seen map[string]time.Time
+}
+
+func New(secret []byte, opts ...Option) *Verifier {
+	conf := Config{
+		Scheme:    HeaderScheme("X-Signature", "", ""),
+		Secrets:   [][]byte{secret},
+		Hash:      sha256.New,
+		Tolerance: defaultTolerance,
+		MaxBody:   defaultMaxBody,
+		Now:       time.Now,
+	}.WithOptions(opts)
+	return &Verifier{
+		conf: conf,
+		seen: make(map[string]time.Time),
+	}
+}
+
+// Verify reads the body of a webhook request and verifies it. The body is
+// replaced so that it may be read again by the caller and is also returned.
+func (v *Verifier) Verify(req *http.Request) ([]byte, error) {
+	var body []byte
+	if req.Body != nil {
+		defer req.Body.Close()
+		var err error
+		body, err = io.ReadAll(io.LimitReader(req.Body, v.conf.MaxBody+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > v.conf.MaxBody {
+			return nil, ErrTooLarge
+		}
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, v.VerifyPayload(req.Header, body)
+}
+
+// VerifyPayload verifies a webhook payload with the provided headers
+func (v *Verifier) VerifyPayload(hdr http.Header, body []byte) error {
+	ts, sigs, err := v.conf.Scheme.Extract(hdr)
+	if err != nil {
+		return err
+	}
+	if len(sigs) == 0 {
+		return ErrMissingSignature
+	}
+
+	now := v.conf.Now()
+	var when time.Time
+	if ts == "" && v.hasTimestamp(hdr, body) {
+		return ErrMissingTimestamp
+	} else if ts != "" {
+		n, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTimestamp, err)
+		}
+		when = time.Unix(n, 0)
+		if d := now.Sub(when); d > v.conf.Tolerance || d < -v.conf.Tolerance {
+			return fmt.Errorf("%w: %v", ErrExpired, when)
+		}
+	}
+
+	payload := v.conf.Scheme.Payload(hdr, ts, body)
+	var valid []byte // the verified MAC; replays are recognized by it rather than its encoding
+outer:
+	for _, secret := range v.conf.Secrets {
+		mac := hmac.New(v.conf.Hash, secret)
+		mac.Write(payload)
+		expect := mac.Sum(nil)
+		for _, e := range sigs {
+			sig, err := v.conf.Encoding.decode(e)
+			if err == nil && hmac.Equal(sig, expect) {
+				valid = expect
+				break outer
+			}
+		}
+	}
+	if valid == nil {
+		return ErrInvalidSignature
+	}
+
+	if v.conf.Replay && ts != "" {
+		return v.remember(string(valid), when, now)
+	}
+	return nil
+}
+
+// Determine whether the scheme signs a timestamp, which is the case if the
+// signed payload depends on it
+func (v *Verifier) hasTimestamp(hdr http.Header, body []byte) bool {
+	return !bytes.Equal(v.conf.Scheme.Payload(hdr, "", body), v.conf.Scheme.Payload(hdr, "0", body))
+}
+
+// Record a verified MAC, rejecting it if it has been seen before, and forget
+// MACs which can no longer be replayed.
+func (v *Verifier) remember(mac string, when, now time.Time) error {
+	v.Lock()
+	defer v.Unlock()
+	for k, t := range v.seen {
+		if now.Sub(t) > v.conf.Tolerance {
+			delete(v.seen, k)
+		}
+	}
+	if _, ok := v.seen[mac]; ok {
+		return ErrReplayed
+	}
+	v.seen[mac] = when
+	return nil
+}
+
+// Unmarshal verifies a webhook request and unmarshals its payload into the
+// provided entity according to its content type, as a client unmarshals a
+// response.
+func (v *Verifier) Unmarshal(req *http.Request, entity interface{}) error {
+	body, err := v.Verify(req)
+	if err != nil {
+		return err
+	}
+	return api.Entity{ContentType: req.Header.Get("Content-Type"), Data: body}.Unmarshal(entity)
+}
+
+// Handler produces a handler which verifies webhook requests before they are
+// handled by the provided handler. Requests which cannot be verified are
+// rejected with 401 Unauthorized, or 413 Request Entity Too Large if the
+// payload is too large.
+func (v *Verifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		_, err := v.Verify(req)
+		if errors.Is(err, ErrTooLarge) {
+			http.Error(rsp, err.Error(), http.StatusRequestEntityTooLarge)
+		} else if err != nil {
+			http.Error(rsp, err.Error(), http.StatusUnauthorized)
+		} else {
+			next.ServeHTTP(rsp, req)
+		}
+	})
+}
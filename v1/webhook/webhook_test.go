@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+	body := `{"id":"evt_1"}`
+	clock := WithClock(func() time.Time { return now })
+
+	tests := []struct {
+		Name   string
+		Scheme Scheme
+		Header http.Header
+		Secret string
+		Error  error
+	}{
+		{"github", GitHub, http.Header{"X-Hub-Signature-256": {"sha256=" + sign("s3cr3t", body)}}, "s3cr3t", nil},
+		{"github/wrong secret", GitHub, http.Header{"X-Hub-Signature-256": {"sha256=" + sign("other", body)}}, "s3cr3t", ErrInvalidSignature},
+		{"github/missing", GitHub, http.Header{}, "s3cr3t", ErrMissingSignature},
+		{"github/malformed", GitHub, http.Header{"X-Hub-Signature-256": {"sha256=zz"}}, "s3cr3t", ErrInvalidSignature},
+		{"stripe", Stripe, http.Header{"Stripe-Signature": {"t=" + ts + ",v1=" + sign("whsec", ts+"."+body) + ",v0=abc"}}, "whsec", nil},
+		{"stripe/rotated", Stripe, http.Header{"Stripe-Signature": {"t=" + ts + ",v1=" + sign("other", ts+"."+body) + ",v1=" + sign("previous", ts+"."+body)}}, "whsec", nil},
+		{"stripe/expired", Stripe, http.Header{"Stripe-Signature": {"t=" + old + ",v1=" + sign("whsec", old+"."+body)}}, "whsec", ErrExpired},
+		{"stripe/no timestamp", Stripe, http.Header{"Stripe-Signature": {"v1=" + sign("whsec", "."+body)}}, "whsec", ErrMissingTimestamp},
+		{"stripe/bad timestamp", Stripe, http.Header{"Stripe-Signature": {"t=x,v1=" + sign("whsec", "x."+body)}}, "whsec", ErrInvalidTimestamp},
+		{"slack", Slack, http.Header{"X-Slack-Request-Timestamp": {ts}, "X-Slack-Signature": {"v0=" + sign("slack", "v0:"+ts+":"+body)}}, "slack", nil},
+		{"header", HeaderScheme("X-Sig", "", "X-Time"), http.Header{"X-Time": {ts}, "X-Sig": {sign("k", ts+"."+body)}}, "k", nil},
+		{"header/tampered", HeaderScheme("X-Sig", "", "X-Time"), http.Header{"X-Time": {ts}, "X-Sig": {sign("k", ts+".{}")}}, "k", ErrInvalidSignature},
+	}
+	for _, e := range tests {
+		v := New([]byte(e.Secret), WithScheme(e.Scheme), WithSecrets([]byte("previous")), clock)
+		err := v.VerifyPayload(e.Header, []byte(body))
+		if e.Error != nil {
+			assert.ErrorIs(t, err, e.Error, e.Name)
+		} else {
+			assert.NoError(t, err, e.Name)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	v := New([]byte("whsec"), WithScheme(Stripe), WithReplayProtection(), WithClock(func() time.Time { return now }))
+	hdr := http.Header{"Stripe-Signature": {"t=" + ts + ",v1=" + sign("whsec", ts+".{}")}}
+
+	assert.NoError(t, v.VerifyPayload(hdr, []byte("{}")))
+	assert.ErrorIs(t, v.VerifyPayload(hdr, []byte("{}")), ErrReplayed)
+	upper := http.Header{"Stripe-Signature": {"t=" + ts + ",v1=" + strings.ToUpper(sign("whsec", ts+".{}"))}}
+	assert.ErrorIs(t, v.VerifyPayload(upper, []byte("{}")), ErrReplayed, "a signature is recognized regardless of its encoding")
+
+	now = now.Add(time.Minute * 10) // the signature is forgotten, but the timestamp has now expired
+	assert.ErrorIs(t, v.VerifyPayload(hdr, []byte("{}")), ErrExpired)
+	ts = strconv.FormatInt(now.Unix(), 10)
+	assert.NoError(t, v.VerifyPayload(http.Header{"Stripe-Signature": {"t=" + ts + ",v1=" + sign("whsec", ts+".{}")}}, []byte("{}")))
+	assert.Len(t, v.seen, 1, "expired signatures are forgotten")
+}
+
+func TestHandler(t *testing.T) {
+	v := New([]byte("s3cr3t"), WithScheme(GitHub), WithMaxBody(64))
+	var got struct {
+		Id string `json:"id"`
+	}
+	h := v.Handler(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		assert.NoError(t, v.Unmarshal(req, &got), "the body may be verified again")
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+
+	body := `{"id":"evt_1"}`
+	req := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+sign("s3cr3t", body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "evt_1", got.Id)
+
+	req = httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader(body))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+sign("wrong", body))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	large := strings.Repeat("x", 65)
+	req = httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader(large))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+sign("s3cr3t", large))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}